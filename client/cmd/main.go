@@ -9,12 +9,18 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hashicorp/yamux"
+	"github.com/pires/go-proxyproto"
 	pb "github.com/voidprobe/client/api/proto"
 	"github.com/voidprobe/client/internal/config"
+	"github.com/voidprobe/client/internal/forward"
+	"github.com/voidprobe/client/internal/health"
+	"github.com/voidprobe/client/internal/policy"
 	"github.com/voidprobe/client/internal/security"
 	"github.com/voidprobe/client/internal/transport"
 	"google.golang.org/grpc"
@@ -39,7 +45,13 @@ func main() {
 
 	log.Printf("Client ID: %s", cfg.ClientID)
 	log.Printf("Target Service: %s", cfg.TargetService)
-	log.Printf("Server Address: %s", cfg.ServerAddress)
+	log.Printf("Server Address: %s", strings.Join(cfg.ServerAddress, ", "))
+	if len(cfg.AllowedSockets) > 0 {
+		log.Printf("Allowed Unix sockets: %s", strings.Join(cfg.AllowedSockets, ", "))
+	}
+	if len(cfg.AllowedTargets) > 0 {
+		log.Printf("Allowed targets: %s", strings.Join(cfg.AllowedTargets, ", "))
+	}
 
 	// Configura autenticação
 	authInterceptor := security.NewClientAuthInterceptor(cfg.AuthToken)
@@ -71,19 +83,22 @@ func main() {
 		cancel()
 	}()
 
-	// Loop de reconexão
+	// Loop de reconexão; com vários nós, cada falha passa ao próximo
 	retryCount := 0
+	node := 0
 	for retryCount < cfg.MaxRetries {
 		if ctx.Err() != nil {
 			break
 		}
 
-		log.Printf("Connecting to server (attempt %d/%d)...", retryCount+1, cfg.MaxRetries)
+		address := cfg.ServerAddress[node%len(cfg.ServerAddress)]
+		log.Printf("Connecting to server %s (attempt %d/%d)...", address, retryCount+1, cfg.MaxRetries)
 
-		err := connectAndServe(ctx, cfg, creds, authInterceptor)
+		err := connectAndServe(ctx, cfg, address, creds, authInterceptor)
 		if err != nil {
 			log.Printf("Connection error: %v", err)
 			retryCount++
+			node++
 
 			if retryCount < cfg.MaxRetries {
 				waitTime := cfg.ReconnectDelay * time.Duration(retryCount)
@@ -102,6 +117,7 @@ func main() {
 func connectAndServe(
 	ctx context.Context,
 	cfg *config.ClientConfig,
+	address string,
 	creds credentials.TransportCredentials,
 	authInterceptor *security.ClientAuthInterceptor,
 ) error {
@@ -115,7 +131,7 @@ func connectAndServe(
 	dialCtx, dialCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer dialCancel()
 
-	conn, err := grpc.DialContext(dialCtx, cfg.ServerAddress, dialOpts...)
+	conn, err := grpc.DialContext(dialCtx, address, dialOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
@@ -160,6 +176,22 @@ func connectAndServe(
 	}
 	configStream.Close()
 
+	// Serviços oferecidos ficam pendentes no servidor até o operador aprovar
+	if err := advertiseServices(session, cfg.Services); err != nil {
+		log.Printf("Failed to advertise services: %v", err)
+	}
+
+	// Listeners de local-forward são abertos quando o servidor envia a lista
+	forwards := forward.NewManager(session)
+	defer forwards.CloseAll()
+
+	// Sondas dos destinos mapeados; a lista também vem do servidor
+	checker := health.NewChecker(session, func(target string) (net.Conn, error) {
+		return dialTarget(target, false, cfg)
+	}, cfg.HealthInterval)
+	go checker.Run()
+	defer checker.Stop()
+
 	log.Println("Ready to accept connections")
 
 	for {
@@ -172,37 +204,125 @@ func connectAndServe(
 			return fmt.Errorf("session closed: %w", err)
 		}
 
-		go handleStream(remoteStream)
+		go handleStream(remoteStream, cfg, forwards, checker)
+	}
+}
+
+// headerServices abre o stream com a lista de serviços oferecidos (deve coincidir com o servidor).
+const headerServices = "@services"
+
+// advertiseServices envia os serviços do SERVICES ("nome=destino"); a lista
+// vazia retira os oferecidos antes.
+func advertiseServices(session *yamux.Session, services []string) error {
+	var b strings.Builder
+	b.WriteString(headerServices + "\n")
+	for _, s := range services {
+		name, target, ok := strings.Cut(s, "=")
+		if !ok || name == "" || target == "" {
+			log.Printf("Invalid service %q (expected name=target)", s)
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", name, target)
+	}
+
+	stream, err := session.Open()
+	if err != nil {
+		return err
 	}
+	defer stream.Close()
+
+	_, err = stream.Write([]byte(b.String()))
+	return err
 }
 
+// unixPrefix identifica destinos do tipo Unix domain socket (unix:///caminho).
+const unixPrefix = "unix://"
+
+// optionDynamic marca destinos escolhidos pelo admin (SOCKS5): exigem
+// ALLOWED_TARGETS e uma resposta "OK" ou "ERR <motivo>" antes dos dados.
+const optionDynamic = "dynamic"
+
+// Opções de PROXY protocol: "proxy=v1|v2 src=<admin ip:porta> dst=<listener ip:porta>".
+// O cliente envia o header ao destino antes dos dados, com o endereço real do admin.
+const (
+	optionProxy  = "proxy="
+	optionSource = "src="
+	optionDest   = "dst="
+)
+
+// maxHeaderSize limita o tamanho do header de destino enviado pelo servidor.
+const maxHeaderSize = 512
+
+// dialTimeout limita a conexão ao serviço local.
+const dialTimeout = 10 * time.Second
+
 // handleStream lê o destino do header e conecta ao serviço local.
-func handleStream(remote net.Conn) {
+func handleStream(remote net.Conn, cfg *config.ClientConfig, forwards *forward.Manager, checker *health.Checker) {
 	defer remote.Close()
 
-	// Lê header com destino (formato: host:porta\n)
-	buf := make([]byte, 256)
-	n, err := remote.Read(buf)
+	// Lê header com destino (formato: host:porta[ opções]\n ou unix:///caminho\n)
+	header, err := readHeader(remote)
 	if err != nil {
 		log.Printf("Failed to read header: %v", err)
 		return
 	}
 
-	// Remove \n do final
-	targetService := string(buf[:n])
-	if len(targetService) > 0 && targetService[len(targetService)-1] == '\n' {
-		targetService = targetService[:len(targetService)-1]
+	// Lista de local-forwards enviada pelo servidor
+	if header == forward.HeaderForwards {
+		list, err := forward.Parse(remote)
+		if err != nil {
+			log.Printf("Invalid local-forward list: %v", err)
+			return
+		}
+		forwards.Apply(list)
+		return
 	}
 
+	// Lista de destinos a sondar enviada pelo servidor
+	if header == health.HeaderChecks {
+		checks, err := health.Parse(remote)
+		if err != nil {
+			log.Printf("Invalid health check list: %v", err)
+			return
+		}
+		checker.Apply(checks)
+		return
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) == 0 {
+		log.Printf("Empty stream header")
+		return
+	}
+	targetService := fields[0]
+	dynamic := hasOption(fields[1:], optionDynamic)
+
 	log.Printf("New connection -> %s", targetService)
 
-	local, err := net.Dial("tcp", targetService)
+	local, err := dialTarget(targetService, dynamic, cfg)
 	if err != nil {
 		log.Printf("Failed to connect to %s: %v", targetService, err)
+		if dynamic {
+			fmt.Fprintf(remote, "ERR %v\n", err)
+		}
 		return
 	}
 	defer local.Close()
 
+	if dynamic {
+		if _, err := remote.Write([]byte("OK\n")); err != nil {
+			return
+		}
+	}
+
+	if version := optionValue(fields[1:], optionProxy); version != "" {
+		err := writeProxyHeader(local, version, optionValue(fields[1:], optionSource), optionValue(fields[1:], optionDest))
+		if err != nil {
+			log.Printf("Failed to send PROXY header to %s: %v", targetService, err)
+			return
+		}
+	}
+
 	done := make(chan struct{}, 2)
 
 	go func() {
@@ -220,3 +340,88 @@ func handleStream(remote net.Conn) {
 	local.SetDeadline(time.Now().Add(1 * time.Second))
 	remote.SetDeadline(time.Now().Add(1 * time.Second))
 }
+
+// readHeader lê a linha de header byte a byte, sem consumir dados do stream.
+func readHeader(conn net.Conn) (string, error) {
+	header := make([]byte, 0, 64)
+	b := make([]byte, 1)
+	for len(header) < maxHeaderSize {
+		if _, err := conn.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(header), nil
+		}
+		header = append(header, b[0])
+	}
+	return "", fmt.Errorf("header exceeds %d bytes", maxHeaderSize)
+}
+
+// hasOption verifica se a opção foi enviada no header.
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// optionValue retorna o valor de uma opção "chave=valor" do header.
+func optionValue(options []string, prefix string) string {
+	for _, o := range options {
+		if strings.HasPrefix(o, prefix) {
+			return strings.TrimPrefix(o, prefix)
+		}
+	}
+	return ""
+}
+
+// writeProxyHeader envia o header PROXY protocol (v1 ou v2) com os endereços originais.
+func writeProxyHeader(w io.Writer, version, source, dest string) error {
+	var v byte
+	switch version {
+	case "v1":
+		v = 1
+	case "v2":
+		v = 2
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+
+	src, err := net.ResolveTCPAddr("tcp", source)
+	if err != nil {
+		return fmt.Errorf("invalid source address %q: %w", source, err)
+	}
+	dst, err := net.ResolveTCPAddr("tcp", dest)
+	if err != nil {
+		return fmt.Errorf("invalid destination address %q: %w", dest, err)
+	}
+
+	_, err = proxyproto.HeaderProxyFromAddrs(v, src, dst).WriteTo(w)
+	return err
+}
+
+// dialTarget conecta ao destino via TCP ou Unix socket, aplicando as allowlists.
+// Destinos dinâmicos (SOCKS5) só são aceitos se casarem com ALLOWED_TARGETS.
+func dialTarget(target string, dynamic bool, cfg *config.ClientConfig) (net.Conn, error) {
+	if !strings.HasPrefix(target, unixPrefix) {
+		if (dynamic || len(cfg.AllowedTargets) > 0) && !policy.TargetAllowed(target, cfg.AllowedTargets) {
+			return nil, fmt.Errorf("target %s not in ALLOWED_TARGETS", target)
+		}
+		return net.DialTimeout("tcp", target, dialTimeout)
+	}
+
+	if dynamic {
+		return nil, fmt.Errorf("unix targets are not allowed for dynamic streams")
+	}
+
+	path := filepath.Clean(strings.TrimPrefix(target, unixPrefix))
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("unix target must be an absolute path")
+	}
+	if !policy.SocketAllowed(path, cfg.AllowedSockets) {
+		return nil, fmt.Errorf("unix socket %s not in ALLOWED_SOCKETS", path)
+	}
+	return net.DialTimeout("unix", path, dialTimeout)
+}
@@ -4,6 +4,7 @@ go 1.23
 
 require (
 	github.com/hashicorp/yamux v0.1.1
+	github.com/pires/go-proxyproto v0.7.0
 	google.golang.org/grpc v1.60.1
 	google.golang.org/protobuf v1.32.0
 )
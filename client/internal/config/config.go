@@ -4,6 +4,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -24,10 +25,14 @@ type ServerConfig struct {
 
 // ClientConfig agrupa as configurações específicas do cliente.
 type ClientConfig struct {
-	ServerAddress  string
+	ServerAddress  []string // nós do servidor (SERVER_ADDRESS separado por vírgula); falhas passam ao próximo
 	ClientID       string
 	AuthToken      string
 	TargetService  string
+	AllowedSockets []string      // Unix sockets liberados para destinos unix:// (aceita padrões glob)
+	AllowedTargets []string      // destinos TCP liberados (host[:porta], CIDR, glob); vazio libera mapeamentos fixos
+	HealthInterval time.Duration // intervalo entre sondas dos destinos mapeados
+	Services       []string      // serviços oferecidos ao servidor ("nome=destino"), expostos após aprovação
 	ReconnectDelay time.Duration
 	MaxRetries     int
 	Version        string
@@ -53,15 +58,23 @@ func LoadServerConfig() *ServerConfig {
 
 // LoadClientConfig carrega configurações do cliente a partir do ambiente.
 func LoadClientConfig() *ClientConfig {
-	return &ClientConfig{
-		ServerAddress:  getEnv("SERVER_ADDRESS", "localhost:50051"),
+	cfg := &ClientConfig{
+		ServerAddress:  getListEnv("SERVER_ADDRESS"),
 		ClientID:       getEnv("CLIENT_ID", "client-001"),
 		AuthToken:      getEnv("AUTH_TOKEN", ""),
 		TargetService:  getEnv("TARGET_SERVICE", "localhost:22"),
+		AllowedSockets: getListEnv("ALLOWED_SOCKETS"),
+		AllowedTargets: getListEnv("ALLOWED_TARGETS"),
+		HealthInterval: getDurationEnv("HEALTH_INTERVAL", 30*time.Second),
+		Services:       getListEnv("SERVICES"),
 		ReconnectDelay: getDurationEnv("RECONNECT_DELAY", 5*time.Second),
 		MaxRetries:     getIntEnv("MAX_RETRIES", 10),
 		Version:        "1.0.0",
 	}
+	if len(cfg.ServerAddress) == 0 {
+		cfg.ServerAddress = []string{"localhost:50051"}
+	}
+	return cfg
 }
 
 // LoadTLSConfig carrega configurações TLS a partir do ambiente.
@@ -82,6 +95,16 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getListEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getIntEnv(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		var i int
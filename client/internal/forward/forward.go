@@ -0,0 +1,160 @@
+// Package forward mantém os listeners de local-forward abertos na rede do cliente.
+//
+// O servidor envia a lista de local-forwards pelo túnel; cada conexão aceita
+// abre um stream yamux para o servidor, que conecta ao destino configurado.
+package forward
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/yamux"
+)
+
+// Headers de controle do túnel (devem coincidir com o servidor).
+const (
+	HeaderForwards = "@forwards"
+	HeaderForward  = "@forward"
+)
+
+// Forward descreve um local-forward enviado pelo servidor.
+type Forward struct {
+	ID     int
+	Listen string
+}
+
+type listener struct {
+	forward  Forward
+	listener net.Listener
+}
+
+// Manager sincroniza os listeners locais com a lista do servidor.
+type Manager struct {
+	session   *yamux.Session
+	listeners map[int]*listener
+	mu        sync.Mutex
+}
+
+// NewManager cria um gerenciador para a sessão yamux atual.
+func NewManager(session *yamux.Session) *Manager {
+	return &Manager{
+		session:   session,
+		listeners: make(map[int]*listener),
+	}
+}
+
+// Parse lê as linhas "<id> <host:porta>" enviadas após o header @forwards.
+func Parse(r io.Reader) ([]Forward, error) {
+	var forwards []Forward
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		idStr, listen, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid forward line %q", line)
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward id %q", idStr)
+		}
+		forwards = append(forwards, Forward{ID: id, Listen: listen})
+	}
+	return forwards, scanner.Err()
+}
+
+// Apply abre listeners novos, fecha os removidos e reabre os alterados.
+func (m *Manager) Apply(forwards []Forward) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[int]Forward)
+	for _, f := range forwards {
+		wanted[f.ID] = f
+	}
+
+	for id, l := range m.listeners {
+		if f, ok := wanted[id]; !ok || f.Listen != l.forward.Listen {
+			log.Printf("Closing local-forward %d on %s", id, l.forward.Listen)
+			l.listener.Close()
+			delete(m.listeners, id)
+		}
+	}
+
+	for id, f := range wanted {
+		if _, ok := m.listeners[id]; ok {
+			continue
+		}
+		ln, err := net.Listen("tcp", f.Listen)
+		if err != nil {
+			log.Printf("Failed to open local-forward %d on %s: %v", id, f.Listen, err)
+			continue
+		}
+		l := &listener{forward: f, listener: ln}
+		m.listeners[id] = l
+		log.Printf("Local-forward %d listening on %s", id, f.Listen)
+		go m.accept(l)
+	}
+}
+
+// CloseAll fecha todos os listeners (sessão encerrada).
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, l := range m.listeners {
+		l.listener.Close()
+		delete(m.listeners, id)
+	}
+}
+
+func (m *Manager) accept(l *listener) {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(l.forward, conn)
+	}
+}
+
+// handle abre um stream para o servidor e faz proxy da conexão local.
+func (m *Manager) handle(f Forward, conn net.Conn) {
+	defer conn.Close()
+
+	stream, err := m.session.Open()
+	if err != nil {
+		log.Printf("Local-forward %d: failed to open stream: %v", f.ID, err)
+		return
+	}
+	defer stream.Close()
+
+	if _, err := fmt.Fprintf(stream, "%s %d\n", HeaderForward, f.ID); err != nil {
+		log.Printf("Local-forward %d: failed to send header: %v", f.ID, err)
+		return
+	}
+
+	log.Printf("Local-forward %d: connection from %s", f.ID, conn.RemoteAddr())
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(stream, conn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(conn, stream)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
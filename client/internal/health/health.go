@@ -0,0 +1,252 @@
+// Package health sonda periodicamente os destinos mapeados e reporta ao
+// servidor as mudanças de estado.
+//
+// O servidor envia a lista de sondas pelo túnel (header @checks); os estados
+// seguem em um único stream de controle (header @health), uma linha por mudança.
+package health
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// Headers de controle do túnel (devem coincidir com o servidor).
+const (
+	HeaderChecks = "@checks"
+	HeaderHealth = "@health"
+)
+
+// Estados reportados ao servidor.
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// probeTimeout limita cada sonda.
+const probeTimeout = 5 * time.Second
+
+// DialFunc conecta a um destino aplicando as allowlists do cliente.
+type DialFunc func(target string) (net.Conn, error)
+
+// Check descreve uma sonda enviada pelo servidor.
+type Check struct {
+	PortID int
+	Kind   string // tcp, tls ou http
+	Path   string // caminho do GET para http
+	Target string // host:porta ou unix:///caminho
+}
+
+// Checker executa as sondas e mantém o último estado de cada uma.
+type Checker struct {
+	session  *yamux.Session
+	dial     DialFunc
+	interval time.Duration
+
+	mu     sync.Mutex
+	checks []Check
+	state  map[int]string
+	stream net.Conn
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// NewChecker cria um verificador para a sessão yamux atual.
+func NewChecker(session *yamux.Session, dial DialFunc, interval time.Duration) *Checker {
+	return &Checker{
+		session:  session,
+		dial:     dial,
+		interval: interval,
+		state:    make(map[int]string),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Parse lê as linhas "<port_id> <check> <destino>" enviadas após o header @checks.
+func Parse(r io.Reader) ([]Check, error) {
+	var checks []Check
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid check line %q", scanner.Text())
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port id %q", fields[0])
+		}
+		kind, path, _ := strings.Cut(fields[1], ":")
+		if kind != "tcp" && kind != "tls" && kind != "http" {
+			return nil, fmt.Errorf("unknown check %q", fields[1])
+		}
+		if path == "" {
+			path = "/"
+		}
+		checks = append(checks, Check{PortID: id, Kind: kind, Path: path, Target: fields[2]})
+	}
+	return checks, scanner.Err()
+}
+
+// Apply substitui a lista de sondas e dispara uma rodada imediata.
+func (c *Checker) Apply(checks []Check) {
+	c.mu.Lock()
+	c.checks = checks
+	wanted := make(map[int]bool)
+	for _, ch := range checks {
+		wanted[ch.PortID] = true
+	}
+	for id := range c.state {
+		if !wanted[id] {
+			delete(c.state, id)
+		}
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run executa as sondas a cada intervalo até Stop.
+func (c *Checker) Run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+		c.probeAll()
+	}
+}
+
+// Stop encerra o loop e fecha o stream de estados.
+func (c *Checker) Stop() {
+	close(c.done)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream != nil {
+		c.stream.Close()
+	}
+}
+
+func (c *Checker) probeAll() {
+	c.mu.Lock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ch := range checks {
+		wg.Add(1)
+		go func(ch Check) {
+			defer wg.Done()
+			status, detail := StatusUp, ""
+			if err := c.probe(ch); err != nil {
+				status, detail = StatusDown, err.Error()
+			}
+			c.report(ch, status, detail)
+		}(ch)
+	}
+	wg.Wait()
+}
+
+// probe executa uma sonda: conexão TCP, handshake TLS ou GET HTTP (5xx = falha).
+func (c *Checker) probe(ch Check) error {
+	conn, err := c.dial(ch.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+
+	switch ch.Kind {
+	case "tls":
+		host, _, _ := net.SplitHostPort(ch.Target)
+		// Sonda de disponibilidade: o certificado não é validado
+		return tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true}).Handshake()
+
+	case "http":
+		host := ch.Target
+		if strings.HasPrefix(host, "unix://") {
+			host = "localhost"
+		}
+		transport := &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) { return conn, nil },
+		}
+		client := &http.Client{
+			Transport: transport,
+			Timeout:   probeTimeout,
+			// Redirecionamento também indica serviço no ar
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.Get("http://" + host + ch.Path)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// report envia o estado ao servidor quando muda (ou na primeira sonda).
+func (c *Checker) report(ch Check, status, detail string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, known := c.state[ch.PortID]
+	if known && previous == status {
+		return
+	}
+
+	if c.stream == nil {
+		stream, err := c.session.Open()
+		if err != nil {
+			log.Printf("Health: failed to open stream: %v", err)
+			return
+		}
+		if _, err := stream.Write([]byte(HeaderHealth + "\n")); err != nil {
+			stream.Close()
+			log.Printf("Health: failed to send header: %v", err)
+			return
+		}
+		c.stream = stream
+	}
+
+	detail = strings.ReplaceAll(detail, "\n", " ")
+	if _, err := fmt.Fprintf(c.stream, "%d %s %s\n", ch.PortID, status, detail); err != nil {
+		log.Printf("Health: failed to report port %d: %v", ch.PortID, err)
+		c.stream.Close()
+		c.stream = nil
+		return
+	}
+
+	c.state[ch.PortID] = status
+	if status == StatusDown {
+		log.Printf("Health: %s down (%s)", ch.Target, detail)
+	} else {
+		log.Printf("Health: %s up", ch.Target)
+	}
+}
@@ -0,0 +1,69 @@
+// Package policy decide quais destinos o cliente aceita conectar a pedido do servidor.
+package policy
+
+import (
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SocketAllowed verifica o caminho contra a allowlist (caminhos exatos ou padrões glob).
+func SocketAllowed(socketPath string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if ok, _ := filepath.Match(pattern, socketPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetAllowed verifica host:porta contra a allowlist.
+//
+// Cada entrada tem o formato "<host>[:<porta>]", onde host pode ser um IP,
+// uma rede CIDR (10.0.0.0/8) ou um nome com glob (*.internal), e porta pode
+// ser "*" ou omitida para aceitar qualquer porta. Redes CIDR só casam com
+// destinos informados como IP.
+func TargetAllowed(target string, allowed []string) bool {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range allowed {
+		patHost, patPort := splitEntry(entry)
+		if patPort != "*" && patPort != port {
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(patHost); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if patIP := net.ParseIP(patHost); patIP != nil {
+			if ip != nil && patIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		if ok, _ := path.Match(strings.ToLower(patHost), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitEntry separa host e porta de uma entrada da allowlist.
+func splitEntry(entry string) (string, string) {
+	if host, port, err := net.SplitHostPort(entry); err == nil {
+		return host, port
+	}
+	// Sem porta (inclui CIDR IPv6 e IPv6 sem colchetes)
+	return strings.Trim(entry, "[]"), "*"
+}
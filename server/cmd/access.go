@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"log"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/transport"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AccessStream conecta um operador autenticado ao destino de um cliente.
+// Cada conexão aceita pelo voidprobe-cli connect abre um AccessStream próprio.
+func (s *server) AccessStream(stream pb.RemoteTunnel_AccessStreamServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	operatorID := firstValue(md, "operator-id")
+	key := strings.TrimPrefix(firstValue(md, "authorization"), "Bearer ")
+	clientID := firstValue(md, "client-id")
+	target := firstValue(md, "target")
+
+	operator, err := s.repo.ValidateOperator(operatorID, key)
+	if err != nil {
+		log.Printf("Access denied: %v", err)
+		return status.Error(codes.Unauthenticated, "invalid operator credentials")
+	}
+
+	// Viewers só consultam; operadores restritos só alcançam clientes dos seus grupos
+	if !operator.HasRole(database.RoleOperator) {
+		log.Printf("Access denied: operator %s has role %s", operator.OperatorID, operator.Role)
+		return status.Errorf(codes.PermissionDenied, "role %s cannot open connections", operator.Role)
+	}
+	if client, err := s.repo.GetClient(clientID); err != nil || client == nil || !operator.InScope(client.Group) {
+		log.Printf("Access denied: operator %s -> client %s outside its groups", operator.OperatorID, clientID)
+		return status.Errorf(codes.PermissionDenied, "client %s is not available to %s", clientID, operator.OperatorID)
+	}
+
+	remote, err := sessionManager.Access(operator.OperatorID, clientID, target)
+	if err != nil {
+		log.Printf("Operator %s -> %s:%s failed: %v", operator.OperatorID, clientID, target, err)
+		return status.Errorf(codes.Unavailable, "%v", err)
+	}
+	defer remote.Close()
+
+	log.Printf("Operator %s -> %s:%s", operator.OperatorID, clientID, target)
+
+	adapter := transport.NewAdapter(stream)
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(remote, adapter)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(adapter, remote)
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+	case <-stream.Context().Done():
+	}
+	return nil
+}
+
+// firstValue retorna o primeiro valor de uma chave do metadata
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
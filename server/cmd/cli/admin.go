@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// socketPath é o socket de controle local do servidor (API sem token)
+const socketPath = "/tmp/voidprobe.sock"
+
+// callTimeout limita chamadas unárias à API
+const callTimeout = 30 * time.Second
+
+// Destino e credenciais da API de administração (flags globais -admin,
+// -token, -operator, -key, -tls, -ca e -insecure)
+var (
+	adminAddr     string
+	adminToken    string
+	adminOperator string
+	adminKey      string
+	adminTLS      string
+	adminCA       string
+	adminInsecure bool
+)
+
+var adminConn pb.AdminClient
+
+// api conecta na primeira chamada: socket de controle local ou, com -admin,
+// ADMIN_ADDRESS do servidor. Autentica com a chave do operador ou o token de
+// API; sem credenciais, o socket local só aceita enquanto não houver admin.
+func api() pb.AdminClient {
+	if adminConn != nil {
+		return adminConn
+	}
+
+	var md []string
+	switch {
+	case adminOperator != "" && adminKey != "":
+		md = []string{"operator-id", adminOperator, "authorization", "Bearer " + adminKey}
+	case adminToken != "":
+		md = []string{"authorization", "Bearer " + adminToken}
+	case adminAddr != "":
+		fmt.Fprintln(os.Stderr, "Error: -operator and -key, or -token, are required with -admin (or VOIDPROBE_OPERATOR/VOIDPROBE_KEY, VOIDPROBE_TOKEN)")
+		os.Exit(1)
+	}
+
+	target := "unix://" + socketPath
+	creds := insecure.NewCredentials()
+	if adminAddr != "" {
+		target = adminAddr
+
+		if adminTLS != "off" && adminTLS != "false" {
+			creds = tlsCredentials(adminCA)
+		}
+	}
+
+	conn, err := grpc.Dial(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, md...), method, req, reply, cc, opts...)
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(metadata.AppendToOutgoingContext(ctx, md...), desc, cc, method, opts...)
+		}),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", target, err)
+		os.Exit(1)
+	}
+	adminConn = pb.NewAdminClient(conn)
+	return adminConn
+}
+
+// tlsCredentials verifica o certificado do servidor pela CA em caFile (PEM;
+// aceita o próprio certificado autoassinado) ou pelas raízes do sistema. A
+// chave ou token só segue sem verificação com -insecure.
+func tlsCredentials(caFile string) credentials.TransportCredentials {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case adminInsecure:
+		fmt.Fprintln(os.Stderr, "Warning: -insecure: the server certificate is not verified")
+		config.InsecureSkipVerify = true
+	case caFile != "":
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			fmt.Fprintf(os.Stderr, "Error: no PEM certificate in %s\n", caFile)
+			os.Exit(1)
+		}
+	}
+	return credentials.NewTLS(config)
+}
+
+// call retorna o contexto de uma chamada unária
+func call() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), callTimeout)
+}
+
+// check encerra com a mensagem do servidor se a chamada falhou
+func check(err error) {
+	if err == nil {
+		return
+	}
+	st := status.Convert(err)
+	if st.Code() == codes.Unavailable && adminAddr == "" {
+		fmt.Fprintf(os.Stderr, "Error: Server control socket not available\n")
+		fmt.Fprintf(os.Stderr, "Make sure the server is running\n")
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s\n", st.Message())
+	os.Exit(1)
+}
+
+// ============= Session Commands =============
+
+func reload(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: reload <client_id>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ReloadClient(ctx, &pb.ClientRef{ClientId: args[0]})
+	check(err)
+
+	if len(resp.Failed) > 0 {
+		for _, f := range resp.Failed {
+			fmt.Fprintln(os.Stderr, "FAILED "+f)
+		}
+		fmt.Fprintf(os.Stderr, "ERROR: %d mapping(s) failed\n", len(resp.Failed))
+		os.Exit(1)
+	}
+	fmt.Println("Ports and forwards reloaded successfully")
+}
+
+func connected(args []string) {
+	req := &pb.ListSessionsRequest{}
+	if len(args) > 0 {
+		req.Selector = strings.Join(args, ",")
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListSessions(ctx, req)
+	check(err)
+
+	fmt.Printf("%-36s %-13s %-19s %-9s %-4s %-4s %-7s\n", "CLIENT_ID", "STATE", "SINCE", "LISTENERS", "UP", "DOWN", "UNKNOWN")
+	fmt.Println(strings.Repeat("-", 98))
+
+	for _, s := range resp.Sessions {
+		counts := make(map[string]int)
+		var down []string
+		for _, l := range s.Listeners {
+			counts[l.Health]++
+			if l.Health == "down" {
+				down = append(down, fmt.Sprintf("  port %d -> %s down: %s", l.Port, l.Target, l.HealthDetail))
+			}
+		}
+
+		state := s.State
+		if state == "reconnecting" || state == "relayed" {
+			state += "*"
+		}
+		fmt.Printf("%-36s %-13s %-19s %-9d %-4d %-4d %-7d\n", s.ClientId, state, s.Since, len(s.Listeners),
+			counts["up"], counts["down"], counts["unknown"])
+		if s.State == "relayed" {
+			fmt.Printf("  connected to node %s\n", s.Node)
+		}
+		for _, line := range down {
+			fmt.Println(line)
+		}
+	}
+
+	notes := map[string]string{
+		"reconnecting": "* reconnecting: listeners held until the client returns or GRACE_PERIOD expires",
+		"relayed":      "* relayed: client connected to another cluster node; connections are forwarded to it",
+	}
+	for _, state := range []string{"reconnecting", "relayed"} {
+		for _, s := range resp.Sessions {
+			if s.State == state {
+				fmt.Println("\n" + notes[state])
+				break
+			}
+		}
+	}
+}
+
+func kick(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: kick <client_id>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().KickClient(ctx, &pb.ClientRef{ClientId: args[0]})
+	check(err)
+
+	fmt.Println("Client disconnected")
+}
+
+// connections lista as conexões em andamento; IN segue para o cliente, OUT volta dele
+func connections(args []string) {
+	req := &pb.ListConnectionsRequest{}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListConnections(ctx, req)
+	check(err)
+
+	fmt.Printf("%-6s %-20s %-6s %-5s %-22s %-24s %-19s %-9s %-9s\n", "ID", "CLIENT_ID", "KIND", "PORT", "SOURCE", "TARGET", "SINCE", "IN", "OUT")
+	fmt.Println(strings.Repeat("-", 128))
+
+	for _, c := range resp.Connections {
+		port := "-"
+		if c.Port != 0 {
+			port = fmt.Sprint(c.Port)
+		}
+		fmt.Printf("%-6d %-20s %-6s %-5s %-22s %-24s %-19s %-9s %-9s\n", c.Id, truncate(c.ClientId, 20), c.Kind, port,
+			truncate(c.Source, 22), truncate(c.Target, 24), c.Since, formatBytes(c.BytesIn), formatBytes(c.BytesOut))
+	}
+}
+
+// formatBytes formata um contador de bytes (1.5M, 320K)
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// events acompanha os eventos do servidor até Ctrl+C
+func events(args []string) {
+	req := &pb.WatchEventsRequest{}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	stream, err := api().WatchEvents(context.Background(), req)
+	check(err)
+
+	for {
+		e, err := stream.Recv()
+		check(err)
+
+		line := fmt.Sprintf("%s %-19s %-20s %s", e.Time, e.Type, e.ClientId, e.Detail)
+		if e.OperatorId != "" {
+			line += " (by " + e.OperatorId + ")"
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Declarative Config (plan / apply / export) =============
+
+// O formato de "voidprobe-cli apply -f" e "export" é lido e comparado com o
+// banco pelo servidor (pacote declarative): clientes (sem chaves), pools por
+// grupo e mapeamentos de porta. Depois do apply o banco reflete exatamente o
+// arquivo: o que não estiver nele é removido.
+
+// configPath extrai o arquivo de "-f arquivo" ou "--file arquivo"
+func configPath(args []string, usage string) (string, bool) {
+	var path string
+	yes := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--file":
+			if i+1 < len(args) {
+				i++
+				path = args[i]
+			}
+		case "-y", "--yes":
+			yes = true
+		}
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Usage: "+usage)
+		os.Exit(1)
+	}
+	return path, yes
+}
+
+// readConfig lê o arquivo que vai para o servidor
+func readConfig(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return data
+}
+
+// printPlan mostra o plano e retorna falso se não há mudanças
+func printPlan(changes []*pb.PlanChange) bool {
+	if len(changes) == 0 {
+		fmt.Println("No changes. The database matches the file.")
+		return false
+	}
+
+	counts := make(map[string]int)
+	for _, c := range changes {
+		fmt.Println(c.Op + " " + c.Subject)
+		for _, d := range c.Details {
+			fmt.Println("      " + d)
+		}
+		counts[c.Op]++
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to remove.\n", counts["+"], counts["~"], counts["-"])
+	return true
+}
+
+func planConfig(args []string) {
+	path, _ := configPath(args, "plan -f <voidprobe.yaml>")
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().PlanConfig(ctx, &pb.PlanConfigRequest{Config: readConfig(path), Name: path})
+	check(err)
+
+	printPlan(resp.Changes)
+}
+
+func applyConfig(args []string) {
+	path, yes := configPath(args, "apply -f <voidprobe.yaml> [--yes]")
+	data := readConfig(path)
+
+	ctx, cancel := call()
+	defer cancel()
+	plan, err := api().PlanConfig(ctx, &pb.PlanConfigRequest{Config: data, Name: path})
+	check(err)
+	if !printPlan(plan.Changes) {
+		return
+	}
+
+	if !yes {
+		fmt.Print("\nApply these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	// O servidor refaz o plano numa transação: se o banco mudou depois de
+	// exibido, nada é aplicado
+	ctx, cancel = call()
+	defer cancel()
+	resp, err := api().ApplyConfig(ctx, &pb.ApplyConfigRequest{Config: data, Name: path, Plan: plan.Plan})
+	check(err)
+
+	fmt.Println("\nApplied.")
+	for _, s := range resp.Synced {
+		fmt.Printf("  %s\n", templateSync(s))
+	}
+	if len(resp.Secrets) > 0 {
+		fmt.Println()
+		for _, s := range resp.Secrets {
+			fmt.Println(s)
+		}
+		fmt.Println()
+		fmt.Println("⚠️  Save these keys and passwords now! They cannot be recovered.")
+	}
+
+	reloadAffected(resp.Reload)
+}
+
+// reloadAffected recarrega os clientes afetados que estão conectados; sai com
+// erro se algum mapeamento falhou
+func reloadAffected(clients []string) {
+	if len(clients) == 0 {
+		return
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListSessions(ctx, &pb.ListSessionsRequest{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not reach the server to reload clients (%s); connected clients pick up the changes automatically\n",
+			status.Convert(err).Message())
+		return
+	}
+
+	online := make(map[string]bool)
+	for _, s := range resp.Sessions {
+		online[s.ClientId] = s.State == "connected"
+	}
+	failed := false
+	for _, id := range clients {
+		if !online[id] {
+			continue
+		}
+		r, err := api().ReloadClient(ctx, &pb.ClientRef{ClientId: id})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: reload %s: %s\n", id, status.Convert(err).Message())
+			continue
+		}
+		if len(r.Failed) > 0 {
+			failed = true
+			for _, f := range r.Failed {
+				fmt.Fprintf(os.Stderr, "FAILED %s: %s\n", id, f)
+			}
+			continue
+		}
+		fmt.Printf("Reloaded %s\n", id)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func exportConfig() {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ExportConfig(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("# voidprobe-cli export (%s UTC)\n", time.Now().UTC().Format(timeLayout))
+	fmt.Println("# Client keys and SOCKS5 passwords are not exported.")
+	os.Stdout.Write(resp.Config)
+}
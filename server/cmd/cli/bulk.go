@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"google.golang.org/grpc/status"
+)
+
+// ============= Tags e Ações em Lote =============
+
+// formatTags exibe as tags como "env=prod,site=lisbon"
+func formatTags(tags map[string]string) string {
+	var parts []string
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if tags[key] == "" {
+			parts = append(parts, key)
+		} else {
+			parts = append(parts, key+"="+tags[key])
+		}
+	}
+	return orNone(strings.Join(parts, ","))
+}
+
+// tagChanges converte "chave=valor", "chave" e "-chave" nas tags a gravar e remover
+func tagChanges(args []string) (set map[string]string, remove []string) {
+	set = make(map[string]string)
+	for _, arg := range args {
+		if key, ok := strings.CutPrefix(arg, "-"); ok {
+			remove = append(remove, key)
+			continue
+		}
+		key, value, _ := strings.Cut(arg, "=")
+		set[key] = value
+	}
+	return set, remove
+}
+
+func clientTag(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: client-tag <client_id> <key=value|key|-key>...")
+		os.Exit(1)
+	}
+
+	set, remove := tagChanges(args[1:])
+	ctx, cancel := call()
+	defer cancel()
+	c, err := api().SetClientTags(ctx, &pb.SetClientTagsRequest{ClientId: args[0], Set: set, Remove: remove})
+	check(err)
+
+	fmt.Printf("Client %s tags: %s\n", c.ClientId, formatTags(c.Tags))
+}
+
+// bulkActions são as ações aceitas por bulk, com o verbo da confirmação
+var bulkActions = map[string]string{
+	"block":    "Block",
+	"unblock":  "Unblock",
+	"reload":   "Reload",
+	"kick":     "Disconnect",
+	"tag":      "Change tags of",
+	"port-add": "Add ports to",
+}
+
+// bulk aplica a ação a cada cliente escolhido pelo seletor, continuando
+// depois de falhas; sai com erro se alguma falhou
+func bulk(args []string) {
+	flags, args := extractFlags(args, "ttl", "schedule")
+	var yes bool
+	var rest []string
+	for _, a := range args {
+		if a == "-y" || a == "--yes" {
+			yes = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	if len(rest) < 2 || bulkActions[rest[1]] == "" || (rest[1] == "tag" || rest[1] == "port-add") && len(rest) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: bulk <selector> block|unblock|reload|kick [--yes]")
+		fmt.Fprintln(os.Stderr, "       bulk <selector> tag <key=value|key|-key>... [--yes]")
+		fmt.Fprintln(os.Stderr, "       bulk <selector> port-add <target>... [--ttl 4h] [--schedule ...] [--yes]")
+		os.Exit(1)
+	}
+	sel, action, params := rest[0], rest[1], rest[2:]
+
+	// Destinos validados antes de qualquer mudança
+	var targets []portTarget
+	if action == "port-add" {
+		for _, t := range params {
+			target, err := parsePortTarget(t)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	ctx, cancel := call()
+	resp, err := api().ListClients(ctx, &pb.ListClientsRequest{Selector: sel})
+	cancel()
+	check(err)
+	if len(resp.Clients) == 0 {
+		fmt.Printf("No clients match %q.\n", sel)
+		return
+	}
+
+	for _, c := range resp.Clients {
+		fmt.Printf("  %-36s %-20s %-12s %s\n", c.ClientId, truncate(c.Name, 20), truncate(orNone(c.Group), 12), formatTags(c.Tags))
+	}
+	if !yes {
+		fmt.Printf("\n%s %d client(s)? [y/N] ", bulkActions[action], len(resp.Clients))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+	fmt.Println()
+
+	// Sessões e portas atuais, para pular clientes desconectados e destinos já mapeados
+	ctx, cancel = call()
+	defer cancel()
+	online := make(map[string]bool)
+	existing := make(map[string][]portTarget)
+	switch action {
+	case "reload", "kick":
+		sessions, err := api().ListSessions(ctx, &pb.ListSessionsRequest{Selector: sel})
+		check(err)
+		for _, s := range sessions.Sessions {
+			// Clientes de outro nó do cluster são desconectados por ele
+			online[s.ClientId] = action == "reload" || s.State != "relayed"
+		}
+	case "port-add":
+		ports, err := api().ListPorts(ctx, &pb.ListPortsRequest{Selector: sel})
+		check(err)
+		for _, p := range ports.Ports {
+			if p.Mode != "socks5" {
+				existing[p.ClientId] = append(existing[p.ClientId], portTarget{p.TargetHost, int(p.TargetPort)})
+			}
+		}
+	}
+
+	failed := 0
+	for _, c := range resp.Clients {
+		id := c.ClientId
+		if (action == "reload" || action == "kick") && !online[id] {
+			fmt.Printf("%-36s skipped (not connected here)\n", id)
+			continue
+		}
+
+		result, err := bulkApply(id, action, params, targets, existing[id], flags)
+		if err != nil {
+			failed++
+			fmt.Printf("%-36s FAILED: %s\n", id, status.Convert(err).Message())
+			continue
+		}
+		fmt.Printf("%-36s %s\n", id, result)
+	}
+
+	fmt.Printf("\n%d client(s), %d failed.\n", len(resp.Clients), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// bulkApply executa a ação em um cliente e resume o resultado
+func bulkApply(clientID, action string, params []string, targets, existing []portTarget, flags map[string]string) (string, error) {
+	ctx, cancel := call()
+	defer cancel()
+
+	switch action {
+	case "block", "unblock":
+		st := map[string]string{"block": "blocked", "unblock": "active"}[action]
+		_, err := api().SetClientStatus(ctx, &pb.SetClientStatusRequest{ClientId: clientID, Status: st})
+		return st, err
+
+	case "reload":
+		r, err := api().ReloadClient(ctx, &pb.ClientRef{ClientId: clientID})
+		if err != nil {
+			return "", err
+		}
+		if len(r.Failed) > 0 {
+			return "", errors.New(strings.Join(r.Failed, "; "))
+		}
+		return "reloaded", nil
+
+	case "kick":
+		_, err := api().KickClient(ctx, &pb.ClientRef{ClientId: clientID})
+		return "disconnected", err
+
+	case "tag":
+		set, remove := tagChanges(params)
+		c, err := api().SetClientTags(ctx, &pb.SetClientTagsRequest{ClientId: clientID, Set: set, Remove: remove})
+		if err != nil {
+			return "", err
+		}
+		return "tags: " + formatTags(c.Tags), nil
+	}
+
+	// port-add: destinos já mapeados no cliente são mantidos
+	var added []string
+	for _, t := range targets {
+		if slices.Contains(existing, t) {
+			added = append(added, t.String()+" exists")
+			continue
+		}
+		resp, err := api().CreatePort(ctx, &pb.CreatePortRequest{
+			ClientId:   clientID,
+			TargetHost: t.host,
+			TargetPort: int32(t.port),
+			Ttl:        flags["ttl"],
+			Schedule:   flags["schedule"],
+		})
+		if err != nil {
+			return strings.Join(added, ", "), err
+		}
+		added = append(added, fmt.Sprintf("server:%d -> %s", resp.Port.ExposedPort, t))
+	}
+	return strings.Join(added, ", "), nil
+}
+
+// portTarget é o destino de um mapeamento no cliente
+type portTarget struct {
+	host string
+	port int // 0 para unix://
+}
+
+func (t portTarget) String() string {
+	return formatTarget(t.host, t.port)
+}
+
+// parsePortTarget converte "porta", "host:porta" ou "unix:///caminho"
+func parsePortTarget(s string) (portTarget, error) {
+	if strings.HasPrefix(s, unixPrefix) {
+		return portTarget{host: s}, nil
+	}
+	host, port := "127.0.0.1", s
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		host, port = h, p
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return portTarget{}, fmt.Errorf("invalid target %q (use port, host:port or unix:///path)", s)
+	}
+	return portTarget{host, n}, nil
+}
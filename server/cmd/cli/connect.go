@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/security"
+	"github.com/voidprobe/server/internal/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// connect abre um listener local (no notebook do operador) e encaminha cada
+// conexão pelo servidor até o destino do cliente, sem porta pública no servidor
+func connect(args []string) {
+	flags, args := extractFlags(args, "listen", "server", "operator", "key", "tls", "ca")
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: connect <client_id> <target> [--listen addr] [--server host:port] [--operator id] [--key key] [--tls on|off] [--ca file]")
+		os.Exit(1)
+	}
+
+	clientID, target := args[0], args[1]
+	server := flagOrEnv(flags, "server", "VOIDPROBE_SERVER")
+	operator := flagOrEnv(flags, "operator", "VOIDPROBE_OPERATOR")
+	key := flagOrEnv(flags, "key", "VOIDPROBE_KEY")
+	if operator == "" && key == "" {
+		operator, key = adminOperator, adminKey
+	}
+	listen := flags["listen"]
+	if listen == "" {
+		listen = "127.0.0.1:0"
+	}
+	if server == "" || operator == "" || key == "" {
+		fmt.Fprintln(os.Stderr, "Error: --server, --operator and --key are required (or VOIDPROBE_SERVER, VOIDPROBE_OPERATOR, VOIDPROBE_KEY)")
+		os.Exit(1)
+	}
+
+	ca := adminCA
+	if v, ok := flags["ca"]; ok {
+		ca = v
+	}
+	var creds credentials.TransportCredentials
+	if tlsMode := flagOrEnv(flags, "tls", "VOIDPROBE_TLS"); tlsMode == "off" || tlsMode == "false" {
+		creds = insecure.NewCredentials()
+	} else {
+		creds = tlsCredentials(ca)
+	}
+
+	auth := security.NewClientAuthInterceptor(key)
+	conn, err := grpc.Dial(server,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStreamInterceptor(auth.Stream()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", server, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listening on %s: %v\n", listen, err)
+		os.Exit(1)
+	}
+	defer ln.Close()
+
+	fmt.Printf("Forwarding %s -> %s:%s via %s (Ctrl+C to stop)\n", ln.Addr(), clientID, target, server)
+
+	client := pb.NewRemoteTunnelClient(conn)
+	for {
+		local, err := ln.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		go accessConn(client, operator, clientID, target, local)
+	}
+}
+
+// accessConn abre um AccessStream para a conexão local e copia os dados nos dois sentidos
+func accessConn(client pb.RemoteTunnelClient, operator, clientID, target string, local net.Conn) {
+	defer local.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "operator-id", operator, "client-id", clientID, "target", target)
+
+	stream, err := client.AccessStream(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Connection from %s failed: %s\n", local.RemoteAddr(), status.Convert(err).Message())
+		return
+	}
+
+	adapter := transport.NewAdapter(stream)
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(adapter, local)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		// io.Writer puro: evita que ReadFrom embrulhe o status gRPC no erro
+		if _, err := io.Copy(struct{ io.Writer }{local}, adapter); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Connection from %s failed: %s\n", local.RemoteAddr(), status.Convert(err).Message())
+		}
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// flagOrEnv retorna o valor da flag ou, se ausente, da variável de ambiente
+func flagOrEnv(flags map[string]string, name, env string) string {
+	if v, ok := flags[name]; ok {
+		return v
+	}
+	return os.Getenv(env)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+)
+
+// ============= History Commands =============
+
+func historyList(args []string) {
+	flags, args := extractFlags(args, "limit")
+
+	// Sem --limit, as 50 mais recentes
+	req := &pb.ListRevisionsRequest{Limit: limitFlag(flags, "history [client_id] [--limit N]")}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListRevisions(ctx, req)
+	check(err)
+
+	fmt.Printf("%-6s %-19s %-20s %-20s %s\n", "REV", "TIME", "OPERATOR", "CLIENT", "CHANGE")
+	fmt.Println(strings.Repeat("-", 110))
+
+	for _, r := range resp.Revisions {
+		fmt.Printf("%-6d %-19s %-20s %-20s %s\n", r.Id, r.CreatedAt, truncate(orNone(r.OperatorId), 20),
+			truncate(r.ClientId, 20), r.Summary)
+	}
+}
+
+func rollback(args []string) {
+	var yes bool
+	var rest []string
+	for _, a := range args {
+		if a == "-y" || a == "--yes" {
+			yes = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	if len(rest) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: rollback <rev> [client_id] [--yes]")
+		os.Exit(1)
+	}
+	rev, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil || rev < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid revision %q\n", rest[0])
+		os.Exit(1)
+	}
+	var clientID string
+	if len(rest) > 1 {
+		clientID = rest[1]
+	}
+
+	// Desfaz da mais recente até a seguinte a rev
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListRevisions(ctx, &pb.ListRevisionsRequest{ClientId: clientID, After: rev})
+	check(err)
+	revisions := resp.Revisions
+	if len(revisions) == 0 {
+		fmt.Printf("Nothing to roll back: no changes after revision %d.\n", rev)
+		return
+	}
+
+	for _, r := range revisions {
+		fmt.Printf("undo %-6d %-20s %s\n", r.Id, truncate(r.ClientId, 20), r.Summary)
+	}
+	fmt.Printf("\nRollback: %d change(s) to undo.\n", len(revisions))
+
+	if !yes {
+		fmt.Print("\nRoll back these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	// O servidor recusa se surgiu revisão mais nova que a exibida
+	ctx, cancel = call()
+	defer cancel()
+	done, err := api().Rollback(ctx, &pb.RollbackRequest{Revision: rev, ClientId: clientID, Latest: revisions[0].Id})
+	check(err)
+
+	fmt.Printf("Rolled back to revision %d.\n", rev)
+	for _, s := range done.Synced {
+		fmt.Printf("  %s\n", templateSync(s))
+	}
+	reloadAffected(done.Reload)
+}
@@ -1,25 +1,40 @@
 package main
 
 import (
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/user"
+	"strconv"
 	"strings"
+	"time"
 
-	_ "modernc.org/sqlite"
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/declarative"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 const version = "1.0.0"
 
-var dbPath string
+var (
+	dbPath  string
+	store   database.Store
+	command string
+)
 
 func main() {
 	// Flags globais
-	flag.StringVar(&dbPath, "db", "/opt/voidprobe/data/voidprobe.db", "Path to database")
+	flag.StringVar(&dbPath, "db", envOr("DB_PATH", "/opt/voidprobe/data/voidprobe.db"), "Path to the SQLite database or postgres:// URL")
+	flag.StringVar(&adminAddr, "admin", os.Getenv("VOIDPROBE_ADMIN"), "Admin API address (host:port); default: local control socket")
+	flag.StringVar(&adminToken, "token", os.Getenv("VOIDPROBE_TOKEN"), "Admin API token")
+	flag.StringVar(&adminOperator, "operator", os.Getenv("VOIDPROBE_OPERATOR"), "Operator ID for the admin API (with -key)")
+	flag.StringVar(&adminKey, "key", os.Getenv("VOIDPROBE_KEY"), "Operator key for the admin API")
+	flag.StringVar(&adminTLS, "tls", os.Getenv("VOIDPROBE_TLS"), "TLS to the admin API: on|off (default on)")
+	flag.StringVar(&adminCA, "ca", os.Getenv("VOIDPROBE_CA"), "CA (or self-signed server certificate) to verify the server; default: system roots")
+	flag.BoolVar(&adminInsecure, "insecure", false, "Do not verify the server certificate (testing only)")
 	flag.Parse()
 
 	args := flag.Args()
@@ -28,54 +43,192 @@ func main() {
 		os.Exit(0)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Close()
-
-	command := args[0]
+	command = args[0]
 	cmdArgs := args[1:]
+	defer func() {
+		if store != nil {
+			store.Close()
+		}
+	}()
 
 	switch command {
 	// Client commands
 	case "client-list", "cl":
-		clientList(db)
+		clientList(cmdArgs)
 	case "client-add", "ca":
-		clientAdd(db, cmdArgs)
+		clientAdd(cmdArgs)
 	case "client-remove", "cr":
-		clientRemove(db, cmdArgs)
+		clientRemove(cmdArgs)
 	case "client-block", "cb":
-		clientBlock(db, cmdArgs)
+		setClientStatus(cmdArgs, "blocked")
 	case "client-unblock", "cu":
-		clientUnblock(db, cmdArgs)
+		setClientStatus(cmdArgs, "active")
 	case "client-info", "ci":
-		clientInfo(db, cmdArgs)
+		clientInfo(cmdArgs)
 	case "client-key", "ck":
-		clientRegenKey(db, cmdArgs)
+		clientRegenKey(cmdArgs)
 	case "client-set-key", "csk":
-		clientSetKey(db, cmdArgs)
+		clientSetKey(cmdArgs)
+	case "client-set-group", "csg":
+		clientSetGroup(cmdArgs)
+	case "client-tag", "ct":
+		clientTag(cmdArgs)
+	case "bulk":
+		bulk(cmdArgs)
+
+	// Operator commands
+	case "operator-list", "ol":
+		operatorList()
+	case "operator-add", "oa":
+		operatorAdd(cmdArgs)
+	case "operator-remove", "or":
+		operatorRemove(cmdArgs)
+	case "operator-block", "ob":
+		setOperatorStatus(cmdArgs, "blocked")
+	case "operator-unblock", "ou":
+		setOperatorStatus(cmdArgs, "active")
+	case "operator-key", "ok":
+		operatorRegenKey(cmdArgs)
+	case "operator-set", "os":
+		operatorSet(cmdArgs)
+	case "audit", "au":
+		auditList(cmdArgs)
+
+	// API token commands
+	case "token-list", "tkl":
+		tokenList()
+	case "token-add", "tka":
+		tokenAdd(cmdArgs)
+	case "token-revoke", "tkr":
+		tokenRevoke(cmdArgs)
+
+	// Access command (runs on the operator's machine, no database needed)
+	case "connect":
+		connect(cmdArgs)
 
 	// Port commands
 	case "port-list", "pl":
-		portList(db, cmdArgs)
+		portList(cmdArgs)
 	case "port-add", "pa":
-		portAdd(db, cmdArgs)
+		portAdd(cmdArgs)
 	case "port-remove", "pr":
-		portRemove(db, cmdArgs)
+		portRemove(cmdArgs)
 	case "port-enable", "pe":
-		portEnable(db, cmdArgs)
+		setPortEnabled(cmdArgs, true)
 	case "port-disable", "pd":
-		portDisable(db, cmdArgs)
-
-	// Control commands (Unix socket)
+		setPortEnabled(cmdArgs, false)
+	case "port-set", "ps":
+		portSet(cmdArgs)
+
+	// Service commands
+	case "service-list", "svl":
+		serviceList(cmdArgs)
+	case "service-approve", "sva":
+		serviceApprove(cmdArgs)
+	case "service-revoke", "svr":
+		serviceRevoke(cmdArgs)
+
+	// Port pool commands
+	case "pool-list", "pol":
+		poolList()
+	case "pool-add", "poa":
+		poolAdd(cmdArgs)
+	case "pool-remove", "por":
+		poolRemove(cmdArgs)
+
+	// Port template commands
+	case "template-list", "tpl":
+		templateList(cmdArgs)
+	case "template-add", "tpa":
+		templateAdd(cmdArgs)
+	case "template-set", "tps":
+		templateSet(cmdArgs)
+	case "template-remove", "tpr":
+		templateRemove(cmdArgs)
+	case "template-attach", "tpat":
+		templateAttach(cmdArgs, true)
+	case "template-detach", "tpd":
+		templateAttach(cmdArgs, false)
+
+	// Local-forward commands
+	case "forward-list", "fl":
+		forwardList(cmdArgs)
+	case "forward-add", "fa":
+		forwardAdd(cmdArgs)
+	case "forward-remove", "fr":
+		forwardRemove(cmdArgs)
+	case "forward-enable", "fe":
+		setForwardEnabled(cmdArgs, true)
+	case "forward-disable", "fd":
+		setForwardEnabled(cmdArgs, false)
+
+	// Client link commands
+	case "link-list", "ll":
+		linkList()
+	case "link-allow", "la":
+		linkAllow(cmdArgs)
+	case "link-revoke", "lr":
+		linkRevoke(cmdArgs)
+
+	// HTTP route commands
+	case "route-list", "rl":
+		routeList(httpRoutes, cmdArgs)
+	case "route-add", "ra":
+		routeAdd(httpRoutes, cmdArgs)
+	case "route-remove", "rr":
+		routeRemove(httpRoutes, cmdArgs)
+	case "route-enable", "re":
+		setRouteEnabled(httpRoutes, cmdArgs, true)
+	case "route-disable", "rd":
+		setRouteEnabled(httpRoutes, cmdArgs, false)
+
+	// TLS route commands (SNI passthrough)
+	case "tls-route-list", "tl":
+		routeList(tlsRoutes, cmdArgs)
+	case "tls-route-add", "ta":
+		routeAdd(tlsRoutes, cmdArgs)
+	case "tls-route-remove", "tr":
+		routeRemove(tlsRoutes, cmdArgs)
+	case "tls-route-enable", "te":
+		setRouteEnabled(tlsRoutes, cmdArgs, true)
+	case "tls-route-disable", "td":
+		setRouteEnabled(tlsRoutes, cmdArgs, false)
+
+	// Declarative config
+	case "plan":
+		planConfig(cmdArgs)
+	case "apply":
+		applyConfig(cmdArgs)
+	case "export":
+		exportConfig()
+
+	// History commands
+	case "history", "hi":
+		historyList(cmdArgs)
+	case "rollback":
+		rollback(cmdArgs)
+
+	// Database commands
+	case "migrate":
+		migrate(cmdArgs)
+
+	// Cluster commands
+	case "node-list", "nl":
+		nodeList(cmdArgs)
+	case "node-remove", "nr":
+		nodeRemove(cmdArgs)
+
+	// Session commands
 	case "reload", "r":
-		sendControl("RELOAD", cmdArgs)
+		reload(cmdArgs)
 	case "connected", "conn":
-		sendControl("LIST", nil)
+		connected(cmdArgs)
 	case "kick", "k":
-		sendControl("KICK", cmdArgs)
+		kick(cmdArgs)
+	case "events", "ev":
+		events(cmdArgs)
+	case "connections", "cn":
+		connections(cmdArgs)
 
 	// Help
 	case "help", "h":
@@ -90,6 +243,30 @@ func main() {
 	}
 }
 
+// openDB abre o banco (arquivo SQLite ou URL do PostgreSQL) sem verificar a
+// versão do schema. Só migrate e operator-key --recover usam o banco
+// diretamente: rodam no servidor, antes de ele subir ou sem credenciais.
+func openDB() database.Store {
+	if adminAddr != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s needs direct database access; run it on the server without -admin\n", command)
+		os.Exit(1)
+	}
+
+	repo, err := database.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
+		os.Exit(1)
+	}
+	return repo
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func printHelp() {
 	help := `VoidProbe CLI - Client and Port Management
 
@@ -97,9 +274,20 @@ Usage: voidprobe-cli [options] <command> [args]
 
 Options:
   -db string    Path to database (default: /opt/voidprobe/data/voidprobe.db)
+  -admin addr   Admin API of a remote server (env VOIDPROBE_ADMIN; default: local
+                control socket). Every command goes through the API except
+                migrate and operator-key --recover, which open the database
+                (-db) and fail with -admin
+  -operator id  Operator for the admin API (env VOIDPROBE_OPERATOR)
+  -key key      Operator key or password (env VOIDPROBE_KEY)
+  -token tok    Admin API token (env VOIDPROBE_TOKEN, see token-add)
+  -tls on|off   TLS to the admin API (env VOIDPROBE_TLS, default on)
+  -ca file      CA or self-signed server certificate that verifies the server
+                (env VOIDPROBE_CA; default: system roots)
+  -insecure     Do not verify the server certificate (testing only)
 
 Client Commands:
-  client-list, cl                    List all clients
+  client-list, cl [selector]         List clients (all or matching the selector)
   client-add, ca <id> <name>         Add new client (prints key)
   client-remove, cr <id>             Remove client and all ports
   client-block, cb <id>              Block client
@@ -107,18 +295,170 @@ Client Commands:
   client-info, ci <id>               Show client details
   client-key, ck <id>                Regenerate client key (random)
   client-set-key, csk <id> <key>     Set specific client key
+  client-set-group, csg <id> <group|none>
+                                     Set client group (selects port pool)
+  client-tag, ct <id> <key=value|key|-key>...
+                                     Set or remove (-key) client tags
+
+Selectors (client-list, port-list, connected, bulk) match tags and the fields
+id, name, group and status; all terms must match:
+  env=staging,site=lis*              Value equals (wildcards * ? [..])
+  env!=prod   canary   !canary       Differs or absent / present / absent
+
+Bulk Commands (list the matching clients and ask before changing them):
+  bulk <selector> block|unblock|reload|kick [--yes]
+                                     Apply to every matching client (reload and
+                                     kick only to connected ones)
+  bulk <selector> tag <key=value|key|-key>... [--yes]
+                                     Change tags of every matching client
+  bulk <selector> port-add <target>... [--ttl 4h] [--schedule spec] [--yes]
+                                     Map targets (port, host:port or unix:///path)
+                                     on each client, server ports from its pool;
+                                     targets already mapped are skipped
 
 Port Commands:
-  port-list, pl [client_id]          List ports (all or for client)
-  port-add, pa <client> <exp> <tgt>  Add port (server:client)
+  port-list, pl [client_id|selector] List ports (all, for client or matching clients)
+  port-add, pa <client> <exp> <tgt>  Add port (exp may be "auto", tgt may be unix:///path)
+  port-add, pa <client> <exp> socks5 <user> [pass]
+                                     Add SOCKS5 port (dynamic targets on client)
   port-remove, pr <id>               Remove port by ID
   port-enable, pe <id>               Enable port
   port-disable, pd <id>              Disable port
-
-Control Commands (hot-reload):
-  reload, r <client_id>              Reload ports for connected client
-  connected, conn                    List connected clients
+  port-set, ps <id> proxy-protocol <v1|v2|off>
+                                     Client sends PROXY header with admin address
+  port-set, ps <id> accept-proxy <on|off>
+                                     Require PROXY header on listener (behind LB)
+  port-set, ps <id> health-check <off|tcp|tls|http[:/path]>
+                                     How the client probes the target (default tcp)
+  port-set, ps <id> refuse-unhealthy <on|off>
+                                     Refuse connections while target is down
+  port-set, ps <id> ttl <4h|2d|off>  Close port automatically after duration
+  port-set, ps <id> schedule <spec|off>
+                                     Open only in weekly windows (server local time)
+  port-add ... --ttl 4h --schedule "mon-fri 08:00-18:00"
+                                     Time-limited / scheduled port (no reload needed)
+
+Service Commands (offered by clients via SERVICES, pending until approved):
+  service-list, svl [client_id]      List offered services and their status
+  service-approve, sva <client> <name> [--port N]
+                                     Expose service (server port N or from pool)
+  service-revoke, svr <client> <name>
+                                     Remove mapping, service goes back to pending
+
+Port Pool Commands (used by "port-add <client> auto <tgt>"):
+  pool-list, pol                     List port pools and usage
+  pool-add, poa <start-end> [group]  Add pool (default or for client group)
+  pool-remove, por <id>              Remove pool (existing ports are kept)
+
+  Automatic ports (pools, template ranges) skip mapped ports and ports that
+  fail to bind on the server.
+
+Port Template Commands (ports created on every client attached directly or by group):
+  template-list, tpl [name]          List templates (or show one with its ports)
+  template-add, tpa <name> [target...] [--alloc pool|start-end]
+                                     Add template (server ports from the client's
+                                     pool or from the range)
+  template-set, tps <name> add|remove <target>...
+                                     Add or remove targets (ports follow on every client)
+  template-set, tps <name> alloc <pool|start-end>
+                                     Change allocation (existing ports are kept)
+  template-remove, tpr <name>        Remove template and the ports it created
+  template-attach, tpat <name> client|group <id>
+                                     Create the template's ports on the client or group
+  template-detach, tpd <name> client|group <id>
+                                     Remove the ports created through this attachment
+
+Local-Forward Commands (client listener -> host reachable from server):
+  forward-list, fl [client_id]       List local-forwards (all or for client)
+  forward-add, fa <client> <lport> <host:port> [listen_host] [--via <client>]
+                                     Add local-forward (client:lport -> host:port,
+                                     dialed from the --via client's network)
+  forward-remove, fr <id>            Remove local-forward by ID
+  forward-enable, fe <id>            Enable local-forward
+  forward-disable, fd <id>           Disable local-forward
+
+Client Link Commands (pairs allowed to use "forward-add --via"):
+  link-list, ll                      List allowed client pairs
+  link-allow, la <from> <to>         Allow <from> to reach <to>'s network
+  link-revoke, lr <from> <to>        Revoke pair (existing forwards stop relaying)
+
+HTTP Route Commands (shared HTTP_ROUTER_ADDRESS, routed by Host header):
+  route-list, rl [client_id]         List HTTP routes (all or for client)
+  route-add, ra <host> <client> <port> [target_host]
+                                     Route hostname to client target
+  route-remove, rr <id>              Remove HTTP route by ID
+  route-enable, re <id>              Enable HTTP route
+  route-disable, rd <id>             Disable HTTP route
+
+TLS Route Commands (shared TLS_ROUTER_ADDRESS, passthrough by SNI):
+  tls-route-list, tl [client_id]     List TLS routes (all or for client)
+  tls-route-add, ta <host> <client> <port> [target_host]
+                                     Route SNI hostname to client target
+                                     (host "*" = default for unknown SNI)
+  tls-route-remove, tr <id>          Remove TLS route by ID
+  tls-route-enable, te <id>          Enable TLS route
+  tls-route-disable, td <id>         Disable TLS route
+
+Operator Commands (roles: viewer = read only, operator = ports and sessions,
+admin = everything; groups limit non-admins to clients in those groups):
+  operator-list, ol                  List operators
+  operator-add, oa <id> <name> [--role viewer|operator|admin]
+          [--groups g1,g2|all] [--password pw]
+                                     Add operator (default role operator; prints
+                                     generated key unless --password is given)
+  operator-set, os <id> role|groups <value>
+                                     Change operator role or groups
+  operator-remove, or <id>           Remove operator
+  operator-block, ob <id>            Block operator
+  operator-unblock, ou <id>          Unblock operator
+  operator-key, ok <id> [password] [--recover]
+                                     Generate new key (or set password) for operator
+                                     (--recover: without credentials, file access only)
+  audit, au [client_id] [--limit N]  Show who changed what (newest first, default 50)
+
+API Token Commands (for -admin; scopes: read, write, control, events or all):
+  token-list, tkl                    List API tokens
+  token-add, tka <operator> <name> [--scopes read,control]
+                                     Issue token for operator (default scope: read)
+  token-revoke, tkr <id>             Revoke token
+
+Access Command (on the operator's machine, no public port needed):
+  connect <client> <target> [--listen addr] [--server host:port]
+          [--operator id] [--key key] [--tls on|off] [--ca file]
+                                     Local listener -> server -> client target
+                                     (env: VOIDPROBE_SERVER, VOIDPROBE_OPERATOR,
+                                     VOIDPROBE_KEY, VOIDPROBE_TLS)
+
+Declarative Config (clients without keys, group pools and ports; the database
+is made to match the file, so anything missing from it is removed):
+  plan -f <voidprobe.yaml>           Show what apply would create, update or remove
+  apply -f <voidprobe.yaml> [--yes]  Apply the plan in one transaction and reload
+                                     affected connected clients (prints new keys)
+  export                             Print the database in the same format
+
+History Commands (every change to clients and ports is a numbered revision):
+  history, hi [client_id] [--limit N]
+                                     List revisions with operator and before/after
+  rollback <rev> [client_id] [--yes] Undo every change after revision rev (only
+                                     the client's, if given) and reload sessions
+
+Database Commands:
+  migrate                            Apply pending schema migrations (the server
+                                     also applies them at start)
+  migrate status                     List migrations and when they were applied
+
+Cluster Commands (servers sharing the database, see CLUSTER_ADDRESS):
+  node-list, nl [node_id]            List nodes (or the clients connected to one)
+  node-remove, nr <node_id>          Forget a decommissioned node (its clients
+                                     show as offline until they reconnect)
+
+Session Commands:
+  reload, r <client_id>              Reload ports and forwards now (the server also
+                                     picks up database changes automatically)
+  connected, conn [selector]         List connected clients and target health
   kick, k <client_id>                Disconnect client
+  events, ev [client_id]             Follow connections, port states and changes
+  connections, cn [client_id]        List open connections and bytes transferred
 
 Examples:
   # Client Management
@@ -131,420 +471,1290 @@ Examples:
   voidprobe-cli client-unblock srv-prod                  # Unblock client
   voidprobe-cli client-remove srv-prod                   # Remove client and ports
 
+  # Tags and Bulk Actions
+  voidprobe-cli client-tag srv-prod env=prod site=lisbon     # Tag a client
+  voidprobe-cli client-list site=lisbon                      # Clients in Lisbon
+  voidprobe-cli connected env=prod,!canary                   # Connected production clients
+  voidprobe-cli port-list env=staging                        # Ports of staging clients
+  voidprobe-cli bulk env=staging reload                      # Reload every staging client
+  voidprobe-cli bulk site=lisbon port-add 22 9100 --yes      # SSH and node-exporter on every Lisbon client
+
   # Port Management
   voidprobe-cli port-list                                # List all ports
   voidprobe-cli port-list srv-prod                       # List ports for client
   voidprobe-cli port-add srv-prod 2222 22                # Server:2222 -> Client:22
   voidprobe-cli port-add srv-prod 8080 80                # Server:8080 -> Client:80
   voidprobe-cli port-add srv-prod 9000 9000 10.0.0.5     # Server:9000 -> 10.0.0.5:9000
+  voidprobe-cli port-add srv-prod 2375 unix:///var/run/docker.sock  # Server:2375 -> Docker socket
+  voidprobe-cli port-add srv-prod 1080 socks5 admin      # SOCKS5 on server:1080 (prints password)
   voidprobe-cli port-disable 1                           # Disable port ID 1
   voidprobe-cli port-enable 1                            # Enable port ID 1
   voidprobe-cli port-remove 1                            # Remove port ID 1
+  voidprobe-cli port-set 1 proxy-protocol v2             # Target sees real admin IP (PROXY v2)
+  voidprobe-cli port-set 1 accept-proxy on               # Server behind LB sending PROXY headers
+  voidprobe-cli port-set 2 health-check http:/healthz    # Probe with HTTP GET (5xx = down)
+  voidprobe-cli port-set 2 refuse-unhealthy on           # Refuse admins while target is down
+  voidprobe-cli port-add srv-prod 3389 3389 --ttl 4h     # Vendor access, closes in 4 hours
+  voidprobe-cli pool-add 20000-20999                     # Default pool for auto allocation
+  voidprobe-cli pool-add 30000-30099 vendors             # Pool for clients in group "vendors"
+  voidprobe-cli port-add srv-prod auto 22                # Pick a free server port (printed)
+  voidprobe-cli port-add srv-prod 2223 22 --schedule "mon-fri 08:00-18:00"  # Business hours only
+
+  # Port Templates (ports follow group membership and template changes)
+  voidprobe-cli template-add base 22 9100                            # SSH and node-exporter
+  voidprobe-cli template-add rdp 3389 --alloc 33000-33999            # Server ports from a fixed range
+  voidprobe-cli template-attach base group lisbon                    # Every client in group "lisbon"
+  voidprobe-cli client-set-group srv-new lisbon                      # srv-new gets 22 and 9100 mapped
+  voidprobe-cli template-set base add 10.0.0.5:5432                  # New target on every attached client
+  voidprobe-cli template-list base                                   # Ports created by the template
+
+  # Client-Declared Services (SERVICES=ssh=localhost:22,web=127.0.0.1:8080 on the client)
+  voidprobe-cli service-list srv-prod                                # Pending and approved services
+  voidprobe-cli service-approve srv-prod ssh --port 2222             # Expose "ssh" on server:2222
+  voidprobe-cli service-approve srv-prod web                         # Port from the client's pool
+
+  # Local-Forward Management (like ssh -L, opened on the client's network)
+  voidprobe-cli forward-add srv-prod 27000 10.1.0.5:27000            # Client:27000 -> license server
+  voidprobe-cli forward-add srv-prod 3142 mirror.internal:3142 127.0.0.1  # Bind only on client loopback
+  voidprobe-cli forward-list srv-prod                                # List forwards for client
+  voidprobe-cli link-allow site-a site-b                             # Authorize site-a -> site-b
+  voidprobe-cli forward-add site-a 15432 127.0.0.1:5432 --via site-b # site-a:15432 -> site-b's postgres
+  voidprobe-cli reload srv-prod                                      # Push changes to client
+
+  # HTTP Routes (take effect immediately, no reload needed)
+  voidprobe-cli route-add grafana.example.com srv-prod 3000          # grafana.example.com -> Client:3000
+  voidprobe-cli route-add '*.lab.example.com' srv-lab 80 10.0.0.8    # Wildcard -> 10.0.0.8:80
+  voidprobe-cli tls-route-add app.example.com srv-prod 443           # TLS passthrough by SNI
+  voidprobe-cli tls-route-add '*' srv-prod 8443                      # Default for unknown SNI
+
+  # Operator Access (like cloudflared access)
+  voidprobe-cli operator-add alice "Alice Souza"                     # Prints VOIDPROBE_KEY
+  voidprobe-cli operator-add root "Root" --role admin                # First admin: socket now requires credentials
+  voidprobe-cli operator-add noc "NOC" --role viewer                 # Read-only (dashboard, lists, events)
+  voidprobe-cli operator-add vendor "Vendor" --groups vendors        # Only clients in group "vendors"
+  voidprobe-cli audit srv-prod                                       # Who changed srv-prod
+  voidprobe-cli connect srv-prod 127.0.0.1:22 --listen 127.0.0.1:2222 \
+      --server tunnel.empresa.com:50051 --operator alice --key KEY --ca server.crt  # Then: ssh -p 2222 user@127.0.0.1
+
+  # Configuration as Code
+  voidprobe-cli export > voidprobe.yaml                              # Start from the current database
+  voidprobe-cli plan -f voidprobe.yaml                               # Review the diff (e.g. in CI)
+  voidprobe-cli apply -f voidprobe.yaml --yes                        # Apply without prompting
+
+  # Undoing Mistakes
+  voidprobe-cli history srv-prod                                     # Find the revision before the mistake
+  voidprobe-cli rollback 41 srv-prod                                 # Restore srv-prod as it was after rev 41
+
+  # Upgrades
+  voidprobe-cli migrate status                                       # Pending migrations after installing a new version
+  voidprobe-cli migrate                                              # Apply them before restarting the server
+
+  # Remote Administration (ADMIN_ADDRESS on the server)
+  voidprobe-cli token-add alice ci --scopes read,control             # On the server: prints VOIDPROBE_TOKEN
+  voidprobe-cli -admin tunnel.empresa.com:50052 -token TOKEN connected
+  VOIDPROBE_ADMIN=tunnel.empresa.com:50052 VOIDPROBE_TOKEN=TOKEN voidprobe-cli reload srv-prod
 `
 	fmt.Print(help)
 }
 
 // ============= Client Commands =============
 
-func clientList(db *sql.DB) {
-	rows, err := db.Query(`
-		SELECT client_id, client_name, status, created_at, last_seen_at,
-		       (SELECT COUNT(*) FROM client_ports WHERE client_ports.client_id = clients.client_id) as port_count
-		FROM clients ORDER BY client_name
-	`)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return
+func clientList(args []string) {
+	req := &pb.ListClientsRequest{}
+	if len(args) > 0 {
+		req.Selector = strings.Join(args, ",")
 	}
-	defer rows.Close()
-
-	fmt.Printf("%-36s %-20s %-8s %-5s %-19s %-19s\n", "CLIENT_ID", "NAME", "STATUS", "PORTS", "CREATED", "LAST_SEEN")
-	fmt.Println(strings.Repeat("-", 120))
 
-	for rows.Next() {
-		var id, name, status, created string
-		var lastSeen sql.NullString
-		var portCount int
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListClients(ctx, req)
+	check(err)
 
-		rows.Scan(&id, &name, &status, &created, &lastSeen, &portCount)
+	fmt.Printf("%-36s %-20s %-8s %-12s %-5s %-19s %-19s %s\n", "CLIENT_ID", "NAME", "STATUS", "GROUP", "PORTS", "CREATED", "LAST_SEEN", "TAGS")
+	fmt.Println(strings.Repeat("-", 150))
 
-		ls := "-"
-		if lastSeen.Valid {
-			ls = lastSeen.String
+	for _, c := range resp.Clients {
+		ls := c.LastSeenAt
+		if ls == "" {
+			ls = "-"
+		}
+		group := c.Group
+		if group == "" {
+			group = "-"
 		}
 
-		fmt.Printf("%-36s %-20s %-8s %-5d %-19s %-19s\n", id, truncate(name, 20), status, portCount, created, ls)
+		fmt.Printf("%-36s %-20s %-8s %-12s %-5d %-19s %-19s %s\n", c.ClientId, truncate(c.Name, 20), c.Status, truncate(group, 12), c.PortCount, c.CreatedAt, ls, formatTags(c.Tags))
 	}
 }
 
-func clientAdd(db *sql.DB, args []string) {
+func clientAdd(args []string) {
 	if len(args) < 2 {
 		fmt.Fprintln(os.Stderr, "Usage: client-add <client_id> <name>")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
-	name := strings.Join(args[1:], " ")
-
-	// Generate key
-	key := generateKey()
-	keyHash := hashKey(key)
-
-	_, err := db.Exec(`
-		INSERT INTO clients (client_id, client_name, key_hash)
-		VALUES (?, ?, ?)
-	`, clientID, name, keyHash)
-
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error adding client: %v\n", err)
-		os.Exit(1)
-	}
+	ctx, cancel := call()
+	defer cancel()
+	creds, err := api().CreateClient(ctx, &pb.CreateClientRequest{ClientId: args[0], Name: strings.Join(args[1:], " ")})
+	check(err)
 
 	fmt.Println("Client added successfully!")
 	fmt.Println()
 	fmt.Println("=== Client Configuration ===")
-	fmt.Printf("CLIENT_ID=%s\n", clientID)
-	fmt.Printf("AUTH_TOKEN=%s\n", key)
+	fmt.Printf("CLIENT_ID=%s\n", creds.ClientId)
+	fmt.Printf("AUTH_TOKEN=%s\n", creds.Key)
 	fmt.Println()
 	fmt.Println("⚠️  Save the AUTH_TOKEN now! It cannot be recovered.")
 }
 
-func clientRemove(db *sql.DB, args []string) {
+func clientRemove(args []string) {
 	if len(args) < 1 {
 		fmt.Fprintln(os.Stderr, "Usage: client-remove <client_id>")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteClient(ctx, &pb.ClientRef{ClientId: args[0]})
+	check(err)
 
-	result, err := db.Exec("DELETE FROM clients WHERE client_id = ?", clientID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error removing client: %v\n", err)
+	fmt.Println("Client and all associated ports removed.")
+}
+
+func setClientStatus(args []string, status string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: client-block/client-unblock <client_id>")
 		os.Exit(1)
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Client not found")
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetClientStatus(ctx, &pb.SetClientStatusRequest{ClientId: args[0], Status: status})
+	check(err)
+
+	fmt.Printf("Client %s is now %s\n", args[0], status)
+}
+
+func clientSetGroup(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: client-set-group <client_id> <group|none>")
 		os.Exit(1)
 	}
 
-	fmt.Println("Client and all associated ports removed.")
-}
+	group := args[1]
+	if group == "none" {
+		group = ""
+	}
 
-func clientBlock(db *sql.DB, args []string) {
-	setClientStatus(db, args, "blocked")
-}
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetClientGroup(ctx, &pb.SetClientGroupRequest{ClientId: args[0], Group: group})
+	check(err)
+
+	fmt.Printf("Client %s group set to %s\n", args[0], args[1])
 
-func clientUnblock(db *sql.DB, args []string) {
-	setClientStatus(db, args, "active")
+	// Portas dos modelos ligados ao grupo (criadas ou removidas pelo servidor)
+	resp, err := api().ListPorts(ctx, &pb.ListPortsRequest{ClientId: args[0]})
+	check(err)
+	for _, p := range resp.Ports {
+		if p.Template != "" {
+			fmt.Printf("  server:%d -> %s (template %s)\n", p.ExposedPort, formatTarget(p.TargetHost, int(p.TargetPort)), p.Template)
+		}
+	}
 }
 
-func setClientStatus(db *sql.DB, args []string, status string) {
+func clientInfo(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: client-%s <client_id>\n", status)
+		fmt.Fprintln(os.Stderr, "Usage: client-info <client_id>")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
+	ctx, cancel := call()
+	defer cancel()
+	c, err := api().GetClient(ctx, &pb.ClientRef{ClientId: args[0]})
+	check(err)
 
-	result, err := db.Exec("UPDATE clients SET status = ? WHERE client_id = ?", status, clientID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	group := c.Group
+	if group == "" {
+		group = "-"
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Client not found")
-		os.Exit(1)
+	fmt.Printf("Client ID:   %s\n", c.ClientId)
+	fmt.Printf("Name:        %s\n", c.Name)
+	fmt.Printf("Status:      %s\n", c.Status)
+	fmt.Printf("Group:       %s\n", group)
+	fmt.Printf("Tags:        %s\n", formatTags(c.Tags))
+	fmt.Printf("Created:     %s\n", c.CreatedAt)
+	if c.LastSeenAt != "" {
+		fmt.Printf("Last Seen:   %s\n", c.LastSeenAt)
+	} else {
+		fmt.Printf("Last Seen:   Never\n")
 	}
 
-	fmt.Printf("Client %s is now %s\n", clientID, status)
+	fmt.Println("\nPorts:")
+	portList(args)
+
+	fmt.Println("\nLocal-Forwards:")
+	forwardList(args)
+
+	fmt.Println("\nHTTP Routes:")
+	routeList(httpRoutes, args)
+
+	fmt.Println("\nTLS Routes:")
+	routeList(tlsRoutes, args)
 }
 
-func clientInfo(db *sql.DB, args []string) {
+func clientRegenKey(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: client-info <client_id>")
+		fmt.Fprintln(os.Stderr, "Usage: client-key <client_id>")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
+	ctx, cancel := call()
+	defer cancel()
+	creds, err := api().SetClientKey(ctx, &pb.SetClientKeyRequest{ClientId: args[0]})
+	check(err)
+
+	fmt.Println("Key regenerated!")
+	fmt.Println()
+	fmt.Printf("AUTH_TOKEN=%s\n", creds.Key)
+	fmt.Println()
+	fmt.Println("⚠️  Update the client configuration with the new key.")
+}
+
+func clientSetKey(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: client-set-key <client_id> <key>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	creds, err := api().SetClientKey(ctx, &pb.SetClientKeyRequest{ClientId: args[0], Key: args[1]})
+	check(err)
+
+	fmt.Println("Key updated!")
+	fmt.Printf("AUTH_TOKEN=%s\n", creds.Key)
+}
+
+// ============= Operator Commands =============
+
+func operatorList() {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListOperators(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-20s %-24s %-8s %-8s %-20s %-19s %-19s\n", "OPERATOR_ID", "NAME", "STATUS", "ROLE", "GROUPS", "CREATED", "LAST_SEEN")
+	fmt.Println(strings.Repeat("-", 124))
 
-	var name, status, created string
-	var lastSeen sql.NullString
+	for _, op := range resp.Operators {
+		groups := strings.Join(op.Groups, ",")
+		if groups == "" || op.Role == database.RoleAdmin {
+			groups = "all"
+		}
 
-	err := db.QueryRow(`
-		SELECT client_name, status, created_at, last_seen_at
-		FROM clients WHERE client_id = ?
-	`, clientID).Scan(&name, &status, &created, &lastSeen)
+		fmt.Printf("%-20s %-24s %-8s %-8s %-20s %-19s %-19s\n", truncate(op.OperatorId, 20), truncate(op.Name, 24), op.Status, op.Role,
+			truncate(groups, 20), op.CreatedAt, orNone(op.LastSeenAt))
+	}
+}
 
-	if err == sql.ErrNoRows {
-		fmt.Fprintln(os.Stderr, "Client not found")
+func operatorAdd(args []string) {
+	flags, args := extractFlags(args, "role", "groups", "password")
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: operator-add <operator_id> <name> [--role viewer|operator|admin] [--groups g1,g2] [--password pass]")
 		os.Exit(1)
 	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+
+	// Sem --password, o servidor gera a chave e a devolve uma única vez
+	req := &pb.CreateOperatorRequest{
+		OperatorId: args[0],
+		Name:       strings.Join(args[1:], " "),
+		Role:       flags["role"],
+		Groups:     database.ParseGroups(flags["groups"]),
+		Password:   flags["password"],
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	creds, err := api().CreateOperator(ctx, req)
+	check(err)
+
+	fmt.Println("Operator added successfully!")
+	fmt.Println()
+	fmt.Println("=== Operator Configuration ===")
+	fmt.Printf("VOIDPROBE_OPERATOR=%s\n", creds.OperatorId)
+	if creds.Key != "" {
+		fmt.Printf("VOIDPROBE_KEY=%s\n", creds.Key)
+		fmt.Println()
+		fmt.Println("⚠️  Save the VOIDPROBE_KEY now! It cannot be recovered.")
+	}
+}
+
+// operatorSet altera papel ou grupos de clientes de um operador
+func operatorSet(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: operator-set <operator_id> role <viewer|operator|admin>")
+		fmt.Fprintln(os.Stderr, "       operator-set <operator_id> groups <g1,g2|all>")
 		os.Exit(1)
 	}
 
-	fmt.Printf("Client ID:   %s\n", clientID)
-	fmt.Printf("Name:        %s\n", name)
-	fmt.Printf("Status:      %s\n", status)
-	fmt.Printf("Created:     %s\n", created)
-	if lastSeen.Valid {
-		fmt.Printf("Last Seen:   %s\n", lastSeen.String)
-	} else {
-		fmt.Printf("Last Seen:   Never\n")
+	ctx, cancel := call()
+	defer cancel()
+
+	value := args[2]
+	var err error
+	switch args[1] {
+	case "role":
+		_, err = api().SetOperatorRole(ctx, &pb.SetOperatorRoleRequest{OperatorId: args[0], Role: value})
+	case "groups":
+		groups := database.ParseGroups(value)
+		value = strings.Join(groups, ",")
+		if value == "" {
+			value = "all"
+		}
+		_, err = api().SetOperatorGroups(ctx, &pb.SetOperatorGroupsRequest{OperatorId: args[0], Groups: groups})
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown option %q (use role or groups)\n", args[1])
+		os.Exit(1)
 	}
+	check(err)
 
-	fmt.Println("\nPorts:")
-	portList(db, args)
+	fmt.Printf("Operator %s %s set to %s\n", args[0], args[1], value)
 }
 
-func clientRegenKey(db *sql.DB, args []string) {
+func operatorRemove(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: client-key <client_id>")
+		fmt.Fprintln(os.Stderr, "Usage: operator-remove <operator_id>")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteOperator(ctx, &pb.OperatorRef{OperatorId: args[0]})
+	check(err)
 
-	key := generateKey()
-	keyHash := hashKey(key)
+	fmt.Printf("Operator %s removed.\n", args[0])
+}
 
-	result, err := db.Exec("UPDATE clients SET key_hash = ? WHERE client_id = ?", keyHash, clientID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+func setOperatorStatus(args []string, status string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: operator-block/operator-unblock <operator_id>")
 		os.Exit(1)
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Client not found")
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetOperatorStatus(ctx, &pb.SetOperatorStatusRequest{OperatorId: args[0], Status: status})
+	check(err)
+
+	fmt.Printf("Operator %s is now %s\n", args[0], status)
+}
+
+func operatorRegenKey(args []string) {
+	var recovery bool
+	var rest []string
+	for _, a := range args {
+		if a == "--recover" {
+			recovery = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	args = rest
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: operator-key <operator_id> [password] [--recover]")
 		os.Exit(1)
 	}
 
+	var password string
+	if len(args) > 1 {
+		password = args[1]
+	}
+
+	var key string
+	if recovery {
+		key = recoverOperatorKey(args[0], password)
+	} else {
+		ctx, cancel := call()
+		defer cancel()
+		creds, err := api().SetOperatorKey(ctx, &pb.SetOperatorKeyRequest{OperatorId: args[0], Password: password})
+		check(err)
+		key = creds.Key
+	}
+
+	if password != "" {
+		fmt.Println("Password changed.")
+		return
+	}
 	fmt.Println("Key regenerated!")
 	fmt.Println()
-	fmt.Printf("AUTH_TOKEN=%s\n", key)
-	fmt.Println()
-	fmt.Println("⚠️  Update the client configuration with the new key.")
+	fmt.Printf("VOIDPROBE_KEY=%s\n", key)
+}
+
+// recoverOperatorKey redefine a chave direto no banco, sem credenciais: é o
+// caminho de quem perdeu a chave do último admin (o acesso ao arquivo do banco
+// já permite isso). O autor é o usuário do sistema (local:<usuário>).
+func recoverOperatorKey(operatorID, password string) string {
+	store = openDB()
+
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	author := "local:" + name
+	fmt.Fprintf(os.Stderr, "Warning: recovering operator %s as %s without credentials\n", operatorID, author)
+
+	key := password
+	if key == "" {
+		key = database.GenerateKey()
+	}
+	if err := store.As(author).SetOperatorKey(operatorID, key); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			fmt.Fprintln(os.Stderr, "Operator not found")
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	action := "key regenerated"
+	if password != "" {
+		action = "password changed"
+	}
+	if err := store.Audit(author, "", fmt.Sprintf("operator %s %s", operatorID, action)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return key
+}
+
+// ============= API Token Commands =============
+
+func tokenList() {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListAPITokens(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-5s %-20s %-20s %-28s %-19s %-19s\n", "ID", "OPERATOR_ID", "NAME", "SCOPES", "CREATED", "LAST_USED")
+	fmt.Println(strings.Repeat("-", 116))
+
+	for _, t := range resp.Tokens {
+		fmt.Printf("%-5d %-20s %-20s %-28s %-19s %-19s\n", t.Id, truncate(t.OperatorId, 20), truncate(t.Name, 20),
+			strings.Join(t.Scopes, ","), t.CreatedAt, orNone(t.LastUsedAt))
+	}
 }
 
-func clientSetKey(db *sql.DB, args []string) {
+func tokenAdd(args []string) {
+	flags, args := extractFlags(args, "scopes")
 	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: client-set-key <client_id> <key>")
+		fmt.Fprintln(os.Stderr, "Usage: token-add <operator_id> <name> [--scopes read,write,control,events|all]")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
-	key := args[1]
-	keyHash := hashKey(key)
+	// Sem --scopes, o servidor emite o token só com leitura
+	var scopes []string
+	if list, ok := flags["scopes"]; ok {
+		scopes = strings.Split(list, ",")
+	}
 
-	result, err := db.Exec("UPDATE clients SET key_hash = ? WHERE client_id = ?", keyHash, clientID)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	ctx, cancel := call()
+	defer cancel()
+	creds, err := api().CreateAPIToken(ctx, &pb.CreateAPITokenRequest{OperatorId: args[0], Name: strings.Join(args[1:], " "), Scopes: scopes})
+	check(err)
+
+	fmt.Printf("Token added for %s (scopes: %s)\n", args[0], strings.Join(creds.Scopes, ","))
+	fmt.Println()
+	fmt.Printf("VOIDPROBE_TOKEN=%s\n", creds.Token)
+	fmt.Println()
+	fmt.Println("⚠️  Save the VOIDPROBE_TOKEN now! It cannot be recovered.")
+}
+
+func tokenRevoke(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: token-revoke <token_id>")
 		os.Exit(1)
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Client not found")
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteAPIToken(ctx, &pb.APITokenRef{TokenId: idArg(args[0], "token")})
+	check(err)
+
+	fmt.Println("Token revoked.")
+}
+
+// ============= Audit Commands =============
+
+// limitFlag lê --limit N (0 = padrão do servidor)
+func limitFlag(flags map[string]string, usage string) int32 {
+	v, ok := flags["limit"]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: "+usage)
 		os.Exit(1)
 	}
+	return int32(n)
+}
 
-	fmt.Println("Key updated!")
-	fmt.Printf("AUTH_TOKEN=%s\n", key)
+func auditList(args []string) {
+	flags, args := extractFlags(args, "limit")
+	req := &pb.ListAuditRequest{Limit: limitFlag(flags, "audit [client_id] [--limit N]")}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListAudit(ctx, req)
+	check(err)
+
+	fmt.Printf("%-19s %-20s %-20s %s\n", "TIME", "OPERATOR", "CLIENT", "ACTION")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, e := range resp.Entries {
+		fmt.Printf("%-19s %-20s %-20s %s\n", e.Time, truncate(e.OperatorId, 20), truncate(orNone(e.ClientId), 20), e.Action)
+	}
 }
 
 // ============= Port Commands =============
 
-func portList(db *sql.DB, args []string) {
-	var rows *sql.Rows
-	var err error
-
+func portList(args []string) {
+	req := &pb.ListPortsRequest{}
 	if len(args) > 0 {
-		rows, err = db.Query(`
-			SELECT id, client_id, exposed_port, target_host, target_port, enabled
-			FROM client_ports WHERE client_id = ? ORDER BY exposed_port
-		`, args[0])
-	} else {
-		rows, err = db.Query(`
-			SELECT id, client_id, exposed_port, target_host, target_port, enabled
-			FROM client_ports ORDER BY client_id, exposed_port
-		`)
+		// Com "=" ou "!" o argumento é um seletor, ex: env=prod
+		if strings.ContainsAny(args[0], "=!") {
+			req.Selector = strings.Join(args, ",")
+		} else {
+			req.ClientId = args[0]
+		}
 	}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListPorts(ctx, req)
+	check(err)
+
+	fmt.Printf("%-5s %-36s %-12s %-30s %-22s %-26s %-8s %-14s %-8s\n", "ID", "CLIENT_ID", "SERVER_PORT", "TARGET", "OPTIONS", "WINDOW", "HEALTH", "STATE", "ENABLED")
+	fmt.Println(strings.Repeat("-", 169))
+
+	for _, p := range resp.Ports {
+		enabledStr := "✓"
+		if !p.Enabled {
+			enabledStr = "✗"
+		}
+
+		target := formatTarget(p.TargetHost, int(p.TargetPort))
+		if p.Mode == "socks5" {
+			target = "socks5 (user " + p.AuthUser + ")"
+		}
+
+		var options []string
+		if p.Template != "" {
+			options = append(options, "template:"+p.Template)
+		}
+		if p.ProxyProtocol != "" {
+			options = append(options, "proxy:"+p.ProxyProtocol)
+		}
+		if p.AcceptProxy {
+			options = append(options, "accept-proxy")
+		}
+		if p.HealthCheck != "tcp" && p.HealthCheck != "off" {
+			options = append(options, "check:"+p.HealthCheck)
+		}
+		if p.RefuseUnhealthy {
+			options = append(options, "refuse-down")
+		}
+		health := p.Health
+		if p.Mode == "socks5" || p.HealthCheck == "off" {
+			health = "-"
+		}
+		optionsStr := strings.Join(options, ",")
+		if optionsStr == "" {
+			optionsStr = "-"
+		}
+
+		fmt.Printf("%-5d %-36s %-12d %-30s %-22s %-26s %-8s %-14s %-8s\n", p.Id, p.ClientId, p.ExposedPort, target, truncate(optionsStr, 22),
+			truncate(formatWindow(p.ExpiresAt, p.Schedule), 26), health, p.State, enabledStr)
+		if p.State == "bind_error" {
+			fmt.Printf("      ! %s\n", p.StateDetail)
+		}
+	}
+}
+
+func portAdd(args []string) {
+	flags, args := extractFlags(args, "ttl", "schedule")
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: port-add <client_id> <exposed_port|auto> <target_port|unix:///path> [target_host] [--ttl 4h] [--schedule \"mon-fri 08:00-18:00\"]")
+		fmt.Fprintln(os.Stderr, "       port-add <client_id> <exposed_port|auto> socks5 <username> [password] [--ttl 4h] [--schedule ...]")
+		os.Exit(1)
+	}
+
+	req := &pb.CreatePortRequest{ClientId: args[0], Ttl: flags["ttl"], Schedule: flags["schedule"]}
+
+	// "auto" (porta 0): o servidor escolhe porta livre no pool do grupo do cliente
+	if args[1] != "auto" {
+		port, err := strconv.Atoi(args[1])
+		if err != nil || port < 1 || port > 65535 {
+			fmt.Fprintf(os.Stderr, "Error: invalid server port %q\n", args[1])
+			os.Exit(1)
+		}
+		req.ExposedPort = int32(port)
+	}
+
+	switch {
+	case args[2] == "socks5":
+		// Destino escolhido pelo admin a cada CONNECT
+		if len(args) < 4 {
+			fmt.Fprintln(os.Stderr, "Usage: port-add <client_id> <exposed_port> socks5 <username> [password]")
+			os.Exit(1)
+		}
+		req.Mode = "socks5"
+		req.AuthUser = args[3]
+		if len(args) > 4 {
+			req.Password = args[4]
+		}
+	case strings.HasPrefix(args[2], unixPrefix):
+		// Destino unix:///caminho (socket no cliente)
+		req.TargetHost = args[2]
+	default:
+		port, err := strconv.Atoi(args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid target port %q\n", args[2])
+			os.Exit(1)
+		}
+		req.TargetPort = int32(port)
+		if len(args) > 3 {
+			req.TargetHost = args[3]
+		}
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().CreatePort(ctx, req)
+	check(err)
+
+	p := resp.Port
+	if req.ExposedPort == 0 {
+		fmt.Printf("Allocated server port %d\n", p.ExposedPort)
+	}
+
+	if p.Mode == "socks5" {
+		fmt.Printf("SOCKS5 port added: server:%d -> %s (dynamic targets)\n", p.ExposedPort, p.ClientId)
+		printWindow(p)
+		fmt.Println()
+		fmt.Printf("SOCKS5_USER=%s\n", p.AuthUser)
+		if resp.Password != "" {
+			fmt.Printf("SOCKS5_PASSWORD=%s\n", resp.Password)
+			fmt.Println()
+			fmt.Println("⚠️  Save the SOCKS5_PASSWORD now! It cannot be recovered.")
+		}
+		fmt.Println("ℹ️  The client only connects to destinations listed in its ALLOWED_TARGETS.")
 		return
 	}
-	defer rows.Close()
 
-	fmt.Printf("%-5s %-36s %-12s %-25s %-8s\n", "ID", "CLIENT_ID", "SERVER_PORT", "TARGET", "ENABLED")
-	fmt.Println(strings.Repeat("-", 90))
+	fmt.Printf("Port added: server:%d -> %s\n", p.ExposedPort, formatTarget(p.TargetHost, int(p.TargetPort)))
+	printWindow(p)
+}
+
+// printWindow informa validade e janela de um mapeamento recém-criado
+func printWindow(p *pb.PortInfo) {
+	if p.ExpiresAt != "" {
+		fmt.Printf("Expires at: %s UTC (closed automatically)\n", p.ExpiresAt)
+	}
+	if p.Schedule != "" {
+		fmt.Printf("Schedule: %s (server local time)\n", p.Schedule)
+	}
+}
+
+// portSet altera opções de um mapeamento (aplicadas pelo servidor na hora)
+func portSet(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: port-set <port_id> proxy-protocol <v1|v2|off>")
+		fmt.Fprintln(os.Stderr, "       port-set <port_id> accept-proxy <on|off>")
+		fmt.Fprintln(os.Stderr, "       port-set <port_id> ttl <duration|off>")
+		fmt.Fprintln(os.Stderr, "       port-set <port_id> schedule <\"days HH:MM-HH:MM\"|off>")
+		fmt.Fprintln(os.Stderr, "       port-set <port_id> health-check <off|tcp|tls|http[:/path]>")
+		fmt.Fprintln(os.Stderr, "       port-set <port_id> refuse-unhealthy <on|off>")
+		os.Exit(1)
+	}
+
+	id, option, value := portID(args[0]), args[1], args[2]
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetPortOption(ctx, &pb.SetPortOptionRequest{PortId: id, Option: option, Value: value})
+	check(err)
+
+	fmt.Printf("Port %d: %s set to %s\n", id, option, value)
+}
+
+func portRemove(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: port-remove <port_id>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeletePort(ctx, &pb.PortRef{PortId: portID(args[0])})
+	check(err)
+
+	fmt.Println("Port removed.")
+}
+
+func setPortEnabled(args []string, enabled bool) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: port-enable/port-disable <port_id>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetPortEnabled(ctx, &pb.SetPortEnabledRequest{PortId: portID(args[0]), Enabled: enabled})
+	check(err)
+
+	status := "enabled"
+	if !enabled {
+		status = "disabled"
+	}
+	fmt.Printf("Port %s\n", status)
+}
+
+// portID converte o ID informado na linha de comando
+func portID(arg string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid port ID %q\n", arg)
+		os.Exit(1)
+	}
+	return id
+}
+
+// ============= Local-Forward Commands =============
+
+func forwardList(args []string) {
+	req := &pb.ListForwardsRequest{}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
 
-	for rows.Next() {
-		var id, exposedPort, targetPort int
-		var clientID, targetHost string
-		var enabled int
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListForwards(ctx, req)
+	check(err)
 
-		rows.Scan(&id, &clientID, &exposedPort, &targetHost, &targetPort, &enabled)
+	fmt.Printf("%-5s %-36s %-21s %-30s %-20s %-8s\n", "ID", "CLIENT_ID", "CLIENT_LISTEN", "TARGET", "VIA", "ENABLED")
+	fmt.Println(strings.Repeat("-", 125))
 
+	for _, f := range resp.Forwards {
 		enabledStr := "✓"
-		if enabled == 0 {
+		if !f.Enabled {
 			enabledStr = "✗"
 		}
+		via := f.Via
+		if via == "" {
+			via = "(server)"
+		}
 
-		fmt.Printf("%-5d %-36s %-12d %-25s %-8s\n", id, clientID, exposedPort, fmt.Sprintf("%s:%d", targetHost, targetPort), enabledStr)
+		fmt.Printf("%-5d %-36s %-21s %-30s %-20s %-8s\n", f.Id, f.ClientId, net.JoinHostPort(f.ListenHost, strconv.Itoa(int(f.ListenPort))),
+			net.JoinHostPort(f.TargetHost, strconv.Itoa(int(f.TargetPort))), truncate(via, 20), enabledStr)
 	}
 }
 
-func portAdd(db *sql.DB, args []string) {
+func forwardAdd(args []string) {
+	flags, args := extractFlags(args, "via")
 	if len(args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: port-add <client_id> <exposed_port> <target_port> [target_host]")
+		fmt.Fprintln(os.Stderr, "Usage: forward-add <client_id> <listen_port> <target_host:target_port> [listen_host] [--via <client_id>]")
 		os.Exit(1)
 	}
 
-	clientID := args[0]
-	exposedPort := args[1]
-	targetPort := args[2]
-	targetHost := "127.0.0.1"
+	req := &pb.ForwardInfo{ClientId: args[0], Via: flags["via"]}
 	if len(args) > 3 {
-		targetHost = args[3]
+		req.ListenHost = args[3]
 	}
 
-	_, err := db.Exec(`
-		INSERT INTO client_ports (client_id, exposed_port, target_host, target_port)
-		VALUES (?, ?, ?, ?)
-	`, clientID, exposedPort, targetHost, targetPort)
-
+	port, err := strconv.Atoi(args[1])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error adding port: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: invalid listen port %q\n", args[1])
 		os.Exit(1)
 	}
+	req.ListenPort = int32(port)
+	targetHost, targetPort, err := net.SplitHostPort(args[2])
+	if err == nil {
+		req.TargetHost = targetHost
+		port, err = strconv.Atoi(targetPort)
+		req.TargetPort = int32(port)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid target %q (expected host:port)\n", args[2])
+		os.Exit(1)
+	}
+
+	// Destino na rede de outro cliente: o par precisa estar autorizado
+	ctx, cancel := call()
+	defer cancel()
+	f, err := api().CreateForward(ctx, req)
+	check(err)
 
-	fmt.Printf("Port added: server:%s -> %s:%s\n", exposedPort, targetHost, targetPort)
+	listen := net.JoinHostPort(f.ListenHost, strconv.Itoa(int(f.ListenPort)))
+	if f.Via != "" {
+		fmt.Printf("Forward added: client:%s -> %s:%s\n", listen, f.Via, args[2])
+		return
+	}
+	fmt.Printf("Forward added: client:%s -> %s\n", listen, args[2])
 }
 
-func portRemove(db *sql.DB, args []string) {
+func forwardRemove(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: port-remove <port_id>")
+		fmt.Fprintln(os.Stderr, "Usage: forward-remove <forward_id>")
 		os.Exit(1)
 	}
 
-	result, err := db.Exec("DELETE FROM client_ports WHERE id = ?", args[0])
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteForward(ctx, &pb.ForwardRef{ForwardId: idArg(args[0], "forward")})
+	check(err)
+
+	fmt.Println("Forward removed.")
+}
+
+func setForwardEnabled(args []string, enabled bool) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: forward-enable/forward-disable <forward_id>")
 		os.Exit(1)
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Port not found")
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetForwardEnabled(ctx, &pb.SetForwardEnabledRequest{ForwardId: idArg(args[0], "forward"), Enabled: enabled})
+	check(err)
+
+	status := "enabled"
+	if !enabled {
+		status = "disabled"
+	}
+	fmt.Printf("Forward %s\n", status)
+}
+
+// ============= Client Link Commands =============
+
+func linkList() {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListLinks(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-36s %-36s %-9s %-20s\n", "FROM", "TO", "FORWARDS", "CREATED")
+	fmt.Println(strings.Repeat("-", 104))
+
+	for _, l := range resp.Links {
+		fmt.Printf("%-36s %-36s %-9d %-20s\n", l.From, l.To, l.Forwards, l.CreatedAt)
+	}
+}
+
+func linkAllow(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: link-allow <from_client_id> <to_client_id>")
 		os.Exit(1)
 	}
 
-	fmt.Println("Port removed.")
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().CreateLink(ctx, &pb.LinkRef{From: args[0], To: args[1]})
+	check(err)
+
+	fmt.Printf("Link allowed: %s -> %s\n", args[0], args[1])
+}
+
+func linkRevoke(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: link-revoke <from_client_id> <to_client_id>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteLink(ctx, &pb.LinkRef{From: args[0], To: args[1]})
+	check(err)
+
+	fmt.Println("Link revoked. Forwards using it stop relaying (remove them with forward-remove).")
+}
+
+// ============= Service Commands =============
+
+func serviceList(args []string) {
+	req := &pb.ListServicesRequest{}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListServices(ctx, req)
+	check(err)
+
+	fmt.Printf("%-36s %-20s %-30s %-9s %-12s %-19s\n", "CLIENT_ID", "NAME", "TARGET", "STATUS", "SERVER_PORT", "OFFERED")
+	fmt.Println(strings.Repeat("-", 131))
+
+	for _, s := range resp.Services {
+		status, port := "pending", "-"
+		if s.ExposedPort != 0 {
+			status, port = "approved", strconv.Itoa(int(s.ExposedPort))
+		}
+
+		fmt.Printf("%-36s %-20s %-30s %-9s %-12s %-19s\n", s.ClientId, truncate(s.Name, 20),
+			truncate(formatTarget(s.TargetHost, int(s.TargetPort)), 30), status, port, s.OfferedAt)
+	}
 }
 
-func portEnable(db *sql.DB, args []string) {
-	setPortEnabled(db, args, 1)
+func serviceApprove(args []string) {
+	flags, args := extractFlags(args, "port")
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: service-approve <client_id> <name> [--port N]")
+		os.Exit(1)
+	}
+	req := &pb.ApproveServiceRequest{ClientId: args[0], Name: args[1]}
+
+	// Sem --port, a primeira livre no pool do grupo do cliente
+	if v, ok := flags["port"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			fmt.Fprintf(os.Stderr, "Error: invalid port %q\n", v)
+			os.Exit(1)
+		}
+		req.ExposedPort = int32(n)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	p, err := api().ApproveService(ctx, req)
+	check(err)
+
+	fmt.Printf("Service %s approved: server:%d -> %s\n", req.Name, p.ExposedPort, formatTarget(p.TargetHost, int(p.TargetPort)))
 }
 
-func portDisable(db *sql.DB, args []string) {
-	setPortEnabled(db, args, 0)
+func serviceRevoke(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: service-revoke <client_id> <name>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().RevokeService(ctx, &pb.ServiceRef{ClientId: args[0], Name: args[1]})
+	check(err)
+
+	fmt.Printf("Service %s revoked (pending again).\n", args[1])
 }
 
-func setPortEnabled(db *sql.DB, args []string, enabled int) {
+// ============= Port Pool Commands =============
+
+func poolList() {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListPools(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-5s %-20s %-13s %-10s\n", "ID", "GROUP", "RANGE", "USED")
+	fmt.Println(strings.Repeat("-", 51))
+
+	for _, p := range resp.Pools {
+		group := p.Group
+		if group == "" {
+			group = "(default)"
+		}
+
+		fmt.Printf("%-5d %-20s %-13s %-10s\n", p.Id, truncate(group, 20), fmt.Sprintf("%d-%d", p.Start, p.End),
+			fmt.Sprintf("%d/%d", p.Used, p.End-p.Start+1))
+	}
+}
+
+func poolAdd(args []string) {
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: port-enable/port-disable <port_id>")
+		fmt.Fprintln(os.Stderr, "Usage: pool-add <start-end> [group]")
 		os.Exit(1)
 	}
 
-	result, err := db.Exec("UPDATE client_ports SET enabled = ? WHERE id = ?", enabled, args[0])
+	var group string
+	if len(args) > 1 {
+		group = args[1]
+	}
+	start, end, err := declarative.ParseRange(args[0])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected == 0 {
-		fmt.Fprintln(os.Stderr, "Port not found")
-		os.Exit(1)
+	ctx, cancel := call()
+	defer cancel()
+	_, err = api().CreatePool(ctx, &pb.CreatePoolRequest{Group: group, Start: int32(start), End: int32(end)})
+	check(err)
+
+	if group == "" {
+		fmt.Printf("Pool added: %d-%d (default)\n", start, end)
+	} else {
+		fmt.Printf("Pool added: %d-%d (group %s)\n", start, end, group)
 	}
+}
 
-	status := "enabled"
-	if enabled == 0 {
-		status = "disabled"
+func poolRemove(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pool-remove <pool_id>")
+		os.Exit(1)
 	}
-	fmt.Printf("Port %s\n", status)
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeletePool(ctx, &pb.PoolRef{PoolId: idArg(args[0], "pool")})
+	check(err)
+
+	fmt.Println("Pool removed. Existing ports are kept.")
 }
 
-// ============= Helpers =============
+// ============= Cluster Commands =============
 
-func generateKey() string {
-	b := make([]byte, 32)
-	f, _ := os.Open("/dev/urandom")
-	defer f.Close()
-	f.Read(b)
-	return hex.EncodeToString(b)
+func nodeList(args []string) {
+	if len(args) > 0 {
+		nodeClients(args[0])
+		return
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListNodes(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-24s %-28s %-6s %-19s %-19s %-7s\n", "NODE", "ADDRESS", "STATUS", "STARTED", "LAST_SEEN", "CLIENTS")
+	fmt.Println(strings.Repeat("-", 108))
+
+	for _, n := range resp.Nodes {
+		status := "up"
+		if !n.Alive {
+			status = "down"
+		}
+		fmt.Printf("%-24s %-28s %-6s %-19s %-19s %-7d\n", truncate(n.NodeId, 24), truncate(n.Address, 28), status,
+			n.StartedAt, n.LastSeenAt, n.Clients)
+	}
 }
 
-func hashKey(key string) string {
-	h := sha256.Sum256([]byte(key))
-	return hex.EncodeToString(h[:])
+// nodeClients lista os clientes conectados a um nó
+func nodeClients(nodeID string) {
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListNodeClients(ctx, &pb.NodeRef{NodeId: nodeID})
+	check(err)
+
+	fmt.Printf("%-36s %-19s\n", "CLIENT_ID", "CONNECTED")
+	fmt.Println(strings.Repeat("-", 56))
+
+	for _, cn := range resp.Clients {
+		fmt.Printf("%-36s %-19s\n", cn.ClientId, cn.AttachedAt)
+	}
 }
 
-func truncate(s string, max int) string {
-	if len(s) > max {
-		return s[:max-3] + "..."
+func nodeRemove(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: node-remove <node_id>")
+		os.Exit(1)
 	}
-	return s
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteNode(ctx, &pb.NodeRef{NodeId: args[0]})
+	check(err)
+
+	fmt.Println("Node removed. A running node registers itself again on its next heartbeat.")
 }
 
-// ============= Control Commands =============
+// ============= Route Commands (HTTP / TLS) =============
 
-const socketPath = "/tmp/voidprobe.sock"
+// routeKind descreve uma tabela de rotas por hostname
+type routeKind struct {
+	command string // prefixo dos comandos (mensagens de uso)
+	scheme  string // tipo na API (http|tls), exibido em "Route added"
+}
 
-func sendControl(cmd string, args []string) {
-	conn, err := net.Dial("unix", socketPath)
+var (
+	httpRoutes = routeKind{command: "route", scheme: "http"}
+	tlsRoutes  = routeKind{command: "tls-route", scheme: "tls"}
+)
+
+func routeList(kind routeKind, args []string) {
+	req := &pb.ListRoutesRequest{Kind: kind.scheme}
+	if len(args) > 0 {
+		req.ClientId = args[0]
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListRoutes(ctx, req)
+	check(err)
+
+	fmt.Printf("%-5s %-32s %-36s %-21s %-8s\n", "ID", "HOSTNAME", "CLIENT_ID", "TARGET", "ENABLED")
+	fmt.Println(strings.Repeat("-", 106))
+
+	for _, r := range resp.Routes {
+		enabledStr := "✓"
+		if !r.Enabled {
+			enabledStr = "✗"
+		}
+		hostname := r.Hostname
+		if hostname == database.DefaultRoute {
+			hostname = "* (default)"
+		}
+
+		fmt.Printf("%-5d %-32s %-36s %-21s %-8s\n", r.Id, truncate(hostname, 32), r.ClientId,
+			net.JoinHostPort(r.TargetHost, strconv.Itoa(int(r.TargetPort))), enabledStr)
+	}
+}
+
+func routeAdd(kind routeKind, args []string) {
+	if len(args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s-add <hostname> <client_id> <target_port> [target_host]\n", kind.command)
+		os.Exit(1)
+	}
+
+	// Hostname normalizado e validado pelo servidor
+	req := &pb.RouteInfo{Kind: kind.scheme, Hostname: args[0], ClientId: args[1]}
+	if len(args) > 3 {
+		req.TargetHost = args[3]
+	}
+	port, err := strconv.Atoi(args[2])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Server control socket not available\n")
-		fmt.Fprintf(os.Stderr, "Make sure the server is running\n")
+		fmt.Fprintf(os.Stderr, "Error: invalid target port %q\n", args[2])
 		os.Exit(1)
 	}
-	defer conn.Close()
+	req.TargetPort = int32(port)
 
-	// Envia comando
-	message := cmd
-	if len(args) > 0 {
-		message += " " + args[0]
+	ctx, cancel := call()
+	defer cancel()
+	r, err := api().CreateRoute(ctx, req)
+	check(err)
+
+	fmt.Printf("Route added: %s://%s -> %s (%s)\n", kind.scheme, r.Hostname, net.JoinHostPort(r.TargetHost, strconv.Itoa(int(r.TargetPort))), r.ClientId)
+}
+
+func routeRemove(kind routeKind, args []string) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s-remove <route_id>\n", kind.command)
+		os.Exit(1)
 	}
-	message += "\n"
 
-	conn.Write([]byte(message))
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().DeleteRoute(ctx, &pb.RouteRef{Kind: kind.scheme, RouteId: idArg(args[0], "route")})
+	check(err)
 
-	// Lê resposta
-	buf := make([]byte, 4096)
-	n, _ := conn.Read(buf)
-	response := string(buf[:n])
+	fmt.Println("Route removed.")
+}
 
-	// Exibe resposta
-	lines := strings.Split(strings.TrimSpace(response), "\n")
-	for _, line := range lines {
-		if line == "OK" {
-			if cmd == "RELOAD" {
-				fmt.Println("Ports reloaded successfully")
-			} else if cmd == "KICK" {
-				fmt.Println("Client disconnected")
+func setRouteEnabled(kind routeKind, args []string, enabled bool) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s-enable/%s-disable <route_id>\n", kind.command, kind.command)
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	_, err := api().SetRouteEnabled(ctx, &pb.SetRouteEnabledRequest{Kind: kind.scheme, RouteId: idArg(args[0], "route"), Enabled: enabled})
+	check(err)
+
+	status := "enabled"
+	if !enabled {
+		status = "disabled"
+	}
+	fmt.Printf("Route %s\n", status)
+}
+
+// ============= Helpers =============
+
+// idArg converte o ID numérico de um registro (token, pool, forward, rota)
+func idArg(arg, what string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid %s id %q\n", what, arg)
+		os.Exit(1)
+	}
+	return id
+}
+
+// orNone exibe valores vazios como "-"
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+const unixPrefix = "unix://"
+
+// formatTarget exibe o destino como host:porta ou unix:///caminho
+func formatTarget(host string, port int) string {
+	if strings.HasPrefix(host, unixPrefix) {
+		return host
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// timeLayout é o formato de data/hora gravado no banco (UTC, igual a datetime('now'))
+const timeLayout = "2006-01-02 15:04:05"
+
+// formatWindow resume validade e janela de horário para listagens
+func formatWindow(expiresAt, sched string) string {
+	var parts []string
+	if expiresAt != "" {
+		t, err := time.ParseInLocation(timeLayout, expiresAt, time.UTC)
+		if err == nil && !time.Now().Before(t) {
+			parts = append(parts, "expired")
+		} else if err == nil {
+			parts = append(parts, "until "+t.Local().Format("01-02 15:04"))
+		}
+	}
+	if sched != "" {
+		parts = append(parts, sched)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// extractFlags separa opções "--nome valor" ou "--nome=valor" dos argumentos posicionais
+func extractFlags(args []string, names ...string) (map[string]string, []string) {
+	flags := make(map[string]string)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		known := false
+		for _, n := range names {
+			if strings.HasPrefix(args[i], "--") && name == n {
+				known = true
 			}
-		} else if strings.HasPrefix(line, "ERROR:") {
-			fmt.Fprintln(os.Stderr, line)
-			os.Exit(1)
-		} else if line != "" {
-			fmt.Println(line)
 		}
+		if !known {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: --%s requires a value\n", name)
+				os.Exit(1)
+			}
+			i++
+			value = args[i]
+		}
+		flags[name] = value
 	}
+	return flags, rest
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max-3] + "..."
+	}
+	return s
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ============= Database Commands =============
+
+func migrate(args []string) {
+	store = openDB()
+
+	if len(args) > 0 && args[0] == "status" {
+		migrateStatus()
+		return
+	}
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: migrate [status]")
+		os.Exit(1)
+	}
+
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		fmt.Printf("Database is up to date (version %d).\n", store.LatestVersion())
+		return
+	}
+	fmt.Printf("Database migrated to version %d.\n", store.LatestVersion())
+}
+
+func migrateStatus() {
+	list, current, err := store.MigrationStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-8s %-30s %s\n", "VERSION", "NAME", "APPLIED")
+	fmt.Println(strings.Repeat("-", 60))
+
+	pending := 0
+	for _, m := range list {
+		at := m.AppliedAt
+		if at == "" {
+			at = "pending"
+			pending++
+		}
+		fmt.Printf("%-8s %-30s %s\n", fmt.Sprintf("%04d", m.Version), truncate(m.Name, 30), at)
+	}
+
+	latest := store.LatestVersion()
+	switch {
+	case current > latest:
+		fmt.Printf("\nDatabase is at version %d, newer than this binary (%d): upgrade voidprobe.\n", current, latest)
+	case pending > 0:
+		fmt.Printf("\n%d pending migration(s): run voidprobe-cli migrate.\n", pending)
+	default:
+		fmt.Printf("\nDatabase is up to date (version %d).\n", current)
+	}
+}
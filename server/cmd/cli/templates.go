@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Port Template Commands =============
+
+func templateList(args []string) {
+	if len(args) > 0 {
+		templateInfo(args[0])
+		return
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().ListTemplates(ctx, &emptypb.Empty{})
+	check(err)
+
+	fmt.Printf("%-20s %-13s %-36s %-30s %-6s\n", "NAME", "ALLOCATION", "TARGETS", "ATTACHED TO", "PORTS")
+	fmt.Println(strings.Repeat("-", 109))
+
+	for _, t := range resp.Templates {
+		fmt.Printf("%-20s %-13s %-36s %-30s %-6d\n", truncate(t.Name, 20), t.Allocation, truncate(templateTargets(t), 36),
+			truncate(templateAttachments(t), 30), t.Mapped)
+	}
+}
+
+func templateInfo(name string) {
+	ctx, cancel := call()
+	defer cancel()
+	t, err := api().GetTemplate(ctx, &pb.TemplateRef{Name: name})
+	check(err)
+
+	fmt.Printf("Template:    %s\n", t.Name)
+	fmt.Printf("Allocation:  %s\n", t.Allocation)
+	fmt.Printf("Targets:     %s\n", templateTargets(t))
+	fmt.Printf("Attached to: %s\n", templateAttachments(t))
+	fmt.Printf("Created:     %s\n", t.CreatedAt)
+
+	resp, err := api().ListPorts(ctx, &pb.ListPortsRequest{})
+	check(err)
+	fmt.Printf("\nPorts (%d):\n", t.Mapped)
+	for _, p := range resp.Ports {
+		if p.Template == t.Name {
+			fmt.Printf("  %-5d %-36s server:%-6d -> %-30s %s\n", p.Id, p.ClientId, p.ExposedPort,
+				formatTarget(p.TargetHost, int(p.TargetPort)), p.State)
+		}
+	}
+}
+
+// templateTargets exibe os destinos do modelo separados por vírgula
+func templateTargets(t *pb.TemplateInfo) string {
+	var targets []string
+	for _, p := range t.Targets {
+		targets = append(targets, formatTarget(p.TargetHost, int(p.TargetPort)))
+	}
+	return orNone(strings.Join(targets, ","))
+}
+
+// templateAttachments exibe as ligações como "group:lisbon,client:srv-01"
+func templateAttachments(t *pb.TemplateInfo) string {
+	var attached []string
+	for _, a := range t.Attachments {
+		attached = append(attached, a.Kind+":"+a.Name)
+	}
+	return orNone(strings.Join(attached, ","))
+}
+
+// templatePorts converte os destinos da linha de comando
+func templatePorts(args []string) []*pb.PortTarget {
+	var targets []*pb.PortTarget
+	for _, arg := range args {
+		target, err := parsePortTarget(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, &pb.PortTarget{TargetHost: target.host, TargetPort: int32(target.port)})
+	}
+	return targets
+}
+
+// printSynced exibe os mapeamentos criados e removidos pelo servidor (que já
+// os auditou; as sessões conectadas recarregam as portas sozinhas)
+func printSynced(synced []*pb.TemplateSync) {
+	if len(synced) == 0 {
+		fmt.Println("No ports changed.")
+		return
+	}
+	fmt.Printf("\nPorts changed (%d):\n", len(synced))
+	for _, s := range synced {
+		fmt.Printf("  %s\n", templateSync(s))
+	}
+}
+
+// templateSync converte para o formato de exibição de database.TemplateSync
+func templateSync(s *pb.TemplateSync) database.TemplateSync {
+	return database.TemplateSync{
+		Template:    s.Template,
+		ClientID:    s.ClientId,
+		ExposedPort: int(s.ExposedPort),
+		Target:      s.Target,
+		Removed:     s.Removed,
+	}
+}
+
+func templateAdd(args []string) {
+	flags, args := extractFlags(args, "alloc")
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: template-add <name> [target...] [--alloc pool|start-end]")
+		os.Exit(1)
+	}
+
+	req := &pb.CreateTemplateRequest{Name: args[0], Allocation: database.AllocationPool, Targets: templatePorts(args[1:])}
+	if v, ok := flags["alloc"]; ok {
+		req.Allocation = v
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().CreateTemplate(ctx, req)
+	check(err)
+
+	fmt.Printf("Template %s added (allocation %s).\n", req.Name, req.Allocation)
+	printSynced(resp.Synced)
+}
+
+func templateSet(args []string) {
+	if len(args) < 3 || (args[1] != "add" && args[1] != "remove" && args[1] != "alloc") {
+		fmt.Fprintln(os.Stderr, "Usage: template-set <name> add|remove <target>...")
+		fmt.Fprintln(os.Stderr, "       template-set <name> alloc <pool|start-end>")
+		os.Exit(1)
+	}
+
+	name, action := args[0], args[1]
+
+	ctx, cancel := call()
+	defer cancel()
+	var resp *pb.TemplateSyncResponse
+	var err error
+	switch action {
+	case "alloc":
+		resp, err = api().SetTemplateAllocation(ctx, &pb.SetTemplateAllocationRequest{Name: name, Allocation: args[2]})
+	case "add":
+		resp, err = api().AddTemplateTargets(ctx, &pb.TemplateTargetsRequest{Name: name, Targets: templatePorts(args[2:])})
+	case "remove":
+		resp, err = api().RemoveTemplateTargets(ctx, &pb.TemplateTargetsRequest{Name: name, Targets: templatePorts(args[2:])})
+	}
+	check(err)
+
+	if action == "alloc" {
+		fmt.Printf("Template %s allocation set to %s (existing ports are kept).\n", name, args[2])
+	} else {
+		fmt.Printf("Template %s updated.\n", name)
+	}
+	printSynced(resp.Synced)
+}
+
+func templateRemove(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: template-remove <name>")
+		os.Exit(1)
+	}
+
+	ctx, cancel := call()
+	defer cancel()
+	resp, err := api().DeleteTemplate(ctx, &pb.TemplateRef{Name: args[0]})
+	check(err)
+
+	fmt.Printf("Template %s removed.\n", args[0])
+	printSynced(resp.Synced)
+}
+
+func templateAttach(args []string, attach bool) {
+	if len(args) < 3 || (args[1] != database.AttachClient && args[1] != database.AttachGroup) {
+		if attach {
+			fmt.Fprintln(os.Stderr, "Usage: template-attach <name> client|group <client_id|group>")
+		} else {
+			fmt.Fprintln(os.Stderr, "Usage: template-detach <name> client|group <client_id|group>")
+		}
+		os.Exit(1)
+	}
+
+	req := &pb.TemplateAttachmentRequest{Name: args[0], Attachment: &pb.TemplateAttachment{Kind: args[1], Name: args[2]}}
+
+	ctx, cancel := call()
+	defer cancel()
+	var resp *pb.TemplateSyncResponse
+	var err error
+	if attach {
+		resp, err = api().AttachTemplate(ctx, req)
+	} else {
+		resp, err = api().DetachTemplate(ctx, req)
+	}
+	check(err)
+
+	if attach {
+		fmt.Printf("Template %s attached to %s %s.\n", req.Name, args[1], args[2])
+	} else {
+		fmt.Printf("Template %s detached from %s %s.\n", req.Name, args[1], args[2])
+	}
+	printSynced(resp.Synced)
+}
@@ -12,8 +12,10 @@ import (
 
 	"github.com/hashicorp/yamux"
 	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/admin"
 	"github.com/voidprobe/server/internal/config"
 	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/router"
 	"github.com/voidprobe/server/internal/session"
 	"github.com/voidprobe/server/internal/transport"
 	"google.golang.org/grpc"
@@ -21,14 +23,17 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
-// sessionManager global para acesso do controller
+// shutdownTimeout limita a espera pelo fim das conexões ao encerrar
+const shutdownTimeout = 10 * time.Second
+
+// sessionManager global para acesso dos handlers gRPC
 var sessionManager *session.Manager
 
 // server implementa o serviço gRPC
 type server struct {
 	pb.UnimplementedRemoteTunnelServer
 	config *config.ServerConfig
-	repo   *database.Repository
+	repo   database.Store
 }
 
 func main() {
@@ -43,25 +48,75 @@ func main() {
 
 	// Inicializa banco de dados
 	dbCfg := database.DefaultConfig()
-	if err := database.Init(dbCfg); err != nil {
+	repo, err := database.Init(dbCfg)
+	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer database.Close()
+	defer repo.Close()
 
-	repo := database.NewRepository()
+	// Estados da execução anterior não valem mais: todos começam offline. No
+	// cluster, só os clientes que estavam neste nó; os demais seguem nos outros
+	if cfg.ClusterAddress == "" {
+		if err := repo.ResetPortStates(); err != nil {
+			log.Printf("Warning: Failed to reset port states: %v", err)
+		}
+	} else {
+		if cfg.ClusterToken == "" {
+			log.Fatal("CLUSTER_TOKEN is required with CLUSTER_ADDRESS")
+		}
+		if err := repo.StartNode(cfg.NodeID, cfg.ClusterAdvertise); err != nil {
+			log.Fatalf("Failed to register cluster node: %v", err)
+		}
+	}
 
 	// Inicializa session manager
-	sessionManager = session.NewManager(repo)
+	sessionManager = session.NewManager(repo, cfg.GracePeriod, cfg.GraceQueue)
+
+	// Cluster: relay até clientes conectados a outros nós
+	if cfg.ClusterAddress != "" {
+		relay, err := sessionManager.StartCluster(session.Cluster{
+			NodeID:  cfg.NodeID,
+			Address: cfg.ClusterAdvertise,
+			Token:   cfg.ClusterToken,
+		}, cfg.ClusterAddress)
+		if err != nil {
+			log.Fatalf("Failed to start cluster relay on %s: %v", cfg.ClusterAddress, err)
+		}
+		defer relay.Close()
+	}
 
-	// Inicia controller para comandos de reload
-	controller := session.NewController(sessionManager)
-	if err := controller.Start(); err != nil {
-		log.Printf("Warning: Failed to start control socket: %v", err)
+	// Abre/fecha portas com validade ou janela de horário sem RELOAD manual
+	go sessionManager.RunScheduler()
+
+	// Aplica mudanças feitas pelo voidprobe-cli sem RELOAD manual
+	if cfg.AutoReload > 0 {
+		go sessionManager.RunWatcher(cfg.AutoReload)
+	}
+
+	// Listener HTTP compartilhado (roteamento por Host)
+	if cfg.HTTPAddress != "" {
+		httpRouter, err := router.NewHTTPRouter(sessionManager, repo, cfg.HTTPErrorPage)
+		if err != nil {
+			log.Fatalf("Failed to configure HTTP router: %v", err)
+		}
+		if err := httpRouter.Start(cfg.HTTPAddress); err != nil {
+			log.Fatalf("Failed to start HTTP router on %s: %v", cfg.HTTPAddress, err)
+		}
+		defer httpRouter.Stop()
+	}
+
+	// Listener TLS compartilhado (passthrough por SNI)
+	if cfg.TLSAddress != "" {
+		tlsRouter := router.NewTLSRouter(sessionManager, repo)
+		if err := tlsRouter.Start(cfg.TLSAddress); err != nil {
+			log.Fatalf("Failed to start TLS router on %s: %v", cfg.TLSAddress, err)
+		}
+		defer tlsRouter.Stop()
 	}
-	defer controller.Stop()
 
 	// Configura TLS
 	var creds credentials.TransportCredentials
+	var serverTLS *tls.Config
 	if tlsCfg.Enabled {
 		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
 		if err != nil {
@@ -69,15 +124,44 @@ func main() {
 			log.Println("Running in insecure mode (not recommended for production)")
 			creds = nil
 		} else {
-			config := &tls.Config{
+			serverTLS = &tls.Config{
 				Certificates: []tls.Certificate{cert},
 				MinVersion:   tls.VersionTLS12,
 			}
-			creds = credentials.NewTLS(config)
+			creds = credentials.NewTLS(serverTLS)
 			log.Println("TLS enabled")
 		}
 	}
 
+	// API de administração: socket de controle local (voidprobe-cli) e,
+	// se configurado, listener TCP com tokens de operador
+	adminServer := admin.NewServer(repo, sessionManager)
+	if control, err := adminServer.ServeUnix(admin.SocketPath); err != nil {
+		log.Printf("Warning: Failed to start control socket: %v", err)
+	} else {
+		defer control.Stop()
+	}
+	if cfg.AdminAddress != "" {
+		// Chaves e tokens de operador não trafegam sem TLS
+		if creds == nil {
+			log.Fatal("ADMIN_ADDRESS requires TLS (TLS_ENABLED=true with a valid certificate)")
+		}
+		adminAPI, err := adminServer.ServeTCP(cfg.AdminAddress, creds)
+		if err != nil {
+			log.Fatalf("Failed to start admin API on %s: %v", cfg.AdminAddress, err)
+		}
+		defer adminAPI.Stop()
+	}
+
+	// Dashboard web (listener só para administradores; HTTP só em loopback)
+	if cfg.WebAddress != "" {
+		dashboard, err := adminServer.ServeWeb(cfg.WebAddress, serverTLS, cfg.WebInsecure)
+		if err != nil {
+			log.Fatalf("Failed to start web dashboard on %s: %v", cfg.WebAddress, err)
+		}
+		defer dashboard.Close()
+	}
+
 	// Configura servidor gRPC
 	var opts []grpc.ServerOption
 	if creds != nil {
@@ -110,7 +194,20 @@ func main() {
 		<-sigChan
 
 		log.Println("\nShutting down server...")
-		grpcServer.GracefulStop()
+		sessionManager.LeaveCluster()
+
+		// Túneis abertos não terminam sozinhos: após o prazo, encerra e os
+		// clientes reconectam (no cluster, a outro nó)
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			grpcServer.Stop()
+		}
 		log.Println("Server stopped")
 		os.Exit(0)
 	}()
@@ -177,16 +274,25 @@ func (s *server) TunnelStream(stream pb.RemoteTunnel_TunnelStreamServer) error {
 
 	// Registra sessão no manager
 	cs := sessionManager.RegisterSession(clientID, yamuxSession)
-	defer sessionManager.UnregisterSession(clientID)
+	defer sessionManager.UnregisterSession(clientID, yamuxSession)
+
+	// Aceita streams abertos pelo cliente (local-forwards, saúde)
+	go cs.AcceptStreams(yamuxSession)
 
 	// Carrega portas iniciais
+	// Falhas de bind ficam registradas em port_state; a sessão continua
 	if err := cs.Reload(); err != nil {
 		log.Printf("Failed to load ports: %v", err)
-		return err
+		if _, ok := err.(session.BindErrors); !ok {
+			return err
+		}
 	}
 
-	// Aguarda desconexão
-	<-stream.Context().Done()
+	// Aguarda desconexão (ou KICK/bloqueio, que fecham a sessão yamux)
+	select {
+	case <-stream.Context().Done():
+	case <-yamuxSession.CloseChan():
+	}
 	log.Println("Client disconnected")
 	return stream.Context().Err()
 }
@@ -26,47 +26,8 @@ echo "Client Name: $CLIENT_NAME"
 echo "Client Key: $CLIENT_KEY"
 echo ""
 
-# Criar banco e tabelas
-sqlite3 "$DB_PATH" << 'EOF'
-PRAGMA foreign_keys = ON;
-PRAGMA journal_mode = WAL;
-PRAGMA synchronous = NORMAL;
-
-CREATE TABLE IF NOT EXISTS clients (
-  client_id     TEXT PRIMARY KEY,
-  client_name   TEXT NOT NULL,
-  key_hash      TEXT NOT NULL,
-  status        TEXT NOT NULL DEFAULT 'active',
-  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
-  last_seen_at  TEXT,
-  CHECK (status IN ('active','blocked'))
-);
-
-CREATE INDEX IF NOT EXISTS idx_clients_name ON clients(client_name);
-CREATE INDEX IF NOT EXISTS idx_clients_status ON clients(status);
-CREATE INDEX IF NOT EXISTS idx_clients_last_seen ON clients(last_seen_at);
-
-CREATE TABLE IF NOT EXISTS client_ports (
-  id            INTEGER PRIMARY KEY AUTOINCREMENT,
-  client_id     TEXT NOT NULL,
-  exposed_port  INTEGER NOT NULL,
-  target_host   TEXT NOT NULL DEFAULT '127.0.0.1',
-  target_port   INTEGER NOT NULL,
-  proto         TEXT NOT NULL DEFAULT 'tcp',
-  enabled       INTEGER NOT NULL DEFAULT 1,
-  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
-  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
-  CHECK (exposed_port BETWEEN 1 AND 65535),
-  CHECK (target_port BETWEEN 1 AND 65535),
-  CHECK (enabled IN (0,1)),
-  CHECK (proto IN ('tcp','udp')),
-  UNIQUE (exposed_port),
-  UNIQUE (client_id, target_host, target_port, proto)
-);
-
-CREATE INDEX IF NOT EXISTS idx_ports_client ON client_ports(client_id);
-CREATE INDEX IF NOT EXISTS idx_ports_enabled ON client_ports(enabled);
-EOF
+# Criar banco e tabelas (mesmas migrações que o servidor aplica ao iniciar)
+"${VOIDPROBE_CLI:-voidprobe-cli}" -db "$DB_PATH" migrate
 
 # Inserir cliente de teste
 sqlite3 "$DB_PATH" "INSERT OR REPLACE INTO clients (client_id, client_name, key_hash) VALUES ('$CLIENT_ID', '$CLIENT_NAME', '$KEY_HASH');"
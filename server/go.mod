@@ -3,9 +3,13 @@ module github.com/voidprobe/server
 go 1.23
 
 require (
+	github.com/armon/go-socks5 v0.0.0-20160902184237-e75332964ef5
 	github.com/hashicorp/yamux v0.1.1
+	github.com/lib/pq v1.10.9
+	github.com/pires/go-proxyproto v0.7.0
 	google.golang.org/grpc v1.60.1
 	google.golang.org/protobuf v1.32.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.28.0
 )
 
@@ -0,0 +1,661 @@
+// Package admin implementa a API gRPC de administração (serviço Admin de
+// admin.proto), usada pelo voidprobe-cli pelo socket de controle local ou,
+// com token de operador, por ADMIN_ADDRESS.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/schedule"
+	"github.com/voidprobe/server/internal/selector"
+	"github.com/voidprobe/server/internal/session"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// SocketPath é o socket de controle local (sem token; protegido pelas permissões do arquivo)
+const SocketPath = "/tmp/voidprobe.sock"
+
+// Server implementa o serviço Admin sobre o repositório e o session manager
+type Server struct {
+	pb.UnimplementedAdminServer
+	repo    database.Store
+	manager *session.Manager
+
+	webSessions map[string]webSession // logins do dashboard (ID do cookie -> operador)
+	webMu       sync.Mutex
+	webTLS      bool // dashboard em HTTPS: cookie de sessão com Secure
+}
+
+// NewServer cria o serviço de administração
+func NewServer(repo database.Store, manager *session.Manager) *Server {
+	return &Server{repo: repo, manager: manager, webSessions: make(map[string]webSession)}
+}
+
+// ServeUnix atende a API no socket de controle local; sem credenciais, o
+// acesso é total até existir um operador admin
+func (s *Server) ServeUnix(path string) (*grpc.Server, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Somente o usuário do servidor e seu grupo
+	os.Chmod(path, 0660)
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuth(true)),
+		grpc.StreamInterceptor(s.streamAuth(true)),
+	)
+	pb.RegisterAdminServer(grpcServer, s)
+	go grpcServer.Serve(listener)
+
+	log.Printf("Control socket started: %s", path)
+	return grpcServer, nil
+}
+
+// ServeTCP atende a API em addr com TLS, exigindo chave ou token de operador
+func (s *Server) ServeTCP(addr string, creds credentials.TransportCredentials) (*grpc.Server, error) {
+	if creds == nil {
+		return nil, errors.New("TLS credentials are required")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.UnaryInterceptor(s.unaryAuth(false)),
+		grpc.StreamInterceptor(s.streamAuth(false)),
+	)
+	pb.RegisterAdminServer(grpcServer, s)
+	go grpcServer.Serve(listener)
+
+	log.Printf("Admin API listening on %s", addr)
+	return grpcServer, nil
+}
+
+// store retorna o repositório com o operador da requisição como autor das
+// revisões gravadas pelas mudanças
+func (s *Server) store(ctx context.Context) database.Store {
+	return s.repo.As(operatorFrom(ctx))
+}
+
+// record registra a ação do operador no log e na auditoria (clientID vazio =
+// mudança global)
+func (s *Server) record(ctx context.Context, clientID, detail string) string {
+	operator := operatorFrom(ctx)
+	if clientID == "" {
+		log.Printf("Operator %s: %s", operator, detail)
+	} else {
+		log.Printf("Operator %s: %s (client %s)", operator, detail, clientID)
+	}
+	if err := s.repo.Audit(operator, clientID, detail); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return operator
+}
+
+// changed registra a mudança com o operador, publica o evento e aplica a
+// configuração à sessão do cliente (reload, ou desconexão se bloqueado/removido)
+func (s *Server) changed(ctx context.Context, clientID, format string, args ...interface{}) {
+	detail := fmt.Sprintf(format, args...)
+	operator := s.record(ctx, clientID, detail)
+
+	s.manager.Publish(session.Event{Type: session.EventConfig, ClientID: clientID, Detail: detail, OperatorID: operator})
+	s.manager.Refresh(clientID)
+}
+
+// statusError traduz erros do repositório em status gRPC
+func statusError(err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+// invalid traduz erros de validação do repositório (InvalidArgument, salvo
+// ErrNotFound)
+func invalid(err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return statusError(err)
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// ============= Clientes =============
+
+func clientInfo(c database.Client) *pb.ClientInfo {
+	info := &pb.ClientInfo{
+		ClientId:  c.ClientID,
+		Name:      c.ClientName,
+		Status:    c.Status,
+		Group:     c.Group,
+		CreatedAt: c.CreatedAt.Format(database.TimeLayout),
+		PortCount: int32(c.PortCount),
+		Tags:      c.Tags,
+	}
+	if c.LastSeenAt != nil {
+		info.LastSeenAt = c.LastSeenAt.Format(database.TimeLayout)
+	}
+	return info
+}
+
+// parseSelector interpreta o seletor de uma requisição
+func parseSelector(spec string) (selector.Selector, error) {
+	sel, err := selector.Parse(spec)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return sel, nil
+}
+
+// selected combina o escopo do operador com o seletor da requisição; nil =
+// todos os clientes
+func (s *Server) selected(ctx context.Context, spec string) (func(clientID string) bool, error) {
+	sel, err := parseSelector(spec)
+	if err != nil {
+		return nil, err
+	}
+	visible, err := s.visible(ctx)
+	if err != nil || len(sel) == 0 {
+		return visible, err
+	}
+
+	clients, err := s.repo.ListClients()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	chosen := make(map[string]bool)
+	for _, c := range clients {
+		if (visible == nil || visible(c.ClientID)) && sel.Match(c.Labels()) {
+			chosen[c.ClientID] = true
+		}
+	}
+	return func(clientID string) bool { return chosen[clientID] }, nil
+}
+
+func (s *Server) ListClients(ctx context.Context, req *pb.ListClientsRequest) (*pb.ListClientsResponse, error) {
+	sel, err := parseSelector(req.Selector)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := s.repo.ListClients()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListClientsResponse{}
+	for _, c := range clients {
+		if (visible == nil || visible(c.ClientID)) && sel.Match(c.Labels()) {
+			resp.Clients = append(resp.Clients, clientInfo(c))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) GetClient(ctx context.Context, req *pb.ClientRef) (*pb.ClientInfo, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	client, err := s.repo.GetClient(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if client == nil {
+		return nil, status.Errorf(codes.NotFound, "client %s not found", req.ClientId)
+	}
+	return clientInfo(*client), nil
+}
+
+func (s *Server) CreateClient(ctx context.Context, req *pb.CreateClientRequest) (*pb.ClientCredentials, error) {
+	if req.ClientId == "" || req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_id and name are required")
+	}
+
+	key := database.GenerateKey()
+	if err := s.store(ctx).CreateClient(database.Client{ClientID: req.ClientId, ClientName: req.Name}, key); err != nil {
+		return nil, statusError(fmt.Errorf("failed to add client: %w", err))
+	}
+
+	s.changed(ctx, req.ClientId, "client added")
+	return &pb.ClientCredentials{ClientId: req.ClientId, Key: key}, nil
+}
+
+func (s *Server) DeleteClient(ctx context.Context, req *pb.ClientRef) (*emptypb.Empty, error) {
+	if err := s.store(ctx).DeleteClient(req.ClientId); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "client removed")
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetClientStatus(ctx context.Context, req *pb.SetClientStatusRequest) (*emptypb.Empty, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).SetClientStatus(req.ClientId, req.Status); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "client %s", req.Status)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetClientGroup(ctx context.Context, req *pb.SetClientGroupRequest) (*emptypb.Empty, error) {
+	// Os modelos do grupo antigo saem e os do novo entram na mesma transação
+	var synced []database.TemplateSync
+	err := s.store(ctx).Tx(func(tx database.Store) error {
+		if err := tx.SetClientGroup(req.ClientId, req.Group); err != nil {
+			return err
+		}
+		var err error
+		synced, err = tx.SyncTemplates(req.ClientId)
+		return err
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "group set to %q%s", req.Group, templateChanges(synced))
+	return &emptypb.Empty{}, nil
+}
+
+// templateChanges resume os mapeamentos criados e removidos pelos modelos para a auditoria
+func templateChanges(synced []database.TemplateSync) string {
+	if len(synced) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, t := range synced {
+		sign := "+"
+		if t.Removed {
+			sign = "-"
+		}
+		parts = append(parts, fmt.Sprintf("%s%d", sign, t.ExposedPort))
+	}
+	return ", template ports " + strings.Join(parts, " ")
+}
+
+func (s *Server) SetClientTags(ctx context.Context, req *pb.SetClientTagsRequest) (*pb.ClientInfo, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	client, err := s.repo.GetClient(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if client == nil {
+		return nil, status.Errorf(codes.NotFound, "client %s not found", req.ClientId)
+	}
+
+	tags := make(map[string]string)
+	for key, value := range client.Tags {
+		tags[key] = value
+	}
+	for _, key := range req.Remove {
+		delete(tags, key)
+	}
+	for key, value := range req.Set {
+		tags[key] = value
+	}
+	if err := s.store(ctx).SetClientTags(req.ClientId, tags); err != nil {
+		return nil, invalid(err)
+	}
+
+	s.changed(ctx, req.ClientId, "tags set to %q", database.FormatTags(tags))
+	client.Tags = tags
+	return clientInfo(*client), nil
+}
+
+func (s *Server) SetClientKey(ctx context.Context, req *pb.SetClientKeyRequest) (*pb.ClientCredentials, error) {
+	key := req.Key
+	if key == "" {
+		key = database.GenerateKey()
+	}
+	if err := s.store(ctx).SetClientKey(req.ClientId, key); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "key changed")
+	return &pb.ClientCredentials{ClientId: req.ClientId, Key: key}, nil
+}
+
+// ============= Portas =============
+
+func portInfo(p database.PortInfo) *pb.PortInfo {
+	return &pb.PortInfo{
+		Id:              int64(p.ID),
+		ClientId:        p.ClientID,
+		ExposedPort:     int32(p.ExposedPort),
+		TargetHost:      p.TargetHost,
+		TargetPort:      int32(p.TargetPort),
+		Mode:            p.Mode,
+		AuthUser:        p.AuthUser,
+		ProxyProtocol:   p.ProxyProto,
+		AcceptProxy:     p.AcceptProxy,
+		ExpiresAt:       p.ExpiresAt,
+		Schedule:        p.Schedule,
+		HealthCheck:     p.HealthCheck,
+		RefuseUnhealthy: p.RefuseDown,
+		Enabled:         p.Enabled,
+		Health:          p.Health,
+		State:           p.State,
+		StateDetail:     p.StateDetail,
+		Template:        p.Template,
+	}
+}
+
+func (s *Server) ListPorts(ctx context.Context, req *pb.ListPortsRequest) (*pb.ListPortsResponse, error) {
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	ports, err := s.repo.ListPorts(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.selected(ctx, req.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListPortsResponse{}
+	for _, p := range ports {
+		if visible == nil || visible(p.ClientID) {
+			resp.Ports = append(resp.Ports, portInfo(p))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) CreatePort(ctx context.Context, req *pb.CreatePortRequest) (*pb.CreatePortResponse, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	client, err := s.repo.GetClient(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if client == nil {
+		return nil, status.Errorf(codes.NotFound, "client %s not found", req.ClientId)
+	}
+
+	p := database.PortMapping{
+		ClientID:    req.ClientId,
+		ExposedPort: int(req.ExposedPort),
+		TargetHost:  req.TargetHost,
+		TargetPort:  int(req.TargetPort),
+		Mode:        req.Mode,
+		Schedule:    req.Schedule,
+		Enabled:     true,
+	}
+
+	if req.Ttl != "" {
+		d, err := schedule.ParseTTL(req.Ttl)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		p.ExpiresAt = time.Now().UTC().Add(d).Format(database.TimeLayout)
+	}
+	if p.Schedule != "" {
+		if _, err := schedule.Parse(p.Schedule); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid schedule: %v", err)
+		}
+	}
+
+	var password string
+	switch p.Mode {
+	case database.ModeSocks5:
+		if req.AuthUser == "" {
+			return nil, status.Error(codes.InvalidArgument, "socks5 requires a username")
+		}
+		p.AuthUser = req.AuthUser
+		password = req.Password
+		if password == "" {
+			password = database.GenerateKey()[:24]
+		}
+		p.AuthHash = database.HashKey(password)
+	case "", database.ModeForward:
+		if !p.IsUnix() && (p.TargetPort < 1 || p.TargetPort > 65535) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid target port %d", p.TargetPort)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mode %q (use forward or socks5)", p.Mode)
+	}
+
+	// Porta 0: primeira livre no pool do grupo do cliente
+	if p.ExposedPort == 0 {
+		if p.ExposedPort, err = s.repo.AllocatePort(req.ClientId); err != nil {
+			return nil, statusError(err)
+		}
+	}
+
+	id, err := s.store(ctx).AddPort(p)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	created, err := s.repo.GetPort(id)
+	if err != nil || created == nil {
+		return nil, status.Errorf(codes.Internal, "port %d created but not readable: %v", id, err)
+	}
+
+	s.changed(ctx, req.ClientId, "port %d added (server:%d -> %s)", id, created.ExposedPort, created.Target())
+
+	resp := &pb.CreatePortResponse{Port: portInfo(database.PortInfo{PortMapping: *created})}
+	if req.Password == "" {
+		resp.Password = password
+	}
+	return resp, nil
+}
+
+// portClient busca o cliente dono do mapeamento (NotFound se não existir)
+// e verifica se o autor alcança esse cliente
+func (s *Server) portClient(ctx context.Context, portID int64) (string, error) {
+	p, err := s.repo.GetPort(int(portID))
+	if err != nil {
+		return "", statusError(err)
+	}
+	if p == nil {
+		return "", status.Errorf(codes.NotFound, "port %d not found", portID)
+	}
+	if err := s.clientAllowed(ctx, p.ClientID); err != nil {
+		return "", err
+	}
+	return p.ClientID, nil
+}
+
+func (s *Server) DeletePort(ctx context.Context, req *pb.PortRef) (*emptypb.Empty, error) {
+	clientID, err := s.portClient(ctx, req.PortId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).DeletePort(int(req.PortId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, clientID, "port %d removed", req.PortId)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetPortEnabled(ctx context.Context, req *pb.SetPortEnabledRequest) (*emptypb.Empty, error) {
+	clientID, err := s.portClient(ctx, req.PortId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).SetPortEnabled(int(req.PortId), req.Enabled); err != nil {
+		return nil, statusError(err)
+	}
+
+	state := "enabled"
+	if !req.Enabled {
+		state = "disabled"
+	}
+	s.changed(ctx, clientID, "port %d %s", req.PortId, state)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetPortOption(ctx context.Context, req *pb.SetPortOptionRequest) (*emptypb.Empty, error) {
+	clientID, err := s.portClient(ctx, req.PortId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).SetPortOption(int(req.PortId), req.Option, req.Value); err != nil {
+		return nil, invalid(err)
+	}
+
+	s.changed(ctx, clientID, "port %d %s set to %s", req.PortId, req.Option, req.Value)
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Sessões =============
+
+func (s *Server) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	visible, err := s.selected(ctx, req.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListSessionsResponse{}
+	for _, info := range s.manager.Sessions() {
+		if visible != nil && !visible(info.ClientID) {
+			continue
+		}
+		state := "connected"
+		switch {
+		case info.Node != "":
+			state = "relayed"
+		case !info.Connected:
+			state = "reconnecting"
+		}
+
+		sess := &pb.SessionInfo{
+			ClientId: info.ClientID,
+			State:    state,
+			Since:    info.Since.UTC().Format(database.TimeLayout),
+			Node:     info.Node,
+		}
+		for _, l := range info.Listeners {
+			listener := &pb.ListenerInfo{PortId: int64(l.PortID), Port: int32(l.Port), Target: l.Target}
+			if l.Checked {
+				listener.Health = l.Health.Status
+				listener.HealthDetail = l.Health.Detail
+			}
+			sess.Listeners = append(sess.Listeners, listener)
+		}
+		resp.Sessions = append(resp.Sessions, sess)
+	}
+	return resp, nil
+}
+
+func (s *Server) KickClient(ctx context.Context, req *pb.ClientRef) (*emptypb.Empty, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	if err := s.manager.Kick(req.ClientId); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	operator := s.record(ctx, req.ClientId, "client kicked")
+	s.manager.Publish(session.Event{Type: session.EventDisconnected, ClientID: req.ClientId, Detail: "kicked", OperatorID: operator})
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ReloadClient(ctx context.Context, req *pb.ClientRef) (*pb.ReloadResponse, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	s.record(ctx, req.ClientId, "reload requested")
+
+	err := s.manager.ReloadPorts(req.ClientId)
+	var failed session.BindErrors
+	if errors.As(err, &failed) {
+		return &pb.ReloadResponse{Failed: failed}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.ReloadResponse{}, nil
+}
+
+func (s *Server) ListConnections(ctx context.Context, req *pb.ListConnectionsRequest) (*pb.ListConnectionsResponse, error) {
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListConnectionsResponse{}
+	for _, c := range s.manager.Connections(req.ClientId) {
+		if visible != nil && !visible(c.ClientID) {
+			continue
+		}
+		resp.Connections = append(resp.Connections, &pb.ConnectionInfo{
+			Id:       c.ID,
+			ClientId: c.ClientID,
+			Kind:     c.Kind,
+			Port:     int32(c.Port),
+			Source:   c.Source,
+			Target:   c.Target,
+			Since:    c.Since.UTC().Format(database.TimeLayout),
+			BytesIn:  c.BytesIn,
+			BytesOut: c.BytesOut,
+		})
+	}
+	return resp, nil
+}
+
+// ============= Eventos =============
+
+func eventMessage(e session.Event) *pb.Event {
+	return &pb.Event{
+		Time:       e.Time.UTC().Format(database.TimeLayout),
+		Type:       e.Type,
+		ClientId:   e.ClientID,
+		Detail:     e.Detail,
+		OperatorId: e.OperatorID,
+	}
+}
+
+func (s *Server) WatchEvents(req *pb.WatchEventsRequest, stream pb.Admin_WatchEventsServer) error {
+	events, cancel := s.manager.Subscribe()
+	defer cancel()
+	p := principalFrom(stream.Context())
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-events:
+			if req.ClientId != "" && e.ClientID != req.ClientId {
+				continue
+			}
+			if !s.inScope(p, e.ClientID) {
+				continue
+			}
+			if err := stream.Send(eventMessage(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package admin
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/session"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Testes de comportamento da API: um servidor no socket de controle de um
+// diretório temporário, sobre um banco SQLite novo e migrado, chamado como o
+// voidprobe-cli chama (metadados operator-id/authorization)
+
+// testAPI é o servidor de teste e o repositório por trás dele
+type testAPI struct {
+	repo   database.Store
+	client pb.AdminClient
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := database.Open(filepath.Join(dir, "voidprobe.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	if _, err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(repo, session.NewManager(repo, time.Second, 16))
+	socket := filepath.Join(dir, "admin.sock")
+	server, err := s.ServeUnix(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testAPI{repo: repo, client: pb.NewAdminClient(conn)}
+}
+
+// operator cadastra um operador e retorna o contexto das chamadas feitas por ele
+func (a *testAPI) operator(t *testing.T, id, role string, groups ...string) context.Context {
+	t.Helper()
+	if err := a.repo.CreateOperator(database.Operator{OperatorID: id, Name: id, Role: role, Groups: groups}, id+"-key"); err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "operator-id", id, "authorization", "Bearer "+id+"-key")
+}
+
+// token emite um token de API do operador e retorna o contexto das chamadas com ele
+func (a *testAPI) token(t *testing.T, operatorID string, scopes ...string) context.Context {
+	t.Helper()
+	token, err := a.repo.CreateAPIToken(operatorID, "test", scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// addClient cadastra um cliente no grupo
+func (a *testAPI) addClient(t *testing.T, id, group string) {
+	t.Helper()
+	if err := a.repo.CreateClient(database.Client{ClientID: id, ClientName: id, Group: group}, id+"-key"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantCode verifica o código gRPC do erro (OK = sem erro)
+func wantCode(t *testing.T, what string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got %v (%v), want %v", what, got, err, want)
+	}
+}
+
+func TestMethodAccessCoversService(t *testing.T) {
+	// Métodos fora de methodAccess são recusados a todos (ver principal.check)
+	for _, m := range pb.Admin_ServiceDesc.Methods {
+		if _, ok := methodAccess["/"+pb.Admin_ServiceDesc.ServiceName+"/"+m.MethodName]; !ok {
+			t.Errorf("method %s has no access rule", m.MethodName)
+		}
+	}
+	for _, m := range pb.Admin_ServiceDesc.Streams {
+		if _, ok := methodAccess["/"+pb.Admin_ServiceDesc.ServiceName+"/"+m.StreamName]; !ok {
+			t.Errorf("stream %s has no access rule", m.StreamName)
+		}
+	}
+}
+
+func TestCredentialsRequiredAfterFirstAdmin(t *testing.T) {
+	a := newTestAPI(t)
+	ctx := context.Background()
+
+	// Sem admin, o socket local aceita chamadas sem credenciais
+	_, err := a.client.ListOperators(ctx, &emptypb.Empty{})
+	wantCode(t, "ListOperators before the first admin", err, codes.OK)
+
+	a.operator(t, "root", database.RoleAdmin)
+	_, err = a.client.ListOperators(ctx, &emptypb.Empty{})
+	wantCode(t, "ListOperators without credentials", err, codes.Unauthenticated)
+
+	bad := metadata.AppendToOutgoingContext(ctx, "operator-id", "root", "authorization", "Bearer wrong")
+	_, err = a.client.ListOperators(bad, &emptypb.Empty{})
+	wantCode(t, "ListOperators with a wrong key", err, codes.Unauthenticated)
+}
+
+func TestTokenScopes(t *testing.T) {
+	a := newTestAPI(t)
+	a.operator(t, "root", database.RoleAdmin)
+	a.addClient(t, "srv-01", "")
+
+	read := a.token(t, "root", database.ScopeRead)
+	_, err := a.client.ListRoutes(read, &pb.ListRoutesRequest{Kind: "http"})
+	wantCode(t, "ListRoutes with read", err, codes.OK)
+	_, err = a.client.ExportConfig(read, &emptypb.Empty{})
+	wantCode(t, "ExportConfig with read", err, codes.OK)
+
+	route := &pb.RouteInfo{Kind: "http", Hostname: "app.example.com", ClientId: "srv-01", TargetPort: 80}
+	_, err = a.client.CreateRoute(read, route)
+	wantCode(t, "CreateRoute with read", err, codes.PermissionDenied)
+	_, err = a.client.CreatePool(read, &pb.CreatePoolRequest{Start: 20000, End: 20099})
+	wantCode(t, "CreatePool with read", err, codes.PermissionDenied)
+	_, err = a.client.Rollback(read, &pb.RollbackRequest{})
+	wantCode(t, "Rollback with read", err, codes.PermissionDenied)
+
+	write := a.token(t, "root", database.ScopeWrite)
+	_, err = a.client.CreateRoute(write, route)
+	wantCode(t, "CreateRoute with write", err, codes.OK)
+	_, err = a.client.ListRoutes(write, &pb.ListRoutesRequest{Kind: "http"})
+	wantCode(t, "ListRoutes with write only", err, codes.PermissionDenied)
+}
+
+func TestRoles(t *testing.T) {
+	a := newTestAPI(t)
+	a.operator(t, "root", database.RoleAdmin)
+	viewer := a.operator(t, "noc", database.RoleViewer)
+	operator := a.operator(t, "alice", database.RoleOperator)
+	a.addClient(t, "srv-01", "")
+
+	forward := &pb.ForwardInfo{ClientId: "srv-01", ListenPort: 15432, TargetHost: "10.0.0.5", TargetPort: 5432}
+
+	// viewer: só leitura
+	_, err := a.client.ListForwards(viewer, &pb.ListForwardsRequest{})
+	wantCode(t, "viewer ListForwards", err, codes.OK)
+	_, err = a.client.ListAudit(viewer, &pb.ListAuditRequest{})
+	wantCode(t, "viewer ListAudit", err, codes.OK)
+	_, err = a.client.CreateForward(viewer, forward)
+	wantCode(t, "viewer CreateForward", err, codes.PermissionDenied)
+	_, err = a.client.ListOperators(viewer, &emptypb.Empty{})
+	wantCode(t, "viewer ListOperators", err, codes.PermissionDenied)
+
+	// operator: forwards, rotas e serviços, mas não configuração global
+	_, err = a.client.CreateForward(operator, forward)
+	wantCode(t, "operator CreateForward", err, codes.OK)
+	_, err = a.client.CreatePool(operator, &pb.CreatePoolRequest{Start: 20000, End: 20099})
+	wantCode(t, "operator CreatePool", err, codes.PermissionDenied)
+	_, err = a.client.CreateTemplate(operator, &pb.CreateTemplateRequest{Name: "base"})
+	wantCode(t, "operator CreateTemplate", err, codes.PermissionDenied)
+	_, err = a.client.CreateLink(operator, &pb.LinkRef{From: "srv-01", To: "srv-01"})
+	wantCode(t, "operator CreateLink", err, codes.PermissionDenied)
+	_, err = a.client.CreateOperator(operator, &pb.CreateOperatorRequest{OperatorId: "mallory", Name: "Mallory", Role: database.RoleAdmin})
+	wantCode(t, "operator CreateOperator", err, codes.PermissionDenied)
+	_, err = a.client.SetOperatorRole(operator, &pb.SetOperatorRoleRequest{OperatorId: "alice", Role: database.RoleAdmin})
+	wantCode(t, "operator SetOperatorRole on itself", err, codes.PermissionDenied)
+	_, err = a.client.CreateAPIToken(operator, &pb.CreateAPITokenRequest{OperatorId: "root", Name: "stolen"})
+	wantCode(t, "operator CreateAPIToken", err, codes.PermissionDenied)
+	_, err = a.client.ApplyConfig(operator, &pb.ApplyConfigRequest{Config: []byte("clients: []\n")})
+	wantCode(t, "operator ApplyConfig", err, codes.PermissionDenied)
+	_, err = a.client.DeleteNode(operator, &pb.NodeRef{NodeId: "n1"})
+	wantCode(t, "operator DeleteNode", err, codes.PermissionDenied)
+
+	if op, _ := a.repo.GetOperator("alice"); op.Role != database.RoleOperator {
+		t.Errorf("alice role changed to %s", op.Role)
+	}
+	if ops, _ := a.repo.ListOperators(); len(ops) != 3 {
+		t.Errorf("operators after denied CreateOperator: %d", len(ops))
+	}
+}
+
+func TestGroupScope(t *testing.T) {
+	a := newTestAPI(t)
+	root := a.operator(t, "root", database.RoleAdmin)
+	dba := a.operator(t, "dba", database.RoleOperator, "db")
+	a.addClient(t, "db-01", "db")
+	a.addClient(t, "web-01", "web")
+
+	// Um forward e uma rota em cada cliente, criados pelo admin
+	for _, id := range []string{"db-01", "web-01"} {
+		_, err := a.client.CreateForward(root, &pb.ForwardInfo{ClientId: id, ListenPort: 15432, TargetHost: "10.0.0.5", TargetPort: 5432})
+		wantCode(t, "root CreateForward "+id, err, codes.OK)
+		_, err = a.client.CreateRoute(root, &pb.RouteInfo{Kind: "tls", Hostname: id + ".example.com", ClientId: id, TargetPort: 443})
+		wantCode(t, "root CreateRoute "+id, err, codes.OK)
+	}
+	_, err := a.client.CreatePool(root, &pb.CreatePoolRequest{Start: 20000, End: 20099})
+	wantCode(t, "root CreatePool", err, codes.OK)
+
+	// Mudanças só nos clientes do grupo
+	_, err = a.client.CreateForward(dba, &pb.ForwardInfo{ClientId: "web-01", ListenPort: 16379, TargetHost: "10.0.0.6", TargetPort: 6379})
+	wantCode(t, "dba CreateForward web-01", err, codes.PermissionDenied)
+	_, err = a.client.CreateForward(dba, &pb.ForwardInfo{ClientId: "db-01", ListenPort: 16379, TargetHost: "10.0.0.6", TargetPort: 6379, Via: "web-01"})
+	wantCode(t, "dba CreateForward via web-01", err, codes.PermissionDenied)
+	_, err = a.client.CreateForward(dba, &pb.ForwardInfo{ClientId: "db-01", ListenPort: 16379, TargetHost: "10.0.0.6", TargetPort: 6379})
+	wantCode(t, "dba CreateForward db-01", err, codes.OK)
+	_, err = a.client.CreateRoute(dba, &pb.RouteInfo{Kind: "http", Hostname: "web.example.com", ClientId: "web-01", TargetPort: 80})
+	wantCode(t, "dba CreateRoute web-01", err, codes.PermissionDenied)
+	_, err = a.client.ApproveService(dba, &pb.ApproveServiceRequest{ClientId: "web-01", Name: "ssh"})
+	wantCode(t, "dba ApproveService web-01", err, codes.PermissionDenied)
+
+	// Registros de outros grupos: recusados pelo dono, não pelo ID
+	forwards, err := a.repo.ListForwards("web-01")
+	if err != nil || len(forwards) != 1 {
+		t.Fatalf("web-01 forwards: %v %v", forwards, err)
+	}
+	_, err = a.client.DeleteForward(dba, &pb.ForwardRef{ForwardId: int64(forwards[0].ID)})
+	wantCode(t, "dba DeleteForward of web-01", err, codes.PermissionDenied)
+	routes, err := a.repo.ListRoutes(database.TLSRoutes, "web-01")
+	if err != nil || len(routes) != 1 {
+		t.Fatalf("web-01 routes: %v %v", routes, err)
+	}
+	_, err = a.client.SetRouteEnabled(dba, &pb.SetRouteEnabledRequest{Kind: "tls", RouteId: int64(routes[0].ID)})
+	wantCode(t, "dba SetRouteEnabled of web-01", err, codes.PermissionDenied)
+	if forwards, _ := a.repo.ListForwards("web-01"); len(forwards) != 1 {
+		t.Errorf("web-01 forwards after denied delete: %d", len(forwards))
+	}
+
+	// Listagens só com os clientes do grupo
+	fl, err := a.client.ListForwards(dba, &pb.ListForwardsRequest{})
+	wantCode(t, "dba ListForwards", err, codes.OK)
+	for _, f := range fl.GetForwards() {
+		if f.ClientId != "db-01" {
+			t.Errorf("dba sees forward of %s", f.ClientId)
+		}
+	}
+	if len(fl.GetForwards()) != 2 {
+		t.Errorf("dba forwards: %d, want 2", len(fl.GetForwards()))
+	}
+	rl, err := a.client.ListRoutes(dba, &pb.ListRoutesRequest{Kind: "tls"})
+	wantCode(t, "dba ListRoutes", err, codes.OK)
+	if len(rl.GetRoutes()) != 1 || rl.Routes[0].ClientId != "db-01" {
+		t.Errorf("dba routes: %v", rl.GetRoutes())
+	}
+	_, err = a.client.ListForwards(dba, &pb.ListForwardsRequest{ClientId: "web-01"})
+	wantCode(t, "dba ListForwards web-01", err, codes.PermissionDenied)
+
+	// Auditoria sem clientes de outros grupos nem mudanças globais (pools)
+	audit, err := a.client.ListAudit(dba, &pb.ListAuditRequest{})
+	wantCode(t, "dba ListAudit", err, codes.OK)
+	if len(audit.GetEntries()) == 0 {
+		t.Error("dba audit is empty")
+	}
+	for _, e := range audit.GetEntries() {
+		if e.ClientId != "db-01" {
+			t.Errorf("dba sees audit entry %q (client %q)", e.Action, e.ClientId)
+		}
+	}
+	_, err = a.client.ListAudit(dba, &pb.ListAuditRequest{ClientId: "web-01"})
+	wantCode(t, "dba ListAudit web-01", err, codes.PermissionDenied)
+
+	// O admin enxerga tudo, inclusive o autor de cada mudança
+	audit, err = a.client.ListAudit(root, &pb.ListAuditRequest{})
+	wantCode(t, "root ListAudit", err, codes.OK)
+	authors := make(map[string]int)
+	for _, e := range audit.GetEntries() {
+		authors[e.OperatorId]++
+	}
+	if authors["root"] != 5 || authors["dba"] != 1 {
+		t.Errorf("audit authors: %v", authors)
+	}
+}
+
+func TestRevisionAuthors(t *testing.T) {
+	a := newTestAPI(t)
+	root := a.operator(t, "root", database.RoleAdmin)
+	alice := a.operator(t, "alice", database.RoleOperator)
+
+	revisions := func(after int64) []*pb.RevisionInfo {
+		t.Helper()
+		resp, err := a.client.ListRevisions(root, &pb.ListRevisionsRequest{After: after})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Revisions
+	}
+	wantAuthor := func(what string, revs []*pb.RevisionInfo, n int, author string) {
+		t.Helper()
+		if len(revs) != n {
+			t.Fatalf("%s: %d revision(s), want %d", what, len(revs), n)
+		}
+		for _, r := range revs {
+			if r.OperatorId != author {
+				t.Errorf("%s: revision %d (%s) by %q, want %q", what, r.Id, r.Summary, r.OperatorId, author)
+			}
+		}
+	}
+
+	// apply: cliente e porta criados na transação do servidor
+	config := []byte("clients:\n  - id: srv-01\n    ports:\n      - port: 2222\n        target: \"22\"\n")
+	plan, err := a.client.PlanConfig(root, &pb.PlanConfigRequest{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.client.ApplyConfig(root, &pb.ApplyConfigRequest{Config: config, Plan: plan.Plan}); err != nil {
+		t.Fatal(err)
+	}
+	applied := revisions(0)
+	wantAuthor("apply", applied, 2, "root")
+	checkpoint := applied[0].Id
+
+	// Mudanças de outro operador e de outra chamada
+	if _, err := a.client.SetClientStatus(alice, &pb.SetClientStatusRequest{ClientId: "srv-01", Status: "blocked"}); err != nil {
+		t.Fatal(err)
+	}
+	wantAuthor("SetClientStatus", revisions(checkpoint), 1, "alice")
+	if _, err := a.client.CreatePort(root, &pb.CreatePortRequest{ClientId: "srv-01", ExposedPort: 3333, TargetPort: 80}); err != nil {
+		t.Fatal(err)
+	}
+	changes := revisions(checkpoint)
+	wantAuthor("CreatePort", changes[:1], 1, "root")
+
+	// Rollback com a lista desatualizada é recusado sem desfazer nada
+	_, err = a.client.Rollback(root, &pb.RollbackRequest{Revision: checkpoint, Latest: changes[1].Id})
+	wantCode(t, "Rollback with a stale list", err, codes.FailedPrecondition)
+
+	resp, err := a.client.Rollback(root, &pb.RollbackRequest{Revision: checkpoint, Latest: changes[0].Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Undone != 2 || len(resp.Reload) != 1 || resp.Reload[0] != "srv-01" {
+		t.Errorf("Rollback: %+v", resp)
+	}
+	wantAuthor("Rollback", revisions(changes[0].Id), 2, "root")
+
+	client, err := a.repo.GetClient("srv-01")
+	if err != nil || client == nil || client.Status != "active" {
+		t.Errorf("srv-01 after rollback: %+v %v", client, err)
+	}
+	ports, err := a.repo.ListPorts("srv-01")
+	if err != nil || len(ports) != 1 || ports[0].ExposedPort != 2222 {
+		t.Errorf("srv-01 ports after rollback: %+v %v", ports, err)
+	}
+}
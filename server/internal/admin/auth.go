@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// LocalOperator identifica chamadas sem credenciais no socket de controle
+// local, aceitas enquanto não existir operador admin
+const LocalOperator = "local"
+
+// access é o escopo de token e o papel mínimo exigidos por um método
+type access struct {
+	scope string
+	role  string
+}
+
+// methodAccess define o acesso exigido por método
+var methodAccess = map[string]access{
+	pb.Admin_ListClients_FullMethodName:     {database.ScopeRead, database.RoleViewer},
+	pb.Admin_GetClient_FullMethodName:       {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreateClient_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeleteClient_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetClientStatus_FullMethodName: {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetClientGroup_FullMethodName:  {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetClientTags_FullMethodName:   {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetClientKey_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ListPorts_FullMethodName:       {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreatePort_FullMethodName:      {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_DeletePort_FullMethodName:      {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetPortEnabled_FullMethodName:  {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetPortOption_FullMethodName:   {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_ListSessions_FullMethodName:    {database.ScopeRead, database.RoleViewer},
+	pb.Admin_KickClient_FullMethodName:      {database.ScopeControl, database.RoleOperator},
+	pb.Admin_ReloadClient_FullMethodName:    {database.ScopeControl, database.RoleOperator},
+	pb.Admin_ListConnections_FullMethodName: {database.ScopeRead, database.RoleViewer},
+	pb.Admin_WatchEvents_FullMethodName:     {database.ScopeEvents, database.RoleViewer},
+
+	pb.Admin_ListServices_FullMethodName:   {database.ScopeRead, database.RoleViewer},
+	pb.Admin_ApproveService_FullMethodName: {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_RevokeService_FullMethodName:  {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_ListPools_FullMethodName:      {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreatePool_FullMethodName:     {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeletePool_FullMethodName:     {database.ScopeWrite, database.RoleAdmin},
+
+	pb.Admin_ListTemplates_FullMethodName:         {database.ScopeRead, database.RoleViewer},
+	pb.Admin_GetTemplate_FullMethodName:           {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreateTemplate_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeleteTemplate_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_AddTemplateTargets_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_RemoveTemplateTargets_FullMethodName: {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetTemplateAllocation_FullMethodName: {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_AttachTemplate_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DetachTemplate_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+
+	pb.Admin_ListForwards_FullMethodName:      {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreateForward_FullMethodName:     {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_DeleteForward_FullMethodName:     {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetForwardEnabled_FullMethodName: {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_ListLinks_FullMethodName:         {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreateLink_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeleteLink_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ListRoutes_FullMethodName:        {database.ScopeRead, database.RoleViewer},
+	pb.Admin_CreateRoute_FullMethodName:       {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_DeleteRoute_FullMethodName:       {database.ScopeWrite, database.RoleOperator},
+	pb.Admin_SetRouteEnabled_FullMethodName:   {database.ScopeWrite, database.RoleOperator},
+
+	pb.Admin_ListOperators_FullMethodName:     {database.ScopeRead, database.RoleAdmin},
+	pb.Admin_CreateOperator_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeleteOperator_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetOperatorStatus_FullMethodName: {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetOperatorRole_FullMethodName:   {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetOperatorGroups_FullMethodName: {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_SetOperatorKey_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ListAPITokens_FullMethodName:     {database.ScopeRead, database.RoleAdmin},
+	pb.Admin_CreateAPIToken_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_DeleteAPIToken_FullMethodName:    {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ListAudit_FullMethodName:         {database.ScopeRead, database.RoleViewer},
+
+	pb.Admin_PlanConfig_FullMethodName:      {database.ScopeRead, database.RoleAdmin},
+	pb.Admin_ApplyConfig_FullMethodName:     {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ExportConfig_FullMethodName:    {database.ScopeRead, database.RoleAdmin},
+	pb.Admin_ListRevisions_FullMethodName:   {database.ScopeRead, database.RoleViewer},
+	pb.Admin_Rollback_FullMethodName:        {database.ScopeWrite, database.RoleAdmin},
+	pb.Admin_ListNodes_FullMethodName:       {database.ScopeRead, database.RoleViewer},
+	pb.Admin_ListNodeClients_FullMethodName: {database.ScopeRead, database.RoleViewer},
+	pb.Admin_DeleteNode_FullMethodName:      {database.ScopeWrite, database.RoleAdmin},
+}
+
+// principal é o autor de uma chamada: o operador, com os escopos do token
+// usado (nil = chave do operador, todos os escopos)
+type principal struct {
+	database.Operator
+	scopes []string
+}
+
+// localPrincipal é o acesso sem credenciais ao socket de controle
+var localPrincipal = &principal{Operator: database.Operator{OperatorID: LocalOperator, Role: database.RoleAdmin}}
+
+// check verifica papel e escopo exigidos pelo método
+func (p *principal) check(method string) error {
+	acc, ok := methodAccess[method]
+	if !ok {
+		return status.Error(codes.PermissionDenied, "method not allowed")
+	}
+	if !p.HasRole(acc.role) {
+		log.Printf("Admin API: operator %s (%s) denied %s: requires role %s", p.OperatorID, p.Role, method, acc.role)
+		return status.Errorf(codes.PermissionDenied, "role %s cannot do this (requires %s)", p.Role, acc.role)
+	}
+	if p.scopes != nil && !(database.APIToken{Scopes: p.scopes}).Allows(acc.scope) {
+		log.Printf("Admin API: operator %s denied %s: token lacks scope %s", p.OperatorID, method, acc.scope)
+		return status.Errorf(codes.PermissionDenied, "token lacks scope %q", acc.scope)
+	}
+	return nil
+}
+
+// principalKey guarda no contexto o autor da chamada
+type principalKey struct{}
+
+// principalFrom retorna o autor da chamada
+func principalFrom(ctx context.Context) *principal {
+	if p, ok := ctx.Value(principalKey{}).(*principal); ok {
+		return p
+	}
+	return localPrincipal
+}
+
+// operatorFrom retorna o operador que fez a chamada
+func operatorFrom(ctx context.Context) string {
+	return principalFrom(ctx).OperatorID
+}
+
+// authenticate identifica o autor: "operator-id" com a chave do operador ou
+// só o token de API em "authorization: Bearer". No socket local (local), a
+// chamada sem credenciais vale como admin até existir um operador admin.
+func (s *Server) authenticate(ctx context.Context, local bool) (*principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	operatorID := first("operator-id")
+	secret, _ := strings.CutPrefix(first("authorization"), "Bearer ")
+
+	switch {
+	case operatorID != "":
+		op, err := s.repo.ValidateOperator(operatorID, secret)
+		if err != nil {
+			log.Printf("Admin API: authentication failed: %v", err)
+			return nil, status.Error(codes.Unauthenticated, "invalid operator credentials")
+		}
+		return &principal{Operator: *op}, nil
+
+	case secret != "":
+		t, err := s.repo.ValidateAPIToken(secret)
+		if err != nil {
+			log.Printf("Admin API: authentication failed: %v", err)
+			return nil, status.Error(codes.Unauthenticated, "invalid API token")
+		}
+		return &principal{Operator: t.Operator, scopes: t.Scopes}, nil
+
+	case local:
+		admins, err := s.repo.HasAdmins()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if !admins {
+			return localPrincipal, nil
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "operator credentials required (VOIDPROBE_OPERATOR and VOIDPROBE_KEY, or VOIDPROBE_TOKEN)")
+}
+
+// authorize autentica a chamada e verifica o acesso ao método
+func (s *Server) authorize(ctx context.Context, method string, local bool) (context.Context, error) {
+	p, err := s.authenticate(ctx, local)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.check(method); err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, principalKey{}, p), nil
+}
+
+// unaryAuth autoriza chamadas unárias (local: socket de controle)
+func (s *Server) unaryAuth(local bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := s.authorize(ctx, info.FullMethod, local)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamAuth autoriza chamadas de stream (local: socket de controle)
+func (s *Server) streamAuth(local bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := s.authorize(ss.Context(), info.FullMethod, local)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorizedStream expõe o contexto com o autor da chamada
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// ============= Escopo por grupo =============
+
+// clientAllowed verifica se o autor alcança o cliente (grupos do operador)
+func (s *Server) clientAllowed(ctx context.Context, clientID string) error {
+	p := principalFrom(ctx)
+	if !p.Restricted() {
+		return nil
+	}
+
+	client, err := s.repo.GetClient(clientID)
+	if err != nil {
+		return statusError(err)
+	}
+	if client == nil {
+		return status.Errorf(codes.NotFound, "client %s not found", clientID)
+	}
+	if !p.InScope(client.Group) {
+		log.Printf("Admin API: operator %s denied client %s (group %q)", p.OperatorID, clientID, client.Group)
+		return status.Errorf(codes.PermissionDenied, "client %s is outside your groups", clientID)
+	}
+	return nil
+}
+
+// inScope informa, sem registrar negação, se o autor alcança o cliente
+func (s *Server) inScope(p *principal, clientID string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	client, err := s.repo.GetClient(clientID)
+	return err == nil && client != nil && p.InScope(client.Group)
+}
+
+// visible retorna o filtro de clientes visíveis ao autor (nil = todos)
+func (s *Server) visible(ctx context.Context) (func(clientID string) bool, error) {
+	p := principalFrom(ctx)
+	if !p.Restricted() {
+		return nil, nil
+	}
+
+	clients, err := s.repo.ListClients()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	allowed := make(map[string]bool)
+	for _, c := range clients {
+		if p.InScope(c.Group) {
+			allowed[c.ClientID] = true
+		}
+	}
+	return func(clientID string) bool { return allowed[clientID] }, nil
+}
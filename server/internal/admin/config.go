@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/declarative"
+	"github.com/voidprobe/server/internal/session"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Configuração declarativa (plan / apply / export) =============
+
+// loadConfig lê o arquivo enviado; erros de sintaxe e validação são do chamador
+func loadConfig(name string, data []byte) (*declarative.State, error) {
+	if name == "" {
+		name = "voidprobe.yaml"
+	}
+	want, err := declarative.Load(name, data)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return want, nil
+}
+
+func (s *Server) PlanConfig(ctx context.Context, req *pb.PlanConfigRequest) (*pb.PlanConfigResponse, error) {
+	want, err := loadConfig(req.Name, req.Config)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := declarative.Current(s.repo)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	changes := declarative.Plan(cur, want)
+	resp := &pb.PlanConfigResponse{Plan: declarative.Render(changes)}
+	for _, c := range changes {
+		resp.Changes = append(resp.Changes, &pb.PlanChange{Op: c.Op, Subject: c.Subject, Details: c.Details})
+	}
+	return resp, nil
+}
+
+func (s *Server) ApplyConfig(ctx context.Context, req *pb.ApplyConfigRequest) (*pb.ApplyConfigResponse, error) {
+	want, err := loadConfig(req.Name, req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// O plano é refeito na transação: se o banco mudou desde o PlanConfig, nada é aplicado
+	operator := operatorFrom(ctx)
+	res, err := declarative.Apply(s.repo.As(operator), want, req.Plan, operator)
+	if errors.Is(err, declarative.ErrPlanChanged) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	log.Printf("Operator %s: configuration applied (%d client(s) affected)", operator, len(res.Reload))
+	s.published(operator, res.Reload, "configuration applied")
+	return &pb.ApplyConfigResponse{Synced: templateSyncs(res.Synced), Secrets: res.Secrets, Reload: res.Reload}, nil
+}
+
+func (s *Server) ExportConfig(ctx context.Context, req *emptypb.Empty) (*pb.ExportConfigResponse, error) {
+	data, err := declarative.Export(s.repo)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ExportConfigResponse{Config: data}, nil
+}
+
+// published avisa os assinantes de eventos das mudanças já auditadas (o
+// reload fica com quem chamou, que recebe a lista de clientes afetados)
+func (s *Server) published(operator string, clients []string, detail string) {
+	for _, id := range clients {
+		s.manager.Publish(session.Event{Type: session.EventConfig, ClientID: id, Detail: detail, OperatorID: operator})
+	}
+}
+
+// ============= Histórico =============
+
+func (s *Server) ListRevisions(ctx context.Context, req *pb.ListRevisionsRequest) (*pb.ListRevisionsResponse, error) {
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Com grupos, o limite vale para as revisões visíveis ao operador
+	fetch := int(req.Limit)
+	if visible != nil {
+		fetch = 0
+	}
+	revisions, err := s.repo.ListRevisions(req.ClientId, int(req.After), fetch)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListRevisionsResponse{}
+	for _, r := range revisions {
+		if visible != nil && !visible(r.ClientID) {
+			continue
+		}
+		if req.Limit > 0 && len(resp.Revisions) == int(req.Limit) {
+			break
+		}
+		resp.Revisions = append(resp.Revisions, &pb.RevisionInfo{
+			Id:         int64(r.ID),
+			CreatedAt:  r.CreatedAt,
+			OperatorId: r.Operator,
+			ClientId:   r.ClientID,
+			Summary:    r.Summary(),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) Rollback(ctx context.Context, req *pb.RollbackRequest) (*pb.RollbackResponse, error) {
+	if req.Revision < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid revision %d", req.Revision)
+	}
+
+	// Desfaz da mais recente até a seguinte a rev
+	revisions, err := s.repo.ListRevisions(req.ClientId, int(req.Revision), 0)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if len(revisions) == 0 {
+		return &pb.RollbackResponse{}, nil
+	}
+	if int64(revisions[0].ID) != req.Latest {
+		return nil, status.Error(codes.FailedPrecondition, "new changes after the list was shown; run rollback again")
+	}
+
+	operator := operatorFrom(ctx)
+	affected := make(map[string]int)
+	var synced []database.TemplateSync
+	err = s.repo.As(operator).Tx(func(tx database.Store) error {
+		for _, r := range revisions {
+			if err := tx.UndoRevision(r); err != nil {
+				return err
+			}
+			affected[r.ClientID]++
+		}
+		// Ligações e destinos de modelos podem ter mudado depois da revisão
+		var err error
+		synced, err = tx.SyncTemplates("")
+		if err != nil {
+			return err
+		}
+		for _, t := range synced {
+			if err := tx.Audit(operator, t.ClientID, t.AuditAction()); err != nil {
+				return err
+			}
+		}
+		for id, n := range affected {
+			if err := tx.Audit(operator, id, fmt.Sprintf("rolled back to revision %d (%d change(s) undone)", req.Revision, n)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	log.Printf("Operator %s: rolled back to revision %d (%d change(s) undone)", operator, req.Revision, len(revisions))
+
+	// Clientes que deixaram de existir não têm o que recarregar
+	resp := &pb.RollbackResponse{Undone: int32(len(revisions)), Synced: templateSyncs(synced)}
+	for _, id := range slices.Sorted(maps.Keys(affected)) {
+		if c, err := s.repo.GetClient(id); err == nil && c != nil {
+			resp.Reload = append(resp.Reload, id)
+		}
+	}
+	s.published(operator, resp.Reload, fmt.Sprintf("rolled back to revision %d", req.Revision))
+	return resp, nil
+}
+
+// ============= Nós do cluster =============
+
+func (s *Server) ListNodes(ctx context.Context, req *emptypb.Empty) (*pb.ListNodesResponse, error) {
+	nodes, err := s.repo.ListNodes()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListNodesResponse{}
+	for _, n := range nodes {
+		resp.Nodes = append(resp.Nodes, &pb.NodeInfo{
+			NodeId:     n.NodeID,
+			Address:    n.Address,
+			Alive:      n.Alive(),
+			StartedAt:  n.StartedAt,
+			LastSeenAt: n.LastSeenAt,
+			Clients:    int32(n.Clients),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) ListNodeClients(ctx context.Context, req *pb.NodeRef) (*pb.ListNodeClientsResponse, error) {
+	list, err := s.repo.ListClientNodes()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListNodeClientsResponse{}
+	for _, cn := range list {
+		if cn.Node.NodeID != req.NodeId || (visible != nil && !visible(cn.ClientID)) {
+			continue
+		}
+		resp.Clients = append(resp.Clients, &pb.NodeClient{ClientId: cn.ClientID, AttachedAt: cn.AttachedAt})
+	}
+	return resp, nil
+}
+
+func (s *Server) DeleteNode(ctx context.Context, req *pb.NodeRef) (*emptypb.Empty, error) {
+	if err := s.repo.RemoveNode(req.NodeId); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("node %s removed", req.NodeId))
+	return &emptypb.Empty{}, nil
+}
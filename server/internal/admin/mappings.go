@@ -0,0 +1,329 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Serviços =============
+
+func (s *Server) ListServices(ctx context.Context, req *pb.ListServicesRequest) (*pb.ListServicesResponse, error) {
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	services, err := s.repo.ListServices(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListServicesResponse{}
+	for _, svc := range services {
+		if visible != nil && !visible(svc.ClientID) {
+			continue
+		}
+		resp.Services = append(resp.Services, &pb.ServiceInfo{
+			ClientId:    svc.ClientID,
+			Name:        svc.Name,
+			TargetHost:  svc.TargetHost,
+			TargetPort:  int32(svc.TargetPort),
+			ExposedPort: int32(svc.ExposedPort),
+			OfferedAt:   svc.OfferedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) ApproveService(ctx context.Context, req *pb.ApproveServiceRequest) (*pb.PortInfo, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	if req.ExposedPort < 0 || req.ExposedPort > 65535 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid port %d", req.ExposedPort)
+	}
+
+	// Porta 0: primeira livre no pool do grupo do cliente
+	p, err := s.store(ctx).ApproveService(req.ClientId, req.Name, int(req.ExposedPort))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "service %s approved (server:%d)", req.Name, p.ExposedPort)
+	return portInfo(database.PortInfo{PortMapping: *p}), nil
+}
+
+func (s *Server) RevokeService(ctx context.Context, req *pb.ServiceRef) (*emptypb.Empty, error) {
+	if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).RevokeService(req.ClientId, req.Name); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.ClientId, "service %s revoked", req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Pools =============
+
+func (s *Server) ListPools(ctx context.Context, req *emptypb.Empty) (*pb.ListPoolsResponse, error) {
+	pools, err := s.repo.ListPools()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListPoolsResponse{}
+	for _, p := range pools {
+		resp.Pools = append(resp.Pools, &pb.PoolInfo{
+			Id:    int64(p.ID),
+			Group: p.Group,
+			Start: int32(p.Start),
+			End:   int32(p.End),
+			Used:  int32(p.Used),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreatePool(ctx context.Context, req *pb.CreatePoolRequest) (*emptypb.Empty, error) {
+	if req.Start < 1 || req.End > 65535 || req.Start > req.End {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid range %d-%d", req.Start, req.End)
+	}
+	if err := s.store(ctx).AddPool(req.Group, int(req.Start), int(req.End)); err != nil {
+		return nil, statusError(err)
+	}
+
+	if req.Group == "" {
+		s.record(ctx, "", fmt.Sprintf("pool %d-%d added (default)", req.Start, req.End))
+	} else {
+		s.record(ctx, "", fmt.Sprintf("pool %d-%d added (group %s)", req.Start, req.End, req.Group))
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) DeletePool(ctx context.Context, req *pb.PoolRef) (*emptypb.Empty, error) {
+	if err := s.store(ctx).DeletePool(int(req.PoolId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("pool %d removed", req.PoolId))
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Modelos =============
+
+func templateInfo(t database.PortTemplate) *pb.TemplateInfo {
+	info := &pb.TemplateInfo{
+		Name:       t.Name,
+		Allocation: t.Allocation,
+		CreatedAt:  t.CreatedAt,
+		Mapped:     int32(t.Mapped),
+	}
+	for _, p := range t.Ports {
+		info.Targets = append(info.Targets, &pb.PortTarget{TargetHost: p.TargetHost, TargetPort: int32(p.TargetPort)})
+	}
+	for _, a := range t.Attachments {
+		info.Attachments = append(info.Attachments, &pb.TemplateAttachment{Kind: a.Kind, Name: a.Name})
+	}
+	return info
+}
+
+// templateSyncs converte os mapeamentos criados e removidos pelos modelos
+func templateSyncs(synced []database.TemplateSync) []*pb.TemplateSync {
+	var out []*pb.TemplateSync
+	for _, t := range synced {
+		out = append(out, &pb.TemplateSync{
+			Template:    t.Template,
+			ClientId:    t.ClientID,
+			ExposedPort: int32(t.ExposedPort),
+			Target:      t.Target,
+			Removed:     t.Removed,
+		})
+	}
+	return out
+}
+
+// templatePorts valida os destinos da requisição
+func templatePorts(targets []*pb.PortTarget) ([]database.TemplatePort, error) {
+	var ports []database.TemplatePort
+	for _, t := range targets {
+		p := database.TemplatePort{TargetHost: t.TargetHost, TargetPort: int(t.TargetPort)}
+		if strings.HasPrefix(p.TargetHost, database.UnixPrefix) {
+			if !strings.HasPrefix(strings.TrimPrefix(p.TargetHost, database.UnixPrefix), "/") || p.TargetPort != 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid target %q (use unix:///path)", p.TargetHost)
+			}
+		} else if p.TargetHost == "" || p.TargetPort < 1 || p.TargetPort > 65535 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid target %s", p.Target())
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// templateTargets lista os destinos para a auditoria
+func templateTargets(ports []database.TemplatePort) string {
+	var targets []string
+	for _, p := range ports {
+		targets = append(targets, p.Target())
+	}
+	return strings.Join(targets, " ")
+}
+
+// templateChange aplica a mudança no modelo e materializa os mapeamentos na
+// mesma transação; audita a mudança e aplica os mapeamentos de cada cliente
+func (s *Server) templateChange(ctx context.Context, detail string, change func(tx database.Store) error) (*pb.TemplateSyncResponse, error) {
+	var synced []database.TemplateSync
+	err := s.store(ctx).Tx(func(tx database.Store) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		var err error
+		synced, err = tx.SyncTemplates("")
+		return err
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", detail)
+	for _, t := range synced {
+		s.changed(ctx, t.ClientID, "%s", t.AuditAction())
+	}
+	return &pb.TemplateSyncResponse{Synced: templateSyncs(synced)}, nil
+}
+
+func (s *Server) ListTemplates(ctx context.Context, req *emptypb.Empty) (*pb.ListTemplatesResponse, error) {
+	templates, err := s.repo.ListTemplates()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListTemplatesResponse{}
+	for _, t := range templates {
+		resp.Templates = append(resp.Templates, templateInfo(t))
+	}
+	return resp, nil
+}
+
+func (s *Server) GetTemplate(ctx context.Context, req *pb.TemplateRef) (*pb.TemplateInfo, error) {
+	t, err := s.repo.GetTemplate(req.Name)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if t == nil {
+		return nil, status.Errorf(codes.NotFound, "template %s not found", req.Name)
+	}
+	return templateInfo(*t), nil
+}
+
+func (s *Server) CreateTemplate(ctx context.Context, req *pb.CreateTemplateRequest) (*pb.TemplateSyncResponse, error) {
+	ports, err := templatePorts(req.Targets)
+	if err != nil {
+		return nil, err
+	}
+	allocation := req.Allocation
+	if allocation == "" {
+		allocation = database.AllocationPool
+	}
+	if _, _, err := database.ParseAllocation(allocation); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	detail := fmt.Sprintf("template %s added (allocation %s, %d target(s))", req.Name, allocation, len(ports))
+	return s.templateChange(ctx, detail, func(tx database.Store) error {
+		if err := tx.CreateTemplate(req.Name, allocation); err != nil {
+			return err
+		}
+		for _, p := range ports {
+			if err := tx.AddTemplatePort(req.Name, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Server) DeleteTemplate(ctx context.Context, req *pb.TemplateRef) (*pb.TemplateSyncResponse, error) {
+	return s.templateChange(ctx, fmt.Sprintf("template %s removed", req.Name), func(tx database.Store) error {
+		return tx.DeleteTemplate(req.Name)
+	})
+}
+
+func (s *Server) AddTemplateTargets(ctx context.Context, req *pb.TemplateTargetsRequest) (*pb.TemplateSyncResponse, error) {
+	ports, err := templatePorts(req.Targets)
+	if err != nil {
+		return nil, err
+	}
+	return s.templateChange(ctx, fmt.Sprintf("template %s: add %s", req.Name, templateTargets(ports)), func(tx database.Store) error {
+		for _, p := range ports {
+			if err := tx.AddTemplatePort(req.Name, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Server) RemoveTemplateTargets(ctx context.Context, req *pb.TemplateTargetsRequest) (*pb.TemplateSyncResponse, error) {
+	ports, err := templatePorts(req.Targets)
+	if err != nil {
+		return nil, err
+	}
+	return s.templateChange(ctx, fmt.Sprintf("template %s: remove %s", req.Name, templateTargets(ports)), func(tx database.Store) error {
+		for _, p := range ports {
+			if err := tx.RemoveTemplatePort(req.Name, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Server) SetTemplateAllocation(ctx context.Context, req *pb.SetTemplateAllocationRequest) (*pb.TemplateSyncResponse, error) {
+	if _, _, err := database.ParseAllocation(req.Allocation); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return s.templateChange(ctx, fmt.Sprintf("template %s allocation set to %s", req.Name, req.Allocation), func(tx database.Store) error {
+		return tx.SetTemplateAllocation(req.Name, req.Allocation)
+	})
+}
+
+// templateAttachment valida a ligação da requisição
+func templateAttachment(a *pb.TemplateAttachment) (database.TemplateAttachment, error) {
+	if a == nil || (a.Kind != database.AttachClient && a.Kind != database.AttachGroup) || a.Name == "" {
+		return database.TemplateAttachment{}, status.Error(codes.InvalidArgument, "attachment requires kind client or group and a name")
+	}
+	return database.TemplateAttachment{Kind: a.Kind, Name: a.Name}, nil
+}
+
+func (s *Server) AttachTemplate(ctx context.Context, req *pb.TemplateAttachmentRequest) (*pb.TemplateSyncResponse, error) {
+	a, err := templateAttachment(req.Attachment)
+	if err != nil {
+		return nil, err
+	}
+	return s.templateChange(ctx, fmt.Sprintf("template %s attached to %s %s", req.Name, a.Kind, a.Name), func(tx database.Store) error {
+		return tx.AttachTemplate(req.Name, a)
+	})
+}
+
+func (s *Server) DetachTemplate(ctx context.Context, req *pb.TemplateAttachmentRequest) (*pb.TemplateSyncResponse, error) {
+	a, err := templateAttachment(req.Attachment)
+	if err != nil {
+		return nil, err
+	}
+	return s.templateChange(ctx, fmt.Sprintf("template %s detached from %s %s", req.Name, a.Kind, a.Name), func(tx database.Store) error {
+		return tx.DetachTemplate(req.Name, a)
+	})
+}
@@ -0,0 +1,327 @@
+package admin
+
+import (
+	"context"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Local-forwards =============
+
+func forwardInfo(f database.LocalForward) *pb.ForwardInfo {
+	return &pb.ForwardInfo{
+		Id:         int64(f.ID),
+		ClientId:   f.ClientID,
+		ListenHost: f.ListenHost,
+		ListenPort: int32(f.ListenPort),
+		TargetHost: f.TargetHost,
+		TargetPort: int32(f.TargetPort),
+		Via:        f.TargetClient,
+		Enabled:    f.Enabled,
+	}
+}
+
+func (s *Server) ListForwards(ctx context.Context, req *pb.ListForwardsRequest) (*pb.ListForwardsResponse, error) {
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	forwards, err := s.repo.ListForwards(req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListForwardsResponse{}
+	for _, f := range forwards {
+		if visible == nil || visible(f.ClientID) {
+			resp.Forwards = append(resp.Forwards, forwardInfo(f))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateForward(ctx context.Context, req *pb.ForwardInfo) (*pb.ForwardInfo, error) {
+	f := database.LocalForward{
+		ClientID:     req.ClientId,
+		ListenHost:   req.ListenHost,
+		ListenPort:   int(req.ListenPort),
+		TargetHost:   req.TargetHost,
+		TargetPort:   int(req.TargetPort),
+		TargetClient: req.Via,
+		Enabled:      true,
+	}
+	if f.ListenHost == "" {
+		f.ListenHost = "0.0.0.0"
+	}
+	if f.ListenPort < 1 || f.ListenPort > 65535 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid listen port %d", f.ListenPort)
+	}
+	if f.TargetHost == "" || f.TargetPort < 1 || f.TargetPort > 65535 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target %s (expected host:port)", f.Target())
+	}
+
+	if err := s.clientAllowed(ctx, f.ClientID); err != nil {
+		return nil, err
+	}
+	if f.TargetClient != "" {
+		if err := s.clientAllowed(ctx, f.TargetClient); err != nil {
+			return nil, err
+		}
+	}
+
+	// Destino na rede de outro cliente: o par precisa estar autorizado
+	id, err := s.store(ctx).AddForward(f)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	f.ID = id
+
+	if f.TargetClient != "" {
+		s.changed(ctx, f.ClientID, "forward added (client:%s -> %s:%s)", f.ListenAddr(), f.TargetClient, f.Target())
+	} else {
+		s.changed(ctx, f.ClientID, "forward added (client:%s -> %s)", f.ListenAddr(), f.Target())
+	}
+	return forwardInfo(f), nil
+}
+
+// forwardClient busca o cliente dono do forward (NotFound se não existir) e
+// verifica se o autor alcança esse cliente
+func (s *Server) forwardClient(ctx context.Context, id int64) (string, error) {
+	f, err := s.repo.LookupForward(int(id))
+	if err != nil {
+		return "", statusError(err)
+	}
+	if f == nil {
+		return "", status.Errorf(codes.NotFound, "forward %d not found", id)
+	}
+	if err := s.clientAllowed(ctx, f.ClientID); err != nil {
+		return "", err
+	}
+	return f.ClientID, nil
+}
+
+func (s *Server) DeleteForward(ctx context.Context, req *pb.ForwardRef) (*emptypb.Empty, error) {
+	clientID, err := s.forwardClient(ctx, req.ForwardId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).DeleteForward(int(req.ForwardId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, clientID, "forward %d removed", req.ForwardId)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetForwardEnabled(ctx context.Context, req *pb.SetForwardEnabledRequest) (*emptypb.Empty, error) {
+	clientID, err := s.forwardClient(ctx, req.ForwardId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).SetForwardEnabled(int(req.ForwardId), req.Enabled); err != nil {
+		return nil, statusError(err)
+	}
+
+	state := "enabled"
+	if !req.Enabled {
+		state = "disabled"
+	}
+	s.changed(ctx, clientID, "forward %d %s", req.ForwardId, state)
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Links entre clientes =============
+
+func (s *Server) ListLinks(ctx context.Context, req *emptypb.Empty) (*pb.ListLinksResponse, error) {
+	links, err := s.repo.ListLinks()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListLinksResponse{}
+	for _, l := range links {
+		if visible != nil && !(visible(l.Source) && visible(l.Target)) {
+			continue
+		}
+		resp.Links = append(resp.Links, &pb.LinkInfo{From: l.Source, To: l.Target, Forwards: int32(l.Forwards), CreatedAt: l.CreatedAt})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateLink(ctx context.Context, req *pb.LinkRef) (*emptypb.Empty, error) {
+	if req.From == "" || req.To == "" {
+		return nil, status.Error(codes.InvalidArgument, "from and to are required")
+	}
+	if err := s.store(ctx).AddLink(req.From, req.To); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.From, "link to %s allowed", req.To)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) DeleteLink(ctx context.Context, req *pb.LinkRef) (*emptypb.Empty, error) {
+	if err := s.store(ctx).DeleteLink(req.From, req.To); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, req.From, "link to %s revoked", req.To)
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Rotas (HTTP / TLS) =============
+
+// routeKind converte o tipo de rota da requisição (http|tls)
+func routeKind(kind string) (database.RouteKind, error) {
+	switch kind {
+	case "http":
+		return database.HTTPRoutes, nil
+	case "tls":
+		return database.TLSRoutes, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "invalid route kind %q (use http or tls)", kind)
+}
+
+func routeInfo(kind string, r database.Route) *pb.RouteInfo {
+	return &pb.RouteInfo{
+		Kind:       kind,
+		Id:         int64(r.ID),
+		Hostname:   r.Hostname,
+		ClientId:   r.ClientID,
+		TargetHost: r.TargetHost,
+		TargetPort: int32(r.TargetPort),
+		Enabled:    r.Enabled,
+	}
+}
+
+func (s *Server) ListRoutes(ctx context.Context, req *pb.ListRoutesRequest) (*pb.ListRoutesResponse, error) {
+	kind, err := routeKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	routes, err := s.repo.ListRoutes(kind, req.ClientId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListRoutesResponse{}
+	for _, r := range routes {
+		if visible == nil || visible(r.ClientID) {
+			resp.Routes = append(resp.Routes, routeInfo(req.Kind, r))
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateRoute(ctx context.Context, req *pb.RouteInfo) (*pb.RouteInfo, error) {
+	kind, err := routeKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	route := database.Route{
+		Hostname:   strings.ToLower(strings.TrimSuffix(req.Hostname, ".")),
+		ClientID:   req.ClientId,
+		TargetHost: req.TargetHost,
+		TargetPort: int(req.TargetPort),
+		Enabled:    true,
+	}
+	if route.TargetHost == "" {
+		route.TargetHost = "127.0.0.1"
+	}
+
+	// "*" sozinho é a rota padrão, aceita apenas no roteamento TLS
+	hostname := route.Hostname
+	if hostname == "" || strings.ContainsAny(hostname, ":/ ") || (hostname == database.DefaultRoute && kind != database.TLSRoutes) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid hostname %q", req.Hostname)
+	}
+	if route.TargetPort < 1 || route.TargetPort > 65535 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target port %d", route.TargetPort)
+	}
+
+	if err := s.clientAllowed(ctx, route.ClientID); err != nil {
+		return nil, err
+	}
+	if route.ID, err = s.store(ctx).AddRoute(kind, route); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, route.ClientID, "%s route %s added (-> %s)", req.Kind, hostname, route.Target())
+	return routeInfo(req.Kind, route), nil
+}
+
+// routeClient busca o cliente dono da rota (NotFound se não existir) e
+// verifica se o autor alcança esse cliente
+func (s *Server) routeClient(ctx context.Context, kind database.RouteKind, id int64) (string, error) {
+	r, err := s.repo.LookupRoute(kind, int(id))
+	if err != nil {
+		return "", statusError(err)
+	}
+	if r == nil {
+		return "", status.Errorf(codes.NotFound, "route %d not found", id)
+	}
+	if err := s.clientAllowed(ctx, r.ClientID); err != nil {
+		return "", err
+	}
+	return r.ClientID, nil
+}
+
+func (s *Server) DeleteRoute(ctx context.Context, req *pb.RouteRef) (*emptypb.Empty, error) {
+	kind, err := routeKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := s.routeClient(ctx, kind, req.RouteId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).DeleteRoute(kind, int(req.RouteId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.changed(ctx, clientID, "%s route %d removed", req.Kind, req.RouteId)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetRouteEnabled(ctx context.Context, req *pb.SetRouteEnabledRequest) (*emptypb.Empty, error) {
+	kind, err := routeKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := s.routeClient(ctx, kind, req.RouteId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store(ctx).SetRouteEnabled(kind, int(req.RouteId), req.Enabled); err != nil {
+		return nil, statusError(err)
+	}
+
+	state := "enabled"
+	if !req.Enabled {
+		state = "disabled"
+	}
+	s.changed(ctx, clientID, "%s route %d %s", req.Kind, req.RouteId, state)
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,227 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"github.com/voidprobe/server/internal/database"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// ============= Operadores =============
+
+// orAll exibe a lista de grupos vazia como "all"
+func orAll(groups []string) string {
+	if len(groups) == 0 {
+		return "all"
+	}
+	return strings.Join(groups, ",")
+}
+
+func (s *Server) ListOperators(ctx context.Context, req *emptypb.Empty) (*pb.ListOperatorsResponse, error) {
+	operators, err := s.repo.ListOperators()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListOperatorsResponse{}
+	for _, op := range operators {
+		resp.Operators = append(resp.Operators, &pb.OperatorInfo{
+			OperatorId: op.OperatorID,
+			Name:       op.Name,
+			Status:     op.Status,
+			Role:       op.Role,
+			Groups:     op.Groups,
+			CreatedAt:  op.CreatedAt,
+			LastSeenAt: op.LastSeenAt,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateOperator(ctx context.Context, req *pb.CreateOperatorRequest) (*pb.OperatorCredentials, error) {
+	if req.OperatorId == "" || req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "operator_id and name are required")
+	}
+	role := req.Role
+	if role == "" {
+		role = database.RoleOperator
+	}
+	if _, err := database.ParseRole(role); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	key := req.Password
+	if key == "" {
+		key = database.GenerateKey()
+	}
+	op := database.Operator{OperatorID: req.OperatorId, Name: req.Name, Role: role, Groups: req.Groups}
+	if err := s.store(ctx).CreateOperator(op, key); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("operator %s added (role %s, groups %s)", req.OperatorId, role, orAll(req.Groups)))
+	creds := &pb.OperatorCredentials{OperatorId: req.OperatorId}
+	if req.Password == "" {
+		creds.Key = key
+	}
+	return creds, nil
+}
+
+func (s *Server) DeleteOperator(ctx context.Context, req *pb.OperatorRef) (*emptypb.Empty, error) {
+	// Tokens da API deixam de valer junto com o operador
+	if err := s.store(ctx).DeleteOperator(req.OperatorId); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("operator %s removed", req.OperatorId))
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetOperatorStatus(ctx context.Context, req *pb.SetOperatorStatusRequest) (*emptypb.Empty, error) {
+	if err := s.store(ctx).SetOperatorStatus(req.OperatorId, req.Status); err != nil {
+		return nil, invalid(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("operator %s %s", req.OperatorId, req.Status))
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetOperatorRole(ctx context.Context, req *pb.SetOperatorRoleRequest) (*emptypb.Empty, error) {
+	if err := s.store(ctx).SetOperatorRole(req.OperatorId, req.Role); err != nil {
+		return nil, invalid(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("operator %s role set to %s", req.OperatorId, req.Role))
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetOperatorGroups(ctx context.Context, req *pb.SetOperatorGroupsRequest) (*emptypb.Empty, error) {
+	if err := s.store(ctx).SetOperatorGroups(req.OperatorId, req.Groups); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("operator %s groups set to %s", req.OperatorId, orAll(req.Groups)))
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) SetOperatorKey(ctx context.Context, req *pb.SetOperatorKeyRequest) (*pb.OperatorCredentials, error) {
+	key := req.Password
+	if key == "" {
+		key = database.GenerateKey()
+	}
+	if err := s.store(ctx).SetOperatorKey(req.OperatorId, key); err != nil {
+		return nil, statusError(err)
+	}
+
+	if req.Password != "" {
+		s.record(ctx, "", fmt.Sprintf("operator %s password changed", req.OperatorId))
+		return &pb.OperatorCredentials{OperatorId: req.OperatorId}, nil
+	}
+	s.record(ctx, "", fmt.Sprintf("operator %s key regenerated", req.OperatorId))
+	return &pb.OperatorCredentials{OperatorId: req.OperatorId, Key: key}, nil
+}
+
+// ============= Tokens da API =============
+
+func (s *Server) ListAPITokens(ctx context.Context, req *emptypb.Empty) (*pb.ListAPITokensResponse, error) {
+	tokens, err := s.repo.ListAPITokens()
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListAPITokensResponse{}
+	for _, t := range tokens {
+		resp.Tokens = append(resp.Tokens, &pb.APITokenInfo{
+			Id:         int64(t.ID),
+			OperatorId: t.Operator.OperatorID,
+			Name:       t.Name,
+			Scopes:     t.Scopes,
+			CreatedAt:  t.CreatedAt,
+			LastUsedAt: t.LastUsedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) CreateAPIToken(ctx context.Context, req *pb.CreateAPITokenRequest) (*pb.APITokenCredentials, error) {
+	list := strings.Join(req.Scopes, ",")
+	if list == "" {
+		list = database.ScopeRead
+	}
+	scopes, err := database.ParseScopes(list)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	token, err := s.store(ctx).CreateAPIToken(req.OperatorId, req.Name, scopes)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("token %q added for %s (scopes %s)", req.Name, req.OperatorId, strings.Join(scopes, ",")))
+	return &pb.APITokenCredentials{Token: token, Scopes: scopes}, nil
+}
+
+func (s *Server) DeleteAPIToken(ctx context.Context, req *pb.APITokenRef) (*emptypb.Empty, error) {
+	if err := s.store(ctx).DeleteAPIToken(int(req.TokenId)); err != nil {
+		return nil, statusError(err)
+	}
+
+	s.record(ctx, "", fmt.Sprintf("token %d revoked", req.TokenId))
+	return &emptypb.Empty{}, nil
+}
+
+// ============= Auditoria =============
+
+// defaultLimit é o número de linhas de audit e history sem limite informado
+const defaultLimit = 50
+
+func (s *Server) ListAudit(ctx context.Context, req *pb.ListAuditRequest) (*pb.ListAuditResponse, error) {
+	if req.ClientId != "" {
+		if err := s.clientAllowed(ctx, req.ClientId); err != nil {
+			return nil, err
+		}
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	visible, err := s.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Com grupos, o limite vale para as linhas visíveis ao operador
+	fetch := limit
+	if visible != nil {
+		fetch = math.MaxInt32
+	}
+	entries, err := s.repo.ListAudit(req.ClientId, fetch)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListAuditResponse{}
+	for _, e := range entries {
+		// Mudanças globais (operadores, pools, modelos) só para quem alcança todos os clientes
+		if visible != nil && (e.ClientID == "" || !visible(e.ClientID)) {
+			continue
+		}
+		if len(resp.Entries) == limit {
+			break
+		}
+		resp.Entries = append(resp.Entries, &pb.AuditEntry{
+			Time:       e.CreatedAt,
+			OperatorId: e.OperatorID,
+			ClientId:   e.ClientID,
+			Action:     e.Action,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,374 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/voidprobe/server/api/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// webSessionTTL é a validade do login no dashboard
+const webSessionTTL = 12 * time.Hour
+
+// webCookie guarda o ID da sessão do dashboard
+const webCookie = "voidprobe_session"
+
+// maxRequestBody limita o corpo JSON das chamadas do dashboard
+const maxRequestBody = 64 * 1024
+
+//go:embed web
+var webFiles embed.FS
+
+// webSession é o login de um operador no dashboard
+type webSession struct {
+	operator string
+	expires  time.Time
+}
+
+// webMethod liga um método unário do serviço Admin a POST /api/<Método>
+type webMethod struct {
+	request func() proto.Message
+	call    func(context.Context, proto.Message) (proto.Message, error)
+}
+
+// rpc adapta um handler do serviço Admin ao dashboard
+func rpc[Req, Resp proto.Message](handler func(context.Context, Req) (Resp, error)) webMethod {
+	return webMethod{
+		request: func() proto.Message {
+			var req Req
+			return req.ProtoReflect().Type().New().Interface()
+		},
+		call: func(ctx context.Context, req proto.Message) (proto.Message, error) {
+			return handler(ctx, req.(Req))
+		},
+	}
+}
+
+// webMethods são os métodos disponíveis no dashboard, com os mesmos dados do voidprobe-cli
+func (s *Server) webMethods() map[string]webMethod {
+	return map[string]webMethod{
+		"ListClients":     rpc(s.ListClients),
+		"GetClient":       rpc(s.GetClient),
+		"SetClientStatus": rpc(s.SetClientStatus),
+		"SetClientGroup":  rpc(s.SetClientGroup),
+		"SetClientTags":   rpc(s.SetClientTags),
+		"ListPorts":       rpc(s.ListPorts),
+		"CreatePort":      rpc(s.CreatePort),
+		"DeletePort":      rpc(s.DeletePort),
+		"SetPortEnabled":  rpc(s.SetPortEnabled),
+		"SetPortOption":   rpc(s.SetPortOption),
+		"ListSessions":    rpc(s.ListSessions),
+		"ListConnections": rpc(s.ListConnections),
+		"KickClient":      rpc(s.KickClient),
+		"ReloadClient":    rpc(s.ReloadClient),
+	}
+}
+
+// ServeWeb atende o dashboard em addr; o login usa as credenciais dos
+// operadores (operator-add). Como na API, chaves de operador só trafegam com
+// TLS: tlsConfig nil é recusado, salvo em endereço de loopback com insecure.
+func (s *Server) ServeWeb(addr string, tlsConfig *tls.Config, insecure bool) (*http.Server, error) {
+	if tlsConfig == nil && !(insecure && loopback(addr)) {
+		return nil, errors.New("TLS is required (plain HTTP only on a loopback address with WEB_INSECURE_LOOPBACK=true)")
+	}
+	s.webTLS = tlsConfig != nil
+
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		return nil, err
+	}
+	methods := s.webMethods()
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("POST /api/login", s.webLogin)
+	mux.HandleFunc("POST /api/logout", s.webLogout)
+	mux.HandleFunc("GET /api/me", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.webOperator(r)
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		writeJSON(w, map[string]interface{}{"operator": p.OperatorID, "role": p.Role, "groups": p.Groups})
+	})
+	mux.HandleFunc("GET /api/events", s.webEvents)
+	mux.HandleFunc("POST /api/{method}", func(w http.ResponseWriter, r *http.Request) {
+		s.webCall(w, r, methods)
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:           securityHeaders(mux),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if tlsConfig != nil {
+		go server.ServeTLS(listener, "", "")
+	} else {
+		go server.Serve(listener)
+	}
+
+	if tlsConfig == nil {
+		log.Printf("Warning: web dashboard listening on %s without TLS", addr)
+	} else {
+		log.Printf("Web dashboard listening on %s", addr)
+	}
+	return server, nil
+}
+
+// loopback indica se addr (host:porta) só aceita conexões da própria máquina
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// securityHeaders impede que o dashboard seja embutido ou tenha scripts de fora
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// webLogin valida operador e chave e abre a sessão do dashboard
+func (s *Server) webLogin(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		Operator string `json:"operator"`
+		Key      string `json:"key"`
+	}
+	if !jsonRequest(r) || json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&creds) != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	op, err := s.repo.ValidateOperator(creds.Operator, creds.Key)
+	if err != nil {
+		log.Printf("Dashboard: login failed from %s: %v", r.RemoteAddr, err)
+		writeJSONError(w, http.StatusUnauthorized, "invalid operator credentials")
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+	id := hex.EncodeToString(buf)
+
+	s.webMu.Lock()
+	now := time.Now()
+	for sid, sess := range s.webSessions {
+		if now.After(sess.expires) {
+			delete(s.webSessions, sid)
+		}
+	}
+	s.webSessions[id] = webSession{operator: op.OperatorID, expires: now.Add(webSessionTTL)}
+	s.webMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     webCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(webSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   s.webTLS,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	log.Printf("Dashboard: operator %s (%s) logged in from %s", op.OperatorID, op.Role, r.RemoteAddr)
+	writeJSON(w, map[string]interface{}{"operator": op.OperatorID, "role": op.Role, "groups": op.Groups})
+}
+
+// webLogout encerra a sessão do dashboard
+func (s *Server) webLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(webCookie); err == nil {
+		s.webMu.Lock()
+		delete(s.webSessions, cookie.Value)
+		s.webMu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: webCookie, Value: "", Path: "/", MaxAge: -1, Secure: s.webTLS})
+	writeJSON(w, map[string]string{})
+}
+
+// webOperator retorna o operador da sessão com papel e grupos atuais;
+// operadores bloqueados ou removidos perdem o acesso na hora
+func (s *Server) webOperator(r *http.Request) (*principal, bool) {
+	cookie, err := r.Cookie(webCookie)
+	if err != nil {
+		return nil, false
+	}
+
+	s.webMu.Lock()
+	sess, ok := s.webSessions[cookie.Value]
+	if ok && time.Now().After(sess.expires) {
+		delete(s.webSessions, cookie.Value)
+		ok = false
+	}
+	s.webMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	op, err := s.repo.GetOperator(sess.operator)
+	if err != nil || op == nil || op.Status != "active" {
+		return nil, false
+	}
+	return &principal{Operator: *op}, true
+}
+
+// webCall executa um método do serviço Admin em nome do operador logado
+func (s *Server) webCall(w http.ResponseWriter, r *http.Request, methods map[string]webMethod) {
+	p, ok := s.webOperator(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+
+	// Exigir JSON impede formulários de outros sites (sem preflight)
+	if !jsonRequest(r) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "content type must be application/json")
+		return
+	}
+
+	name := r.PathValue("method")
+	method, ok := methods[name]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown method")
+		return
+	}
+	if err := p.check("/" + pb.Admin_ServiceDesc.ServiceName + "/" + name); err != nil {
+		writeJSONError(w, http.StatusForbidden, status.Convert(err).Message())
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	req := method.request()
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), principalKey{}, p)
+	resp, err := method.call(ctx, req)
+	if err != nil {
+		st := status.Convert(err)
+		writeJSONError(w, httpStatus(st.Code()), st.Message())
+		return
+	}
+
+	out, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// webEvents envia os eventos do servidor como Server-Sent Events
+func (s *Server) webEvents(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.webOperator(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "login required")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	events, cancel := s.manager.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher.Flush()
+
+	marshal := protojson.MarshalOptions{UseProtoNames: true}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if !s.inScope(p, e.ClientID) {
+				continue
+			}
+			data, _ := marshal.Marshal(eventMessage(e))
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// jsonRequest informa se o corpo da requisição é JSON
+func jsonRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+// httpStatus traduz o código gRPC do serviço Admin
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,311 @@
+// Dashboard do VoidProbe: cada ação chama POST /api/<Método> do serviço Admin
+// com JSON (mesmos campos de admin.proto) e o cookie de sessão do operador.
+"use strict";
+
+const $ = (sel) => document.querySelector(sel);
+
+let selected = "";    // client_id com as portas abertas no painel
+let events = null;    // EventSource de /api/events
+let pollTimer = null; // atualização das conexões ao vivo
+let refreshTimer = null;
+
+// el cria um elemento com texto (nunca HTML) e filhos
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k === "onclick") node.addEventListener("click", v);
+    else node.setAttribute(k, v);
+  }
+  for (const child of children) {
+    node.append(child instanceof Node ? child : String(child ?? ""));
+  }
+  return node;
+}
+
+function button(label, onclick, cls) {
+  return el("button", { type: "button", class: cls || "", onclick }, label);
+}
+
+async function request(path, body) {
+  const resp = await fetch(path, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body || {}),
+  });
+  const data = await resp.json().catch(() => ({}));
+  if (resp.status === 401) {
+    showLogin();
+  }
+  if (!resp.ok) {
+    throw new Error(data.error || resp.statusText);
+  }
+  return data;
+}
+
+const api = (method, body) => request("/api/" + method, body);
+
+// run executa uma ação e mostra o erro do servidor, se houver
+async function run(action) {
+  $("#error").textContent = "";
+  try {
+    await action();
+  } catch (err) {
+    $("#error").textContent = err.message;
+  }
+  refresh();
+}
+
+function formatBytes(n) {
+  n = Number(n);
+  const units = ["B", "K", "M", "G", "T"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i === 0 ? n : n.toFixed(1)) + units[i];
+}
+
+// ============= Login =============
+
+function showLogin() {
+  stop();
+  $("#app").hidden = true;
+  $("#login").hidden = false;
+}
+
+// showApp abre o painel; viewers não veem os botões que alteram algo
+// (o servidor recusa a chamada de qualquer forma)
+function showApp(me) {
+  $("#login").hidden = true;
+  $("#app").hidden = false;
+  $("#operator").textContent = `${me.operator} (${me.role})`;
+  document.body.classList.toggle("readonly", me.role === "viewer");
+  start();
+}
+
+$("#login-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  $("#login-error").textContent = "";
+  try {
+    const me = await request("/api/login", { operator: form.get("operator"), key: form.get("key") });
+    e.target.reset();
+    showApp(me);
+  } catch (err) {
+    $("#login-error").textContent = err.message;
+  }
+});
+
+$("#logout").addEventListener("click", async () => {
+  await request("/api/logout").catch(() => {});
+  showLogin();
+});
+
+// ============= Clientes =============
+
+// formatTags exibe as tags como "env=prod, site=lisbon"
+function formatTags(tags) {
+  const list = Object.keys(tags || {}).sort().map((k) => (tags[k] ? `${k}=${tags[k]}` : k));
+  return list.join(", ") || "-";
+}
+
+async function loadClients() {
+  const filter = { selector: $("#client-filter").value };
+  const [clients, sessions] = await Promise.all([api("ListClients", filter), api("ListSessions", filter)]);
+  const bySession = new Map(sessions.sessions.map((s) => [s.client_id, s]));
+
+  const rows = clients.clients.map((c) => {
+    const s = bySession.get(c.client_id);
+    const state = s ? s.state : "offline";
+    const stateLabel = s && s.node ? `${state} (${s.node})` : state;
+    const since = s ? s.since : c.last_seen_at || "never";
+
+    const health = { up: 0, down: 0 };
+    for (const l of s ? s.listeners : []) {
+      if (l.health in health) health[l.health]++;
+    }
+
+    const actions = el("td", {},
+      button("Reload", () => run(() => api("ReloadClient", { client_id: c.client_id }).then(reloadFailures)), "mutate"),
+      " ",
+      s && s.state !== "relayed" ? button("Kick", () => run(() => api("KickClient", { client_id: c.client_id })), "mutate danger") : "",
+      " ",
+      c.status === "active"
+        ? button("Block", () => run(() => api("SetClientStatus", { client_id: c.client_id, status: "blocked" })), "mutate danger")
+        : button("Unblock", () => run(() => api("SetClientStatus", { client_id: c.client_id, status: "active" })), "mutate"),
+    );
+    actions.addEventListener("click", (e) => e.stopPropagation());
+
+    const row = el("tr", { class: c.client_id === selected ? "selected" : "" },
+      el("td", {}, c.client_id),
+      el("td", {}, c.name),
+      el("td", { class: c.status }, c.status),
+      el("td", {}, c.group || "-"),
+      el("td", {}, formatTags(c.tags)),
+      el("td", { class: state }, stateLabel),
+      el("td", {}, since),
+      el("td", {}, c.port_count),
+      el("td", {}, s ? `${health.up} up / ${health.down} down` : "-"),
+      actions,
+    );
+    row.addEventListener("click", () => selectClient(c.client_id));
+    return row;
+  });
+
+  $("#clients tbody").replaceChildren(...rows);
+}
+
+// reloadFailures mostra os mapeamentos que não abriram no reload
+function reloadFailures(resp) {
+  if (resp.failed && resp.failed.length) {
+    throw new Error("Reload: " + resp.failed.join("; "));
+  }
+}
+
+function selectClient(clientID) {
+  selected = clientID;
+  $("#ports-client").textContent = clientID;
+  $("#ports-panel").hidden = false;
+  refresh();
+}
+
+// ============= Portas =============
+
+function portTarget(p) {
+  if (p.mode === "socks5") return `socks5 (user ${p.auth_user})`;
+  if (p.target_host.startsWith("unix://")) return p.target_host;
+  return `${p.target_host}:${p.target_port}`;
+}
+
+function portOptions(p) {
+  const opts = [];
+  if (p.proxy_protocol) opts.push("proxy-" + p.proxy_protocol);
+  if (p.accept_proxy) opts.push("accept-proxy");
+  if (p.health_check && p.health_check !== "off") opts.push("check " + p.health_check);
+  if (p.refuse_unhealthy) opts.push("refuse-unhealthy");
+  return opts.join(", ") || "-";
+}
+
+function portWindow(p) {
+  const parts = [];
+  if (p.expires_at) parts.push("until " + p.expires_at);
+  if (p.schedule) parts.push(p.schedule);
+  return parts.join(", ") || "-";
+}
+
+async function loadPorts() {
+  if (!selected) return;
+  const resp = await api("ListPorts", { client_id: selected });
+
+  const rows = resp.ports.map((p) => el("tr", {},
+    el("td", {}, p.id),
+    el("td", {}, p.exposed_port),
+    el("td", {}, portTarget(p)),
+    el("td", {}, portOptions(p)),
+    el("td", {}, portWindow(p)),
+    el("td", { class: p.health }, p.health || "-"),
+    el("td", { class: p.state, title: p.state_detail }, p.state + (p.state_detail ? " *" : "")),
+    el("td", {},
+      p.enabled
+        ? button("Disable", () => run(() => api("SetPortEnabled", { port_id: p.id, enabled: false })), "mutate")
+        : button("Enable", () => run(() => api("SetPortEnabled", { port_id: p.id, enabled: true })), "mutate"),
+      " ",
+      button("Remove", () => {
+        if (confirm(`Remove port ${p.exposed_port} of ${p.client_id}?`)) {
+          run(() => api("DeletePort", { port_id: p.id }));
+        }
+      }, "mutate danger"),
+    ),
+  ));
+
+  $("#ports tbody").replaceChildren(...rows);
+}
+
+$("#port-add").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const req = {
+    client_id: selected,
+    exposed_port: Number(form.get("exposed_port") || 0),
+    target_host: form.get("target_host") || "127.0.0.1",
+    target_port: Number(form.get("target_port") || 0),
+    ttl: form.get("ttl"),
+    schedule: form.get("schedule"),
+  };
+  run(async () => {
+    await api("CreatePort", req);
+    e.target.reset();
+  });
+});
+
+$("#port-set").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  run(async () => {
+    await api("SetPortOption", { port_id: form.get("id"), option: form.get("option"), value: form.get("value") });
+    e.target.reset();
+  });
+});
+
+// ============= Conexões e eventos =============
+
+async function loadConnections() {
+  const resp = await api("ListConnections", {});
+  const rows = resp.connections.map((c) => el("tr", {},
+    el("td", {}, c.id),
+    el("td", {}, c.client_id),
+    el("td", {}, c.kind),
+    el("td", {}, c.port || "-"),
+    el("td", {}, c.source),
+    el("td", {}, c.target),
+    el("td", {}, c.since),
+    el("td", {}, formatBytes(c.bytes_in)),
+    el("td", {}, formatBytes(c.bytes_out)),
+  ));
+  $("#connections tbody").replaceChildren(...rows);
+}
+
+function addEvent(e) {
+  const by = e.operator_id ? ` (by ${e.operator_id})` : "";
+  const list = $("#events");
+  list.prepend(el("li", {}, `${e.time} ${e.type} ${e.client_id || ""} ${e.detail || ""}${by}`));
+  while (list.children.length > 100) list.lastChild.remove();
+}
+
+$("#client-filter").addEventListener("change", () => {
+  $("#error").textContent = "";
+  refresh();
+});
+
+// refresh recarrega clientes e portas (agrupando rajadas de eventos)
+function refresh() {
+  clearTimeout(refreshTimer);
+  refreshTimer = setTimeout(() => {
+    Promise.all([loadClients(), loadPorts()]).catch((err) => {
+      $("#error").textContent = err.message;
+    });
+  }, 100);
+}
+
+function start() {
+  refresh();
+  loadConnections().catch(() => {});
+  pollTimer = setInterval(() => loadConnections().catch(() => {}), 2000);
+
+  events = new EventSource("/api/events");
+  events.onmessage = (msg) => {
+    addEvent(JSON.parse(msg.data));
+    refresh();
+  };
+}
+
+function stop() {
+  clearInterval(pollTimer);
+  if (events) events.close();
+  events = null;
+}
+
+fetch("/api/me")
+  .then((resp) => (resp.ok ? resp.json() : Promise.reject()))
+  .then((me) => showApp(me), () => showLogin());
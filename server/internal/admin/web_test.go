@@ -0,0 +1,43 @@
+package admin
+
+import "testing"
+
+func TestServeWebRequiresTLS(t *testing.T) {
+	s := NewServer(nil, nil)
+	for _, tt := range []struct {
+		addr     string
+		insecure bool
+	}{
+		{"127.0.0.1:0", false},
+		{"0.0.0.0:0", true},
+		{":0", true},
+	} {
+		if server, err := s.ServeWeb(tt.addr, nil, tt.insecure); err == nil {
+			server.Close()
+			t.Errorf("ServeWeb(%q, insecure %v) served plain HTTP", tt.addr, tt.insecure)
+		}
+	}
+
+	server, err := s.ServeWeb("127.0.0.1:0", nil, true)
+	if err != nil {
+		t.Fatalf("ServeWeb on loopback: %v", err)
+	}
+	server.Close()
+}
+
+func TestLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8443": true,
+		"[::1]:8443":     true,
+		"localhost:8443": true,
+		"0.0.0.0:8443":   false,
+		":8443":          false,
+		"10.0.0.1:8443":  false,
+		"example.com:80": false,
+		"127.0.0.1":      false,
+	} {
+		if got := loopback(addr); got != want {
+			t.Errorf("loopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
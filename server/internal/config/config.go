@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"time"
 )
@@ -16,10 +17,24 @@ type Config struct {
 
 // ServerConfig define os parâmetros de exposição do servidor.
 type ServerConfig struct {
-	Address     string
-	Port        string
-	MetricsPort string
-	LogLevel    string
+	Address       string
+	Port          string
+	MetricsPort   string
+	LogLevel      string
+	HTTPAddress   string        // listener HTTP compartilhado (roteamento por Host); vazio desabilita
+	HTTPErrorPage string        // página HTML exibida quando o cliente da rota está offline
+	TLSAddress    string        // listener TLS compartilhado (passthrough por SNI); vazio desabilita
+	GracePeriod   time.Duration // listeners ficam abertos após a queda do cliente; 0 desabilita
+	GraceQueue    int           // conexões retidas por cliente aguardando a reconexão
+	AutoReload    time.Duration // intervalo de verificação de mudanças no banco; 0 desabilita
+	AdminAddress  string        // API de administração com tokens de operador; vazio desabilita
+	WebAddress    string        // dashboard web com login de operador; vazio desabilita
+	WebInsecure   bool          // aceita o dashboard sem TLS em endereço de loopback
+
+	NodeID           string // nome do nó no cluster (padrão: hostname)
+	ClusterAddress   string // listener do relay entre nós; vazio = servidor único
+	ClusterAdvertise string // endereço do relay usado pelos outros nós
+	ClusterToken     string // segredo compartilhado pelos nós do cluster
 }
 
 // ClientConfig agrupa as configurações específicas do cliente.
@@ -43,12 +58,49 @@ type TLSConfig struct {
 
 // LoadServerConfig carrega configurações do servidor a partir do ambiente.
 func LoadServerConfig() *ServerConfig {
-	return &ServerConfig{
-		Address:     getEnv("SERVER_ADDRESS", "0.0.0.0"),
-		Port:        getEnv("SERVER_PORT", "50051"),
-		MetricsPort: getEnv("METRICS_PORT", "9090"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+	cfg := &ServerConfig{
+		Address:       getEnv("SERVER_ADDRESS", "0.0.0.0"),
+		Port:          getEnv("SERVER_PORT", "50051"),
+		MetricsPort:   getEnv("METRICS_PORT", "9090"),
+		LogLevel:      getEnv("LOG_LEVEL", "info"),
+		HTTPAddress:   getEnv("HTTP_ROUTER_ADDRESS", ""),
+		HTTPErrorPage: getEnv("HTTP_ERROR_PAGE", ""),
+		TLSAddress:    getEnv("TLS_ROUTER_ADDRESS", ""),
+		GracePeriod:   getDurationEnv("GRACE_PERIOD", 0),
+		GraceQueue:    getIntEnv("GRACE_QUEUE", 64),
+		AutoReload:    getDurationEnv("AUTO_RELOAD_INTERVAL", 2*time.Second),
+		AdminAddress:  getEnv("ADMIN_ADDRESS", ""),
+		WebAddress:    getEnv("WEB_ADDRESS", ""),
+		WebInsecure:   getBoolEnv("WEB_INSECURE_LOOPBACK", false),
+	}
+
+	cfg.NodeID = getEnv("NODE_ID", hostname())
+	cfg.ClusterAddress = getEnv("CLUSTER_ADDRESS", "")
+	cfg.ClusterAdvertise = getEnv("CLUSTER_ADVERTISE", advertise(cfg.ClusterAddress, cfg.NodeID))
+	cfg.ClusterToken = getEnv("CLUSTER_TOKEN", "")
+	return cfg
+}
+
+// hostname retorna o nome da máquina, usado como NODE_ID padrão
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "voidprobe"
+	}
+	return name
+}
+
+// advertise deriva o endereço anunciado do listener: sem host (ou 0.0.0.0)
+// usa o nome do nó
+func advertise(address, node string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = node
 	}
+	return net.JoinHostPort(host, port)
 }
 
 // LoadClientConfig carrega configurações do cliente a partir do ambiente.
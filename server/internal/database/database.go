@@ -1,28 +1,17 @@
 package database
 
 import (
-	"database/sql"
-	"embed"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
-	"path/filepath"
-	"sync"
-
-	_ "modernc.org/sqlite"
-)
-
-//go:embed schema.sql
-var schemaFS embed.FS
-
-// DB é a instância global do banco de dados
-var (
-	db   *sql.DB
-	once sync.Once
+	"strings"
 )
 
 // Config configuração do banco
 type Config struct {
+	// Path é o arquivo SQLite ou a URL do PostgreSQL (postgres://...), que
+	// permite várias instâncias do servidor compartilharem o estado
 	Path string
 }
 
@@ -40,57 +29,66 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// Init inicializa o banco de dados
-func Init(cfg *Config) error {
-	var initErr error
-
-	once.Do(func() {
-		// Criar diretório se não existir
-		dir := filepath.Dir(cfg.Path)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			initErr = fmt.Errorf("failed to create database directory: %w", err)
-			return
-		}
-
-		// Conectar ao banco
-		var err error
-		db, err = sql.Open("sqlite", cfg.Path)
-		if err != nil {
-			initErr = fmt.Errorf("failed to open database: %w", err)
-			return
-		}
+// Init abre o banco do servidor e aplica as migrações pendentes. Portas
+// alocadas por este Store (pools e modelos) também precisam aceitar bind
+// neste host, onde os listeners abrem.
+func Init(cfg *Config) (Store, error) {
+	store, err := open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	store.bindCheck = true
 
-		// Configurar pool de conexões
-		db.SetMaxOpenConns(1) // SQLite funciona melhor com uma conexão
-		db.SetMaxIdleConns(1)
+	// Aplica as migrações pendentes (recusa banco mais novo que o binário)
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		log.Printf("Database migrated: %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
 
-		// Executar schema
-		schema, err := schemaFS.ReadFile("schema.sql")
-		if err != nil {
-			initErr = fmt.Errorf("failed to read schema: %w", err)
-			return
-		}
+	log.Printf("Database initialized: %s", Describe(cfg.Path))
+	return store, nil
+}
 
-		if _, err := db.Exec(string(schema)); err != nil {
-			initErr = fmt.Errorf("failed to execute schema: %w", err)
-			return
-		}
+// Open conecta ao banco sem migrar: PostgreSQL para URLs postgres:// ou
+// postgresql://, SQLite para os demais caminhos
+func Open(dsn string) (Store, error) {
+	return open(dsn)
+}
 
-		log.Printf("Database initialized: %s", cfg.Path)
-	})
+func open(dsn string) (*Repository, error) {
+	d := sqliteDialect
+	if IsPostgres(dsn) {
+		d = postgresDialect
+	}
 
-	return initErr
+	db, err := d.open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return &Repository{db: db, dialect: d}, nil
 }
 
-// GetDB retorna a instância do banco
-func GetDB() *sql.DB {
-	return db
+// IsPostgres informa se dsn é uma URL do PostgreSQL
+func IsPostgres(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
 }
 
-// Close fecha a conexão
-func Close() error {
-	if db != nil {
-		return db.Close()
+// Describe exibe o banco em logs, sem a senha da URL do PostgreSQL
+func Describe(dsn string) string {
+	if !IsPostgres(dsn) {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "postgres"
 	}
-	return nil
+	return u.Redacted()
 }
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// dialect reúne o que muda entre os bancos suportados. As consultas do
+// Repository são escritas para o SQLite e traduzidas por rebind; schema,
+// triggers e detecção de mudanças têm uma versão por banco.
+type dialect struct {
+	name string
+
+	// open conecta e configura o pool
+	open func(dsn string) (*sql.DB, error)
+
+	// rebind traduz uma consulta escrita para o SQLite
+	rebind func(query string) string
+
+	// migrations é o diretório das migrações em migrationsFS e steps os
+	// passos em Go executados depois do SQL da migração de mesma versão
+	migrations string
+	steps      map[int]func(tx *sql.Tx) error
+
+	// schemaMigrations cria a tabela de controle das migrações
+	schemaMigrations string
+
+	// hasTable conta as tabelas com o nome informado (parâmetro)
+	hasTable string
+
+	// lockMigrations serializa migrações de instâncias que iniciam juntas
+	lockMigrations string
+
+	// dataVersion lê um valor que muda quando outro processo grava configuração
+	dataVersion string
+
+	// revisionTriggers gera os triggers que gravam revisões de clients e
+	// client_ports (recriados a cada Migrate)
+	revisionTriggers func() string
+}
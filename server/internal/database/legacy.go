@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Bancos criados antes das migrações versionadas: a migração 0001 cria o
+// schema base com CREATE TABLE IF NOT EXISTS e adoptLegacy completa tabelas
+// antigas. Mudanças novas de schema entram como novos arquivos em migrations/.
+
+// upgradePorts recria client_ports com a definição atual (destinos unix://, socks5, PROXY protocol, janelas, health checks).
+// A tabela nova é criada ao lado e renomeada no fim: renomear a antiga faria as
+// chaves estrangeiras de port_health e port_state seguirem client_ports_old.
+const upgradePorts = `
+CREATE TABLE client_ports_new (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id     TEXT NOT NULL,
+  exposed_port  INTEGER NOT NULL,
+  target_host   TEXT NOT NULL DEFAULT '127.0.0.1',
+  target_port   INTEGER,
+  proto         TEXT NOT NULL DEFAULT 'tcp',
+  mode          TEXT NOT NULL DEFAULT 'forward',
+  auth_user     TEXT,
+  auth_hash     TEXT,
+  proxy_protocol TEXT NOT NULL DEFAULT '',
+  accept_proxy  INTEGER NOT NULL DEFAULT 0,
+  expires_at    TEXT,
+  schedule      TEXT,
+  health_check  TEXT NOT NULL DEFAULT 'tcp',
+  refuse_unhealthy INTEGER NOT NULL DEFAULT 0,
+  enabled       INTEGER NOT NULL DEFAULT 1,
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+  CHECK (exposed_port BETWEEN 1 AND 65535),
+  CHECK (
+    (mode = 'socks5' AND target_port IS NULL) OR
+    (target_port IS NOT NULL AND target_port BETWEEN 1 AND 65535 AND target_host NOT LIKE 'unix://%') OR
+    (target_port IS NULL AND target_host LIKE 'unix://%')
+  ),
+  CHECK (mode IN ('forward','socks5')),
+  CHECK (mode <> 'socks5' OR (auth_user IS NOT NULL AND auth_hash IS NOT NULL)),
+  CHECK (proxy_protocol IN ('','v1','v2')),
+  CHECK (accept_proxy IN (0,1)),
+  CHECK (health_check IN ('off','tcp','tls','http') OR health_check LIKE 'http:/%'),
+  CHECK (refuse_unhealthy IN (0,1)),
+  CHECK (enabled IN (0,1)),
+  CHECK (proto IN ('tcp','udp')),
+  UNIQUE (exposed_port),
+  UNIQUE (client_id, target_host, target_port, proto)
+);
+
+INSERT INTO client_ports_new (id, client_id, exposed_port, target_host, target_port, proto, enabled, created_at)
+SELECT id, client_id, exposed_port, target_host, target_port, proto, enabled, created_at FROM client_ports;
+
+DROP TABLE client_ports;
+ALTER TABLE client_ports_new RENAME TO client_ports;
+
+CREATE INDEX IF NOT EXISTS idx_ports_client ON client_ports(client_id);
+CREATE INDEX IF NOT EXISTS idx_ports_enabled ON client_ports(enabled);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ports_unix_target
+  ON client_ports(client_id, target_host, proto)
+  WHERE target_port IS NULL AND target_host LIKE 'unix://%';
+`
+
+// addedColumns lista colunas incluídas antes das migrações (ALTER TABLE ADD COLUMN)
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"client_ports", "proxy_protocol", "TEXT NOT NULL DEFAULT '' CHECK (proxy_protocol IN ('','v1','v2'))"},
+	{"client_ports", "accept_proxy", "INTEGER NOT NULL DEFAULT 0 CHECK (accept_proxy IN (0,1))"},
+	{"client_ports", "expires_at", "TEXT"},
+	{"client_ports", "schedule", "TEXT"},
+	{"client_ports", "health_check", "TEXT NOT NULL DEFAULT 'tcp' CHECK (health_check IN ('off','tcp','tls','http') OR health_check LIKE 'http:/%')"},
+	{"client_ports", "refuse_unhealthy", "INTEGER NOT NULL DEFAULT 0 CHECK (refuse_unhealthy IN (0,1))"},
+	{"clients", "group_name", "TEXT"},
+	{"client_forwards", "target_client_id", "TEXT REFERENCES clients(client_id) ON DELETE CASCADE"},
+	{"operators", "role", "TEXT NOT NULL DEFAULT 'operator' CHECK (role IN ('viewer','operator','admin'))"},
+	{"operators", "client_groups", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// adoptLegacy aplica a bancos anteriores às migrações as alterações que
+// CREATE TABLE IF NOT EXISTS não cobre (no-op em bancos novos)
+func adoptLegacy(tx *sql.Tx) error {
+	current, err := hasColumn(tx, "client_ports", "mode")
+	if err != nil {
+		return err
+	}
+	if !current {
+		if _, err := tx.Exec(upgradePorts); err != nil {
+			return fmt.Errorf("failed to recreate client_ports: %w", err)
+		}
+		log.Println("Database upgraded: client_ports recreated with current definition")
+	}
+
+	for _, c := range addedColumns {
+		exists, err := hasColumn(tx, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+		log.Printf("Database upgraded: added column %s.%s", c.table, c.column)
+	}
+
+	return nil
+}
+
+// hasColumn informa se a tabela já possui a coluna
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s.%s: %w", table, column, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Migrações versionadas: migrations/<banco>/NNNN_nome.sql, aplicadas em
+// ordem, cada uma na sua transação, e registradas em schema_migrations.
+// Arquivos já publicados não mudam; alterações de schema entram como um novo
+// arquivo, com a mesma versão nos diretórios de todos os bancos.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationsFS embed.FS
+
+// ErrSchemaTooNew indica um banco migrado por uma versão mais nova do voidprobe
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration é uma migração embutida no binário
+type Migration struct {
+	Version   int
+	Name      string
+	AppliedAt string // vazio = pendente
+	sql       string
+}
+
+// migrations lista as migrações embutidas do diretório em ordem de versão
+func migrations(dir string) ([]Migration, error) {
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Migration
+	for _, e := range entries {
+		num, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration file name %q (use NNNN_name.sql)", e.Name())
+		}
+		data, err := migrationsFS.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(list) > 0 && list[len(list)-1].Version >= version {
+			return nil, fmt.Errorf("migration %d is out of order or duplicated", version)
+		}
+		list = append(list, Migration{Version: version, Name: name, sql: string(data)})
+	}
+	return list, nil
+}
+
+// LatestVersion é a versão de schema mais nova conhecida pelo binário
+func (r *Repository) LatestVersion() int {
+	list, err := migrations(r.dialect.migrations)
+	if err != nil || len(list) == 0 {
+		return 0
+	}
+	return list[len(list)-1].Version
+}
+
+// MigrationStatus lista as migrações conhecidas com a data em que foram
+// aplicadas e a versão atual do banco (que pode ser maior que a do binário)
+func (r *Repository) MigrationStatus() ([]Migration, int, error) {
+	list, err := migrations(r.dialect.migrations)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var exists int
+	if err := r.queryRow(r.dialect.hasTable, "schema_migrations").Scan(&exists); err != nil {
+		return nil, 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if exists == 0 {
+		return list, 0, nil
+	}
+
+	rows, err := r.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	current := 0
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, 0, err
+		}
+		applied[version] = at
+		current = max(current, version)
+	}
+	for i := range list {
+		list[i].AppliedAt = applied[list[i].Version]
+	}
+	return list, current, rows.Err()
+}
+
+// CheckVersion recusa bancos migrados por um binário mais novo
+func (r *Repository) CheckVersion() (current, latest int, err error) {
+	_, current, err = r.MigrationStatus()
+	if err != nil {
+		return 0, 0, err
+	}
+	latest = r.LatestVersion()
+	if current > latest {
+		return current, latest, fmt.Errorf("%w (database version %d, this binary supports up to %d); upgrade voidprobe", ErrSchemaTooNew, current, latest)
+	}
+	return current, latest, nil
+}
+
+// Migrate aplica as migrações pendentes e recria os triggers de revisão.
+// Retorna as migrações aplicadas agora.
+func (r *Repository) Migrate() ([]Migration, error) {
+	if _, err := r.db.Exec(r.dialect.schemaMigrations); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	if _, _, err := r.CheckVersion(); err != nil {
+		return nil, err
+	}
+	list, _, err := r.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range list {
+		if m.AppliedAt != "" {
+			continue
+		}
+		done, err := r.apply(m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if done {
+			applied = append(applied, m)
+		}
+	}
+
+	// Triggers recriados depois das migrações para acompanhar as colunas atuais
+	err = r.migrationTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(r.dialect.revisionTriggers())
+		return err
+	})
+	if err != nil {
+		return applied, fmt.Errorf("failed to create revision triggers: %w", err)
+	}
+	return applied, nil
+}
+
+// apply executa uma migração e a registra na mesma transação; retorna false
+// se outra instância a aplicou enquanto esta esperava o lock
+func (r *Repository) apply(m Migration) (done bool, err error) {
+	err = r.migrationTx(func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRow(r.dialect.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), m.Version).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			return nil
+		}
+
+		if _, err := tx.Exec(m.sql); err != nil {
+			return err
+		}
+		if step := r.dialect.steps[m.Version]; step != nil {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(r.dialect.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), m.Version, m.Name); err != nil {
+			return err
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
+
+// migrationTx executa fn numa transação com o lock de migrações do banco
+func (r *Repository) migrationTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if r.dialect.lockMigrations != "" {
+		if _, err := tx.Exec(r.dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
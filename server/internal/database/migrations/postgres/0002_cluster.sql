@@ -0,0 +1,22 @@
+-- Cluster: nós do servidor que compartilham o banco e o nó em que cada
+-- cliente está conectado. Escritas só pelo servidor, não disparam reload.
+
+-- NÓS (heartbeat periódico; sem heartbeat recente o nó é considerado fora)
+CREATE TABLE IF NOT EXISTS nodes (
+  node_id       TEXT PRIMARY KEY,                 -- NODE_ID do servidor (padrão: hostname)
+  address       TEXT NOT NULL,                    -- endereço do relay entre nós (host:porta)
+  started_at    TEXT NOT NULL DEFAULT (utc_now()),
+  last_seen_at  TEXT NOT NULL DEFAULT (utc_now())
+);
+
+-- CLIENTES CONECTADOS (uma linha por cliente: a última conexão vence)
+CREATE TABLE IF NOT EXISTS client_nodes (
+  client_id     TEXT PRIMARY KEY,
+  node_id       TEXT NOT NULL,
+  attached_at   TEXT NOT NULL DEFAULT (utc_now()),
+
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+  FOREIGN KEY (node_id) REFERENCES nodes(node_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_nodes_node ON client_nodes(node_id);
@@ -0,0 +1,7 @@
+-- Autor das revisões gravadas pelos triggers. A linha é inserida no início
+-- da transação da mudança e apagada antes do commit: cada transação só
+-- enxerga a própria, então mudanças concorrentes ou sem autor não herdam o
+-- operador de outra.
+CREATE TABLE IF NOT EXISTS revision_actor (
+  operator_id   TEXT NOT NULL
+);
@@ -0,0 +1,261 @@
+-- VoidProbe: schema base (SQLite 3.x)
+-- Bancos anteriores às migrações também passam por aqui: as tabelas já
+-- existem e adoptLegacy (legacy.go) completa colunas antigas.
+
+-- CLIENTES
+CREATE TABLE IF NOT EXISTS clients (
+  client_id     TEXT PRIMARY KEY,                 -- UUID persistido no client
+  client_name   TEXT NOT NULL,                    -- nome/alias (ex: hostname)
+  key_hash      TEXT NOT NULL,                    -- hash da chave (NUNCA chave pura)
+  status        TEXT NOT NULL DEFAULT 'active',   -- active|blocked
+  group_name    TEXT,                             -- grupo do cliente (pools de portas), opcional
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  last_seen_at  TEXT,
+
+  CHECK (status IN ('active','blocked'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_clients_name ON clients(client_name);
+CREATE INDEX IF NOT EXISTS idx_clients_status ON clients(status);
+CREATE INDEX IF NOT EXISTS idx_clients_last_seen ON clients(last_seen_at);
+
+-- PORTAS (mapeamento exposta -> destino no cliente)
+CREATE TABLE IF NOT EXISTS client_ports (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id     TEXT NOT NULL,
+  exposed_port  INTEGER NOT NULL,                 -- porta no servidor (ex: 2222)
+  target_host   TEXT NOT NULL DEFAULT '127.0.0.1', -- host ou unix:///caminho/do/socket
+  target_port   INTEGER,                          -- porta no cliente (ex: 22), NULL para unix://
+  proto         TEXT NOT NULL DEFAULT 'tcp',       -- tcp (udp futuro)
+  mode          TEXT NOT NULL DEFAULT 'forward',   -- forward|socks5 (destino dinâmico)
+  auth_user     TEXT,                             -- usuário SOCKS5
+  auth_hash     TEXT,                             -- hash da senha SOCKS5 (NUNCA senha pura)
+  proxy_protocol TEXT NOT NULL DEFAULT '',         -- ''|v1|v2: header PROXY enviado pelo cliente ao destino
+  accept_proxy  INTEGER NOT NULL DEFAULT 0,        -- 0/1: listener exige header PROXY (servidor atrás de LB)
+  expires_at    TEXT,                             -- UTC; após esse instante o listener é fechado
+  schedule      TEXT,                             -- janelas semanais, ex: "mon-fri 08:00-18:00"
+  health_check  TEXT NOT NULL DEFAULT 'tcp',       -- off|tcp|tls|http[:/caminho] (sonda feita pelo cliente)
+  refuse_unhealthy INTEGER NOT NULL DEFAULT 0,     -- 0/1: recusa conexões enquanto o destino estiver down
+  enabled       INTEGER NOT NULL DEFAULT 1,        -- 0/1
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+
+  CHECK (exposed_port BETWEEN 1 AND 65535),
+  CHECK (
+    (mode = 'socks5' AND target_port IS NULL) OR
+    (target_port IS NOT NULL AND target_port BETWEEN 1 AND 65535 AND target_host NOT LIKE 'unix://%') OR
+    (target_port IS NULL AND target_host LIKE 'unix://%')
+  ),
+  CHECK (mode IN ('forward','socks5')),
+  CHECK (mode <> 'socks5' OR (auth_user IS NOT NULL AND auth_hash IS NOT NULL)),
+  CHECK (proxy_protocol IN ('','v1','v2')),
+  CHECK (accept_proxy IN (0,1)),
+  CHECK (health_check IN ('off','tcp','tls','http') OR health_check LIKE 'http:/%'),
+  CHECK (refuse_unhealthy IN (0,1)),
+  CHECK (enabled IN (0,1)),
+  CHECK (proto IN ('tcp','udp')),
+
+  UNIQUE (exposed_port),                          -- impede conflito de porta no servidor
+  UNIQUE (client_id, target_host, target_port, proto)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ports_client ON client_ports(client_id);
+CREATE INDEX IF NOT EXISTS idx_ports_enabled ON client_ports(enabled);
+
+-- Destinos unix:// têm target_port NULL, que o UNIQUE acima não compara:
+-- o índice parcial impede mapear o mesmo socket duas vezes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ports_unix_target
+  ON client_ports(client_id, target_host, proto)
+  WHERE target_port IS NULL AND target_host LIKE 'unix://%';
+
+-- SERVIÇOS DECLARADOS PELO CLIENTE (pendentes até o operador aprovar com uma porta)
+CREATE TABLE IF NOT EXISTS client_services (
+  client_id     TEXT NOT NULL,
+  name          TEXT NOT NULL,                    -- nome declarado no SERVICES do cliente
+  target_host   TEXT NOT NULL,                    -- host ou unix:///caminho/do/socket
+  target_port   INTEGER,                          -- NULL para unix://
+  port_id       INTEGER,                          -- mapeamento criado na aprovação (NULL = pendente)
+  offered_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  PRIMARY KEY (client_id, name),
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+  FOREIGN KEY (port_id) REFERENCES client_ports(id) ON DELETE SET NULL
+);
+
+-- OPERADORES (administração com papéis e acesso a destinos via voidprobe-cli connect)
+CREATE TABLE IF NOT EXISTS operators (
+  operator_id   TEXT PRIMARY KEY,
+  name          TEXT NOT NULL,
+  key_hash      TEXT NOT NULL,                    -- hash da chave/senha (NUNCA chave pura)
+  status        TEXT NOT NULL DEFAULT 'active',   -- active|blocked
+  role          TEXT NOT NULL DEFAULT 'operator', -- viewer|operator|admin
+  client_groups TEXT NOT NULL DEFAULT '',         -- grupos de clientes permitidos, separados por vírgula ('' = todos)
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  last_seen_at  TEXT,
+
+  CHECK (status IN ('active','blocked')),
+  CHECK (role IN ('viewer','operator','admin'))
+);
+
+-- TOKENS DA API DE ADMINISTRAÇÃO (emitidos para um operador, com escopos)
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  operator_id   TEXT NOT NULL,
+  name          TEXT NOT NULL,                    -- descrição (ex: ci, notebook)
+  token_hash    TEXT NOT NULL,                    -- hash do token (NUNCA token puro)
+  scopes        TEXT NOT NULL,                    -- lista separada por vírgula: read,write,control,events
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  last_used_at  TEXT,
+
+  FOREIGN KEY (operator_id) REFERENCES operators(operator_id) ON DELETE CASCADE,
+
+  UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_operator ON api_tokens(operator_id);
+
+-- AUDITORIA (autor de cada mudança feita pela API, dashboard ou voidprobe-cli)
+CREATE TABLE IF NOT EXISTS audit_log (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  operator_id   TEXT NOT NULL,                    -- operador ou local:<usuário> (acesso direto ao banco)
+  client_id     TEXT,                             -- NULL para mudanças globais (pools, operadores, tokens)
+  action        TEXT NOT NULL                     -- descrição (ex: port 3 disabled)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_client ON audit_log(client_id, id);
+
+-- REVISÕES (cada mudança em clients e client_ports, gravada por triggers; history/rollback)
+CREATE TABLE IF NOT EXISTS revisions (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  operator_id   TEXT,                             -- autor, preenchido junto com o audit_log (NULL = sem registro)
+  table_name    TEXT NOT NULL,                    -- clients|client_ports
+  row_key       TEXT NOT NULL,                    -- client_id ou id do mapeamento
+  client_id     TEXT NOT NULL,
+  op            TEXT NOT NULL,                    -- insert|update|delete
+  before_data   TEXT,                             -- linha antes da mudança (JSON; NULL em insert)
+  after_data    TEXT,                             -- linha depois da mudança (JSON; NULL em delete)
+
+  CHECK (table_name IN ('clients','client_ports')),
+  CHECK (op IN ('insert','update','delete'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_revisions_client ON revisions(client_id, id);
+
+-- LOCAL-FORWARDS (listener na rede do cliente -> destino alcançável pelo servidor)
+CREATE TABLE IF NOT EXISTS client_forwards (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id     TEXT NOT NULL,
+  listen_host   TEXT NOT NULL DEFAULT '0.0.0.0',   -- endereço de bind no cliente
+  listen_port   INTEGER NOT NULL,                  -- porta aberta na rede do cliente
+  target_host   TEXT NOT NULL,                     -- host alcançável pelo servidor (ou pelo target_client_id)
+  target_port   INTEGER NOT NULL,
+  enabled       INTEGER NOT NULL DEFAULT 1,        -- 0/1
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+  target_client_id TEXT,                           -- cliente que conecta ao destino (NULL = servidor)
+
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+  FOREIGN KEY (target_client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+
+  CHECK (listen_port BETWEEN 1 AND 65535),
+  CHECK (target_port BETWEEN 1 AND 65535),
+  CHECK (enabled IN (0,1)),
+
+  UNIQUE (client_id, listen_host, listen_port)    -- impede conflito de porta no cliente
+);
+
+CREATE INDEX IF NOT EXISTS idx_forwards_client ON client_forwards(client_id);
+
+-- LINKS ENTRE CLIENTES (pares autorizados a usar local-forwards com target_client_id)
+CREATE TABLE IF NOT EXISTS client_links (
+  source_client_id TEXT NOT NULL,                  -- cliente que abre o listener
+  target_client_id TEXT NOT NULL,                  -- cliente que conecta ao destino
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  PRIMARY KEY (source_client_id, target_client_id),
+  FOREIGN KEY (source_client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+  FOREIGN KEY (target_client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+
+  CHECK (source_client_id <> target_client_id)
+);
+
+-- ROTAS HTTP (porta pública compartilhada, roteamento pelo header Host)
+CREATE TABLE IF NOT EXISTS http_routes (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  hostname      TEXT NOT NULL,                     -- ex: grafana.example.com ou *.lab.example.com
+  client_id     TEXT NOT NULL,
+  target_host   TEXT NOT NULL DEFAULT '127.0.0.1',
+  target_port   INTEGER NOT NULL,                  -- porta HTTP no cliente
+  enabled       INTEGER NOT NULL DEFAULT 1,        -- 0/1
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+
+  CHECK (target_port BETWEEN 1 AND 65535),
+  CHECK (enabled IN (0,1)),
+
+  UNIQUE (hostname)
+);
+
+CREATE INDEX IF NOT EXISTS idx_http_routes_client ON http_routes(client_id);
+
+-- ROTAS TLS (passthrough pelo SNI, sem terminar TLS; hostname "*" = rota padrão)
+CREATE TABLE IF NOT EXISTS tls_routes (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  hostname      TEXT NOT NULL,                     -- ex: app.example.com, *.example.com ou *
+  client_id     TEXT NOT NULL,
+  target_host   TEXT NOT NULL DEFAULT '127.0.0.1',
+  target_port   INTEGER NOT NULL,                  -- porta TLS no cliente
+  enabled       INTEGER NOT NULL DEFAULT 1,        -- 0/1
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  FOREIGN KEY (client_id) REFERENCES clients(client_id) ON DELETE CASCADE,
+
+  CHECK (target_port BETWEEN 1 AND 65535),
+  CHECK (enabled IN (0,1)),
+
+  UNIQUE (hostname)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tls_routes_client ON tls_routes(client_id);
+
+-- POOLS DE PORTAS (alocação automática de exposed_port; group_name NULL = pool padrão)
+CREATE TABLE IF NOT EXISTS port_pools (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  group_name    TEXT,                             -- usado só por clientes desse grupo
+  range_start   INTEGER NOT NULL,
+  range_end     INTEGER NOT NULL,
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  CHECK (range_start BETWEEN 1 AND 65535),
+  CHECK (range_end BETWEEN range_start AND 65535)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pools_group ON port_pools(group_name);
+
+-- SAÚDE DOS DESTINOS (reportada pelo cliente; uma linha por mapeamento)
+CREATE TABLE IF NOT EXISTS port_health (
+  port_id       INTEGER PRIMARY KEY,
+  status        TEXT NOT NULL DEFAULT 'unknown',   -- up|down|unknown
+  detail        TEXT,                             -- motivo da falha (ex: connection refused)
+  reported_at   TEXT NOT NULL DEFAULT (datetime('now')),
+  changed_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  FOREIGN KEY (port_id) REFERENCES client_ports(id) ON DELETE CASCADE,
+
+  CHECK (status IN ('up','down','unknown'))
+);
+
+-- ESTADO DOS MAPEAMENTOS (escrito pelo servidor; linha ausente = cliente offline)
+CREATE TABLE IF NOT EXISTS port_state (
+  port_id       INTEGER PRIMARY KEY,
+  state         TEXT NOT NULL,                    -- listening|bind_error|client_offline|disabled
+  detail        TEXT,                             -- erro do bind ou motivo (expired, outside schedule)
+  updated_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  FOREIGN KEY (port_id) REFERENCES client_ports(id) ON DELETE CASCADE,
+
+  CHECK (state IN ('listening','bind_error','client_offline','disabled'))
+);
@@ -0,0 +1,4 @@
+-- Tags livres dos clientes, ex: "env=prod,site=lisbon" (chaves em ordem;
+-- NULL = sem tags). Usadas pelos seletores de client-list, port-list,
+-- connected e bulk. Gravadas em clients para entrarem nas revisões.
+ALTER TABLE clients ADD COLUMN tags TEXT;
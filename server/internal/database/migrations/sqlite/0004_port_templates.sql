@@ -0,0 +1,38 @@
+-- Modelos de porta: listas de destinos aplicadas a clientes ou grupos. Os
+-- mapeamentos gerados ficam em client_ports com template_port_id e são
+-- criados e removidos pela sincronização dos modelos (SyncTemplates).
+
+-- MODELOS (allocation: pool = pool do grupo do cliente, ou faixa "inicio-fim")
+CREATE TABLE IF NOT EXISTS port_templates (
+  name          TEXT PRIMARY KEY,
+  allocation    TEXT NOT NULL DEFAULT 'pool',
+  created_at    TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+-- DESTINOS DE CADA MODELO
+CREATE TABLE IF NOT EXISTS template_ports (
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  template_name TEXT NOT NULL,
+  target_host   TEXT NOT NULL DEFAULT '127.0.0.1', -- host ou unix:///caminho/do/socket
+  target_port   INTEGER NOT NULL DEFAULT 0,       -- 0 para unix://
+
+  UNIQUE (template_name, target_host, target_port),
+  FOREIGN KEY (template_name) REFERENCES port_templates(name) ON DELETE CASCADE
+);
+
+-- CLIENTES E GRUPOS QUE RECEBEM CADA MODELO
+CREATE TABLE IF NOT EXISTS template_attachments (
+  template_name TEXT NOT NULL,
+  kind          TEXT NOT NULL,                    -- client|group
+  name          TEXT NOT NULL,                    -- client_id ou grupo
+  created_at    TEXT NOT NULL DEFAULT (datetime('now')),
+
+  PRIMARY KEY (template_name, kind, name),
+  CHECK (kind IN ('client', 'group')),
+  FOREIGN KEY (template_name) REFERENCES port_templates(name) ON DELETE CASCADE
+);
+
+-- Destino do modelo que gerou o mapeamento (NULL = criado à mão)
+ALTER TABLE client_ports ADD COLUMN template_port_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_client_ports_template ON client_ports(template_port_id);
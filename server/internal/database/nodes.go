@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Heartbeat dos nós do cluster: sem heartbeat em NodeTimeout o nó é
+// considerado fora e os outros nós deixam de encaminhar conexões a ele
+const (
+	HeartbeatInterval = 5 * time.Second
+	NodeTimeout       = 3 * HeartbeatInterval
+)
+
+// Node é um servidor do cluster (instâncias que compartilham o banco)
+type Node struct {
+	NodeID     string
+	Address    string // endereço do relay entre nós
+	StartedAt  string
+	LastSeenAt string
+	Idle       time.Duration // desde o último heartbeat, pelo relógio do banco
+	Clients    int           // clientes conectados ao nó
+}
+
+// Alive informa se o nó mandou heartbeat dentro de NodeTimeout
+func (n Node) Alive() bool {
+	return n.Idle < NodeTimeout
+}
+
+// ClientNode é o nó em que um cliente está conectado
+type ClientNode struct {
+	ClientID   string
+	AttachedAt string
+	Node       Node
+}
+
+// nodeColumns inclui o horário atual do banco para calcular Node.Idle sem
+// depender do relógio de cada servidor
+const nodeColumns = `n.node_id, n.address, n.started_at, n.last_seen_at, datetime('now')`
+
+// nodeFields retorna os destinos de nodeColumns; now recebe o horário do banco
+func nodeFields(n *Node, now *string) []interface{} {
+	return []interface{}{&n.NodeID, &n.Address, &n.StartedAt, &n.LastSeenAt, now}
+}
+
+// setIdle calcula o tempo desde o último heartbeat; datas ilegíveis contam como nó fora
+func (n *Node) setIdle(now string) {
+	seen, err1 := time.Parse(time.DateTime, n.LastSeenAt)
+	current, err2 := time.Parse(time.DateTime, now)
+	if err1 != nil || err2 != nil {
+		n.Idle = time.Duration(math.MaxInt64)
+		return
+	}
+	n.Idle = current.Sub(seen)
+}
+
+// StartNode registra o nó ao iniciar: clientes que ele atendia antes de
+// reiniciar ficam offline até reconectarem (a este ou a outro nó)
+func (r *Repository) StartNode(nodeID, address string) error {
+	return r.inTx(func(tx *Repository) error {
+		if _, err := tx.exec(`
+			INSERT INTO nodes (node_id, address) VALUES (?, ?)
+			ON CONFLICT (node_id) DO UPDATE SET
+				address = excluded.address,
+				started_at = datetime('now'),
+				last_seen_at = datetime('now')
+		`, nodeID, address); err != nil {
+			return fmt.Errorf("failed to register node: %w", err)
+		}
+		return tx.releaseClients(nodeID)
+	})
+}
+
+// NodeHeartbeat atualiza last_seen_at do nó (recriando-o se foi removido)
+func (r *Repository) NodeHeartbeat(nodeID, address string) error {
+	_, err := r.exec(`
+		INSERT INTO nodes (node_id, address) VALUES (?, ?)
+		ON CONFLICT (node_id) DO UPDATE SET
+			address = excluded.address,
+			last_seen_at = datetime('now')
+	`, nodeID, address)
+	if err != nil {
+		return fmt.Errorf("failed to update node heartbeat: %w", err)
+	}
+	return nil
+}
+
+// ListNodes lista os nós com a quantidade de clientes conectados
+func (r *Repository) ListNodes() ([]Node, error) {
+	rows, err := r.query(`
+		SELECT ` + nodeColumns + `, (SELECT COUNT(*) FROM client_nodes c WHERE c.node_id = n.node_id)
+		FROM nodes n ORDER BY n.node_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []Node
+	for rows.Next() {
+		var n Node
+		var now string
+		if err := rows.Scan(append(nodeFields(&n, &now), &n.Clients)...); err != nil {
+			return nil, err
+		}
+		n.setIdle(now)
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// RemoveNode apaga um nó desativado; seus clientes ficam offline
+func (r *Repository) RemoveNode(nodeID string) error {
+	return r.inTx(func(tx *Repository) error {
+		if err := tx.releaseClients(nodeID); err != nil {
+			return err
+		}
+		return tx.affect("node", nodeID, "DELETE FROM nodes WHERE node_id = ?", nodeID)
+	})
+}
+
+// releaseClients marca offline os mapeamentos dos clientes do nó e apaga os registros
+func (r *Repository) releaseClients(nodeID string) error {
+	if _, err := r.exec(`
+		UPDATE port_state SET state = 'client_offline', detail = NULL, updated_at = datetime('now')
+		WHERE port_id IN (SELECT p.id FROM client_ports p
+		                  JOIN client_nodes c ON c.client_id = p.client_id
+		                  WHERE c.node_id = ?)
+	`, nodeID); err != nil {
+		return fmt.Errorf("failed to update port states: %w", err)
+	}
+	if _, err := r.exec("DELETE FROM client_nodes WHERE node_id = ?", nodeID); err != nil {
+		return fmt.Errorf("failed to release clients: %w", err)
+	}
+	return nil
+}
+
+// AttachClient registra o cliente no nó em que acabou de conectar; a última
+// conexão vence, inclusive sobre o registro de outro nó
+func (r *Repository) AttachClient(clientID, nodeID string) error {
+	_, err := r.exec(`
+		INSERT INTO client_nodes (client_id, node_id) VALUES (?, ?)
+		ON CONFLICT (client_id) DO UPDATE SET
+			node_id = excluded.node_id,
+			attached_at = datetime('now')
+	`, clientID, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to attach client to node: %w", err)
+	}
+	return nil
+}
+
+// DetachClient apaga o registro do cliente no nó; moved indica que ele já
+// está registrado em outro nó (reconectou lá) e o registro foi mantido
+func (r *Repository) DetachClient(clientID, nodeID string) (moved bool, err error) {
+	var owner string
+	err = r.queryRow("SELECT node_id FROM client_nodes WHERE client_id = ?", clientID).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get client node: %w", err)
+	}
+	if owner != nodeID {
+		return true, nil
+	}
+
+	if _, err := r.exec("DELETE FROM client_nodes WHERE client_id = ? AND node_id = ?", clientID, nodeID); err != nil {
+		return false, fmt.Errorf("failed to detach client from node: %w", err)
+	}
+	return false, nil
+}
+
+// ListClientNodes lista os clientes conectados e o nó de cada um
+func (r *Repository) ListClientNodes() ([]ClientNode, error) {
+	rows, err := r.query(`
+		SELECT ` + nodeColumns + `, c.client_id, c.attached_at
+		FROM client_nodes c JOIN nodes n ON n.node_id = c.node_id
+		ORDER BY c.client_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list client nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ClientNode
+	for rows.Next() {
+		var cn ClientNode
+		var now string
+		if err := rows.Scan(append(nodeFields(&cn.Node, &now), &cn.ClientID, &cn.AttachedAt)...); err != nil {
+			return nil, err
+		}
+		cn.Node.setIdle(now)
+		list = append(list, cn)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresDialect guarda o estado num PostgreSQL compartilhado por várias
+// instâncias do servidor. O schema espelha o do SQLite (datas em TEXT UTC,
+// flags em INTEGER), então as consultas mudam só na sintaxe.
+var postgresDialect = &dialect{
+	name:       "postgres",
+	open:       openPostgres,
+	rebind:     rebindPostgres,
+	migrations: "migrations/postgres",
+	schemaMigrations: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version     INTEGER PRIMARY KEY,
+		  name        TEXT NOT NULL,
+		  applied_at  TEXT NOT NULL DEFAULT (to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'))
+		)`,
+	hasTable:       "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?",
+	lockMigrations: "LOCK TABLE schema_migrations IN EXCLUSIVE MODE",
+	// Contador incrementado por triggers de clients, client_ports e client_forwards
+	dataVersion:      "SELECT version FROM data_version",
+	revisionTriggers: postgresRevisionTriggers,
+}
+
+func openPostgres(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	return db, nil
+}
+
+// rebindPostgres troca os parâmetros ? e ?N por $N e datetime('now') por
+// utc_now() (função criada pela migração 0001)
+func rebindPostgres(query string) string {
+	query = strings.ReplaceAll(query, "datetime('now')", "utc_now()")
+
+	var b strings.Builder
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			quoted = !quoted
+		}
+		if c != '?' || quoted {
+			b.WriteByte(c)
+			continue
+		}
+
+		j := i + 1
+		for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+			j++
+		}
+		if j > i+1 {
+			b.WriteString("$" + query[i+1:j])
+			i = j - 1
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// postgresRevisionTriggers grava cada insert, update e delete em revisions,
+// com a linha antes e depois em JSON (mesmo formato do SQLite) e o autor de
+// revision_actor
+func postgresRevisionTriggers() string {
+	var b strings.Builder
+	for _, table := range []string{"clients", "client_ports"} {
+		key := revisionKeys[table]
+		row := func(prefix string) string {
+			var fields []string
+			for _, c := range revisionColumns[table] {
+				fields = append(fields, fmt.Sprintf("'%s', %s.%s", c, prefix, c))
+			}
+			return "jsonb_build_object(" + strings.Join(fields, ", ") + ")::text"
+		}
+
+		fmt.Fprintf(&b, `
+CREATE OR REPLACE FUNCTION revision_%[1]s() RETURNS trigger AS $$
+DECLARE
+  b TEXT;
+  a TEXT;
+  k TEXT;
+  c TEXT;
+  o TEXT;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    k := OLD.%[2]s::text;
+    c := OLD.client_id;
+  ELSE
+    k := NEW.%[2]s::text;
+    c := NEW.client_id;
+  END IF;
+  IF TG_OP <> 'INSERT' THEN
+    b := %[4]s;
+  END IF;
+  IF TG_OP <> 'DELETE' THEN
+    a := %[3]s;
+  END IF;
+  IF TG_OP = 'UPDATE' AND a = b THEN
+    RETURN NULL;
+  END IF;
+  SELECT MAX(operator_id) INTO o FROM revision_actor;
+  INSERT INTO revisions (operator_id, table_name, row_key, client_id, op, before_data, after_data)
+  VALUES (o, '%[1]s', k, c, lower(TG_OP), b, a);
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS revision_%[1]s ON %[1]s;
+CREATE TRIGGER revision_%[1]s AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+  FOR EACH ROW EXECUTE FUNCTION revision_%[1]s();
+`, table, key, row("NEW"), row("OLD"))
+	}
+	return b.String()
+}
@@ -1,24 +1,130 @@
 package database
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/voidprobe/server/internal/schedule"
+)
+
+// UnixPrefix identifica destinos do tipo Unix domain socket (unix:///caminho)
+const UnixPrefix = "unix://"
+
+// Modos de mapeamento de porta
+const (
+	ModeForward = "forward" // destino fixo (target_host:target_port)
+	ModeSocks5  = "socks5"  // proxy SOCKS5, destino escolhido a cada CONNECT
 )
 
+// ErrNotFound indica que o cliente, a porta ou o token não existe
+var ErrNotFound = errors.New("not found")
+
 // Client representa um cliente registrado
 type Client struct {
 	ClientID   string
 	ClientName string
 	KeyHash    string
 	Status     string
+	Group      string            // vazio = sem grupo
+	Tags       map[string]string // tags livres, ex: env=prod (vazio = sem tags)
+	PortCount  int
 	CreatedAt  time.Time
 	LastSeenAt *time.Time
 }
 
+// Service representa um serviço declarado pelo cliente
+type Service struct {
+	Name       string
+	TargetHost string // host ou unix:///caminho
+	TargetPort int    // 0 para unix://
+}
+
+// Papéis de operador, do menor para o maior acesso
+const (
+	RoleViewer   = "viewer"   // consulta clientes, portas, sessões e eventos
+	RoleOperator = "operator" // altera portas, reload/kick/bloqueio e connect
+	RoleAdmin    = "admin"    // cria e remove clientes, grupos, chaves e operadores
+)
+
+// Roles lista os papéis válidos
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Operator representa um operador da administração e do acesso aos destinos
+type Operator struct {
+	OperatorID string
+	Name       string
+	KeyHash    string
+	Status     string
+	Role       string
+	Groups     []string // grupos de clientes permitidos; vazio = todos
+	CreatedAt  string
+	LastSeenAt string // vazio = nunca acessou
+}
+
+// HasRole informa se o papel do operador inclui role
+func (op Operator) HasRole(role string) bool {
+	return roleLevel(op.Role) >= roleLevel(role)
+}
+
+// Restricted informa se o operador só alcança clientes de alguns grupos
+// (admins e operadores sem grupos alcançam todos)
+func (op Operator) Restricted() bool {
+	return op.Role != RoleAdmin && len(op.Groups) > 0
+}
+
+// InScope informa se o operador pode agir sobre clientes do grupo
+func (op Operator) InScope(group string) bool {
+	if !op.Restricted() {
+		return true
+	}
+	for _, g := range op.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func roleLevel(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ParseRole valida um papel de operador
+func ParseRole(role string) (string, error) {
+	if roleLevel(role) == 0 {
+		return "", fmt.Errorf("invalid role %q (use %s)", role, strings.Join(Roles, ", "))
+	}
+	return role, nil
+}
+
+// ParseGroups converte a lista de grupos separados por vírgula ("all" ou vazio = todos)
+func ParseGroups(list string) []string {
+	if list == "" || list == "all" {
+		return nil
+	}
+	var groups []string
+	for _, g := range strings.Split(list, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
 // PortMapping representa um mapeamento de porta
 type PortMapping struct {
 	ID          int
@@ -27,17 +133,267 @@ type PortMapping struct {
 	TargetHost  string
 	TargetPort  int
 	Proto       string
+	Mode        string
+	AuthUser    string // usuário SOCKS5
+	AuthHash    string // hash da senha SOCKS5
+	ProxyProto  string // "", "v1" ou "v2": header PROXY enviado pelo cliente ao destino
+	AcceptProxy bool   // listener exige header PROXY de um balanceador à frente do servidor
+	ExpiresAt   string // UTC "2006-01-02 15:04:05"; vazio = sem validade
+	Schedule    string // janelas semanais (pacote schedule); vazio = sempre
+	HealthCheck string // off|tcp|tls|http[:/caminho]
+	RefuseDown  bool   // recusa conexões enquanto o cliente reportar o destino como down
 	Enabled     bool
+	// Mapeamentos gerados por modelo de porta (SyncTemplates); 0 e vazio = criado à mão
+	TemplatePort int
+	Template     string
+}
+
+// IsUnix indica se o destino é um Unix domain socket no cliente
+func (p PortMapping) IsUnix() bool {
+	return strings.HasPrefix(p.TargetHost, UnixPrefix)
+}
+
+// Target retorna o destino no formato enviado ao cliente (host:porta ou unix:///caminho)
+func (p PortMapping) Target() string {
+	if p.Mode == ModeSocks5 {
+		return ModeSocks5
+	}
+	if p.IsUnix() {
+		return p.TargetHost
+	}
+	return net.JoinHostPort(p.TargetHost, strconv.Itoa(p.TargetPort))
+}
+
+// Checked indica se o cliente deve sondar o destino (SOCKS5 não tem destino fixo)
+func (p PortMapping) Checked() bool {
+	return p.Mode != ModeSocks5 && p.HealthCheck != "off"
+}
+
+// TimeLayout é o formato de data/hora gravado no banco (UTC, igual a datetime('now'))
+const TimeLayout = "2006-01-02 15:04:05"
+
+// InactiveReason retorna por que o mapeamento não deve ter listener no instante
+// informado ("expired" ou "outside schedule"), ou "" se deve estar aberto
+func (p PortMapping) InactiveReason(now time.Time) string {
+	if p.ExpiresAt != "" {
+		expires, err := time.ParseInLocation(TimeLayout, p.ExpiresAt, time.UTC)
+		if err != nil || !now.Before(expires) {
+			return "expired"
+		}
+	}
+	if p.Schedule != "" {
+		s, err := schedule.Parse(p.Schedule)
+		if err != nil || !s.Active(now.Local()) {
+			return "outside schedule"
+		}
+	}
+	return ""
+}
+
+// LocalForward representa um local-forward (listener no cliente -> destino alcançável
+// pelo servidor ou, com TargetClient, pela rede de outro cliente)
+type LocalForward struct {
+	ID           int
+	ClientID     string
+	ListenHost   string
+	ListenPort   int
+	TargetHost   string
+	TargetPort   int
+	TargetClient string // vazio: o servidor conecta ao destino
+	Enabled      bool
+}
+
+// ListenAddr retorna o endereço de bind no cliente
+func (f LocalForward) ListenAddr() string {
+	return net.JoinHostPort(f.ListenHost, strconv.Itoa(f.ListenPort))
+}
+
+// Target retorna o destino discado pelo servidor
+func (f LocalForward) Target() string {
+	return net.JoinHostPort(f.TargetHost, strconv.Itoa(f.TargetPort))
+}
+
+// DefaultRoute é o hostname da rota usada quando nenhuma outra casa (SNI desconhecido ou ausente)
+const DefaultRoute = "*"
+
+// RouteKind é a tabela de uma família de rotas por hostname
+type RouteKind string
+
+// Tabelas de rotas
+const (
+	HTTPRoutes RouteKind = "http_routes" // listener HTTP compartilhado (Host)
+	TLSRoutes  RouteKind = "tls_routes"  // listener TLS compartilhado (SNI passthrough)
+)
+
+// Route representa uma rota por hostname em um listener compartilhado (HTTP ou TLS)
+type Route struct {
+	ID         int
+	Hostname   string
+	ClientID   string
+	TargetHost string
+	TargetPort int
+	Enabled    bool
+}
+
+// Target retorna o destino no cliente
+func (r Route) Target() string {
+	return net.JoinHostPort(r.TargetHost, strconv.Itoa(r.TargetPort))
+}
+
+// Estados de saúde de um destino
+const (
+	HealthUp      = "up"
+	HealthDown    = "down"
+	HealthUnknown = "unknown"
+)
+
+// PortHealth é o último estado reportado pelo cliente para um mapeamento
+type PortHealth struct {
+	Status string
+	Detail string
 }
 
-// Repository gerencia operações no banco
+// Repository gerencia operações no banco (SQLite ou PostgreSQL, conforme o
+// dialect). Dentro de Tx, tx é a transação em andamento. Com actor (ver As),
+// as escritas rodam numa transação que grava o autor em revision_actor;
+// active indica que a transação atual já o gravou.
 type Repository struct {
-	db *sql.DB
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect *dialect
+	actor   string
+	active  bool
+
+	// bindCheck: alocação de portas testa bind neste host (só no servidor)
+	bindCheck bool
+}
+
+// exec, query e queryRow traduzem a consulta para o banco e usam a transação
+// de Tx, se houver
+func (r *Repository) exec(query string, args ...any) (sql.Result, error) {
+	if r.actor != "" && !r.active {
+		var res sql.Result
+		err := r.inTx(func(tx *Repository) (err error) {
+			res, err = tx.exec(query, args...)
+			return err
+		})
+		return res, err
+	}
+
+	query = r.dialect.rebind(query)
+	if r.tx != nil {
+		return r.tx.Exec(query, args...)
+	}
+	return r.db.Exec(query, args...)
+}
+
+func (r *Repository) query(query string, args ...any) (*sql.Rows, error) {
+	query = r.dialect.rebind(query)
+	if r.tx != nil {
+		return r.tx.Query(query, args...)
+	}
+	return r.db.Query(query, args...)
+}
+
+func (r *Repository) queryRow(query string, args ...any) *sql.Row {
+	query = r.dialect.rebind(query)
+	if r.tx != nil {
+		return r.tx.QueryRow(query, args...)
+	}
+	return r.db.QueryRow(query, args...)
+}
+
+// insert executa um INSERT e retorna o id gerado (RETURNING funciona nos dois bancos)
+func (r *Repository) insert(query string, args ...any) (int, error) {
+	var id int
+	scan := func(tx *Repository) error {
+		return tx.queryRow(query+" RETURNING id", args...).Scan(&id)
+	}
+	if r.actor != "" && !r.active {
+		return id, r.inTx(scan)
+	}
+	return id, scan(r)
+}
+
+// inTx executa fn numa transação, ou na transação atual se já houver uma
+func (r *Repository) inTx(fn func(tx *Repository) error) error {
+	if r.tx != nil {
+		if r.actor == "" || r.active {
+			return fn(r)
+		}
+		return r.withActor(fn)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := (&Repository{db: r.db, tx: tx, dialect: r.dialect, actor: r.actor, bindCheck: r.bindCheck}).inTx(fn); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withActor executa fn com r.actor como autor das revisões gravadas pelos
+// triggers e restaura o autor anterior (em geral nenhum) antes de retornar.
+// A linha de revision_actor nunca chega ao commit, então outras conexões não
+// a enxergam.
+func (r *Repository) withActor(fn func(tx *Repository) error) error {
+	var previous string
+	if err := r.queryRow("SELECT COALESCE(MAX(operator_id), '') FROM revision_actor").Scan(&previous); err != nil {
+		return fmt.Errorf("failed to read revision author: %w", err)
+	}
+	if err := r.setActor(r.actor); err != nil {
+		return err
+	}
+
+	tx := *r
+	tx.active = true
+	if err := fn(&tx); err != nil {
+		return err
+	}
+	return r.setActor(previous)
+}
+
+// setActor troca o autor das revisões da transação (vazio = nenhum)
+func (r *Repository) setActor(operatorID string) error {
+	if _, err := r.tx.Exec("DELETE FROM revision_actor"); err != nil {
+		return fmt.Errorf("failed to set revision author: %w", err)
+	}
+	if operatorID == "" {
+		return nil
+	}
+	if _, err := r.tx.Exec(r.dialect.rebind("INSERT INTO revision_actor (operator_id) VALUES (?)"), operatorID); err != nil {
+		return fmt.Errorf("failed to set revision author: %w", err)
+	}
+	return nil
+}
+
+// As retorna o Store com operatorID como autor: as revisões das mudanças
+// feitas por ele são atribuídas na mesma transação da mudança (use As(...).Tx
+// para agrupar várias mudanças)
+func (r *Repository) As(operatorID string) Store {
+	return r.as(operatorID)
+}
+
+func (r *Repository) as(operatorID string) *Repository {
+	return &Repository{db: r.db, tx: r.tx, dialect: r.dialect, actor: operatorID, bindCheck: r.bindCheck}
+}
+
+// Tx executa fn numa transação: se fn retornar erro, nada é gravado. Com
+// SQLite há uma única conexão, então fn deve usar apenas tx.
+func (r *Repository) Tx(fn func(tx Store) error) error {
+	return r.inTx(func(tx *Repository) error { return fn(tx) })
 }
 
-// NewRepository cria novo repositório
-func NewRepository() *Repository {
-	return &Repository{db: GetDB()}
+// Close fecha a conexão (sem efeito dentro de Tx)
+func (r *Repository) Close() error {
+	if r.tx != nil {
+		return nil
+	}
+	return r.db.Close()
 }
 
 // HashKey gera hash SHA-256 de uma chave
@@ -46,14 +402,32 @@ func HashKey(key string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// GenerateKey gera uma chave aleatória de 256 bits em hexadecimal
+func GenerateKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DataVersion retorna um valor que muda quando outro processo (voidprobe-cli
+// ou outra instância do servidor) grava configuração no banco
+func (r *Repository) DataVersion() (int64, error) {
+	var version int64
+	if err := r.queryRow(r.dialect.dataVersion).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read data_version: %w", err)
+	}
+	return version, nil
+}
+
 // GetClient busca cliente por ID
 func (r *Repository) GetClient(clientID string) (*Client, error) {
 	var client Client
 	var lastSeen sql.NullString
-	var createdAt string
+	var createdAt, tags string
 
-	err := r.db.QueryRow(`
-		SELECT client_id, client_name, key_hash, status, created_at, last_seen_at
+	err := r.queryRow(`
+		SELECT client_id, client_name, key_hash, status, COALESCE(group_name, ''), COALESCE(tags, ''), created_at, last_seen_at,
+		       (SELECT COUNT(*) FROM client_ports WHERE client_ports.client_id = clients.client_id)
 		FROM clients
 		WHERE client_id = ?
 	`, clientID).Scan(
@@ -61,8 +435,11 @@ func (r *Repository) GetClient(clientID string) (*Client, error) {
 		&client.ClientName,
 		&client.KeyHash,
 		&client.Status,
+		&client.Group,
+		&tags,
 		&createdAt,
 		&lastSeen,
+		&client.PortCount,
 	)
 
 	if err == sql.ErrNoRows {
@@ -73,6 +450,7 @@ func (r *Repository) GetClient(clientID string) (*Client, error) {
 	}
 
 	client.CreatedAt, _ = time.Parse(time.DateTime, createdAt)
+	client.Tags, _ = ParseTags(tags)
 	if lastSeen.Valid {
 		t, _ := time.Parse(time.DateTime, lastSeen.String)
 		client.LastSeenAt = &t
@@ -123,9 +501,191 @@ func (r *Repository) ValidateClientByID(clientID string) (*Client, error) {
 	return client, nil
 }
 
+// operatorColumns são as colunas lidas por scanOperator
+const operatorColumns = "operator_id, name, key_hash, status, role, client_groups, created_at, COALESCE(last_seen_at, '')"
+
+// scanOperator lê um operador a partir de operatorColumns
+func scanOperator(row interface{ Scan(...interface{}) error }) (*Operator, error) {
+	var op Operator
+	var groups string
+	if err := row.Scan(&op.OperatorID, &op.Name, &op.KeyHash, &op.Status, &op.Role, &groups, &op.CreatedAt, &op.LastSeenAt); err != nil {
+		return nil, err
+	}
+	op.Groups = ParseGroups(groups)
+	return &op, nil
+}
+
+// ValidateOperator valida credenciais de um operador ativo
+func (r *Repository) ValidateOperator(operatorID, key string) (*Operator, error) {
+	op, err := scanOperator(r.queryRow("SELECT "+operatorColumns+" FROM operators WHERE operator_id = ?", operatorID))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("operator not found: %s", operatorID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operator: %w", err)
+	}
+
+	if op.Status != "active" {
+		return nil, fmt.Errorf("operator blocked: %s", operatorID)
+	}
+
+	// Comparação segura contra timing attacks
+	if subtle.ConstantTimeCompare([]byte(HashKey(key)), []byte(op.KeyHash)) != 1 {
+		return nil, fmt.Errorf("invalid key for operator: %s", operatorID)
+	}
+
+	r.exec("UPDATE operators SET last_seen_at = datetime('now') WHERE operator_id = ?", operatorID)
+	return op, nil
+}
+
+// GetOperator busca operador por ID (nil se não existir)
+func (r *Repository) GetOperator(operatorID string) (*Operator, error) {
+	op, err := scanOperator(r.queryRow("SELECT "+operatorColumns+" FROM operators WHERE operator_id = ?", operatorID))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operator: %w", err)
+	}
+	return op, nil
+}
+
+// HasAdmins informa se existe operador admin ativo; sem nenhum, o socket de
+// controle local aceita chamadas sem credenciais
+func (r *Repository) HasAdmins() (bool, error) {
+	var count int
+	err := r.queryRow("SELECT COUNT(*) FROM operators WHERE role = ? AND status = 'active'", RoleAdmin).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListOperators lista os operadores por ID
+func (r *Repository) ListOperators() ([]Operator, error) {
+	rows, err := r.query("SELECT " + operatorColumns + " FROM operators ORDER BY operator_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operators: %w", err)
+	}
+	defer rows.Close()
+
+	var operators []Operator
+	for rows.Next() {
+		op, err := scanOperator(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan operator: %w", err)
+		}
+		operators = append(operators, *op)
+	}
+	return operators, rows.Err()
+}
+
+// CreateOperator cria o operador (ativo) com a chave informada
+func (r *Repository) CreateOperator(op Operator, key string) error {
+	if _, err := ParseRole(op.Role); err != nil {
+		return err
+	}
+	_, err := r.exec("INSERT INTO operators (operator_id, name, key_hash, role, client_groups) VALUES (?, ?, ?, ?, ?)",
+		op.OperatorID, op.Name, HashKey(key), op.Role, strings.Join(op.Groups, ","))
+	if err != nil {
+		return fmt.Errorf("failed to add operator: %w", err)
+	}
+	return nil
+}
+
+// SetOperatorRole troca o papel do operador
+func (r *Repository) SetOperatorRole(operatorID, role string) error {
+	if _, err := ParseRole(role); err != nil {
+		return err
+	}
+	return r.affect("operator", operatorID, "UPDATE operators SET role = ? WHERE operator_id = ?", role, operatorID)
+}
+
+// SetOperatorGroups define os grupos de clientes do operador (vazio = todos)
+func (r *Repository) SetOperatorGroups(operatorID string, groups []string) error {
+	return r.affect("operator", operatorID, "UPDATE operators SET client_groups = ? WHERE operator_id = ?", strings.Join(groups, ","), operatorID)
+}
+
+// SetOperatorStatus bloqueia (blocked) ou libera (active) o operador
+func (r *Repository) SetOperatorStatus(operatorID, status string) error {
+	if status != "active" && status != "blocked" {
+		return fmt.Errorf("invalid status %q (use active or blocked)", status)
+	}
+	return r.affect("operator", operatorID, "UPDATE operators SET status = ? WHERE operator_id = ?", status, operatorID)
+}
+
+// SetOperatorKey troca a chave (ou senha) do operador
+func (r *Repository) SetOperatorKey(operatorID, key string) error {
+	return r.affect("operator", operatorID, "UPDATE operators SET key_hash = ? WHERE operator_id = ?", HashKey(key), operatorID)
+}
+
+// DeleteOperator remove o operador; seus tokens da API deixam de valer junto
+func (r *Repository) DeleteOperator(operatorID string) error {
+	return r.inTx(func(tx *Repository) error {
+		if err := tx.affect("operator", operatorID, "DELETE FROM operators WHERE operator_id = ?", operatorID); err != nil {
+			return err
+		}
+		if _, err := tx.exec("DELETE FROM api_tokens WHERE operator_id = ?", operatorID); err != nil {
+			return fmt.Errorf("failed to remove operator tokens: %w", err)
+		}
+		return nil
+	})
+}
+
+// Audit registra uma mudança e seu autor (clientID vazio = mudança global).
+// As revisões são atribuídas pelos triggers, com o autor de As.
+func (r *Repository) Audit(operatorID, clientID, action string) error {
+	var client interface{}
+	if clientID != "" {
+		client = clientID
+	}
+	if _, err := r.exec("INSERT INTO audit_log (operator_id, client_id, action) VALUES (?, ?, ?)", operatorID, client, action); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// AuditEntry é uma linha do audit log
+type AuditEntry struct {
+	CreatedAt  string
+	OperatorID string
+	ClientID   string // vazio = mudança global
+	Action     string
+}
+
+// ListAudit lista as mudanças mais recentes primeiro (todas ou do cliente)
+func (r *Repository) ListAudit(clientID string, limit int) ([]AuditEntry, error) {
+	query := "SELECT created_at, operator_id, COALESCE(client_id, ''), action FROM audit_log"
+	var args []interface{}
+	if clientID != "" {
+		query += " WHERE client_id = ?"
+		args = append(args, clientID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.CreatedAt, &e.OperatorID, &e.ClientID, &e.Action); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
 // UpdateLastSeen atualiza timestamp de última conexão
 func (r *Repository) UpdateLastSeen(clientID string) error {
-	_, err := r.db.Exec(`
+	_, err := r.exec(`
 		UPDATE clients 
 		SET last_seen_at = datetime('now')
 		WHERE client_id = ?
@@ -133,10 +693,10 @@ func (r *Repository) UpdateLastSeen(clientID string) error {
 	return err
 }
 
-// GetClientPorts busca portas configuradas para o cliente
+// GetClientPorts busca portas habilitadas do cliente
 func (r *Repository) GetClientPorts(clientID string) ([]PortMapping, error) {
-	rows, err := r.db.Query(`
-		SELECT id, client_id, exposed_port, target_host, target_port, proto, enabled
+	rows, err := r.query(`
+		SELECT `+portColumns+`
 		FROM client_ports
 		WHERE client_id = ? AND enabled = 1
 		ORDER BY exposed_port
@@ -150,35 +710,1215 @@ func (r *Repository) GetClientPorts(clientID string) ([]PortMapping, error) {
 	var ports []PortMapping
 	for rows.Next() {
 		var p PortMapping
-		var enabled int
-		if err := rows.Scan(&p.ID, &p.ClientID, &p.ExposedPort, &p.TargetHost, &p.TargetPort, &p.Proto, &enabled); err != nil {
+		if err := scanPort(rows, &p); err != nil {
 			return nil, fmt.Errorf("failed to scan port: %w", err)
 		}
-		p.Enabled = enabled == 1
 		ports = append(ports, p)
 	}
 
 	return ports, rows.Err()
 }
 
-// CreateClient cria novo cliente
-func (r *Repository) CreateClient(clientID, clientName, key string) error {
-	keyHash := HashKey(key)
-	_, err := r.db.Exec(`
-		INSERT INTO clients (client_id, client_name, key_hash)
-		VALUES (?, ?, ?)
-	`, clientID, clientName, keyHash)
+// CreateClient cria novo cliente com a chave informada (Status vazio = active)
+func (r *Repository) CreateClient(c Client, key string) error {
+	if c.Status == "" {
+		c.Status = "active"
+	}
+	_, err := r.exec(`
+		INSERT INTO clients (client_id, client_name, key_hash, status, group_name, tags)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))
+	`, c.ClientID, c.ClientName, HashKey(key), c.Status, c.Group, FormatTags(c.Tags))
 	return err
 }
 
-// AddPort adiciona mapeamento de porta
-func (r *Repository) AddPort(clientID string, exposedPort, targetPort int, targetHost string) error {
-	if targetHost == "" {
-		targetHost = "127.0.0.1"
+// UpdateClient grava nome, grupo, tags e status do cliente
+func (r *Repository) UpdateClient(c Client) error {
+	res, err := r.exec("UPDATE clients SET client_name = ?, group_name = NULLIF(?, ''), tags = NULLIF(?, ''), status = ? WHERE client_id = ?",
+		c.ClientName, c.Group, FormatTags(c.Tags), c.Status, c.ClientID)
+	if err != nil {
+		return fmt.Errorf("failed to update client: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("client %s %w", c.ClientID, ErrNotFound)
+	}
+	return nil
+}
+
+// clientTables lista as tabelas com dados do cliente, apagadas junto com ele
+// (bancos antigos do SQLite podem ter sido gravados sem PRAGMA foreign_keys)
+var clientTables = []string{
+	"DELETE FROM port_health WHERE port_id IN (SELECT id FROM client_ports WHERE client_id = ?1)",
+	"DELETE FROM port_state WHERE port_id IN (SELECT id FROM client_ports WHERE client_id = ?1)",
+	"DELETE FROM client_ports WHERE client_id = ?1",
+	"DELETE FROM client_forwards WHERE client_id = ?1 OR target_client_id = ?1",
+	"DELETE FROM client_links WHERE source_client_id = ?1 OR target_client_id = ?1",
+	"DELETE FROM client_services WHERE client_id = ?1",
+	"DELETE FROM http_routes WHERE client_id = ?1",
+	"DELETE FROM tls_routes WHERE client_id = ?1",
+	"DELETE FROM client_nodes WHERE client_id = ?1",
+	"DELETE FROM template_attachments WHERE kind = 'client' AND name = ?1",
+}
+
+// ListClients lista os clientes com grupo, tags e quantidade de portas
+func (r *Repository) ListClients() ([]Client, error) {
+	rows, err := r.query(`
+		SELECT client_id, client_name, status, COALESCE(group_name, ''), COALESCE(tags, ''), created_at, last_seen_at,
+		       (SELECT COUNT(*) FROM client_ports WHERE client_ports.client_id = clients.client_id)
+		FROM clients ORDER BY client_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []Client
+	for rows.Next() {
+		var c Client
+		var createdAt, tags string
+		var lastSeen sql.NullString
+		if err := rows.Scan(&c.ClientID, &c.ClientName, &c.Status, &c.Group, &tags, &createdAt, &lastSeen, &c.PortCount); err != nil {
+			return nil, fmt.Errorf("failed to scan client: %w", err)
+		}
+		c.CreatedAt, _ = time.Parse(time.DateTime, createdAt)
+		c.Tags, _ = ParseTags(tags)
+		if lastSeen.Valid {
+			t, _ := time.Parse(time.DateTime, lastSeen.String)
+			c.LastSeenAt = &t
+		}
+		clients = append(clients, c)
+	}
+
+	return clients, rows.Err()
+}
+
+// DeleteClient remove o cliente com portas, forwards, links, rotas e serviços.
+// Os dados saem antes do cliente, para que o rollback recrie o cliente primeiro.
+func (r *Repository) DeleteClient(clientID string) error {
+	return r.inTx(func(tx *Repository) error {
+		var exists int
+		if err := tx.queryRow("SELECT COUNT(*) FROM clients WHERE client_id = ?", clientID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to remove client: %w", err)
+		}
+		if exists == 0 {
+			return fmt.Errorf("client %s %w", clientID, ErrNotFound)
+		}
+
+		for _, query := range clientTables {
+			if _, err := tx.exec(query, clientID); err != nil {
+				return fmt.Errorf("failed to remove client data: %w", err)
+			}
+		}
+		if _, err := tx.exec("DELETE FROM clients WHERE client_id = ?", clientID); err != nil {
+			return fmt.Errorf("failed to remove client: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetClientStatus bloqueia (blocked) ou libera (active) o cliente
+func (r *Repository) SetClientStatus(clientID, status string) error {
+	if status != "active" && status != "blocked" {
+		return fmt.Errorf("invalid status %q (use active or blocked)", status)
+	}
+	return r.updateClient(clientID, "UPDATE clients SET status = ? WHERE client_id = ?", status)
+}
+
+// SetClientGroup define o grupo do cliente (vazio remove)
+func (r *Repository) SetClientGroup(clientID, group string) error {
+	var value interface{}
+	if group != "" {
+		value = group
+	}
+	return r.updateClient(clientID, "UPDATE clients SET group_name = ? WHERE client_id = ?", value)
+}
+
+// SetClientKey troca a chave do cliente
+func (r *Repository) SetClientKey(clientID, key string) error {
+	return r.updateClient(clientID, "UPDATE clients SET key_hash = ? WHERE client_id = ?", HashKey(key))
+}
+
+// updateClient executa query com (valor, client_id) e retorna ErrNotFound se nada mudou
+func (r *Repository) updateClient(clientID, query string, value interface{}) error {
+	res, err := r.exec(query, value, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to update client: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("client %s %w", clientID, ErrNotFound)
+	}
+	return nil
+}
+
+// PortInfo é um mapeamento com a saúde reportada e o estado de execução
+type PortInfo struct {
+	PortMapping
+	Health      string
+	State       string
+	StateDetail string
+}
+
+// portColumns são as colunas de client_ports lidas por scanPort
+const portColumns = `id, client_id, exposed_port, target_host, COALESCE(target_port, 0), proto,
+	mode, COALESCE(auth_user, ''), COALESCE(auth_hash, ''), proxy_protocol, accept_proxy,
+	COALESCE(expires_at, ''), COALESCE(schedule, ''), health_check, refuse_unhealthy, enabled,
+	COALESCE(template_port_id, 0),
+	COALESCE((SELECT template_name FROM template_ports WHERE template_ports.id = client_ports.template_port_id), '')`
+
+// scanPort lê as colunas de portColumns seguidas de extra
+func scanPort(row interface{ Scan(...any) error }, p *PortMapping, extra ...any) error {
+	var acceptProxy, refuseDown, enabled int
+	dest := []any{&p.ID, &p.ClientID, &p.ExposedPort, &p.TargetHost, &p.TargetPort, &p.Proto,
+		&p.Mode, &p.AuthUser, &p.AuthHash, &p.ProxyProto, &acceptProxy, &p.ExpiresAt, &p.Schedule,
+		&p.HealthCheck, &refuseDown, &enabled, &p.TemplatePort, &p.Template}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	p.AcceptProxy = acceptProxy == 1
+	p.RefuseDown = refuseDown == 1
+	p.Enabled = enabled == 1
+	return nil
+}
+
+// ListPorts lista os mapeamentos (todos ou do cliente), inclusive desabilitados
+func (r *Repository) ListPorts(clientID string) ([]PortInfo, error) {
+	query := `
+		SELECT ` + portColumns + `, COALESCE(h.status, 'unknown'),
+		       COALESCE(s.state, 'client_offline'), COALESCE(s.detail, '')
+		FROM client_ports LEFT JOIN port_health h ON h.port_id = client_ports.id
+		     LEFT JOIN port_state s ON s.port_id = client_ports.id`
+	var rows *sql.Rows
+	var err error
+	if clientID != "" {
+		rows, err = r.query(query+" WHERE client_id = ? ORDER BY exposed_port", clientID)
+	} else {
+		rows, err = r.query(query + " ORDER BY client_id, exposed_port")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ports: %w", err)
+	}
+	defer rows.Close()
+
+	var ports []PortInfo
+	for rows.Next() {
+		var p PortInfo
+		if err := scanPort(rows, &p.PortMapping, &p.Health, &p.State, &p.StateDetail); err != nil {
+			return nil, fmt.Errorf("failed to scan port: %w", err)
+		}
+		if !p.Enabled {
+			p.State = PortDisabled
+		}
+		ports = append(ports, p)
+	}
+
+	return ports, rows.Err()
+}
+
+// GetPort busca um mapeamento pelo ID (nil se não existir)
+func (r *Repository) GetPort(portID int) (*PortMapping, error) {
+	var p PortMapping
+	err := scanPort(r.queryRow("SELECT "+portColumns+" FROM client_ports WHERE id = ?", portID), &p)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	_, err := r.db.Exec(`
-		INSERT INTO client_ports (client_id, exposed_port, target_host, target_port)
-		VALUES (?, ?, ?, ?)
-	`, clientID, exposedPort, targetHost, targetPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get port: %w", err)
+	}
+	return &p, nil
+}
+
+// normalize completa os padrões do mapeamento e retorna os valores de
+// target_port e auth_user gravados (NULL quando o modo não usa)
+func (p *PortMapping) normalize() (targetPort, authUser interface{}, err error) {
+	if p.TargetHost == "" {
+		p.TargetHost = "127.0.0.1"
+	}
+	if p.Mode == "" {
+		p.Mode = ModeForward
+	}
+	if p.Proto == "" {
+		p.Proto = "tcp"
+	}
+	if p.HealthCheck == "" {
+		p.HealthCheck = "tcp"
+	}
+
+	switch {
+	case p.Mode == ModeSocks5:
+		p.TargetHost = "*"
+		authUser = p.AuthUser
+	case p.IsUnix():
+		if !strings.HasPrefix(strings.TrimPrefix(p.TargetHost, UnixPrefix), "/") {
+			return nil, nil, errors.New("unix target must be an absolute path (unix:///path/to.sock)")
+		}
+	default:
+		targetPort = p.TargetPort
+	}
+	return targetPort, authUser, nil
+}
+
+// AddPort cria o mapeamento com todas as opções e retorna o ID. Destinos
+// unix:// e SOCKS5 não têm porta; SOCKS5 exige AuthUser e AuthHash.
+func (r *Repository) AddPort(p PortMapping) (int, error) {
+	targetPort, authUser, err := p.normalize()
+	if err != nil {
+		return 0, err
+	}
+	var authHash interface{}
+	if p.Mode == ModeSocks5 {
+		authHash = p.AuthHash
+	}
+
+	id, err := r.insert(`
+		INSERT INTO client_ports (client_id, exposed_port, target_host, target_port, proto, mode, auth_user, auth_hash,
+		                          proxy_protocol, accept_proxy, expires_at, schedule, health_check, refuse_unhealthy, enabled,
+		                          template_port_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, NULLIF(?, 0))
+	`, p.ClientID, p.ExposedPort, p.TargetHost, targetPort, p.Proto, p.Mode, authUser, authHash,
+		p.ProxyProto, boolInt(p.AcceptProxy), p.ExpiresAt, p.Schedule, p.HealthCheck, boolInt(p.RefuseDown), boolInt(p.Enabled),
+		p.TemplatePort)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add port: %w", err)
+	}
+	return id, nil
+}
+
+// UpdatePort regrava o mapeamento p.ID. Uma porta SOCKS5 sem AuthHash mantém
+// a senha atual; nos demais modos a senha é apagada.
+func (r *Repository) UpdatePort(p PortMapping) error {
+	targetPort, authUser, err := p.normalize()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE client_ports SET client_id = ?, exposed_port = ?, target_host = ?, target_port = ?, proto = ?,
+		       mode = ?, auth_user = ?, proxy_protocol = ?, accept_proxy = ?, expires_at = NULLIF(?, ''),
+		       schedule = NULLIF(?, ''), health_check = ?, refuse_unhealthy = ?, enabled = ?`
+	args := []interface{}{p.ClientID, p.ExposedPort, p.TargetHost, targetPort, p.Proto, p.Mode, authUser,
+		p.ProxyProto, boolInt(p.AcceptProxy), p.ExpiresAt, p.Schedule, p.HealthCheck, boolInt(p.RefuseDown), boolInt(p.Enabled)}
+	switch {
+	case p.Mode != ModeSocks5:
+		query += ", auth_hash = NULL"
+	case p.AuthHash != "":
+		query += ", auth_hash = ?"
+		args = append(args, p.AuthHash)
+	}
+
+	return r.updatePort(p.ID, query+" WHERE id = ?", args...)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// DeletePort remove o mapeamento com seu estado; um serviço aprovado nele
+// volta a pendente. Mapeamentos gerados por modelo saem pelo modelo.
+func (r *Repository) DeletePort(portID int) error {
+	return r.inTx(func(tx *Repository) error {
+		p, err := tx.GetPort(portID)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return fmt.Errorf("port %d %w", portID, ErrNotFound)
+		}
+		if p.TemplatePort != 0 {
+			return fmt.Errorf("port %d belongs to template %s (detach the template or remove the target from it)", portID, p.Template)
+		}
+		return deletePort(tx, portID)
+	})
+}
+
+// deletePort apaga o mapeamento e seu estado (dentro da transação)
+func deletePort(tx *Repository, portID int) error {
+	for _, query := range []string{
+		"DELETE FROM client_ports WHERE id = ?",
+		"DELETE FROM port_health WHERE port_id = ?",
+		"DELETE FROM port_state WHERE port_id = ?",
+		"UPDATE client_services SET port_id = NULL WHERE port_id = ?",
+	} {
+		if _, err := tx.exec(query, portID); err != nil {
+			return fmt.Errorf("failed to remove port: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetPortEnabled habilita ou desabilita o mapeamento
+func (r *Repository) SetPortEnabled(portID int, enabled bool) error {
+	value := 0
+	if enabled {
+		value = 1
+	}
+	return r.updatePort(portID, "UPDATE client_ports SET enabled = ? WHERE id = ?", value)
+}
+
+// SetPortOption altera uma opção do mapeamento, com os nomes e valores de
+// "voidprobe-cli port-set" (ttl e schedule valem sem reload)
+func (r *Repository) SetPortOption(portID int, option, value string) error {
+	var query string
+	var arg interface{}
+	switch option {
+	case "proxy-protocol":
+		switch value {
+		case "v1", "v2":
+			arg = value
+		case "off":
+			arg = ""
+		default:
+			return fmt.Errorf("invalid proxy-protocol %q (use v1, v2 or off)", value)
+		}
+		// SOCKS5 escolhe o destino por CONNECT; o header PROXY só vale para destinos fixos
+		query = "UPDATE client_ports SET proxy_protocol = ? WHERE id = ? AND mode = 'forward'"
+	case "accept-proxy":
+		switch value {
+		case "on":
+			arg = 1
+		case "off":
+			arg = 0
+		default:
+			return fmt.Errorf("invalid accept-proxy %q (use on or off)", value)
+		}
+		query = "UPDATE client_ports SET accept_proxy = ? WHERE id = ?"
+	case "ttl":
+		if value != "off" {
+			d, err := schedule.ParseTTL(value)
+			if err != nil {
+				return err
+			}
+			arg = time.Now().UTC().Add(d).Format(TimeLayout)
+		}
+		query = "UPDATE client_ports SET expires_at = ? WHERE id = ?"
+	case "schedule":
+		if value != "off" {
+			if _, err := schedule.Parse(value); err != nil {
+				return fmt.Errorf("invalid schedule: %w", err)
+			}
+			arg = value
+		}
+		query = "UPDATE client_ports SET schedule = ? WHERE id = ?"
+	case "health-check":
+		if value != "off" && value != "tcp" && value != "tls" && value != "http" && !strings.HasPrefix(value, "http:/") {
+			return fmt.Errorf("invalid health-check %q (use off, tcp, tls, http or http:/path)", value)
+		}
+		arg = value
+		query = "UPDATE client_ports SET health_check = ? WHERE id = ?"
+	case "refuse-unhealthy":
+		switch value {
+		case "on":
+			arg = 1
+		case "off":
+			arg = 0
+		default:
+			return fmt.Errorf("invalid refuse-unhealthy %q (use on or off)", value)
+		}
+		query = "UPDATE client_ports SET refuse_unhealthy = ? WHERE id = ?"
+	default:
+		return fmt.Errorf("unknown option %q (use proxy-protocol, accept-proxy, ttl, schedule, health-check or refuse-unhealthy)", option)
+	}
+
+	err := r.updatePort(portID, query, arg)
+	if errors.Is(err, ErrNotFound) && option == "proxy-protocol" {
+		return fmt.Errorf("port %d %w (proxy-protocol requires a forward mapping)", portID, ErrNotFound)
+	}
+	return err
+}
+
+// updatePort executa query com (valores..., id) e retorna ErrNotFound se nada mudou
+func (r *Repository) updatePort(portID int, query string, values ...interface{}) error {
+	res, err := r.exec(query, append(values, portID)...)
+	if err != nil {
+		return fmt.Errorf("failed to update port: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("port %d %w", portID, ErrNotFound)
+	}
+	return nil
+}
+
+// AllocatePort escolhe a primeira porta livre dos pools do grupo do cliente
+// (ou dos pools padrão, se o grupo não tiver pool próprio) que esteja fora de
+// client_ports e, no servidor, aceite bind (ver freePort).
+func (r *Repository) AllocatePort(clientID string) (int, error) {
+	var group string
+	err := r.queryRow("SELECT COALESCE(group_name, '') FROM clients WHERE client_id = ?", clientID).Scan(&group)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("client %s %w", clientID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := r.query(`
+		SELECT range_start, range_end FROM port_pools
+		WHERE COALESCE(group_name, '') = ?1
+		   OR (group_name IS NULL AND NOT EXISTS (SELECT 1 FROM port_pools WHERE COALESCE(group_name, '') = ?1))
+		ORDER BY range_start
+	`, group)
+	if err != nil {
+		return 0, err
+	}
+
+	var ranges [][2]int
+	for rows.Next() {
+		var pr [2]int
+		if err := rows.Scan(&pr[0], &pr[1]); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan pool: %w", err)
+		}
+		ranges = append(ranges, pr)
+	}
+	rows.Close()
+
+	if len(ranges) == 0 {
+		return 0, fmt.Errorf("no port pool configured (example: pool-add 20000-20999)")
+	}
+
+	port, err := r.freePort(ranges)
+	if err != nil || port != 0 {
+		return port, err
+	}
+
+	if group != "" {
+		return 0, fmt.Errorf("no free port left in pools for group %s", group)
+	}
+	return 0, fmt.Errorf("no free port left in default pools")
+}
+
+// Pool é uma faixa de portas para alocação automática
+type Pool struct {
+	ID    int
+	Group string // vazio = pool padrão
+	Start int
+	End   int
+	Used  int // portas da faixa já mapeadas
+}
+
+// ListPools lista os pools por grupo (padrão primeiro) e faixa
+func (r *Repository) ListPools() ([]Pool, error) {
+	rows, err := r.query(`
+		SELECT id, COALESCE(group_name, ''), range_start, range_end,
+		       (SELECT COUNT(*) FROM client_ports
+		        WHERE exposed_port BETWEEN port_pools.range_start AND port_pools.range_end)
+		FROM port_pools ORDER BY COALESCE(group_name, ''), range_start
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+	defer rows.Close()
+
+	var pools []Pool
+	for rows.Next() {
+		var p Pool
+		if err := rows.Scan(&p.ID, &p.Group, &p.Start, &p.End, &p.Used); err != nil {
+			return nil, fmt.Errorf("failed to scan pool: %w", err)
+		}
+		pools = append(pools, p)
+	}
+	return pools, rows.Err()
+}
+
+// AddPool cria um pool do grupo (vazio = padrão)
+func (r *Repository) AddPool(group string, start, end int) error {
+	_, err := r.exec("INSERT INTO port_pools (group_name, range_start, range_end) VALUES (NULLIF(?, ''), ?, ?)", group, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to add pool: %w", err)
+	}
+	return nil
+}
+
+// DeletePool remove o pool; as portas já alocadas continuam
+func (r *Repository) DeletePool(poolID int) error {
+	return r.affect("pool", poolID, "DELETE FROM port_pools WHERE id = ?", poolID)
+}
+
+// Escopos de tokens da API de administração
+const (
+	ScopeRead    = "read"    // listagens e consultas
+	ScopeWrite   = "write"   // criar, alterar e remover clientes e portas
+	ScopeControl = "control" // reload e kick de sessões
+	ScopeEvents  = "events"  // stream de eventos
+)
+
+// Scopes lista os escopos válidos, na ordem usada por "all"
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeControl, ScopeEvents}
+
+// ParseScopes valida a lista separada por vírgula ("all" = todos os escopos)
+func ParseScopes(list string) ([]string, error) {
+	if list == "all" {
+		return Scopes, nil
+	}
+	var scopes []string
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		valid := false
+		for _, known := range Scopes {
+			valid = valid || s == known
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid scope %q (use %s or all)", s, strings.Join(Scopes, ", "))
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes, nil
+}
+
+// APIToken é um token da API de administração emitido para um operador; o
+// acesso é o do papel do operador, limitado aos escopos do token
+type APIToken struct {
+	ID         int
+	Name       string
+	Scopes     []string
+	Operator   Operator
+	CreatedAt  string
+	LastUsedAt string // vazio = nunca usado
+}
+
+// Allows informa se o token tem o escopo
+func (t APIToken) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAPIToken busca o token pelo hash; o operador dono precisa estar ativo
+func (r *Repository) ValidateAPIToken(token string) (*APIToken, error) {
+	var t APIToken
+	var scopes, groups string
+	op := &t.Operator
+	err := r.queryRow(`
+		SELECT t.id, t.name, t.scopes, o.operator_id, o.name, o.status, o.role, o.client_groups
+		FROM api_tokens t JOIN operators o ON o.operator_id = t.operator_id
+		WHERE t.token_hash = ? AND o.status = 'active'
+	`, HashKey(token)).Scan(&t.ID, &t.Name, &scopes, &op.OperatorID, &op.Name, &op.Status, &op.Role, &groups)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("token %w or operator blocked", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	t.Scopes = strings.Split(scopes, ",")
+	op.Groups = ParseGroups(groups)
+	r.exec("UPDATE api_tokens SET last_used_at = datetime('now') WHERE id = ?", t.ID)
+	return &t, nil
+}
+
+// ListAPITokens lista os tokens por operador (só OperatorID preenchido em Operator)
+func (r *Repository) ListAPITokens() ([]APIToken, error) {
+	rows, err := r.query(`
+		SELECT id, operator_id, name, scopes, created_at, COALESCE(last_used_at, '')
+		FROM api_tokens ORDER BY operator_id, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Operator.OperatorID, &t.Name, &scopes, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// CreateAPIToken emite um token para o operador e o retorna (só o hash é gravado)
+func (r *Repository) CreateAPIToken(operatorID, name string, scopes []string) (string, error) {
+	op, err := r.GetOperator(operatorID)
+	if err != nil {
+		return "", err
+	}
+	if op == nil {
+		return "", fmt.Errorf("operator %s %w", operatorID, ErrNotFound)
+	}
+
+	token := GenerateKey()
+	_, err = r.exec("INSERT INTO api_tokens (operator_id, name, token_hash, scopes) VALUES (?, ?, ?, ?)",
+		operatorID, name, HashKey(token), strings.Join(scopes, ","))
+	if err != nil {
+		return "", fmt.Errorf("failed to add token: %w", err)
+	}
+	return token, nil
+}
+
+// DeleteAPIToken revoga o token
+func (r *Repository) DeleteAPIToken(id int) error {
+	return r.affect("token", id, "DELETE FROM api_tokens WHERE id = ?", id)
+}
+
+// GetClientForwards busca local-forwards habilitados para o cliente
+func (r *Repository) GetClientForwards(clientID string) ([]LocalForward, error) {
+	rows, err := r.query("SELECT "+forwardColumns+" FROM client_forwards WHERE client_id = ? AND enabled = 1 ORDER BY listen_port", clientID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forwards: %w", err)
+	}
+	defer rows.Close()
+
+	return scanForwards(rows)
+}
+
+// forwardColumns são as colunas lidas por scanForward
+const forwardColumns = `id, client_id, listen_host, listen_port, target_host, target_port,
+	COALESCE(target_client_id, ''), enabled`
+
+func scanForward(row interface{ Scan(...any) error }, f *LocalForward) error {
+	var enabled int
+	if err := row.Scan(&f.ID, &f.ClientID, &f.ListenHost, &f.ListenPort, &f.TargetHost, &f.TargetPort, &f.TargetClient, &enabled); err != nil {
+		return err
+	}
+	f.Enabled = enabled == 1
+	return nil
+}
+
+func scanForwards(rows *sql.Rows) ([]LocalForward, error) {
+	var forwards []LocalForward
+	for rows.Next() {
+		var f LocalForward
+		if err := scanForward(rows, &f); err != nil {
+			return nil, fmt.Errorf("failed to scan forward: %w", err)
+		}
+		forwards = append(forwards, f)
+	}
+	return forwards, rows.Err()
+}
+
+// GetForward busca um local-forward habilitado do cliente
+func (r *Repository) GetForward(clientID string, id int) (*LocalForward, error) {
+	return r.getForward("SELECT "+forwardColumns+" FROM client_forwards WHERE id = ? AND client_id = ? AND enabled = 1", id, clientID)
+}
+
+// LookupForward busca um local-forward pelo ID, habilitado ou não (nil se não existir)
+func (r *Repository) LookupForward(id int) (*LocalForward, error) {
+	return r.getForward("SELECT "+forwardColumns+" FROM client_forwards WHERE id = ?", id)
+}
+
+func (r *Repository) getForward(query string, args ...interface{}) (*LocalForward, error) {
+	var f LocalForward
+	err := scanForward(r.queryRow(query, args...), &f)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forward: %w", err)
+	}
+	return &f, nil
+}
+
+// ListForwards lista os local-forwards (todos ou do cliente), inclusive desabilitados
+func (r *Repository) ListForwards(clientID string) ([]LocalForward, error) {
+	var rows *sql.Rows
+	var err error
+	if clientID != "" {
+		rows, err = r.query("SELECT "+forwardColumns+" FROM client_forwards WHERE client_id = ? ORDER BY listen_port", clientID)
+	} else {
+		rows, err = r.query("SELECT " + forwardColumns + " FROM client_forwards ORDER BY client_id, listen_port")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forwards: %w", err)
+	}
+	defer rows.Close()
+
+	return scanForwards(rows)
+}
+
+// AddForward cria o local-forward (habilitado) e retorna o ID; com
+// TargetClient, o link entre os clientes precisa estar autorizado
+func (r *Repository) AddForward(f LocalForward) (int, error) {
+	var via interface{}
+	if f.TargetClient != "" {
+		allowed, err := r.LinkAllowed(f.ClientID, f.TargetClient)
+		if err != nil {
+			return 0, err
+		}
+		if !allowed {
+			return 0, fmt.Errorf("link %s -> %s not allowed (run: link-allow %s %s)", f.ClientID, f.TargetClient, f.ClientID, f.TargetClient)
+		}
+		via = f.TargetClient
+	}
+
+	id, err := r.insert(`
+		INSERT INTO client_forwards (client_id, listen_host, listen_port, target_host, target_port, target_client_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, f.ClientID, f.ListenHost, f.ListenPort, f.TargetHost, f.TargetPort, via)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add forward: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteForward remove o local-forward
+func (r *Repository) DeleteForward(id int) error {
+	return r.affect("forward", id, "DELETE FROM client_forwards WHERE id = ?", id)
+}
+
+// SetForwardEnabled habilita ou desabilita o local-forward
+func (r *Repository) SetForwardEnabled(id int, enabled bool) error {
+	return r.affect("forward", id, "UPDATE client_forwards SET enabled = ? WHERE id = ?", boolInt(enabled), id)
+}
+
+// LinkAllowed informa se o par origem -> destino está autorizado em client_links
+func (r *Repository) LinkAllowed(sourceClientID, targetClientID string) (bool, error) {
+	var n int
+	err := r.queryRow(`
+		SELECT COUNT(*) FROM client_links
+		WHERE source_client_id = ? AND target_client_id = ?
+	`, sourceClientID, targetClientID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check link: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Link autoriza forwards de Source a destinos na rede de Target
+type Link struct {
+	Source    string
+	Target    string
+	CreatedAt string
+	Forwards  int // local-forwards que usam o link
+}
+
+// ListLinks lista os links autorizados com quantos forwards usam cada um
+func (r *Repository) ListLinks() ([]Link, error) {
+	rows, err := r.query(`
+		SELECT l.source_client_id, l.target_client_id, l.created_at,
+		       (SELECT COUNT(*) FROM client_forwards f
+		        WHERE f.client_id = l.source_client_id AND f.target_client_id = l.target_client_id)
+		FROM client_links l ORDER BY l.source_client_id, l.target_client_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var l Link
+		if err := rows.Scan(&l.Source, &l.Target, &l.CreatedAt, &l.Forwards); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// AddLink autoriza o par origem -> destino
+func (r *Repository) AddLink(sourceClientID, targetClientID string) error {
+	_, err := r.exec("INSERT INTO client_links (source_client_id, target_client_id) VALUES (?, ?)", sourceClientID, targetClientID)
+	if err != nil {
+		return fmt.Errorf("failed to allow link: %w", err)
+	}
+	return nil
+}
+
+// DeleteLink revoga o par; forwards que o usam deixam de repassar conexões
+func (r *Repository) DeleteLink(sourceClientID, targetClientID string) error {
+	return r.affect("link", sourceClientID+" -> "+targetClientID,
+		"DELETE FROM client_links WHERE source_client_id = ? AND target_client_id = ?", sourceClientID, targetClientID)
+}
+
+// GetHTTPRoute busca a rota HTTP habilitada para o hostname (exato ou *.domínio-pai)
+func (r *Repository) GetHTTPRoute(hostname string) (*Route, error) {
+	return r.getRoute(HTTPRoutes, hostname, false)
+}
+
+// GetTLSRoute busca a rota TLS habilitada para o SNI, caindo na rota padrão "*" se existir
+func (r *Repository) GetTLSRoute(serverName string) (*Route, error) {
+	return r.getRoute(TLSRoutes, serverName, true)
+}
+
+func (r *Repository) getRoute(kind RouteKind, hostname string, fallback bool) (*Route, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	var candidates []string
+	if hostname != "" {
+		candidates = append(candidates, hostname)
+		if _, parent, ok := strings.Cut(hostname, "."); ok {
+			candidates = append(candidates, "*."+parent)
+		}
+	}
+	if fallback {
+		candidates = append(candidates, DefaultRoute)
+	}
+
+	for _, name := range candidates {
+		var route Route
+		err := scanRoute(r.queryRow("SELECT "+routeColumns+" FROM "+string(kind)+" WHERE hostname = ? AND enabled = 1", name), &route)
+
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get route from %s: %w", kind, err)
+		}
+		return &route, nil
+	}
+
+	return nil, nil
+}
+
+// routeColumns são as colunas lidas por scanRoute
+const routeColumns = "id, hostname, client_id, target_host, target_port, enabled"
+
+func scanRoute(row interface{ Scan(...any) error }, route *Route) error {
+	var enabled int
+	if err := row.Scan(&route.ID, &route.Hostname, &route.ClientID, &route.TargetHost, &route.TargetPort, &enabled); err != nil {
+		return err
+	}
+	route.Enabled = enabled == 1
+	return nil
+}
+
+// LookupRoute busca uma rota pelo ID, habilitada ou não (nil se não existir)
+func (r *Repository) LookupRoute(kind RouteKind, id int) (*Route, error) {
+	var route Route
+	err := scanRoute(r.queryRow("SELECT "+routeColumns+" FROM "+string(kind)+" WHERE id = ?", id), &route)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get route: %w", err)
+	}
+	return &route, nil
+}
+
+// ListRoutes lista as rotas (todas ou do cliente) por hostname
+func (r *Repository) ListRoutes(kind RouteKind, clientID string) ([]Route, error) {
+	query := "SELECT " + routeColumns + " FROM " + string(kind)
+	var args []interface{}
+	if clientID != "" {
+		query += " WHERE client_id = ?"
+		args = append(args, clientID)
+	}
+
+	rows, err := r.query(query+" ORDER BY hostname", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []Route
+	for rows.Next() {
+		var route Route
+		if err := scanRoute(rows, &route); err != nil {
+			return nil, fmt.Errorf("failed to scan route: %w", err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, rows.Err()
+}
+
+// AddRoute cria a rota (habilitada) e retorna o ID
+func (r *Repository) AddRoute(kind RouteKind, route Route) (int, error) {
+	id, err := r.insert("INSERT INTO "+string(kind)+" (hostname, client_id, target_host, target_port) VALUES (?, ?, ?, ?)",
+		route.Hostname, route.ClientID, route.TargetHost, route.TargetPort)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add route: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteRoute remove a rota
+func (r *Repository) DeleteRoute(kind RouteKind, id int) error {
+	return r.affect("route", id, "DELETE FROM "+string(kind)+" WHERE id = ?", id)
+}
+
+// SetRouteEnabled habilita ou desabilita a rota
+func (r *Repository) SetRouteEnabled(kind RouteKind, id int, enabled bool) error {
+	return r.affect("route", id, "UPDATE "+string(kind)+" SET enabled = ? WHERE id = ?", boolInt(enabled), id)
+}
+
+// affect executa query e retorna ErrNotFound se nenhuma linha mudou
+// (subject e key identificam o registro na mensagem)
+func (r *Repository) affect(subject string, key interface{}, query string, args ...interface{}) error {
+	res, err := r.exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", subject, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%s %v %w", subject, key, ErrNotFound)
+	}
+	return nil
+}
+
+// SetPortHealth grava o estado reportado pelo cliente; ignora portas de outros clientes
+func (r *Repository) SetPortHealth(clientID string, portID int, status, detail string) error {
+	_, err := r.exec(`
+		INSERT INTO port_health (port_id, status, detail)
+		SELECT id, ?, ? FROM client_ports WHERE id = ? AND client_id = ?
+		ON CONFLICT (port_id) DO UPDATE SET
+			changed_at = CASE WHEN port_health.status <> excluded.status THEN datetime('now') ELSE port_health.changed_at END,
+			status = excluded.status,
+			detail = excluded.detail,
+			reported_at = datetime('now')
+	`, status, detail, portID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to set port health: %w", err)
+	}
+	return nil
+}
+
+// SyncServices grava os serviços declarados pelo cliente: novos ficam pendentes,
+// os retirados do SERVICES são apagados e os com destino alterado voltam a
+// pendente. Nos dois últimos casos o mapeamento aprovado é removido e
+// portsChanged indica que os listeners precisam ser recarregados.
+func (r *Repository) SyncServices(clientID string, services []Service) (portsChanged bool, err error) {
+	// Mapeamentos removidos pela mudança no SERVICES têm o cliente como autor
+	err = r.as("client:" + clientID).inTx(func(tx *Repository) error {
+		portsChanged, err = syncServices(tx, clientID, services)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return portsChanged, nil
+}
+
+// syncServices é o corpo de SyncServices, dentro da transação
+func syncServices(tx *Repository, clientID string, services []Service) (portsChanged bool, err error) {
+	rows, err := tx.query(`
+		SELECT name, target_host, COALESCE(target_port, 0), COALESCE(port_id, 0)
+		FROM client_services WHERE client_id = ?
+	`, clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get services: %w", err)
+	}
+	existing := make(map[string]Service)
+	portIDs := make(map[string]int)
+	for rows.Next() {
+		var s Service
+		var portID int
+		if err := rows.Scan(&s.Name, &s.TargetHost, &s.TargetPort, &portID); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan service: %w", err)
+		}
+		existing[s.Name] = s
+		portIDs[s.Name] = portID
+	}
+	rows.Close()
+
+	dropPort := func(name string) error {
+		if portIDs[name] == 0 {
+			return nil
+		}
+		res, err := tx.exec("DELETE FROM client_ports WHERE id = ? AND client_id = ?", portIDs[name], clientID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			portsChanged = true
+		}
+		return nil
+	}
+
+	offered := make(map[string]bool)
+	for _, s := range services {
+		offered[s.Name] = true
+		var targetPort interface{}
+		if s.TargetPort != 0 {
+			targetPort = s.TargetPort
+		}
+
+		old, exists := existing[s.Name]
+		switch {
+		case !exists:
+			_, err = tx.exec(`
+				INSERT INTO client_services (client_id, name, target_host, target_port)
+				VALUES (?, ?, ?, ?)
+			`, clientID, s.Name, s.TargetHost, targetPort)
+		case old != s:
+			if err = dropPort(s.Name); err == nil {
+				_, err = tx.exec(`
+					UPDATE client_services
+					SET target_host = ?, target_port = ?, port_id = NULL, offered_at = datetime('now')
+					WHERE client_id = ? AND name = ?
+				`, s.TargetHost, targetPort, clientID, s.Name)
+			}
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to store service %s: %w", s.Name, err)
+		}
+	}
+
+	for name := range existing {
+		if offered[name] {
+			continue
+		}
+		if err := dropPort(name); err != nil {
+			return false, fmt.Errorf("failed to withdraw service %s: %w", name, err)
+		}
+		if _, err := tx.exec("DELETE FROM client_services WHERE client_id = ? AND name = ?", clientID, name); err != nil {
+			return false, fmt.Errorf("failed to withdraw service %s: %w", name, err)
+		}
+	}
+
+	if portsChanged {
+		if err := tx.Audit("client:"+clientID, clientID, "approved service mappings removed (services changed on the client)"); err != nil {
+			return false, err
+		}
+	}
+	return portsChanged, nil
+}
+
+// ServiceInfo é um serviço declarado com a porta aprovada (0 = pendente)
+type ServiceInfo struct {
+	Service
+	ClientID    string
+	ExposedPort int
+	OfferedAt   string
+}
+
+// ListServices lista os serviços declarados (todos ou do cliente)
+func (r *Repository) ListServices(clientID string) ([]ServiceInfo, error) {
+	query := `
+		SELECT s.client_id, s.name, s.target_host, COALESCE(s.target_port, 0),
+		       COALESCE(p.exposed_port, 0), s.offered_at
+		FROM client_services s LEFT JOIN client_ports p ON p.id = s.port_id`
+	var rows *sql.Rows
+	var err error
+	if clientID != "" {
+		rows, err = r.query(query+" WHERE s.client_id = ? ORDER BY s.name", clientID)
+	} else {
+		rows, err = r.query(query + " ORDER BY s.client_id, s.name")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	defer rows.Close()
+
+	var services []ServiceInfo
+	for rows.Next() {
+		var s ServiceInfo
+		if err := rows.Scan(&s.ClientID, &s.Name, &s.TargetHost, &s.TargetPort, &s.ExposedPort, &s.OfferedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan service: %w", err)
+		}
+		services = append(services, s)
+	}
+	return services, rows.Err()
+}
+
+// ApproveService cria o mapeamento do serviço pendente na porta do servidor
+// (0 = primeira livre no pool do grupo do cliente)
+func (r *Repository) ApproveService(clientID, name string, port int) (*PortMapping, error) {
+	var created *PortMapping
+	err := r.inTx(func(tx *Repository) error {
+		var s Service
+		var exposed int
+		err := tx.queryRow(`
+			SELECT s.target_host, COALESCE(s.target_port, 0), COALESCE(p.exposed_port, 0)
+			FROM client_services s LEFT JOIN client_ports p ON p.id = s.port_id
+			WHERE s.client_id = ? AND s.name = ?
+		`, clientID, name).Scan(&s.TargetHost, &s.TargetPort, &exposed)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("client %s does not offer service %q: %w", clientID, name, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get service: %w", err)
+		}
+		if exposed != 0 {
+			return fmt.Errorf("service %q already approved on server port %d", name, exposed)
+		}
+
+		if port == 0 {
+			if port, err = tx.AllocatePort(clientID); err != nil {
+				return err
+			}
+		}
+
+		p := PortMapping{ClientID: clientID, ExposedPort: port, TargetHost: s.TargetHost, TargetPort: s.TargetPort, Enabled: true}
+		if p.ID, err = tx.AddPort(p); err != nil {
+			return err
+		}
+		if _, err := tx.exec("UPDATE client_services SET port_id = ? WHERE client_id = ? AND name = ?", p.ID, clientID, name); err != nil {
+			return fmt.Errorf("failed to approve service: %w", err)
+		}
+		created = &p
+		return nil
+	})
+	return created, err
+}
+
+// RevokeService remove o mapeamento aprovado; o serviço volta a pendente
+func (r *Repository) RevokeService(clientID, name string) error {
+	return r.inTx(func(tx *Repository) error {
+		var portID int
+		err := tx.queryRow("SELECT COALESCE(port_id, 0) FROM client_services WHERE client_id = ? AND name = ?", clientID, name).Scan(&portID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("client %s does not offer service %q: %w", clientID, name, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get service: %w", err)
+		}
+
+		if portID != 0 {
+			if _, err := tx.exec("DELETE FROM client_ports WHERE id = ? AND client_id = ?", portID, clientID); err != nil {
+				return fmt.Errorf("failed to revoke service: %w", err)
+			}
+		}
+		if _, err := tx.exec("UPDATE client_services SET port_id = NULL WHERE client_id = ? AND name = ?", clientID, name); err != nil {
+			return fmt.Errorf("failed to revoke service: %w", err)
+		}
+		return nil
+	})
+}
+
+// Estados de execução de um mapeamento
+const (
+	PortListening     = "listening"
+	PortBindError     = "bind_error"
+	PortClientOffline = "client_offline"
+	PortDisabled      = "disabled"
+)
+
+// SetPortState grava o estado de execução de um mapeamento e o detalhe (erro ou motivo)
+func (r *Repository) SetPortState(portID int, state, detail string) error {
+	_, err := r.exec(`
+		INSERT INTO port_state (port_id, state, detail)
+		SELECT id, ?, NULLIF(?, '') FROM client_ports WHERE id = ?
+		ON CONFLICT (port_id) DO UPDATE SET
+			state = excluded.state,
+			detail = excluded.detail,
+			updated_at = datetime('now')
+	`, state, detail, portID)
+	if err != nil {
+		return fmt.Errorf("failed to set port state: %w", err)
+	}
+	return nil
+}
+
+// SetClientOffline marca os mapeamentos do cliente como client_offline
+func (r *Repository) SetClientOffline(clientID string) error {
+	_, err := r.exec(`
+		UPDATE port_state SET state = 'client_offline', detail = NULL, updated_at = datetime('now')
+		WHERE port_id IN (SELECT id FROM client_ports WHERE client_id = ?)
+	`, clientID)
+	return err
+}
+
+// ResetPortStates descarta estados de uma execução anterior do servidor
+func (r *Repository) ResetPortStates() error {
+	_, err := r.exec("DELETE FROM port_state")
+	return err
+}
+
+// ResetClientHealth marca a saúde das portas do cliente como desconhecida (cliente desconectado)
+func (r *Repository) ResetClientHealth(clientID string) error {
+	_, err := r.exec(`
+		UPDATE port_health SET status = 'unknown', detail = 'client offline', changed_at = datetime('now')
+		WHERE status <> 'unknown'
+		  AND port_id IN (SELECT id FROM client_ports WHERE client_id = ?)
+	`, clientID)
 	return err
 }
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// revisionColumns são as colunas gravadas nas revisões (last_seen_at e o
+// estado de execução não são configuração)
+var revisionColumns = map[string][]string{
+	"clients": {"client_id", "client_name", "key_hash", "status", "group_name", "tags", "created_at"},
+	"client_ports": {"id", "client_id", "exposed_port", "target_host", "target_port", "proto", "mode",
+		"auth_user", "auth_hash", "proxy_protocol", "accept_proxy", "expires_at", "schedule",
+		"health_check", "refuse_unhealthy", "enabled", "template_port_id", "created_at"},
+}
+
+// revisionKeys é a chave primária de cada tabela com revisões
+var revisionKeys = map[string]string{"clients": "client_id", "client_ports": "id"}
+
+// Operações gravadas em revisions
+const (
+	RevisionInsert = "insert"
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+)
+
+// Revision é uma mudança em clients ou client_ports gravada pelos triggers
+type Revision struct {
+	ID        int
+	CreatedAt string
+	Operator  string // vazio: mudança sem autor (ver Repository.As)
+	Table     string
+	Key       string
+	ClientID  string
+	Op        string
+	Before    map[string]interface{} // nil em insert
+	After     map[string]interface{} // nil em delete
+}
+
+// ListRevisions lista as revisões mais recentes primeiro (todas ou do
+// cliente), com ID maior que after; limit 0 = sem limite
+func (r *Repository) ListRevisions(clientID string, after, limit int) ([]Revision, error) {
+	query := `SELECT id, created_at, COALESCE(operator_id, ''), table_name, row_key, client_id, op,
+	                 COALESCE(before_data, ''), COALESCE(after_data, '')
+	          FROM revisions WHERE id > ?`
+	args := []interface{}{after}
+	if clientID != "" {
+		query += " AND client_id = ?"
+		args = append(args, clientID)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := r.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		var rev Revision
+		var before, after string
+		if err := rows.Scan(&rev.ID, &rev.CreatedAt, &rev.Operator, &rev.Table, &rev.Key, &rev.ClientID, &rev.Op, &before, &after); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		if rev.Before, err = decodeRow(before); err != nil {
+			return nil, fmt.Errorf("revision %d: %w", rev.ID, err)
+		}
+		if rev.After, err = decodeRow(after); err != nil {
+			return nil, fmt.Errorf("revision %d: %w", rev.ID, err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// decodeRow lê a linha gravada em JSON (números como int64)
+func decodeRow(data string) (map[string]interface{}, error) {
+	if data == "" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var row map[string]interface{}
+	if err := dec.Decode(&row); err != nil {
+		return nil, fmt.Errorf("invalid row data: %w", err)
+	}
+	for k, v := range row {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				row[k] = i
+			}
+		}
+	}
+	return row, nil
+}
+
+// Summary descreve a revisão, ex: "port 2222 updated (enabled: 1 -> 0)"
+func (r Revision) Summary() string {
+	row := r.After
+	if row == nil {
+		row = r.Before
+	}
+	subject := "client " + r.ClientID
+	if r.Table == "client_ports" {
+		subject = fmt.Sprintf("port %v", row["exposed_port"])
+	}
+
+	switch r.Op {
+	case RevisionInsert:
+		if r.Table == "client_ports" {
+			return fmt.Sprintf("%s added (-> %s)", subject, rowTarget(row))
+		}
+		return subject + " added"
+	case RevisionDelete:
+		return subject + " removed"
+	}
+
+	var changes []string
+	for _, c := range revisionColumns[r.Table] {
+		before, after := r.Before[c], r.After[c]
+		if fmt.Sprint(before) == fmt.Sprint(after) {
+			continue
+		}
+		switch c {
+		case "key_hash":
+			changes = append(changes, "key changed")
+		case "auth_hash":
+			changes = append(changes, "password changed")
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", c, revisionValue(before), revisionValue(after)))
+		}
+	}
+	return fmt.Sprintf("%s updated (%s)", subject, strings.Join(changes, "; "))
+}
+
+// rowTarget monta o destino de um mapeamento gravado
+func rowTarget(row map[string]interface{}) string {
+	if row["mode"] == ModeSocks5 {
+		return ModeSocks5
+	}
+	if row["target_port"] == nil {
+		return fmt.Sprint(row["target_host"])
+	}
+	return fmt.Sprintf("%v:%v", row["target_host"], row["target_port"])
+}
+
+func revisionValue(v interface{}) string {
+	if v == nil || v == "" {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+// UndoRevision desfaz a revisão: remove a linha inserida, recria a removida ou
+// volta a alterada ao estado anterior. As mudanças geram novas revisões.
+func (r *Repository) UndoRevision(rev Revision) error {
+	columns, ok := revisionColumns[rev.Table]
+	if !ok {
+		return fmt.Errorf("revision %d: unknown table %q", rev.ID, rev.Table)
+	}
+	key := revisionKeys[rev.Table]
+
+	var err error
+	switch rev.Op {
+	case RevisionInsert:
+		_, err = r.exec("DELETE FROM "+rev.Table+" WHERE "+key+" = ?", rev.Key)
+		if err == nil && rev.Table == "client_ports" {
+			r.exec("DELETE FROM port_health WHERE port_id = ?", rev.Key)
+			r.exec("DELETE FROM port_state WHERE port_id = ?", rev.Key)
+		}
+
+	case RevisionDelete:
+		values := make([]interface{}, len(columns))
+		for i, c := range columns {
+			values[i] = rev.Before[c]
+		}
+		_, err = r.exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", rev.Table, strings.Join(columns, ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")), values...)
+
+	case RevisionUpdate:
+		var set []string
+		var values []interface{}
+		for _, c := range columns {
+			// Colunas criadas depois da revisão ficam como estão
+			if _, ok := rev.Before[c]; !ok {
+				continue
+			}
+			set = append(set, c+" = ?")
+			values = append(values, rev.Before[c])
+		}
+		_, err = r.exec("UPDATE "+rev.Table+" SET "+strings.Join(set, ", ")+" WHERE "+key+" = ?", append(values, rev.Key)...)
+
+	default:
+		return fmt.Errorf("revision %d: unknown operation %q", rev.ID, rev.Op)
+	}
+
+	if err != nil {
+		return fmt.Errorf("revision %d (%s): %w", rev.ID, rev.Summary(), err)
+	}
+	return nil
+}
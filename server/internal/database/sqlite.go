@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect é o banco padrão: um arquivo local, compartilhado pelo
+// servidor e pelo voidprobe-cli da mesma máquina
+var sqliteDialect = &dialect{
+	name:       "sqlite",
+	open:       openSQLite,
+	rebind:     func(query string) string { return query },
+	migrations: "migrations/sqlite",
+	steps: map[int]func(tx *sql.Tx) error{
+		1: adoptLegacy,
+	},
+	schemaMigrations: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version     INTEGER PRIMARY KEY,
+		  name        TEXT NOT NULL,
+		  applied_at  TEXT NOT NULL DEFAULT (datetime('now'))
+		)`,
+	hasTable: "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+	// O PRAGMA muda quando outra conexão grava no arquivo (não as da própria)
+	dataVersion:      "PRAGMA data_version",
+	revisionTriggers: sqliteRevisionTriggers,
+}
+
+// openSQLite abre o arquivo com os pragmas aplicados a cada conexão
+func openSQLite(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1) // SQLite funciona melhor com uma conexão
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// sqliteRevisionTriggers grava cada insert, update e delete em revisions,
+// com a linha antes e depois em JSON e o autor de revision_actor
+func sqliteRevisionTriggers() string {
+	var b strings.Builder
+	for _, table := range []string{"clients", "client_ports"} {
+		key := revisionKeys[table]
+		row := func(prefix string) string {
+			var fields []string
+			for _, c := range revisionColumns[table] {
+				fields = append(fields, fmt.Sprintf("'%s', %s.%s", c, prefix, c))
+			}
+			return "json_object(" + strings.Join(fields, ", ") + ")"
+		}
+
+		fmt.Fprintf(&b, `
+DROP TRIGGER IF EXISTS revision_%[1]s_insert;
+CREATE TRIGGER revision_%[1]s_insert AFTER INSERT ON %[1]s BEGIN
+  INSERT INTO revisions (operator_id, table_name, row_key, client_id, op, after_data)
+  VALUES ((SELECT MAX(operator_id) FROM revision_actor), '%[1]s', NEW.%[2]s, NEW.client_id, 'insert', %[3]s);
+END;
+
+DROP TRIGGER IF EXISTS revision_%[1]s_update;
+CREATE TRIGGER revision_%[1]s_update AFTER UPDATE ON %[1]s BEGIN
+  INSERT INTO revisions (operator_id, table_name, row_key, client_id, op, before_data, after_data)
+  SELECT (SELECT MAX(operator_id) FROM revision_actor), '%[1]s', NEW.%[2]s, NEW.client_id, 'update', b, a
+  FROM (SELECT %[4]s AS b, %[3]s AS a) WHERE b <> a;
+END;
+
+DROP TRIGGER IF EXISTS revision_%[1]s_delete;
+CREATE TRIGGER revision_%[1]s_delete AFTER DELETE ON %[1]s BEGIN
+  INSERT INTO revisions (operator_id, table_name, row_key, client_id, op, before_data)
+  VALUES ((SELECT MAX(operator_id) FROM revision_actor), '%[1]s', OLD.%[2]s, OLD.client_id, 'delete', %[4]s);
+END;
+`, table, key, row("NEW"), row("OLD"))
+	}
+	return b.String()
+}
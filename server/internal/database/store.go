@@ -0,0 +1,126 @@
+package database
+
+// Store é o armazenamento do voidprobe: clientes, portas, chaves, operadores
+// e auditoria. O servidor e o voidprobe-cli usam apenas esta interface;
+// Repository a implementa sobre SQLite (padrão) e PostgreSQL, que permite
+// várias instâncias do servidor compartilharem o mesmo estado.
+type Store interface {
+	// Schema e conexão
+	Migrate() ([]Migration, error)
+	MigrationStatus() ([]Migration, int, error)
+	CheckVersion() (current, latest int, err error)
+	LatestVersion() int
+	DataVersion() (int64, error)
+	Tx(fn func(tx Store) error) error
+	As(operatorID string) Store
+	Close() error
+
+	// Clientes
+	GetClient(clientID string) (*Client, error)
+	ValidateClient(clientID, key string) (*Client, error)
+	ValidateClientByID(clientID string) (*Client, error)
+	ListClients() ([]Client, error)
+	CreateClient(c Client, key string) error
+	UpdateClient(c Client) error
+	DeleteClient(clientID string) error
+	SetClientStatus(clientID, status string) error
+	SetClientGroup(clientID, group string) error
+	SetClientTags(clientID string, tags map[string]string) error
+	SetClientKey(clientID, key string) error
+	UpdateLastSeen(clientID string) error
+
+	// Mapeamentos de porta e estado de execução
+	GetClientPorts(clientID string) ([]PortMapping, error)
+	ListPorts(clientID string) ([]PortInfo, error)
+	GetPort(portID int) (*PortMapping, error)
+	AddPort(p PortMapping) (int, error)
+	UpdatePort(p PortMapping) error
+	DeletePort(portID int) error
+	SetPortEnabled(portID int, enabled bool) error
+	SetPortOption(portID int, option, value string) error
+	AllocatePort(clientID string) (int, error)
+	SetPortHealth(clientID string, portID int, status, detail string) error
+	SetPortState(portID int, state, detail string) error
+	SetClientOffline(clientID string) error
+	ResetPortStates() error
+	ResetClientHealth(clientID string) error
+
+	// Serviços declarados pelos clientes
+	SyncServices(clientID string, services []Service) (portsChanged bool, err error)
+	ListServices(clientID string) ([]ServiceInfo, error)
+	ApproveService(clientID, name string, port int) (*PortMapping, error)
+	RevokeService(clientID, name string) error
+
+	// Pools de portas
+	ListPools() ([]Pool, error)
+	AddPool(group string, start, end int) error
+	DeletePool(poolID int) error
+
+	// Modelos de porta ligados a clientes e grupos
+	ListTemplates() ([]PortTemplate, error)
+	GetTemplate(name string) (*PortTemplate, error)
+	CreateTemplate(name, allocation string) error
+	DeleteTemplate(name string) error
+	SetTemplateAllocation(name, allocation string) error
+	AddTemplatePort(name string, p TemplatePort) error
+	RemoveTemplatePort(name string, p TemplatePort) error
+	AttachTemplate(name string, a TemplateAttachment) error
+	DetachTemplate(name string, a TemplateAttachment) error
+	SyncTemplates(clientID string) ([]TemplateSync, error)
+
+	// Local-forwards e links entre clientes
+	GetClientForwards(clientID string) ([]LocalForward, error)
+	GetForward(clientID string, id int) (*LocalForward, error)
+	LookupForward(id int) (*LocalForward, error)
+	ListForwards(clientID string) ([]LocalForward, error)
+	AddForward(f LocalForward) (int, error)
+	DeleteForward(id int) error
+	SetForwardEnabled(id int, enabled bool) error
+	LinkAllowed(sourceClientID, targetClientID string) (bool, error)
+	ListLinks() ([]Link, error)
+	AddLink(sourceClientID, targetClientID string) error
+	DeleteLink(sourceClientID, targetClientID string) error
+
+	// Rotas por hostname (HTTP e TLS)
+	GetHTTPRoute(hostname string) (*Route, error)
+	GetTLSRoute(serverName string) (*Route, error)
+	LookupRoute(kind RouteKind, id int) (*Route, error)
+	ListRoutes(kind RouteKind, clientID string) ([]Route, error)
+	AddRoute(kind RouteKind, route Route) (int, error)
+	DeleteRoute(kind RouteKind, id int) error
+	SetRouteEnabled(kind RouteKind, id int, enabled bool) error
+
+	// Nós do cluster e clientes conectados a cada um
+	StartNode(nodeID, address string) error
+	NodeHeartbeat(nodeID, address string) error
+	ListNodes() ([]Node, error)
+	RemoveNode(nodeID string) error
+	AttachClient(clientID, nodeID string) error
+	DetachClient(clientID, nodeID string) (moved bool, err error)
+	ListClientNodes() ([]ClientNode, error)
+
+	// Operadores e tokens da API
+	ValidateOperator(operatorID, key string) (*Operator, error)
+	GetOperator(operatorID string) (*Operator, error)
+	HasAdmins() (bool, error)
+	ListOperators() ([]Operator, error)
+	CreateOperator(op Operator, key string) error
+	SetOperatorRole(operatorID, role string) error
+	SetOperatorGroups(operatorID string, groups []string) error
+	SetOperatorStatus(operatorID, status string) error
+	SetOperatorKey(operatorID, key string) error
+	DeleteOperator(operatorID string) error
+	ValidateAPIToken(token string) (*APIToken, error)
+	ListAPITokens() ([]APIToken, error)
+	CreateAPIToken(operatorID, name string, scopes []string) (string, error)
+	DeleteAPIToken(id int) error
+
+	// Auditoria e histórico
+	Audit(operatorID, clientID, action string) error
+	ListAudit(clientID string, limit int) ([]AuditEntry, error)
+	ListRevisions(clientID string, after, limit int) ([]Revision, error)
+	UndoRevision(rev Revision) error
+}
+
+// Repository implementa Store
+var _ Store = (*Repository)(nil)
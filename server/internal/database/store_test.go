@@ -0,0 +1,1253 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Conformidade de Store: cada teste roda nos dois bancos, num banco novo e
+// migrado. O SQLite usa um arquivo temporário; o PostgreSQL usa a URL de
+// VOIDPROBE_TEST_POSTGRES ou, sem ela, um container do docker (um schema por
+// teste). Sem nenhum dos dois, a parte do PostgreSQL é pulada.
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if postgres.container != "" {
+		exec.Command("docker", "rm", "-f", postgres.container).Run()
+	}
+	os.Exit(code)
+}
+
+// postgres é o servidor usado pelos testes, resolvido na primeira chamada
+var postgres struct {
+	once      sync.Once
+	dsn       string
+	skip      string // motivo para pular, se não houver servidor
+	container string
+	schemas   atomic.Int64
+}
+
+func postgresServer() (dsn, skip string) {
+	postgres.once.Do(func() {
+		if dsn := os.Getenv("VOIDPROBE_TEST_POSTGRES"); dsn != "" {
+			postgres.dsn = dsn
+			return
+		}
+		postgres.dsn, postgres.skip = startPostgresContainer()
+	})
+	return postgres.dsn, postgres.skip
+}
+
+// startPostgresContainer sobe um postgres descartável numa porta local livre
+func startPostgresContainer() (dsn, skip string) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", "set VOIDPROBE_TEST_POSTGRES=postgres://... (docker not available)"
+	}
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-e", "POSTGRES_PASSWORD=voidprobe",
+		"-p", "127.0.0.1::5432", "postgres:16-alpine").Output()
+	if err != nil {
+		return "", fmt.Sprintf("set VOIDPROBE_TEST_POSTGRES=postgres://... (docker run failed: %v)", err)
+	}
+	postgres.container = strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", postgres.container, "5432/tcp").Output()
+	if err != nil {
+		return "", fmt.Sprintf("docker port failed: %v", err)
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	dsn = "postgres://postgres:voidprobe@" + addr + "/postgres?sslmode=disable"
+
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		db, err := sql.Open("postgres", dsn)
+		if err == nil {
+			err = db.Ping()
+			db.Close()
+		}
+		if err == nil {
+			return dsn, ""
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Sprintf("postgres container not ready: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// postgresDSN cria um schema vazio para o teste e retorna a URL que o usa
+func postgresDSN(t *testing.T) string {
+	t.Helper()
+	dsn, skip := postgresServer()
+	if skip != "" {
+		t.Skip(skip)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("voidprobe_test_%d_%d", os.Getpid(), postgres.schemas.Add(1))
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// backends executa fn com a URL de um banco novo, sem migrar, de cada tipo
+func backends(t *testing.T, fn func(t *testing.T, dsn string)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, filepath.Join(t.TempDir(), "voidprobe.db"))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		fn(t, postgresDSN(t))
+	})
+}
+
+// stores executa fn com um banco novo e migrado de cada tipo
+func stores(t *testing.T, fn func(t *testing.T, s Store)) {
+	backends(t, func(t *testing.T, dsn string) {
+		s := openStore(t, dsn)
+		if _, err := s.Migrate(); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		fn(t, s)
+	})
+}
+
+func openStore(t *testing.T, dsn string) Store {
+	t.Helper()
+	s, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func addClient(t *testing.T, s Store, id, group string) {
+	t.Helper()
+	must(t, s.CreateClient(Client{ClientID: id, ClientName: "name-" + id, Group: group}, "key-"+id))
+}
+
+func addPort(t *testing.T, s Store, p PortMapping) int {
+	t.Helper()
+	p.Enabled = true
+	id, err := s.AddPort(p)
+	must(t, err)
+	return id
+}
+
+func findPort(t *testing.T, s Store, clientID string, id int) PortInfo {
+	t.Helper()
+	ports, err := s.ListPorts(clientID)
+	must(t, err)
+	for _, p := range ports {
+		if p.ID == id {
+			return p
+		}
+	}
+	t.Fatalf("port %d not listed for %q", id, clientID)
+	return PortInfo{}
+}
+
+func TestRebindPostgres(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"WHERE a = ? AND b = ?", "WHERE a = $1 AND b = $2"},
+		{"WHERE a = ?1 OR b = ?1", "WHERE a = $1 OR b = $1"},
+		{"VALUES ('?', ?)", "VALUES ('?', $1)"},
+		{"SET at = datetime('now') WHERE id = ?", "SET at = utc_now() WHERE id = $1"},
+		{"LIKE 'a?b' AND x = ? AND y = ?12", "LIKE 'a?b' AND x = $1 AND y = $12"},
+	}
+	for _, c := range cases {
+		if got := rebindPostgres(c.in); got != c.want {
+			t.Errorf("rebindPostgres(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+	if got := sqliteDialect.rebind("a = ?"); got != "a = ?" {
+		t.Errorf("sqlite rebind changed the query: %q", got)
+	}
+}
+
+func TestMigrationFilesMatch(t *testing.T) {
+	lite, err := migrations(sqliteDialect.migrations)
+	must(t, err)
+	pg, err := migrations(postgresDialect.migrations)
+	must(t, err)
+	if len(lite) == 0 || len(lite) != len(pg) {
+		t.Fatalf("sqlite has %d migrations, postgres %d", len(lite), len(pg))
+	}
+	for i := range lite {
+		if lite[i].Version != pg[i].Version || lite[i].Name != pg[i].Name {
+			t.Errorf("migration %d: sqlite %04d_%s, postgres %04d_%s", i, lite[i].Version, lite[i].Name, pg[i].Version, pg[i].Name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	backends(t, func(t *testing.T, dsn string) {
+		s := openStore(t, dsn)
+		latest := s.LatestVersion()
+
+		list, current, err := s.MigrationStatus()
+		must(t, err)
+		if current != 0 || len(list) != latest || list[0].AppliedAt != "" {
+			t.Fatalf("fresh database: current %d, %d migrations, first applied %q", current, len(list), list[0].AppliedAt)
+		}
+
+		applied, err := s.Migrate()
+		must(t, err)
+		if len(applied) != latest {
+			t.Fatalf("applied %d migrations, want %d", len(applied), latest)
+		}
+		if applied, err = s.Migrate(); err != nil || len(applied) != 0 {
+			t.Fatalf("second Migrate applied %d (err %v)", len(applied), err)
+		}
+		list, current, err = s.MigrationStatus()
+		must(t, err)
+		for _, m := range list {
+			if m.AppliedAt == "" {
+				t.Errorf("migration %04d_%s not applied", m.Version, m.Name)
+			}
+		}
+		if c, l, err := s.CheckVersion(); err != nil || c != latest || l != latest {
+			t.Fatalf("CheckVersion = %d, %d, %v", c, l, err)
+		}
+
+		// Banco migrado por um binário mais novo
+		r := s.(*Repository)
+		_, err = r.exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", latest+1, "future")
+		must(t, err)
+		if _, _, err := s.CheckVersion(); !errors.Is(err, ErrSchemaTooNew) {
+			t.Fatalf("CheckVersion on newer schema: %v", err)
+		}
+		if _, err := s.Migrate(); !errors.Is(err, ErrSchemaTooNew) {
+			t.Fatalf("Migrate on newer schema: %v", err)
+		}
+	})
+}
+
+func TestTx(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		failed := errors.New("rollback")
+		err := s.Tx(func(tx Store) error {
+			addClient(t, tx, "c1", "")
+			return failed
+		})
+		if err != failed {
+			t.Fatalf("Tx returned %v", err)
+		}
+		if c, err := s.GetClient("c1"); err != nil || c != nil {
+			t.Fatalf("client written by a rolled back Tx: %v, %v", c, err)
+		}
+
+		must(t, s.Tx(func(tx Store) error {
+			addClient(t, tx, "c1", "")
+			return tx.Tx(func(inner Store) error { return inner.SetClientGroup("c1", "g1") })
+		}))
+		if c, err := s.GetClient("c1"); err != nil || c == nil || c.Group != "g1" {
+			t.Fatalf("client after Tx: %+v, %v", c, err)
+		}
+	})
+}
+
+func TestDataVersion(t *testing.T) {
+	backends(t, func(t *testing.T, dsn string) {
+		s := openStore(t, dsn)
+		_, err := s.Migrate()
+		must(t, err)
+		before, err := s.DataVersion()
+		must(t, err)
+
+		// A mudança vem de outra conexão, como a de outro processo ou nó
+		other := openStore(t, dsn)
+		addClient(t, other, "c1", "")
+
+		after, err := s.DataVersion()
+		must(t, err)
+		if after == before {
+			t.Fatalf("DataVersion did not change (%d)", after)
+		}
+	})
+}
+
+func TestClients(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		must(t, s.CreateClient(Client{ClientID: "c1", ClientName: "Zulu", Group: "lis", Tags: map[string]string{"env": "prod"}}, "k1"))
+		addClient(t, s, "c2", "")
+		if err := s.CreateClient(Client{ClientID: "c1", ClientName: "dup"}, "k"); err == nil {
+			t.Fatal("duplicate client accepted")
+		}
+
+		c, err := s.GetClient("c1")
+		must(t, err)
+		if c == nil || c.ClientName != "Zulu" || c.Status != "active" || c.Group != "lis" || c.Tags["env"] != "prod" || c.CreatedAt.IsZero() || c.LastSeenAt != nil {
+			t.Fatalf("GetClient: %+v", c)
+		}
+		if c, err := s.GetClient("missing"); err != nil || c != nil {
+			t.Fatalf("GetClient(missing) = %v, %v", c, err)
+		}
+
+		if _, err := s.ValidateClient("c1", "k1"); err != nil {
+			t.Fatalf("ValidateClient: %v", err)
+		}
+		if _, err := s.ValidateClient("c1", "wrong"); err == nil {
+			t.Fatal("ValidateClient accepted a wrong key")
+		}
+		must(t, s.SetClientKey("c1", "k2"))
+		if _, err := s.ValidateClient("c1", "k2"); err != nil {
+			t.Fatalf("ValidateClient after SetClientKey: %v", err)
+		}
+		mustNotFound(t, s.SetClientKey("missing", "k"))
+
+		must(t, s.SetClientStatus("c1", "blocked"))
+		if _, err := s.ValidateClientByID("c1"); err == nil {
+			t.Fatal("ValidateClientByID accepted a blocked client")
+		}
+		if err := s.SetClientStatus("c1", "gone"); err == nil {
+			t.Fatal("invalid status accepted")
+		}
+		must(t, s.SetClientStatus("c1", "active"))
+		if _, err := s.ValidateClientByID("c1"); err != nil {
+			t.Fatalf("ValidateClientByID: %v", err)
+		}
+
+		must(t, s.SetClientGroup("c1", ""))
+		mustNotFound(t, s.SetClientGroup("missing", "g"))
+		must(t, s.SetClientTags("c1", map[string]string{"site": "lis", "canary": ""}))
+		if err := s.SetClientTags("c1", map[string]string{"name": "x"}); err == nil {
+			t.Fatal("reserved tag accepted")
+		}
+		must(t, s.UpdateLastSeen("c1"))
+		c, err = s.GetClient("c1")
+		must(t, err)
+		if c.Group != "" || c.Tags["site"] != "lis" || len(c.Tags) != 2 || c.LastSeenAt == nil {
+			t.Fatalf("client after updates: %+v", c)
+		}
+
+		must(t, s.UpdateClient(Client{ClientID: "c2", ClientName: "Alpha", Group: "g2", Status: "blocked"}))
+		mustNotFound(t, s.UpdateClient(Client{ClientID: "missing", ClientName: "x", Status: "active"}))
+
+		list, err := s.ListClients()
+		must(t, err)
+		if len(list) != 2 || list[0].ClientID != "c2" || list[0].Group != "g2" || list[0].Status != "blocked" {
+			t.Fatalf("ListClients: %+v", list)
+		}
+
+		// Os dados do cliente saem junto com ele
+		addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: 2222, TargetPort: 22})
+		_, err = s.AddRoute(HTTPRoutes, Route{Hostname: "a.example.com", ClientID: "c1", TargetHost: "127.0.0.1", TargetPort: 80})
+		must(t, err)
+		must(t, s.DeleteClient("c1"))
+		mustNotFound(t, s.DeleteClient("c1"))
+		if ports, _ := s.ListPorts("c1"); len(ports) != 0 {
+			t.Fatalf("ports left after DeleteClient: %+v", ports)
+		}
+		if routes, _ := s.ListRoutes(HTTPRoutes, "c1"); len(routes) != 0 {
+			t.Fatalf("routes left after DeleteClient: %+v", routes)
+		}
+	})
+}
+
+func TestPorts(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "c1", "")
+		addClient(t, s, "c2", "")
+
+		ssh := addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: 2222, TargetPort: 22})
+		p, err := s.GetPort(ssh)
+		must(t, err)
+		if p == nil || p.TargetHost != "127.0.0.1" || p.Mode != ModeForward || p.Proto != "tcp" || p.HealthCheck != "tcp" || p.Target() != "127.0.0.1:22" {
+			t.Fatalf("GetPort: %+v", p)
+		}
+		if p, err := s.GetPort(9999); err != nil || p != nil {
+			t.Fatalf("GetPort(missing) = %v, %v", p, err)
+		}
+		if _, err := s.AddPort(PortMapping{ClientID: "c2", ExposedPort: 2222, TargetPort: 22}); err == nil {
+			t.Fatal("exposed port used twice")
+		}
+
+		docker := addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: 2375, TargetHost: "unix:///var/run/docker.sock"})
+		if p, _ := s.GetPort(docker); p.TargetPort != 0 || p.Target() != "unix:///var/run/docker.sock" {
+			t.Fatalf("unix port: %+v", p)
+		}
+		if _, err := s.AddPort(PortMapping{ClientID: "c1", ExposedPort: 2376, TargetHost: "unix:///var/run/docker.sock"}); err == nil {
+			t.Fatal("unix socket mapped twice")
+		}
+		if _, err := s.AddPort(PortMapping{ClientID: "c1", ExposedPort: 2377, TargetHost: "unix://relative.sock"}); err == nil {
+			t.Fatal("relative unix path accepted")
+		}
+
+		socks := addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: 1080, Mode: ModeSocks5, AuthUser: "u", AuthHash: HashKey("pw")})
+		if p, _ := s.GetPort(socks); p.TargetHost != "*" || p.Target() != ModeSocks5 || p.AuthUser != "u" || p.AuthHash != HashKey("pw") {
+			t.Fatalf("socks5 port: %+v", p)
+		}
+
+		// Opções de port-set
+		must(t, s.SetPortOption(ssh, "proxy-protocol", "v2"))
+		mustNotFound(t, s.SetPortOption(socks, "proxy-protocol", "v1"))
+		must(t, s.SetPortOption(ssh, "accept-proxy", "on"))
+		must(t, s.SetPortOption(ssh, "health-check", "http:/healthz"))
+		must(t, s.SetPortOption(ssh, "refuse-unhealthy", "on"))
+		must(t, s.SetPortOption(ssh, "schedule", "mon-fri 08:00-18:00"))
+		must(t, s.SetPortOption(ssh, "ttl", "4h"))
+		for _, bad := range [][2]string{{"proxy-protocol", "v3"}, {"ttl", "soon"}, {"schedule", "never"}, {"health-check", "udp"}, {"color", "red"}} {
+			if err := s.SetPortOption(ssh, bad[0], bad[1]); err == nil {
+				t.Errorf("SetPortOption(%s, %s) accepted", bad[0], bad[1])
+			}
+		}
+		mustNotFound(t, s.SetPortOption(9999, "accept-proxy", "on"))
+		p, _ = s.GetPort(ssh)
+		if p.ProxyProto != "v2" || !p.AcceptProxy || p.HealthCheck != "http:/healthz" || !p.RefuseDown || p.Schedule == "" || p.ExpiresAt == "" {
+			t.Fatalf("port after SetPortOption: %+v", p)
+		}
+		must(t, s.SetPortOption(ssh, "ttl", "off"))
+		must(t, s.SetPortOption(ssh, "schedule", "off"))
+		if p, _ = s.GetPort(ssh); p.ExpiresAt != "" || p.Schedule != "" {
+			t.Fatalf("ttl/schedule not cleared: %+v", p)
+		}
+
+		// UpdatePort regrava tudo; SOCKS5 sem AuthHash mantém a senha
+		p.TargetPort = 2022
+		must(t, s.UpdatePort(*p))
+		if p, _ = s.GetPort(ssh); p.TargetPort != 2022 {
+			t.Fatalf("UpdatePort: %+v", p)
+		}
+		sp, _ := s.GetPort(socks)
+		sp.AuthHash = ""
+		sp.AuthUser = "v"
+		must(t, s.UpdatePort(*sp))
+		if sp, _ = s.GetPort(socks); sp.AuthUser != "v" || sp.AuthHash != HashKey("pw") {
+			t.Fatalf("UpdatePort socks5: %+v", sp)
+		}
+		mustNotFound(t, s.UpdatePort(PortMapping{ID: 9999, ClientID: "c1", ExposedPort: 1, TargetPort: 1}))
+
+		// Habilitação e estado de execução
+		must(t, s.SetPortEnabled(docker, false))
+		mustNotFound(t, s.SetPortEnabled(9999, false))
+		enabled, err := s.GetClientPorts("c1")
+		must(t, err)
+		if len(enabled) != 2 || enabled[0].ID != socks || enabled[1].ID != ssh {
+			t.Fatalf("GetClientPorts: %+v", enabled)
+		}
+		if st := findPort(t, s, "c1", docker).State; st != PortDisabled {
+			t.Fatalf("disabled port state %q", st)
+		}
+
+		must(t, s.SetPortState(ssh, PortListening, ""))
+		if st := findPort(t, s, "c1", ssh).State; st != PortListening {
+			t.Fatalf("state %q", st)
+		}
+		must(t, s.SetPortState(ssh, PortBindError, "address in use"))
+		if p := findPort(t, s, "", ssh); p.State != PortBindError || p.StateDetail != "address in use" {
+			t.Fatalf("state %q (%q)", p.State, p.StateDetail)
+		}
+		must(t, s.SetClientOffline("c1"))
+		if st := findPort(t, s, "c1", ssh).State; st != PortClientOffline {
+			t.Fatalf("state after SetClientOffline %q", st)
+		}
+		must(t, s.SetPortState(ssh, PortListening, ""))
+		must(t, s.ResetPortStates())
+		if st := findPort(t, s, "c1", ssh).State; st != PortClientOffline {
+			t.Fatalf("state after ResetPortStates %q", st)
+		}
+
+		// Saúde reportada pelo cliente (só para as próprias portas)
+		must(t, s.SetPortHealth("c1", ssh, HealthDown, "refused"))
+		must(t, s.SetPortHealth("c2", socks, HealthDown, "not mine"))
+		if h := findPort(t, s, "c1", ssh).Health; h != HealthDown {
+			t.Fatalf("health %q", h)
+		}
+		if h := findPort(t, s, "c1", socks).Health; h != HealthUnknown {
+			t.Fatalf("health of another client's port changed to %q", h)
+		}
+		must(t, s.SetPortHealth("c1", ssh, HealthUp, ""))
+		if h := findPort(t, s, "c1", ssh).Health; h != HealthUp {
+			t.Fatalf("health %q", h)
+		}
+		must(t, s.ResetClientHealth("c1"))
+		if h := findPort(t, s, "c1", ssh).Health; h != HealthUnknown {
+			t.Fatalf("health after ResetClientHealth %q", h)
+		}
+
+		must(t, s.DeletePort(ssh))
+		mustNotFound(t, s.DeletePort(ssh))
+		if p, _ := s.GetPort(ssh); p != nil {
+			t.Fatalf("port left after DeletePort: %+v", p)
+		}
+	})
+}
+
+func TestPools(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "c1", "")
+		addClient(t, s, "v1", "vendors")
+
+		if _, err := s.AllocatePort("c1"); err == nil {
+			t.Fatal("AllocatePort without pools")
+		}
+		_, err := s.AllocatePort("missing")
+		mustNotFound(t, err)
+
+		must(t, s.AddPool("", 20000, 20001))
+		must(t, s.AddPool("vendors", 30000, 30000))
+
+		port, err := s.AllocatePort("c1")
+		must(t, err)
+		if port != 20000 {
+			t.Fatalf("AllocatePort = %d", port)
+		}
+		addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: port, TargetPort: 22})
+		if port, _ = s.AllocatePort("c1"); port != 20001 {
+			t.Fatalf("second AllocatePort = %d", port)
+		}
+
+		// Grupo com pool próprio não usa o padrão
+		port, err = s.AllocatePort("v1")
+		must(t, err)
+		if port != 30000 {
+			t.Fatalf("AllocatePort(vendors) = %d", port)
+		}
+		addPort(t, s, PortMapping{ClientID: "v1", ExposedPort: port, TargetPort: 22})
+		if _, err := s.AllocatePort("v1"); err == nil {
+			t.Fatal("AllocatePort on a full pool")
+		}
+
+		pools, err := s.ListPools()
+		must(t, err)
+		if len(pools) != 2 || pools[0].Group != "" || pools[0].Used != 1 || pools[1].Group != "vendors" || pools[1].Used != 1 {
+			t.Fatalf("ListPools: %+v", pools)
+		}
+		must(t, s.DeletePool(pools[1].ID))
+		mustNotFound(t, s.DeletePool(pools[1].ID))
+
+		// Sem pool do grupo, vale o padrão
+		if port, _ = s.AllocatePort("v1"); port != 20001 {
+			t.Fatalf("AllocatePort after removing the group pool = %d", port)
+		}
+	})
+}
+
+func TestPoolsBindCheck(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		busy, err := net.Listen("tcp", "0.0.0.0:0")
+		must(t, err)
+		defer busy.Close()
+		port := busy.Addr().(*net.TCPAddr).Port
+
+		addClient(t, s, "c1", "")
+		must(t, s.AddPool("", port, port))
+
+		// Store de Open só consulta o banco; o do servidor pula a porta ocupada
+		if got, err := s.AllocatePort("c1"); err != nil || got != port {
+			t.Fatalf("AllocatePort without bind check = %d, %v", got, err)
+		}
+		s.(*Repository).bindCheck = true
+		if got, err := s.As("alice").AllocatePort("c1"); err == nil {
+			t.Fatalf("AllocatePort returned busy port %d", got)
+		}
+		err = s.Tx(func(tx Store) error {
+			_, err := tx.AllocatePort("c1")
+			return err
+		})
+		if err == nil {
+			t.Fatal("AllocatePort in Tx returned the busy port")
+		}
+	})
+}
+
+func TestServices(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "c1", "")
+		must(t, s.AddPool("", 20000, 20099))
+
+		changed, err := s.SyncServices("c1", []Service{{"ssh", "localhost", 22}, {"web", "127.0.0.1", 8080}, {"docker", "unix:///var/run/docker.sock", 0}})
+		must(t, err)
+		if changed {
+			t.Fatal("new services changed ports")
+		}
+		services, err := s.ListServices("c1")
+		must(t, err)
+		if len(services) != 3 || services[0].Name != "docker" || services[0].ExposedPort != 0 {
+			t.Fatalf("ListServices: %+v", services)
+		}
+
+		p, err := s.ApproveService("c1", "ssh", 2222)
+		must(t, err)
+		if p.ExposedPort != 2222 || p.Target() != "localhost:22" {
+			t.Fatalf("ApproveService: %+v", p)
+		}
+		if _, err := s.ApproveService("c1", "ssh", 2223); err == nil {
+			t.Fatal("service approved twice")
+		}
+		_, err = s.ApproveService("c1", "ftp", 0)
+		mustNotFound(t, err)
+		if p, err = s.ApproveService("c1", "web", 0); err != nil || p.ExposedPort != 20000 {
+			t.Fatalf("ApproveService from pool: %+v, %v", p, err)
+		}
+		if p, err = s.ApproveService("c1", "docker", 0); err != nil || p.Target() != "unix:///var/run/docker.sock" {
+			t.Fatalf("ApproveService unix: %+v, %v", p, err)
+		}
+
+		must(t, s.RevokeService("c1", "web"))
+		mustNotFound(t, s.RevokeService("c1", "ftp"))
+		services, _ = s.ListServices("")
+		for _, svc := range services {
+			if svc.Name == "web" && svc.ExposedPort != 0 {
+				t.Fatalf("revoked service still mapped: %+v", svc)
+			}
+		}
+		if ports, _ := s.ListPorts("c1"); len(ports) != 2 {
+			t.Fatalf("ports after RevokeService: %+v", ports)
+		}
+
+		// Destino alterado e serviço retirado: os mapeamentos saem, com o cliente como autor
+		changed, err = s.SyncServices("c1", []Service{{"ssh", "localhost", 2022}})
+		must(t, err)
+		if !changed {
+			t.Fatal("SyncServices did not report removed mappings")
+		}
+		services, _ = s.ListServices("c1")
+		if len(services) != 1 || services[0].ExposedPort != 0 || services[0].TargetPort != 2022 {
+			t.Fatalf("services after change: %+v", services)
+		}
+		if ports, _ := s.ListPorts("c1"); len(ports) != 0 {
+			t.Fatalf("ports after SyncServices: %+v", ports)
+		}
+		revisions, err := s.ListRevisions("c1", 0, 2)
+		must(t, err)
+		for _, rev := range revisions {
+			if rev.Op != RevisionDelete || rev.Operator != "client:c1" {
+				t.Fatalf("revision of a service removal: %+v", rev)
+			}
+		}
+		audit, _ := s.ListAudit("c1", 1)
+		if len(audit) != 1 || audit[0].OperatorID != "client:c1" {
+			t.Fatalf("audit of a service removal: %+v", audit)
+		}
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "a", "lis")
+		addClient(t, s, "b", "lis")
+		addClient(t, s, "c", "")
+
+		if err := s.CreateTemplate("", AllocationPool); err == nil {
+			t.Fatal("template without name")
+		}
+		if err := s.CreateTemplate("base", "9-1"); err == nil {
+			t.Fatal("invalid allocation accepted")
+		}
+		must(t, s.CreateTemplate("base", "20000-20010"))
+		if err := s.CreateTemplate("base", AllocationPool); err == nil {
+			t.Fatal("duplicate template")
+		}
+		must(t, s.AddTemplatePort("base", TemplatePort{TargetHost: "127.0.0.1", TargetPort: 22}))
+		mustNotFound(t, s.AddTemplatePort("missing", TemplatePort{TargetHost: "127.0.0.1", TargetPort: 22}))
+		must(t, s.AttachTemplate("base", TemplateAttachment{Kind: AttachGroup, Name: "lis"}))
+		must(t, s.AttachTemplate("base", TemplateAttachment{Kind: AttachGroup, Name: "lis"}))
+		mustNotFound(t, s.AttachTemplate("base", TemplateAttachment{Kind: AttachClient, Name: "missing"}))
+		if err := s.AttachTemplate("base", TemplateAttachment{Kind: "site", Name: "x"}); err == nil {
+			t.Fatal("invalid attachment kind")
+		}
+
+		synced, err := s.SyncTemplates("")
+		must(t, err)
+		if len(synced) != 2 || synced[0].ClientID != "a" || synced[1].ClientID != "b" || synced[0].Removed {
+			t.Fatalf("SyncTemplates: %+v", synced)
+		}
+		for _, sync := range synced {
+			if sync.ExposedPort < 20000 || sync.ExposedPort > 20010 || sync.Template != "base" {
+				t.Fatalf("port outside the template range: %+v", sync)
+			}
+		}
+		if synced, _ = s.SyncTemplates(""); len(synced) != 0 {
+			t.Fatalf("second SyncTemplates changed %+v", synced)
+		}
+
+		ports, _ := s.ListPorts("a")
+		if len(ports) != 1 || ports[0].Template != "base" || ports[0].TemplatePort == 0 {
+			t.Fatalf("template port: %+v", ports)
+		}
+		if err := s.DeletePort(ports[0].ID); err == nil {
+			t.Fatal("DeletePort removed a template port")
+		}
+
+		tpl, err := s.GetTemplate("base")
+		must(t, err)
+		if tpl == nil || len(tpl.Ports) != 1 || len(tpl.Attachments) != 1 || tpl.Mapped != 2 {
+			t.Fatalf("GetTemplate: %+v", tpl)
+		}
+		if tpl, err := s.GetTemplate("missing"); err != nil || tpl != nil {
+			t.Fatalf("GetTemplate(missing) = %v, %v", tpl, err)
+		}
+		list, err := s.ListTemplates()
+		must(t, err)
+		if len(list) != 1 || list[0].Mapped != 2 || len(list[0].Ports) != 1 {
+			t.Fatalf("ListTemplates: %+v", list)
+		}
+
+		// Cliente ligado diretamente; mudar de grupo tira os do grupo antigo
+		must(t, s.AttachTemplate("base", TemplateAttachment{Kind: AttachClient, Name: "c"}))
+		if synced, _ = s.SyncTemplates("c"); len(synced) != 1 || synced[0].ClientID != "c" {
+			t.Fatalf("SyncTemplates(c): %+v", synced)
+		}
+		must(t, s.SetClientGroup("b", ""))
+		if synced, _ = s.SyncTemplates("b"); len(synced) != 1 || !synced[0].Removed {
+			t.Fatalf("SyncTemplates after group change: %+v", synced)
+		}
+
+		must(t, s.SetTemplateAllocation("base", AllocationPool))
+		mustNotFound(t, s.SetTemplateAllocation("missing", AllocationPool))
+
+		must(t, s.RemoveTemplatePort("base", TemplatePort{TargetHost: "127.0.0.1", TargetPort: 22}))
+		mustNotFound(t, s.RemoveTemplatePort("base", TemplatePort{TargetHost: "127.0.0.1", TargetPort: 22}))
+		if synced, _ = s.SyncTemplates(""); len(synced) != 2 || !synced[0].Removed || !synced[1].Removed {
+			t.Fatalf("SyncTemplates after removing the target: %+v", synced)
+		}
+
+		must(t, s.DetachTemplate("base", TemplateAttachment{Kind: AttachGroup, Name: "lis"}))
+		mustNotFound(t, s.DetachTemplate("base", TemplateAttachment{Kind: AttachGroup, Name: "lis"}))
+		must(t, s.DeleteTemplate("base"))
+		mustNotFound(t, s.DeleteTemplate("base"))
+		if tpl, _ := s.GetTemplate("base"); tpl != nil {
+			t.Fatalf("template left after DeleteTemplate: %+v", tpl)
+		}
+	})
+}
+
+func TestForwardsAndLinks(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "a", "")
+		addClient(t, s, "b", "")
+
+		local, err := s.AddForward(LocalForward{ClientID: "a", ListenHost: "0.0.0.0", ListenPort: 9000, TargetHost: "10.0.0.1", TargetPort: 80})
+		must(t, err)
+		if _, err := s.AddForward(LocalForward{ClientID: "a", ListenHost: "0.0.0.0", ListenPort: 9000, TargetHost: "10.0.0.2", TargetPort: 80}); err == nil {
+			t.Fatal("listen port used twice on the client")
+		}
+
+		via := LocalForward{ClientID: "a", ListenHost: "127.0.0.1", ListenPort: 15432, TargetHost: "127.0.0.1", TargetPort: 5432, TargetClient: "b"}
+		if _, err := s.AddForward(via); err == nil {
+			t.Fatal("forward through another client without a link")
+		}
+		if ok, err := s.LinkAllowed("a", "b"); err != nil || ok {
+			t.Fatalf("LinkAllowed before AddLink = %v, %v", ok, err)
+		}
+		must(t, s.AddLink("a", "b"))
+		if ok, _ := s.LinkAllowed("a", "b"); !ok {
+			t.Fatal("LinkAllowed after AddLink")
+		}
+		if ok, _ := s.LinkAllowed("b", "a"); ok {
+			t.Fatal("links are one way")
+		}
+		relayed, err := s.AddForward(via)
+		must(t, err)
+
+		links, err := s.ListLinks()
+		must(t, err)
+		if len(links) != 1 || links[0].Source != "a" || links[0].Target != "b" || links[0].Forwards != 1 {
+			t.Fatalf("ListLinks: %+v", links)
+		}
+
+		f, err := s.GetForward("a", relayed)
+		must(t, err)
+		if f == nil || f.TargetClient != "b" || f.ListenAddr() != "127.0.0.1:15432" || f.Target() != "127.0.0.1:5432" || !f.Enabled {
+			t.Fatalf("GetForward: %+v", f)
+		}
+		if f, _ := s.GetForward("b", relayed); f != nil {
+			t.Fatalf("GetForward of another client: %+v", f)
+		}
+
+		must(t, s.SetForwardEnabled(local, false))
+		mustNotFound(t, s.SetForwardEnabled(9999, false))
+		if list, _ := s.GetClientForwards("a"); len(list) != 1 || list[0].ID != relayed {
+			t.Fatalf("GetClientForwards: %+v", list)
+		}
+		if f, _ := s.GetForward("a", local); f != nil {
+			t.Fatal("GetForward returned a disabled forward")
+		}
+		if f, _ := s.LookupForward(local); f == nil || f.Enabled {
+			t.Fatalf("LookupForward: %+v", f)
+		}
+		if f, err := s.LookupForward(9999); err != nil || f != nil {
+			t.Fatalf("LookupForward(missing) = %v, %v", f, err)
+		}
+		if list, _ := s.ListForwards(""); len(list) != 2 {
+			t.Fatalf("ListForwards: %+v", list)
+		}
+		if list, _ := s.ListForwards("b"); len(list) != 0 {
+			t.Fatalf("ListForwards(b): %+v", list)
+		}
+
+		must(t, s.DeleteForward(local))
+		mustNotFound(t, s.DeleteForward(local))
+		must(t, s.DeleteLink("a", "b"))
+		mustNotFound(t, s.DeleteLink("a", "b"))
+	})
+}
+
+func TestRoutes(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "a", "")
+
+		app, err := s.AddRoute(HTTPRoutes, Route{Hostname: "app.example.com", ClientID: "a", TargetHost: "127.0.0.1", TargetPort: 3000})
+		must(t, err)
+		_, err = s.AddRoute(HTTPRoutes, Route{Hostname: "*.lab.example.com", ClientID: "a", TargetHost: "10.0.0.8", TargetPort: 80})
+		must(t, err)
+		if _, err := s.AddRoute(HTTPRoutes, Route{Hostname: "app.example.com", ClientID: "a", TargetHost: "127.0.0.1", TargetPort: 1}); err == nil {
+			t.Fatal("hostname routed twice")
+		}
+		def, err := s.AddRoute(TLSRoutes, Route{Hostname: DefaultRoute, ClientID: "a", TargetHost: "127.0.0.1", TargetPort: 8443})
+		must(t, err)
+
+		if r, err := s.GetHTTPRoute("APP.example.com."); err != nil || r == nil || r.ID != app || r.Target() != "127.0.0.1:3000" {
+			t.Fatalf("GetHTTPRoute exact: %+v, %v", r, err)
+		}
+		if r, _ := s.GetHTTPRoute("grafana.lab.example.com"); r == nil || r.TargetHost != "10.0.0.8" {
+			t.Fatalf("GetHTTPRoute wildcard: %+v", r)
+		}
+		if r, _ := s.GetHTTPRoute("other.com"); r != nil {
+			t.Fatalf("GetHTTPRoute unknown: %+v", r)
+		}
+		if r, _ := s.GetTLSRoute("unknown.example.com"); r == nil || r.ID != def {
+			t.Fatalf("GetTLSRoute default: %+v", r)
+		}
+		if r, _ := s.GetTLSRoute(""); r == nil || r.ID != def {
+			t.Fatalf("GetTLSRoute without SNI: %+v", r)
+		}
+
+		if r, err := s.LookupRoute(HTTPRoutes, app); err != nil || r == nil || r.Hostname != "app.example.com" {
+			t.Fatalf("LookupRoute: %+v, %v", r, err)
+		}
+		if r, err := s.LookupRoute(TLSRoutes, app+100); err != nil || r != nil {
+			t.Fatalf("LookupRoute(missing) = %v, %v", r, err)
+		}
+		if list, _ := s.ListRoutes(HTTPRoutes, "a"); len(list) != 2 || list[0].Hostname != "*.lab.example.com" {
+			t.Fatalf("ListRoutes: %+v", list)
+		}
+		if list, _ := s.ListRoutes(TLSRoutes, ""); len(list) != 1 {
+			t.Fatalf("ListRoutes(tls): %+v", list)
+		}
+
+		must(t, s.SetRouteEnabled(HTTPRoutes, app, false))
+		if r, _ := s.GetHTTPRoute("app.example.com"); r != nil {
+			t.Fatalf("disabled route matched: %+v", r)
+		}
+		mustNotFound(t, s.SetRouteEnabled(HTTPRoutes, 9999, true))
+		must(t, s.DeleteRoute(HTTPRoutes, app))
+		mustNotFound(t, s.DeleteRoute(HTTPRoutes, app))
+	})
+}
+
+func TestNodes(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "a", "")
+		port := addPort(t, s, PortMapping{ClientID: "a", ExposedPort: 2222, TargetPort: 22})
+
+		must(t, s.StartNode("n1", "10.0.0.1:7000"))
+		must(t, s.NodeHeartbeat("n2", "10.0.0.2:7000"))
+		must(t, s.NodeHeartbeat("n1", "10.0.0.1:7001"))
+		nodes, err := s.ListNodes()
+		must(t, err)
+		if len(nodes) != 2 || nodes[0].Address != "10.0.0.1:7001" || !nodes[0].Alive() || !nodes[1].Alive() {
+			t.Fatalf("ListNodes: %+v", nodes)
+		}
+
+		must(t, s.AttachClient("a", "n1"))
+		list, err := s.ListClientNodes()
+		must(t, err)
+		if len(list) != 1 || list[0].ClientID != "a" || list[0].Node.NodeID != "n1" {
+			t.Fatalf("ListClientNodes: %+v", list)
+		}
+
+		// Reconectou em n2: o desligamento atrasado de n1 não apaga o registro
+		must(t, s.AttachClient("a", "n2"))
+		if moved, err := s.DetachClient("a", "n1"); err != nil || !moved {
+			t.Fatalf("DetachClient from the old node = %v, %v", moved, err)
+		}
+		if moved, err := s.DetachClient("a", "n2"); err != nil || moved {
+			t.Fatalf("DetachClient = %v, %v", moved, err)
+		}
+		if moved, err := s.DetachClient("a", "n2"); err != nil || moved {
+			t.Fatalf("DetachClient without registration = %v, %v", moved, err)
+		}
+
+		// Nó removido (ou reiniciado): os clientes dele ficam offline
+		must(t, s.AttachClient("a", "n1"))
+		must(t, s.SetPortState(port, PortListening, ""))
+		must(t, s.RemoveNode("n1"))
+		mustNotFound(t, s.RemoveNode("n1"))
+		if list, _ := s.ListClientNodes(); len(list) != 0 {
+			t.Fatalf("clients left on a removed node: %+v", list)
+		}
+		if st := findPort(t, s, "a", port).State; st != PortClientOffline {
+			t.Fatalf("state after RemoveNode %q", st)
+		}
+
+		must(t, s.AttachClient("a", "n2"))
+		must(t, s.StartNode("n2", "10.0.0.2:7000"))
+		if list, _ := s.ListClientNodes(); len(list) != 0 {
+			t.Fatalf("clients left after the node restarted: %+v", list)
+		}
+	})
+}
+
+func TestOperatorsAndTokens(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		if ok, err := s.HasAdmins(); err != nil || ok {
+			t.Fatalf("HasAdmins on a new database = %v, %v", ok, err)
+		}
+		if err := s.CreateOperator(Operator{OperatorID: "x", Name: "X", Role: "root"}, "k"); err == nil {
+			t.Fatal("invalid role accepted")
+		}
+		must(t, s.CreateOperator(Operator{OperatorID: "root", Name: "Root", Role: RoleAdmin}, "pw"))
+		must(t, s.CreateOperator(Operator{OperatorID: "vend", Name: "Vendor", Role: RoleOperator, Groups: []string{"vendors", "lab"}}, "vk"))
+		if err := s.CreateOperator(Operator{OperatorID: "root", Name: "Again", Role: RoleAdmin}, "pw"); err == nil {
+			t.Fatal("duplicate operator")
+		}
+		if ok, _ := s.HasAdmins(); !ok {
+			t.Fatal("HasAdmins after creating an admin")
+		}
+
+		op, err := s.ValidateOperator("root", "pw")
+		must(t, err)
+		if op.Role != RoleAdmin || op.Restricted() {
+			t.Fatalf("ValidateOperator: %+v", op)
+		}
+		if _, err := s.ValidateOperator("root", "wrong"); err == nil {
+			t.Fatal("ValidateOperator accepted a wrong key")
+		}
+		if _, err := s.ValidateOperator("missing", "pw"); err == nil {
+			t.Fatal("ValidateOperator accepted a missing operator")
+		}
+		if op, _ = s.GetOperator("root"); op.LastSeenAt == "" {
+			t.Fatalf("last_seen_at not updated: %+v", op)
+		}
+		if op, err := s.GetOperator("missing"); err != nil || op != nil {
+			t.Fatalf("GetOperator(missing) = %v, %v", op, err)
+		}
+
+		op, _ = s.GetOperator("vend")
+		if len(op.Groups) != 2 || !op.Restricted() || !op.InScope("lab") || op.InScope("prod") {
+			t.Fatalf("operator groups: %+v", op)
+		}
+		must(t, s.SetOperatorGroups("vend", nil))
+		must(t, s.SetOperatorRole("vend", RoleViewer))
+		if err := s.SetOperatorRole("vend", "root"); err == nil {
+			t.Fatal("invalid role accepted")
+		}
+		mustNotFound(t, s.SetOperatorRole("missing", RoleViewer))
+		if op, _ = s.GetOperator("vend"); op.Role != RoleViewer || len(op.Groups) != 0 {
+			t.Fatalf("operator after updates: %+v", op)
+		}
+		must(t, s.SetOperatorKey("vend", "new"))
+		if _, err := s.ValidateOperator("vend", "new"); err != nil {
+			t.Fatalf("ValidateOperator after SetOperatorKey: %v", err)
+		}
+		mustNotFound(t, s.SetOperatorKey("missing", "k"))
+
+		list, err := s.ListOperators()
+		must(t, err)
+		if len(list) != 2 || list[0].OperatorID != "root" {
+			t.Fatalf("ListOperators: %+v", list)
+		}
+
+		token, err := s.CreateAPIToken("root", "ci", []string{ScopeRead, ScopeControl})
+		must(t, err)
+		_, err = s.CreateAPIToken("missing", "ci", []string{ScopeRead})
+		mustNotFound(t, err)
+		tok, err := s.ValidateAPIToken(token)
+		must(t, err)
+		if tok.Name != "ci" || tok.Operator.OperatorID != "root" || tok.Operator.Role != RoleAdmin || !tok.Allows(ScopeControl) || tok.Allows(ScopeWrite) {
+			t.Fatalf("ValidateAPIToken: %+v", tok)
+		}
+		_, err = s.ValidateAPIToken("wrong")
+		mustNotFound(t, err)
+		tokens, err := s.ListAPITokens()
+		must(t, err)
+		if len(tokens) != 1 || tokens[0].LastUsedAt == "" || len(tokens[0].Scopes) != 2 {
+			t.Fatalf("ListAPITokens: %+v", tokens)
+		}
+
+		// Operador bloqueado: chave e tokens param de valer
+		must(t, s.SetOperatorStatus("root", "blocked"))
+		if err := s.SetOperatorStatus("root", "gone"); err == nil {
+			t.Fatal("invalid status accepted")
+		}
+		if _, err := s.ValidateOperator("root", "pw"); err == nil {
+			t.Fatal("blocked operator validated")
+		}
+		if _, err := s.ValidateAPIToken(token); err == nil {
+			t.Fatal("token of a blocked operator validated")
+		}
+		if ok, _ := s.HasAdmins(); ok {
+			t.Fatal("HasAdmins counts blocked admins")
+		}
+		must(t, s.SetOperatorStatus("root", "active"))
+
+		must(t, s.DeleteAPIToken(tokens[0].ID))
+		mustNotFound(t, s.DeleteAPIToken(tokens[0].ID))
+
+		_, err = s.CreateAPIToken("vend", "dash", []string{ScopeRead})
+		must(t, err)
+		must(t, s.DeleteOperator("vend"))
+		mustNotFound(t, s.DeleteOperator("vend"))
+		if tokens, _ = s.ListAPITokens(); len(tokens) != 0 {
+			t.Fatalf("tokens left after DeleteOperator: %+v", tokens)
+		}
+	})
+}
+
+func TestAudit(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		must(t, s.Audit("root", "c1", "port 1 added"))
+		must(t, s.Audit("root", "", "pool added"))
+		must(t, s.Audit("alice", "c1", "port 1 removed"))
+
+		all, err := s.ListAudit("", 10)
+		must(t, err)
+		if len(all) != 3 || all[0].Action != "port 1 removed" || all[1].ClientID != "" || all[0].CreatedAt == "" {
+			t.Fatalf("ListAudit: %+v", all)
+		}
+		if list, _ := s.ListAudit("c1", 10); len(list) != 2 {
+			t.Fatalf("ListAudit(c1): %+v", list)
+		}
+		if list, _ := s.ListAudit("", 1); len(list) != 1 || list[0].OperatorID != "alice" {
+			t.Fatalf("ListAudit limit: %+v", list)
+		}
+	})
+}
+
+// revisionActors conta as linhas de revision_actor visíveis fora de transações
+func revisionActors(t *testing.T, s Store) int {
+	t.Helper()
+	var n int
+	must(t, s.(*Repository).queryRow("SELECT COUNT(*) FROM revision_actor").Scan(&n))
+	return n
+}
+
+func TestRevisions(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		alice := s.As("alice")
+		must(t, alice.CreateClient(Client{ClientID: "c1", ClientName: "one"}, "k"))
+		port, err := alice.AddPort(PortMapping{ClientID: "c1", ExposedPort: 2222, TargetPort: 22, Enabled: true})
+		must(t, err)
+
+		revisions, err := s.ListRevisions("c1", 0, 0)
+		must(t, err)
+		if len(revisions) != 2 {
+			t.Fatalf("ListRevisions: %+v", revisions)
+		}
+		insert := revisions[0]
+		if insert.Table != "client_ports" || insert.Op != RevisionInsert || insert.Operator != "alice" || insert.Key != fmt.Sprint(port) || insert.Before != nil {
+			t.Fatalf("port insert revision: %+v", insert)
+		}
+		for _, c := range revisionColumns["client_ports"] {
+			if _, ok := insert.After[c]; !ok {
+				t.Errorf("revision has no column %s", c)
+			}
+		}
+		if revisions[1].Table != "clients" || revisions[1].Operator != "alice" {
+			t.Fatalf("client insert revision: %+v", revisions[1])
+		}
+		if revisionActors(t, s) != 0 {
+			t.Fatal("revision_actor row left after a write")
+		}
+
+		// Sem autor, a revisão fica sem operador mesmo com Audit logo depois
+		// (a atribuição não pode alcançar mudanças de outra transação)
+		must(t, s.SetClientStatus("c1", "blocked"))
+		must(t, alice.Audit("alice", "c1", "unrelated change"))
+		revisions, _ = s.ListRevisions("c1", 0, 1)
+		if revisions[0].Op != RevisionUpdate || revisions[0].Operator != "" {
+			t.Fatalf("unattributed revision: %+v", revisions[0])
+		}
+		if revisions[0].Summary() != "client c1 updated (status: active -> blocked)" {
+			t.Fatalf("Summary: %q", revisions[0].Summary())
+		}
+		last := revisions[0].ID
+
+		// Updates sem mudança e colunas fora da configuração não geram revisão
+		must(t, s.SetClientStatus("c1", "blocked"))
+		must(t, s.UpdateLastSeen("c1"))
+		if revisions, _ = s.ListRevisions("c1", last, 0); len(revisions) != 0 {
+			t.Fatalf("revisions without a configuration change: %+v", revisions)
+		}
+
+		// Tx com autor, e outro autor aninhado só para a própria mudança
+		must(t, s.As("bob").Tx(func(tx Store) error {
+			if err := tx.SetPortEnabled(port, false); err != nil {
+				return err
+			}
+			if err := tx.As("carol").SetClientStatus("c1", "active"); err != nil {
+				return err
+			}
+			if err := tx.SetPortOption(port, "accept-proxy", "on"); err != nil {
+				return err
+			}
+			return tx.Audit("bob", "c1", "port 2222 changed")
+		}))
+		revisions, _ = s.ListRevisions("c1", last, 0)
+		want := []string{"bob", "carol", "bob"}
+		if len(revisions) != len(want) {
+			t.Fatalf("revisions in Tx: %+v", revisions)
+		}
+		for i, rev := range revisions {
+			if rev.Operator != want[i] {
+				t.Errorf("revision %d by %q, want %q", rev.ID, rev.Operator, want[i])
+			}
+		}
+		if revisionActors(t, s) != 0 {
+			t.Fatal("revision_actor row left after Tx")
+		}
+
+		// Tx desfeita não grava revisão nem autor
+		failed := errors.New("rollback")
+		err = s.As("dave").Tx(func(tx Store) error {
+			if err := tx.SetPortEnabled(port, true); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Fatalf("Tx returned %v", err)
+		}
+		if revisions, _ = s.ListRevisions("", revisions[0].ID, 0); len(revisions) != 0 {
+			t.Fatalf("revisions of a rolled back Tx: %+v", revisions)
+		}
+	})
+}
+
+// Uma conexão sem autor gravando durante a transação de outra com autor não
+// herda o autor dela. Só no PostgreSQL: no SQLite a transação trava as escritas.
+func TestRevisionsConcurrentWriter(t *testing.T) {
+	dsn := postgresDSN(t)
+	s := openStore(t, dsn)
+	_, err := s.Migrate()
+	must(t, err)
+	other := openStore(t, dsn)
+	addClient(t, s, "c1", "")
+	addClient(t, s, "c2", "")
+
+	must(t, s.As("erin").Tx(func(tx Store) error {
+		if err := tx.SetClientGroup("c1", "lis"); err != nil {
+			return err
+		}
+		return other.SetClientGroup("c2", "lis")
+	}))
+
+	revisions, err := s.ListRevisions("", 0, 2)
+	must(t, err)
+	for _, rev := range revisions {
+		want := ""
+		if rev.Key == "c1" {
+			want = "erin"
+		}
+		if rev.Operator != want {
+			t.Errorf("%s by %q, want %q", rev.Summary(), rev.Operator, want)
+		}
+	}
+}
+
+func TestUndoRevision(t *testing.T) {
+	stores(t, func(t *testing.T, s Store) {
+		addClient(t, s, "c1", "")
+		port := addPort(t, s, PortMapping{ClientID: "c1", ExposedPort: 2222, TargetPort: 22, Schedule: "mon-fri 08:00-18:00"})
+		must(t, s.SetPortOption(port, "proxy-protocol", "v1"))
+		must(t, s.SetPortHealth("c1", port, HealthUp, ""))
+
+		latest := func() Revision {
+			t.Helper()
+			revisions, err := s.ListRevisions("", 0, 1)
+			must(t, err)
+			return revisions[0]
+		}
+
+		// Update desfeito volta à linha anterior
+		must(t, s.UndoRevision(latest()))
+		if p, _ := s.GetPort(port); p.ProxyProto != "" || p.Schedule != "mon-fri 08:00-18:00" {
+			t.Fatalf("port after undoing the update: %+v", p)
+		}
+
+		// Delete desfeito recria a linha com o mesmo ID e valores
+		before, _ := s.GetPort(port)
+		must(t, s.DeletePort(port))
+		must(t, s.UndoRevision(latest()))
+		after, err := s.GetPort(port)
+		must(t, err)
+		if after == nil || *after != *before {
+			t.Fatalf("port after undoing the delete: %+v, want %+v", after, before)
+		}
+
+		// Cliente removido volta antes das portas (ordem inversa das revisões)
+		must(t, s.DeleteClient("c1"))
+		revisions, _ := s.ListRevisions("c1", 0, 2)
+		must(t, s.Tx(func(tx Store) error {
+			for _, rev := range []Revision{revisions[0], revisions[1]} {
+				if err := tx.UndoRevision(rev); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+		if c, _ := s.GetClient("c1"); c == nil || c.PortCount != 1 {
+			t.Fatalf("client after undoing the delete: %+v", c)
+		}
+		if _, err := s.ValidateClient("c1", "key-c1"); err != nil {
+			t.Fatalf("restored client lost its key: %v", err)
+		}
+
+		// Insert desfeito remove a linha e o estado dela
+		must(t, s.UndoRevision(Revision{ID: -1, Table: "client_ports", Key: fmt.Sprint(port), Op: RevisionInsert, After: map[string]interface{}{"exposed_port": 2222}}))
+		if p, _ := s.GetPort(port); p != nil {
+			t.Fatalf("port after undoing the insert: %+v", p)
+		}
+		if err := s.UndoRevision(Revision{Table: "operators", Op: RevisionInsert}); err == nil {
+			t.Fatal("UndoRevision on an unknown table")
+		}
+		if err := s.UndoRevision(Revision{Table: "clients", Op: "merge"}); err == nil {
+			t.Fatal("UndoRevision with an unknown operation")
+		}
+	})
+}
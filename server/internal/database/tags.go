@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Campos do cliente usados pelos seletores junto com as tags; não podem ser
+// chaves de tag
+var reservedTags = []string{"id", "name", "group", "status"}
+
+// ValidateTag recusa chaves reservadas e caracteres usados pelo formato
+// "chave=valor,chave" e pelos seletores
+func ValidateTag(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("empty tag key")
+	}
+	if slices.Contains(reservedTags, key) {
+		return fmt.Errorf("tag key %q is reserved (use client-set-group or the client fields)", key)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("._-/", c)) {
+			return fmt.Errorf("invalid tag key %q (letters, digits, . _ - /)", key)
+		}
+	}
+	if strings.ContainsAny(value, ",=!*?[] \t") {
+		return fmt.Errorf("invalid tag value %q for %s (no spaces, commas or ,=!*?[])", value, key)
+	}
+	return nil
+}
+
+// FormatTags grava as tags como "chave=valor,chave" em ordem de chave
+// (tags sem valor saem só com a chave)
+func FormatTags(tags map[string]string) string {
+	parts := make([]string, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if tags[key] == "" {
+			parts = append(parts, key)
+		} else {
+			parts = append(parts, key+"="+tags[key])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseTags lê o formato de FormatTags, validando cada tag
+func ParseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		if err := ValidateTag(key, value); err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// Labels são as tags do cliente com id, name, group (se definido) e status,
+// comparados pelos seletores
+func (c Client) Labels() map[string]string {
+	labels := maps.Clone(c.Tags)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels["id"] = c.ClientID
+	labels["name"] = c.ClientName
+	labels["status"] = c.Status
+	if c.Group != "" {
+		labels["group"] = c.Group
+	}
+	return labels
+}
+
+// SetClientTags substitui as tags do cliente (vazio remove todas)
+func (r *Repository) SetClientTags(clientID string, tags map[string]string) error {
+	for key, value := range tags {
+		if err := ValidateTag(key, value); err != nil {
+			return err
+		}
+	}
+	var value interface{}
+	if len(tags) > 0 {
+		value = FormatTags(tags)
+	}
+	return r.updateClient(clientID, "UPDATE clients SET tags = ? WHERE client_id = ?", value)
+}
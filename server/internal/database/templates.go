@@ -0,0 +1,463 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Modelos de porta: cada cliente recebe um mapeamento por destino dos modelos
+// ligados a ele ou ao seu grupo. SyncTemplates cria os que faltam (porta pela
+// regra de alocação do modelo) e remove os que deixaram de valer; portas já
+// alocadas são mantidas quando a regra muda.
+
+// Regras de alocação de porta dos modelos
+const (
+	AllocationPool = "pool" // pools do grupo do cliente, como "port-add auto"
+)
+
+// Alvos de ligação de um modelo
+const (
+	AttachClient = "client"
+	AttachGroup  = "group"
+)
+
+// PortTemplate é um modelo de porta com seus destinos e ligações
+type PortTemplate struct {
+	Name        string
+	Allocation  string // AllocationPool ou faixa "20000-20999"
+	CreatedAt   string
+	Ports       []TemplatePort
+	Attachments []TemplateAttachment
+	Mapped      int // mapeamentos gerados
+}
+
+// TemplatePort é um destino do modelo
+type TemplatePort struct {
+	ID         int
+	TargetHost string // host ou unix:///caminho
+	TargetPort int    // 0 para unix://
+}
+
+// Target monta o destino como host:porta ou unix:///caminho
+func (p TemplatePort) Target() string {
+	return PortMapping{TargetHost: p.TargetHost, TargetPort: p.TargetPort}.Target()
+}
+
+// TemplateAttachment liga o modelo a um cliente ou a um grupo
+type TemplateAttachment struct {
+	Kind string // AttachClient ou AttachGroup
+	Name string // client_id ou grupo
+}
+
+// TemplateSync é um mapeamento criado ou removido por SyncTemplates
+type TemplateSync struct {
+	Template    string // vazio se o destino ou o modelo foi removido
+	ClientID    string
+	ExposedPort int
+	Target      string
+	Removed     bool
+}
+
+func (s TemplateSync) String() string {
+	verb := "added"
+	if s.Removed {
+		verb = "removed"
+	}
+	template := "template " + s.Template
+	if s.Template == "" {
+		template = "target no longer in a template"
+	}
+	return fmt.Sprintf("%s: port %d -> %s %s (%s)", s.ClientID, s.ExposedPort, s.Target, verb, template)
+}
+
+// AuditAction descreve no audit log do cliente o mapeamento criado ou removido
+func (s TemplateSync) AuditAction() string {
+	if s.Removed {
+		return fmt.Sprintf("port %d -> %s removed by template", s.ExposedPort, s.Target)
+	}
+	return fmt.Sprintf("port %d -> %s added by template %s", s.ExposedPort, s.Target, s.Template)
+}
+
+// ParseAllocation valida a regra de alocação: "pool" ou faixa "inicio-fim"
+func ParseAllocation(rule string) (start, end int, err error) {
+	if rule == AllocationPool {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(rule, "-")
+	start, err1 := strconv.Atoi(strings.TrimSpace(from))
+	end, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid allocation %q (use pool or a range like 22000-22999)", rule)
+	}
+	return start, end, nil
+}
+
+// ListTemplates lista os modelos com destinos, ligações e mapeamentos gerados
+func (r *Repository) ListTemplates() ([]PortTemplate, error) {
+	rows, err := r.query(`
+		SELECT name, allocation, created_at,
+		       (SELECT COUNT(*) FROM client_ports p JOIN template_ports tp ON tp.id = p.template_port_id
+		        WHERE tp.template_name = port_templates.name)
+		FROM port_templates ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	var templates []PortTemplate
+	for rows.Next() {
+		var t PortTemplate
+		if err := rows.Scan(&t.Name, &t.Allocation, &t.CreatedAt, &t.Mapped); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range templates {
+		if err := r.loadTemplate(&templates[i]); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// GetTemplate busca um modelo pelo nome (nil se não existir)
+func (r *Repository) GetTemplate(name string) (*PortTemplate, error) {
+	t := PortTemplate{Name: name}
+	err := r.queryRow(`
+		SELECT allocation, created_at,
+		       (SELECT COUNT(*) FROM client_ports p JOIN template_ports tp ON tp.id = p.template_port_id
+		        WHERE tp.template_name = port_templates.name)
+		FROM port_templates WHERE name = ?
+	`, name).Scan(&t.Allocation, &t.CreatedAt, &t.Mapped)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	if err := r.loadTemplate(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// loadTemplate lê destinos e ligações do modelo
+func (r *Repository) loadTemplate(t *PortTemplate) error {
+	rows, err := r.query("SELECT id, target_host, target_port FROM template_ports WHERE template_name = ? ORDER BY id", t.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list template ports: %w", err)
+	}
+	for rows.Next() {
+		var p TemplatePort
+		if err := rows.Scan(&p.ID, &p.TargetHost, &p.TargetPort); err != nil {
+			rows.Close()
+			return err
+		}
+		t.Ports = append(t.Ports, p)
+	}
+	rows.Close()
+
+	rows, err = r.query("SELECT kind, name FROM template_attachments WHERE template_name = ? ORDER BY kind DESC, name", t.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list template attachments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a TemplateAttachment
+		if err := rows.Scan(&a.Kind, &a.Name); err != nil {
+			return err
+		}
+		t.Attachments = append(t.Attachments, a)
+	}
+	return rows.Err()
+}
+
+// CreateTemplate cria o modelo vazio (sem destinos nem ligações)
+func (r *Repository) CreateTemplate(name, allocation string) error {
+	if name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	if _, _, err := ParseAllocation(allocation); err != nil {
+		return err
+	}
+	if _, err := r.exec("INSERT INTO port_templates (name, allocation) VALUES (?, ?)", name, allocation); err != nil {
+		return fmt.Errorf("failed to add template: %w", err)
+	}
+	return nil
+}
+
+// DeleteTemplate remove o modelo; SyncTemplates remove os mapeamentos gerados
+func (r *Repository) DeleteTemplate(name string) error {
+	return r.inTx(func(tx *Repository) error {
+		for _, query := range []string{
+			"DELETE FROM template_attachments WHERE template_name = ?",
+			"DELETE FROM template_ports WHERE template_name = ?",
+		} {
+			if _, err := tx.exec(query, name); err != nil {
+				return fmt.Errorf("failed to remove template: %w", err)
+			}
+		}
+		return tx.affect("template", name, "DELETE FROM port_templates WHERE name = ?", name)
+	})
+}
+
+// SetTemplateAllocation troca a regra de alocação (vale para novos mapeamentos)
+func (r *Repository) SetTemplateAllocation(name, allocation string) error {
+	if _, _, err := ParseAllocation(allocation); err != nil {
+		return err
+	}
+	return r.affect("template", name, "UPDATE port_templates SET allocation = ? WHERE name = ?", allocation, name)
+}
+
+// AddTemplatePort acrescenta um destino ao modelo
+func (r *Repository) AddTemplatePort(name string, p TemplatePort) error {
+	if t, err := r.GetTemplate(name); err != nil {
+		return err
+	} else if t == nil {
+		return fmt.Errorf("template %s %w", name, ErrNotFound)
+	}
+	if _, err := r.exec("INSERT INTO template_ports (template_name, target_host, target_port) VALUES (?, ?, ?)",
+		name, p.TargetHost, p.TargetPort); err != nil {
+		return fmt.Errorf("failed to add %s to template %s: %w", p.Target(), name, err)
+	}
+	return nil
+}
+
+// RemoveTemplatePort retira um destino do modelo
+func (r *Repository) RemoveTemplatePort(name string, p TemplatePort) error {
+	return r.affect("template "+name+" target", p.Target(),
+		"DELETE FROM template_ports WHERE template_name = ? AND target_host = ? AND target_port = ?",
+		name, p.TargetHost, p.TargetPort)
+}
+
+// AttachTemplate liga o modelo a um cliente ou grupo
+func (r *Repository) AttachTemplate(name string, a TemplateAttachment) error {
+	if a.Kind != AttachClient && a.Kind != AttachGroup {
+		return fmt.Errorf("invalid attachment %q (use client or group)", a.Kind)
+	}
+	if t, err := r.GetTemplate(name); err != nil {
+		return err
+	} else if t == nil {
+		return fmt.Errorf("template %s %w", name, ErrNotFound)
+	}
+	if a.Kind == AttachClient {
+		if c, err := r.GetClient(a.Name); err != nil {
+			return err
+		} else if c == nil {
+			return fmt.Errorf("client %s %w", a.Name, ErrNotFound)
+		}
+	}
+	_, err := r.exec(`
+		INSERT INTO template_attachments (template_name, kind, name) VALUES (?, ?, ?)
+		ON CONFLICT (template_name, kind, name) DO NOTHING
+	`, name, a.Kind, a.Name)
+	if err != nil {
+		return fmt.Errorf("failed to attach template: %w", err)
+	}
+	return nil
+}
+
+// DetachTemplate desfaz a ligação do modelo com o cliente ou grupo
+func (r *Repository) DetachTemplate(name string, a TemplateAttachment) error {
+	return r.affect("template "+name+" "+a.Kind, a.Name,
+		"DELETE FROM template_attachments WHERE template_name = ? AND kind = ? AND name = ?", name, a.Kind, a.Name)
+}
+
+// templateTarget é um destino de modelo que um cliente deve ter mapeado
+type templateTarget struct {
+	clientID   string
+	template   string
+	allocation string
+	port       TemplatePort
+}
+
+// SyncTemplates materializa os modelos do cliente (vazio = todos os
+// clientes): cria os mapeamentos que faltam e remove os gerados por destinos,
+// modelos ou ligações que não valem mais. Retorna o que mudou.
+func (r *Repository) SyncTemplates(clientID string) ([]TemplateSync, error) {
+	var changes []TemplateSync
+	err := r.inTx(func(tx *Repository) error {
+		var err error
+		changes, err = syncTemplates(tx, clientID)
+		return err
+	})
+	return changes, err
+}
+
+func syncTemplates(tx *Repository, clientID string) ([]TemplateSync, error) {
+	var wantFilter, haveFilter string
+	var args []interface{}
+	if clientID != "" {
+		wantFilter, haveFilter = " WHERE c.client_id = ?", " AND client_id = ?"
+		args = append(args, clientID)
+	}
+
+	rows, err := tx.query(`
+		SELECT DISTINCT c.client_id, t.name, t.allocation, tp.id, tp.target_host, tp.target_port
+		FROM clients c
+		JOIN template_attachments a ON (a.kind = 'client' AND a.name = c.client_id)
+		                            OR (a.kind = 'group' AND a.name = c.group_name)
+		JOIN port_templates t ON t.name = a.template_name
+		JOIN template_ports tp ON tp.template_name = t.name`+wantFilter+`
+		ORDER BY c.client_id, tp.id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+	var want []templateTarget
+	for rows.Next() {
+		var t templateTarget
+		if err := rows.Scan(&t.clientID, &t.template, &t.allocation, &t.port.ID, &t.port.TargetHost, &t.port.TargetPort); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		want = append(want, t)
+	}
+	rows.Close()
+
+	// Mapeamentos gerados existentes, por cliente e destino do modelo
+	type key struct {
+		clientID string
+		portID   int
+	}
+	rows, err = tx.query(`
+		SELECT id, client_id, template_port_id, exposed_port, target_host, COALESCE(target_port, 0),
+		       COALESCE((SELECT template_name FROM template_ports WHERE template_ports.id = client_ports.template_port_id), '')
+		FROM client_ports WHERE template_port_id IS NOT NULL`+haveFilter+`
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template ports: %w", err)
+	}
+	type mapped struct {
+		id     int
+		sync   TemplateSync
+		portID int
+	}
+	var existing []mapped
+	have := make(map[key]bool)
+	for rows.Next() {
+		var m mapped
+		var host string
+		var port int
+		if err := rows.Scan(&m.id, &m.sync.ClientID, &m.portID, &m.sync.ExposedPort, &host, &port, &m.sync.Template); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.sync.Target = PortMapping{TargetHost: host, TargetPort: port}.Target()
+		existing = append(existing, m)
+	}
+	rows.Close()
+
+	wanted := make(map[key]bool)
+	for _, t := range want {
+		wanted[key{t.clientID, t.port.ID}] = true
+	}
+
+	var changes []TemplateSync
+	for _, m := range existing {
+		k := key{m.sync.ClientID, m.portID}
+		if wanted[k] && !have[k] {
+			have[k] = true
+			continue
+		}
+		// Destino, modelo ou ligação removidos (ou mapeamento duplicado)
+		if err := deletePort(tx, m.id); err != nil {
+			return nil, err
+		}
+		m.sync.Removed = true
+		changes = append(changes, m.sync)
+	}
+
+	for _, t := range want {
+		if have[key{t.clientID, t.port.ID}] {
+			continue
+		}
+		port, err := tx.allocateTemplatePort(t)
+		if err != nil {
+			return nil, fmt.Errorf("template %s, client %s: %w", t.template, t.clientID, err)
+		}
+		p := PortMapping{
+			ClientID:     t.clientID,
+			ExposedPort:  port,
+			TargetHost:   t.port.TargetHost,
+			TargetPort:   t.port.TargetPort,
+			Enabled:      true,
+			TemplatePort: t.port.ID,
+		}
+		if _, err := tx.AddPort(p); err != nil {
+			return nil, fmt.Errorf("template %s, client %s: %w", t.template, t.clientID, err)
+		}
+		changes = append(changes, TemplateSync{Template: t.template, ClientID: t.clientID, ExposedPort: port, Target: t.port.Target()})
+	}
+	return changes, nil
+}
+
+// allocateTemplatePort escolhe a porta pela regra do modelo
+func (r *Repository) allocateTemplatePort(t templateTarget) (int, error) {
+	start, end, err := ParseAllocation(t.allocation)
+	if err != nil {
+		return 0, err
+	}
+	if t.allocation == AllocationPool {
+		return r.AllocatePort(t.clientID)
+	}
+	port, err := r.freePort([][2]int{{start, end}})
+	if err != nil {
+		return 0, err
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("no free port left in %s", t.allocation)
+	}
+	return port, nil
+}
+
+// freePort retorna a primeira porta das faixas sem mapeamento em client_ports
+// (0 se não houver). No servidor (Init) a porta também precisa aceitar bind;
+// o Store de Open (voidprobe-cli com -db) pode estar em outra máquina e só
+// consulta o banco: uma porta ocupada por outro processo aparece como
+// bind_error no estado do mapeamento.
+func (r *Repository) freePort(ranges [][2]int) (int, error) {
+	used := make(map[int]bool)
+	rows, err := r.query("SELECT exposed_port FROM client_ports")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list ports: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var port int
+		if err := rows.Scan(&port); err != nil {
+			return 0, fmt.Errorf("failed to scan port: %w", err)
+		}
+		used[port] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, pr := range ranges {
+		for port := pr[0]; port <= pr[1]; port++ {
+			if used[port] {
+				continue
+			}
+			if r.bindCheck {
+				// Porta ocupada por outro processo (ou pelo próprio servidor)
+				listener, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(port))
+				if err != nil {
+					continue
+				}
+				listener.Close()
+			}
+			return port, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,667 @@
+// Package declarative implementa a configuração declarativa (voidprobe.yaml)
+// de "voidprobe-cli plan", "apply" e "export": clientes (sem chaves), pools
+// por grupo e mapeamentos de porta. Depois do apply o banco reflete
+// exatamente o arquivo: o que não estiver nele é removido.
+package declarative
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/schedule"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile é o formato do arquivo
+type configFile struct {
+	Pools   []string               `yaml:"pools,omitempty"` // pools padrão, ex: 20000-20999
+	Groups  map[string]configGroup `yaml:"groups,omitempty"`
+	Clients []configClient         `yaml:"clients"`
+}
+
+type configGroup struct {
+	Pools []string `yaml:"pools,omitempty"` // pools exclusivos do grupo
+}
+
+type configClient struct {
+	ID     string            `yaml:"id"`
+	Name   string            `yaml:"name,omitempty"`   // padrão: o ID
+	Group  string            `yaml:"group,omitempty"`  // grupo do cliente (pools de portas)
+	Tags   map[string]string `yaml:"tags,omitempty"`   // tags livres, ex: env: prod
+	Status string            `yaml:"status,omitempty"` // active (padrão) ou blocked
+	Ports  []configPort      `yaml:"ports,omitempty"`
+}
+
+type configPort struct {
+	Port            int    `yaml:"port"`                     // porta no servidor
+	Target          string `yaml:"target,omitempty"`         // porta, host:porta ou unix:///caminho
+	Socks5          string `yaml:"socks5,omitempty"`         // usuário SOCKS5 (em vez de target)
+	ProxyProtocol   string `yaml:"proxy_protocol,omitempty"` // v1 ou v2
+	AcceptProxy     bool   `yaml:"accept_proxy,omitempty"`
+	HealthCheck     string `yaml:"health_check,omitempty"` // off|tcp|tls|http[:/caminho], padrão tcp
+	RefuseUnhealthy bool   `yaml:"refuse_unhealthy,omitempty"`
+	Schedule        string `yaml:"schedule,omitempty"`
+	Expires         string `yaml:"expires,omitempty"` // UTC "2006-01-02 15:04:05"
+	Disabled        bool   `yaml:"disabled,omitempty"`
+}
+
+// stateClient são os campos declarados de um cliente
+type stateClient struct {
+	Name   string
+	Group  string
+	Tags   string // no formato de database.FormatTags
+	Status string
+}
+
+// client converte para o formato do banco (tags já validadas em Load)
+func (c stateClient) client(id string) database.Client {
+	tags, _ := database.ParseTags(c.Tags)
+	return database.Client{ClientID: id, ClientName: c.Name, Status: c.Status, Group: c.Group, Tags: tags}
+}
+
+// poolRange identifica um pool pelo grupo ("" = padrão) e faixa
+type poolRange struct {
+	Group      string
+	Start, End int
+}
+
+// State é o conjunto gerenciado pelo arquivo, lido do YAML (Load) ou do banco (Current)
+type State struct {
+	clients map[string]stateClient
+	ports   map[int]database.PortMapping // por porta exposta
+	pools   map[poolRange]int            // ID no banco (0 no arquivo)
+}
+
+func newState() *State {
+	return &State{
+		clients: make(map[string]stateClient),
+		ports:   make(map[int]database.PortMapping),
+		pools:   make(map[poolRange]int),
+	}
+}
+
+// Load lê e valida o arquivo declarativo (name identifica o arquivo nos erros)
+func Load(name string, data []byte) (*State, error) {
+	var cfg configFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	want := newState()
+	addPools := func(group string, ranges []string) error {
+		for _, r := range ranges {
+			start, end, err := ParseRange(r)
+			if err != nil {
+				return err
+			}
+			want.pools[poolRange{Group: group, Start: start, End: end}] = 0
+		}
+		return nil
+	}
+	if err := addPools("", cfg.Pools); err != nil {
+		return nil, fmt.Errorf("%s: pools: %w", name, err)
+	}
+	for group, g := range cfg.Groups {
+		if err := addPools(group, g.Pools); err != nil {
+			return nil, fmt.Errorf("%s: group %s: %w", name, group, err)
+		}
+	}
+
+	for _, c := range cfg.Clients {
+		if c.ID == "" {
+			return nil, fmt.Errorf("%s: client without id", name)
+		}
+		if _, dup := want.clients[c.ID]; dup {
+			return nil, fmt.Errorf("%s: client %s declared twice", name, c.ID)
+		}
+
+		sc := stateClient{Name: c.Name, Group: c.Group, Tags: database.FormatTags(c.Tags), Status: c.Status}
+		if sc.Name == "" {
+			sc.Name = c.ID
+		}
+		if sc.Status == "" {
+			sc.Status = "active"
+		}
+		if sc.Status != "active" && sc.Status != "blocked" {
+			return nil, fmt.Errorf("%s: client %s: invalid status %q (use active or blocked)", name, c.ID, sc.Status)
+		}
+		for key, value := range c.Tags {
+			if err := database.ValidateTag(key, value); err != nil {
+				return nil, fmt.Errorf("%s: client %s: %w", name, c.ID, err)
+			}
+		}
+		want.clients[c.ID] = sc
+
+		for _, cp := range c.Ports {
+			p, err := cp.mapping(c.ID)
+			if err != nil {
+				return nil, fmt.Errorf("%s: client %s port %d: %w", name, c.ID, cp.Port, err)
+			}
+			if other, dup := want.ports[p.ExposedPort]; dup {
+				return nil, fmt.Errorf("%s: port %d declared for %s and %s", name, p.ExposedPort, other.ClientID, c.ID)
+			}
+			want.ports[p.ExposedPort] = p
+		}
+	}
+
+	return want, nil
+}
+
+// ParseRange converte a faixa de um pool, ex: "20000-20999"
+func ParseRange(r string) (start, end int, err error) {
+	from, to, ok := strings.Cut(r, "-")
+	start, err1 := strconv.Atoi(strings.TrimSpace(from))
+	end, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid range %q (example: 20000-20999)", r)
+	}
+	return start, end, nil
+}
+
+// mapping valida a porta declarada e converte para o formato do banco
+func (cp configPort) mapping(clientID string) (database.PortMapping, error) {
+	p := database.PortMapping{
+		ClientID:    clientID,
+		ExposedPort: cp.Port,
+		Mode:        database.ModeForward,
+		ProxyProto:  cp.ProxyProtocol,
+		AcceptProxy: cp.AcceptProxy,
+		ExpiresAt:   cp.Expires,
+		Schedule:    cp.Schedule,
+		HealthCheck: cp.HealthCheck,
+		RefuseDown:  cp.RefuseUnhealthy,
+		Enabled:     !cp.Disabled,
+	}
+
+	if p.ExposedPort < 1 || p.ExposedPort > 65535 {
+		return p, errors.New("invalid server port")
+	}
+
+	switch {
+	case cp.Socks5 != "":
+		if cp.Target != "" {
+			return p, errors.New("socks5 ports have no target")
+		}
+		p.Mode = database.ModeSocks5
+		p.TargetHost = "*"
+		p.AuthUser = cp.Socks5
+	case cp.Target == "":
+		return p, errors.New("target or socks5 is required")
+	case strings.HasPrefix(cp.Target, database.UnixPrefix):
+		if !strings.HasPrefix(strings.TrimPrefix(cp.Target, database.UnixPrefix), "/") {
+			return p, errors.New("unix target must be an absolute path (unix:///path/to.sock)")
+		}
+		p.TargetHost = cp.Target
+	default:
+		host, port := "127.0.0.1", cp.Target
+		if h, pt, err := net.SplitHostPort(cp.Target); err == nil {
+			host, port = h, pt
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return p, fmt.Errorf("invalid target %q (use port, host:port or unix:///path)", cp.Target)
+		}
+		p.TargetHost, p.TargetPort = host, n
+	}
+
+	if p.HealthCheck == "" {
+		p.HealthCheck = "tcp"
+	}
+	if hc := p.HealthCheck; hc != "off" && hc != "tcp" && hc != "tls" && hc != "http" && !strings.HasPrefix(hc, "http:/") {
+		return p, fmt.Errorf("invalid health_check %q (use off, tcp, tls, http or http:/path)", hc)
+	}
+	switch p.ProxyProto {
+	case "", "v1", "v2":
+	default:
+		return p, fmt.Errorf("invalid proxy_protocol %q (use v1 or v2)", p.ProxyProto)
+	}
+	if p.ProxyProto != "" && p.Mode == database.ModeSocks5 {
+		return p, errors.New("proxy_protocol requires a fixed target")
+	}
+	if p.Schedule != "" {
+		if _, err := schedule.Parse(p.Schedule); err != nil {
+			return p, fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	if p.ExpiresAt != "" {
+		if _, err := time.ParseInLocation(database.TimeLayout, p.ExpiresAt, time.UTC); err != nil {
+			return p, fmt.Errorf("invalid expires %q (UTC, format %s)", p.ExpiresAt, database.TimeLayout)
+		}
+	}
+	return p, nil
+}
+
+// Current lê do banco o conjunto gerenciado pelo arquivo
+func Current(repo database.Store) (*State, error) {
+	cur := newState()
+
+	clients, err := repo.ListClients()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clients {
+		cur.clients[c.ClientID] = stateClient{Name: c.ClientName, Group: c.Group, Tags: database.FormatTags(c.Tags), Status: c.Status}
+	}
+
+	ports, err := repo.ListPorts("")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ports {
+		// Portas de modelos seguem o grupo do cliente, fora do arquivo
+		if p.Template == "" {
+			cur.ports[p.ExposedPort] = p.PortMapping
+		}
+	}
+
+	pools, err := repo.ListPools()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pools {
+		cur.pools[poolRange{Group: p.Group, Start: p.Start, End: p.End}] = p.ID
+	}
+	return cur, nil
+}
+
+// ============= Plan =============
+
+// applier executa as mudanças na transação e guarda chaves e senhas geradas
+type applier struct {
+	tx      database.Store
+	secrets []string
+}
+
+// Change é uma linha do plano
+type Change struct {
+	Op       string   // "+" cria, "~" altera, "-" remove
+	Subject  string   // ex: "client srv-prod", "port 2222 (srv-prod)"
+	Details  []string // campos alterados ou resumo do que é criado
+	ClientID string   // cliente afetado ("" = global)
+	exec     func(a *applier) error
+}
+
+func (c Change) String() string {
+	s := c.Op + " " + c.Subject
+	for _, d := range c.Details {
+		s += "\n      " + d
+	}
+	return s
+}
+
+// auditAction descreve a mudança no audit log
+func (c Change) auditAction() string {
+	verb := map[string]string{"+": "created", "~": "updated", "-": "removed"}[c.Op]
+	action := c.Subject + " " + verb + " by apply"
+	if len(c.Details) > 0 {
+		action += " (" + strings.Join(c.Details, "; ") + ")"
+	}
+	return action
+}
+
+// field é um campo exibido no plano
+type field struct{ name, value string }
+
+func clientFields(c stateClient) []field {
+	return []field{{"name", c.Name}, {"group", orNone(c.Group)}, {"tags", orNone(c.Tags)}, {"status", c.Status}}
+}
+
+func portFields(p database.PortMapping) []field {
+	return []field{
+		{"target", describeTarget(p)},
+		{"proxy_protocol", orNone(p.ProxyProto)},
+		{"accept_proxy", onOff(p.AcceptProxy)},
+		{"health_check", p.HealthCheck},
+		{"refuse_unhealthy", onOff(p.RefuseDown)},
+		{"schedule", orNone(p.Schedule)},
+		{"expires", orNone(p.ExpiresAt)},
+		{"enabled", onOff(p.Enabled)},
+	}
+}
+
+// diffFields lista "campo: antes -> depois" dos campos diferentes
+func diffFields(from, to []field) []string {
+	var out []string
+	for i := range from {
+		if from[i].value != to[i].value {
+			out = append(out, fmt.Sprintf("%s: %s -> %s", from[i].name, from[i].value, to[i].value))
+		}
+	}
+	return out
+}
+
+// newFields lista "campo: valor" dos campos que fogem do padrão (def)
+func newFields(def, to []field) []string {
+	var out []string
+	for i := range def {
+		if def[i].value != to[i].value {
+			out = append(out, fmt.Sprintf("%s: %s", to[i].name, to[i].value))
+		}
+	}
+	return out
+}
+
+func describeTarget(p database.PortMapping) string {
+	if p.Mode == database.ModeSocks5 {
+		return "socks5 (user " + p.AuthUser + ")"
+	}
+	return p.Target()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// Plan compara o banco com o arquivo, na ordem de execução: remoções antes
+// das criações, para que portas e faixas possam trocar de dono
+func Plan(cur, want *State) []Change {
+	var changes []Change
+
+	for _, port := range slices.Sorted(maps.Keys(cur.ports)) {
+		p := cur.ports[port]
+		if w, ok := want.ports[port]; ok && w.ClientID == p.ClientID {
+			continue
+		}
+		if _, kept := want.clients[p.ClientID]; !kept {
+			continue // removida junto com o cliente
+		}
+		changes = append(changes, Change{
+			Op: "-", Subject: fmt.Sprintf("port %d (%s)", port, p.ClientID), ClientID: p.ClientID,
+			exec: func(a *applier) error { return a.tx.DeletePort(p.ID) },
+		})
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(cur.clients)) {
+		if _, ok := want.clients[id]; ok {
+			continue
+		}
+		changes = append(changes, Change{
+			Op: "-", Subject: "client " + id, ClientID: id,
+			Details: []string{"with its ports, forwards, links, routes and services"},
+			exec:    func(a *applier) error { return a.tx.DeleteClient(id) },
+		})
+	}
+
+	for _, pool := range sortedPools(cur.pools) {
+		if _, ok := want.pools[pool]; ok {
+			continue
+		}
+		id := cur.pools[pool]
+		changes = append(changes, Change{
+			Op: "-", Subject: poolSubject(pool),
+			exec: func(a *applier) error { return a.tx.DeletePool(id) },
+		})
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(want.clients)) {
+		w := want.clients[id]
+		c, exists := cur.clients[id]
+		if !exists {
+			changes = append(changes, Change{
+				Op: "+", Subject: "client " + id, ClientID: id,
+				Details: newFields(clientFields(stateClient{Status: "active"}), clientFields(w)),
+				exec: func(a *applier) error {
+					key := database.GenerateKey()
+					a.secrets = append(a.secrets, fmt.Sprintf("%s: AUTH_TOKEN=%s", id, key))
+					return a.tx.CreateClient(w.client(id), key)
+				},
+			})
+			continue
+		}
+		if diff := diffFields(clientFields(c), clientFields(w)); len(diff) > 0 {
+			changes = append(changes, Change{
+				Op: "~", Subject: "client " + id, ClientID: id, Details: diff,
+				exec: func(a *applier) error {
+					return a.tx.UpdateClient(w.client(id))
+				},
+			})
+		}
+	}
+
+	for _, pool := range sortedPools(want.pools) {
+		if _, ok := cur.pools[pool]; ok {
+			continue
+		}
+		changes = append(changes, Change{
+			Op: "+", Subject: poolSubject(pool),
+			exec: func(a *applier) error { return a.tx.AddPool(pool.Group, pool.Start, pool.End) },
+		})
+	}
+
+	var creates []Change
+	for _, port := range slices.Sorted(maps.Keys(want.ports)) {
+		w := want.ports[port]
+		subject := fmt.Sprintf("port %d (%s)", port, w.ClientID)
+		p, exists := cur.ports[port]
+		if !exists || p.ClientID != w.ClientID {
+			creates = append(creates, Change{
+				Op: "+", Subject: subject, ClientID: w.ClientID,
+				Details: newFields(portFields(database.PortMapping{HealthCheck: "tcp", Enabled: true}), portFields(w)),
+				exec:    func(a *applier) error { return insertPort(a, w) },
+			})
+			continue
+		}
+		if diff := diffFields(portFields(p), portFields(w)); len(diff) > 0 {
+			w.ID = p.ID
+			toSocks := w.Mode == database.ModeSocks5 && p.Mode != database.ModeSocks5
+			changes = append(changes, Change{
+				Op: "~", Subject: subject, ClientID: w.ClientID, Details: diff,
+				exec: func(a *applier) error { return updatePort(a, w, toSocks) },
+			})
+		}
+	}
+
+	return append(changes, creates...)
+}
+
+func sortedPools(pools map[poolRange]int) []poolRange {
+	return slices.SortedFunc(maps.Keys(pools), func(a, b poolRange) int {
+		if a.Group != b.Group {
+			return strings.Compare(a.Group, b.Group)
+		}
+		return a.Start - b.Start
+	})
+}
+
+func poolSubject(p poolRange) string {
+	if p.Group == "" {
+		return fmt.Sprintf("pool %d-%d (default)", p.Start, p.End)
+	}
+	return fmt.Sprintf("pool %d-%d (group %s)", p.Start, p.End, p.Group)
+}
+
+// socksPassword gera a senha de uma porta SOCKS5 criada pelo apply
+func socksPassword(a *applier, p database.PortMapping) string {
+	password := database.GenerateKey()[:24]
+	a.secrets = append(a.secrets, fmt.Sprintf("%s port %d: SOCKS5_USER=%s SOCKS5_PASSWORD=%s", p.ClientID, p.ExposedPort, p.AuthUser, password))
+	return database.HashKey(password)
+}
+
+func insertPort(a *applier, p database.PortMapping) error {
+	if p.Mode == database.ModeSocks5 {
+		p.AuthHash = socksPassword(a, p)
+	}
+	_, err := a.tx.AddPort(p)
+	return err
+}
+
+// updatePort regrava o mapeamento; a senha SOCKS5 existente é mantida
+func updatePort(a *applier, p database.PortMapping, toSocks bool) error {
+	if toSocks {
+		p.AuthHash = socksPassword(a, p)
+	}
+	return a.tx.UpdatePort(p)
+}
+
+// Render é o texto do plano, usado para detectar mudanças no banco
+func Render(changes []Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString(c.String() + "\n")
+	}
+	return b.String()
+}
+
+// ============= Apply =============
+
+// ErrPlanChanged indica que o banco mudou entre o plano exibido e o apply
+var ErrPlanChanged = errors.New("the database changed after the plan was shown; run apply again")
+
+// Result é o que o apply criou e quem precisa recarregar
+type Result struct {
+	Synced  []database.TemplateSync // portas de modelos criadas e removidas
+	Secrets []string                // chaves de clientes novos e senhas SOCKS5
+	Reload  []string                // clientes afetados que continuam cadastrados
+}
+
+// Apply refaz o plano numa transação e aplica as mudanças se o texto for
+// igual ao exibido (shown); cada mudança vai para a auditoria com o autor
+func Apply(repo database.Store, want *State, shown, author string) (*Result, error) {
+	res := &Result{}
+	a := &applier{}
+	affected := make(map[string]bool)
+	err := repo.Tx(func(tx database.Store) error {
+		cur, err := Current(tx)
+		if err != nil {
+			return err
+		}
+		changes := Plan(cur, want)
+		if Render(changes) != shown {
+			return ErrPlanChanged
+		}
+
+		a.tx = tx
+		for _, c := range changes {
+			if c.Op == "-" && c.Subject == "client "+c.ClientID {
+				affected[c.ClientID] = false // removido: não há o que recarregar
+			}
+			if err := c.exec(a); err != nil {
+				return fmt.Errorf("%s: %w", c.Subject, err)
+			}
+			if err := tx.Audit(author, c.ClientID, c.auditAction()); err != nil {
+				return err
+			}
+			if _, seen := affected[c.ClientID]; !seen && c.ClientID != "" {
+				affected[c.ClientID] = true
+			}
+		}
+
+		// Clientes novos ou que mudaram de grupo recebem as portas dos modelos
+		res.Synced, err = tx.SyncTemplates("")
+		if err != nil {
+			return err
+		}
+		for _, s := range res.Synced {
+			if err := tx.Audit(author, s.ClientID, s.AuditAction()); err != nil {
+				return err
+			}
+			if _, seen := affected[s.ClientID]; !seen {
+				affected[s.ClientID] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Secrets = a.secrets
+	for _, id := range slices.Sorted(maps.Keys(affected)) {
+		if affected[id] {
+			res.Reload = append(res.Reload, id)
+		}
+	}
+	return res, nil
+}
+
+// ============= Export =============
+
+// Export gera o arquivo a partir do banco, sem chaves nem senhas
+func Export(repo database.Store) ([]byte, error) {
+	cur, err := Current(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg configFile
+	for _, pool := range sortedPools(cur.pools) {
+		r := fmt.Sprintf("%d-%d", pool.Start, pool.End)
+		if pool.Group == "" {
+			cfg.Pools = append(cfg.Pools, r)
+			continue
+		}
+		if cfg.Groups == nil {
+			cfg.Groups = make(map[string]configGroup)
+		}
+		g := cfg.Groups[pool.Group]
+		g.Pools = append(g.Pools, r)
+		cfg.Groups[pool.Group] = g
+	}
+
+	byClient := make(map[string][]configPort)
+	for _, port := range slices.Sorted(maps.Keys(cur.ports)) {
+		p := cur.ports[port]
+		cp := configPort{
+			Port:            p.ExposedPort,
+			ProxyProtocol:   p.ProxyProto,
+			AcceptProxy:     p.AcceptProxy,
+			RefuseUnhealthy: p.RefuseDown,
+			Schedule:        p.Schedule,
+			Expires:         p.ExpiresAt,
+			Disabled:        !p.Enabled,
+		}
+		if p.Mode == database.ModeSocks5 {
+			cp.Socks5 = p.AuthUser
+		} else {
+			cp.Target = p.Target()
+		}
+		if p.HealthCheck != "tcp" {
+			cp.HealthCheck = p.HealthCheck
+		}
+		byClient[p.ClientID] = append(byClient[p.ClientID], cp)
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(cur.clients)) {
+		c := cur.clients[id]
+		cc := configClient{ID: id, Name: c.Name, Group: c.Group, Ports: byClient[id]}
+		if c.Tags != "" {
+			cc.Tags, _ = database.ParseTags(c.Tags)
+		}
+		if c.Status != "active" {
+			cc.Status = c.Status
+		}
+		cfg.Clients = append(cfg.Clients, cc)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+// Package router implementa listeners compartilhados que roteiam conexões
+// para clientes conforme o hostname requisitado.
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/session"
+)
+
+// defaultErrorPage é exibida quando o cliente dono da rota está offline
+const defaultErrorPage = `<!DOCTYPE html>
+<html>
+<head><title>502 Service Unavailable</title></head>
+<body>
+<h1>Service unavailable</h1>
+<p>The site behind this address is currently offline. Please try again later.</p>
+</body>
+</html>
+`
+
+// routeHostPrefix identifica a rota no host da URL de saída (chave do pool de conexões)
+const routeHostPrefix = "route-"
+
+// HTTPRouter roteia requisições HTTP pelo header Host para o cliente/destino da rota
+type HTTPRouter struct {
+	manager   *session.Manager
+	repo      database.Store
+	errorPage []byte
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+	server    *http.Server
+	routes    sync.Map // id -> *database.Route (última versão vista)
+}
+
+// NewHTTPRouter cria o roteador; errorPagePath vazio usa a página padrão
+func NewHTTPRouter(manager *session.Manager, repo database.Store, errorPagePath string) (*HTTPRouter, error) {
+	page := []byte(defaultErrorPage)
+	if errorPagePath != "" {
+		var err error
+		page, err = os.ReadFile(errorPagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read error page: %w", err)
+		}
+	}
+
+	r := &HTTPRouter{
+		manager:   manager,
+		repo:      repo,
+		errorPage: page,
+	}
+
+	r.transport = &http.Transport{
+		DialContext:           r.dial,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+	}
+	r.proxy = &httputil.ReverseProxy{
+		Director:  r.direct,
+		Transport: r.transport,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("HTTP route %s: %v", req.Host, err)
+			r.writeErrorPage(w)
+		},
+	}
+
+	return r, nil
+}
+
+// Start abre o listener HTTP compartilhado
+func (r *HTTPRouter) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	r.server = &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	log.Printf("HTTP router listening on %s", addr)
+
+	go r.server.Serve(listener)
+	return nil
+}
+
+// Stop fecha o listener e as conexões ativas
+func (r *HTTPRouter) Stop() {
+	if r.server != nil {
+		r.server.Close()
+	}
+}
+
+// ServeHTTP resolve a rota pelo Host e encaminha pelo túnel do cliente
+func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	route, err := r.repo.GetHTTPRoute(host)
+	if err != nil {
+		log.Printf("HTTP route lookup failed for %s: %v", host, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if route == nil {
+		http.Error(w, "unknown host", http.StatusNotFound)
+		return
+	}
+
+	if r.manager.Reachable(route.ClientID) == nil {
+		log.Printf("HTTP route %s: client %s offline", host, route.ClientID)
+		r.writeErrorPage(w)
+		return
+	}
+
+	// Conexões keep-alive no pool de "route-<id>" seguem para o cliente e
+	// destino antigos: a rota mudou, então são descartadas
+	if prev, loaded := r.routes.Swap(route.ID, route); loaded {
+		if old := prev.(*database.Route); old.ClientID != route.ClientID || old.Target() != route.Target() {
+			log.Printf("HTTP route %s changed, closing idle connections", host)
+			r.transport.CloseIdleConnections()
+		}
+	}
+	ctx := context.WithValue(req.Context(), routeKey{}, route)
+	r.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+type routeKey struct{}
+
+// direct reescreve a URL de saída; o Host original é preservado para o destino
+func (r *HTTPRouter) direct(req *http.Request) {
+	route := req.Context().Value(routeKey{}).(*database.Route)
+
+	// Atrás de um balanceador que termina TLS, mantém o esquema informado por ele
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	} else if p := req.Header.Get("X-Forwarded-Proto"); p == "https" || p == "http" {
+		proto = p
+	}
+
+	req.URL.Scheme = "http"
+	req.URL.Host = routeHostPrefix + strconv.Itoa(route.ID)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	// X-Forwarded-For é acrescentado pelo ReverseProxy
+}
+
+// dial abre um stream yamux para o cliente dono da rota
+func (r *HTTPRouter) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	id, err := strconv.Atoi(strings.TrimPrefix(host, routeHostPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid route address %s", addr)
+	}
+
+	value, ok := r.routes.Load(id)
+	if !ok {
+		return nil, fmt.Errorf("route %d not found", id)
+	}
+	route := value.(*database.Route)
+
+	cs := r.manager.Reachable(route.ClientID)
+	if cs == nil {
+		return nil, fmt.Errorf("client %s offline", route.ClientID)
+	}
+
+	stream, err := cs.OpenStream(route.Target())
+	if err != nil {
+		return nil, err
+	}
+	return cs.TrackStream(stream, session.ConnHTTP, route.Hostname, route.Target()), nil
+}
+
+// writeErrorPage responde com a página configurada para clientes offline
+func (r *HTTPRouter) writeErrorPage(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write(r.errorPage)
+}
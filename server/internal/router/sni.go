@@ -0,0 +1,152 @@
+package router
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+	"github.com/voidprobe/server/internal/session"
+)
+
+// helloTimeout limita a espera pelo ClientHello
+const helloTimeout = 10 * time.Second
+
+// errHelloRead interrompe o handshake assim que o ClientHello é lido
+var errHelloRead = errors.New("client hello read")
+
+// TLSRouter encaminha conexões TLS sem terminá-las, escolhendo a rota pelo SNI
+type TLSRouter struct {
+	manager  *session.Manager
+	repo     database.Store
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// NewTLSRouter cria o roteador de passthrough TLS
+func NewTLSRouter(manager *session.Manager, repo database.Store) *TLSRouter {
+	return &TLSRouter{
+		manager: manager,
+		repo:    repo,
+	}
+}
+
+// Start abre o listener TLS compartilhado
+func (r *TLSRouter) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	r.listener = listener
+
+	log.Printf("TLS router listening on %s", addr)
+
+	r.wg.Add(1)
+	go r.acceptLoop()
+	return nil
+}
+
+// Stop fecha o listener
+func (r *TLSRouter) Stop() {
+	if r.listener != nil {
+		r.listener.Close()
+		r.wg.Wait()
+	}
+}
+
+func (r *TLSRouter) acceptLoop() {
+	defer r.wg.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.handleConnection(conn)
+	}
+}
+
+// handleConnection lê o SNI, resolve a rota e repassa os bytes originais ao cliente
+func (r *TLSRouter) handleConnection(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	serverName, hello, err := peekServerName(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.Printf("TLS router: invalid ClientHello from %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	route, err := r.repo.GetTLSRoute(serverName)
+	if err != nil {
+		log.Printf("TLS route lookup failed for %q: %v", serverName, err)
+		conn.Close()
+		return
+	}
+	if route == nil {
+		log.Printf("TLS router: no route for SNI %q from %s", serverName, conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	cs := r.manager.Reachable(route.ClientID)
+	if cs == nil {
+		log.Printf("TLS route %q: client %s offline", serverName, route.ClientID)
+		conn.Close()
+		return
+	}
+
+	stream, err := cs.OpenStream(route.Target())
+	if err != nil {
+		log.Printf("TLS route %q: failed to open stream: %v", serverName, err)
+		conn.Close()
+		return
+	}
+
+	log.Printf("TLS route %q: %s -> %s (%s)", serverName, conn.RemoteAddr(), route.Target(), route.ClientID)
+	peeked := &peekedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(hello), conn)}
+	session.ProxyConnection(cs.Track(peeked, session.ConnTLS, 0, conn.RemoteAddr().String(), route.Target()), stream)
+}
+
+// peekServerName lê o ClientHello e devolve o SNI junto com os bytes consumidos
+func peekServerName(conn net.Conn) (string, []byte, error) {
+	var buf bytes.Buffer
+	var serverName string
+
+	err := tls.Server(readOnlyConn{Conn: conn, reader: io.TeeReader(conn, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+
+	if !errors.Is(err, errHelloRead) {
+		return "", nil, err
+	}
+	return serverName, buf.Bytes(), nil
+}
+
+// readOnlyConn alimenta o crypto/tls sem permitir escrita na conexão real
+type readOnlyConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.reader.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// peekedConn reapresenta os bytes já lidos antes do restante da conexão
+type peekedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) { return c.reader.Read(p) }
@@ -0,0 +1,161 @@
+// Package schedule interpreta janelas semanais de funcionamento de mapeamentos,
+// no formato "<dias> <HH:MM>-<HH:MM>" (ex: "mon-fri 08:00-18:00"). Várias janelas
+// podem ser separadas por ";" e os horários seguem o fuso local do servidor (TZ).
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window é uma janela diária aplicada a um conjunto de dias da semana.
+// Se End <= Start a janela atravessa a meia-noite e termina no dia seguinte.
+type Window struct {
+	Days  [7]bool
+	Start time.Duration // desde 00:00
+	End   time.Duration
+}
+
+// Schedule é um conjunto de janelas; ativo se qualquer uma estiver ativa
+type Schedule []Window
+
+// Parse interpreta a especificação, ex: "mon-fri 08:00-18:00; sat 09:00-12:00".
+// Dias aceitam listas ("mon,wed"), intervalos ("mon-fri"), "daily" ou "*".
+func Parse(spec string) (Schedule, error) {
+	var s Schedule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Fields(strings.ToLower(part))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid window %q (expected \"<days> HH:MM-HH:MM\")", part)
+		}
+
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		from, to, ok := strings.Cut(fields[1], "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time range %q", fields[1])
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("empty time range %q", fields[1])
+		}
+
+		s = append(s, Window{Days: days, Start: start, End: end})
+	}
+
+	if len(s) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	return s, nil
+}
+
+// Active informa se o instante está dentro de alguma janela (no fuso de t)
+func (s Schedule) Active(t time.Time) bool {
+	for _, w := range s {
+		if w.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) active(t time.Time) bool {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	today := t.Weekday()
+
+	if w.Start < w.End {
+		return w.Days[today] && clock >= w.Start && clock < w.End
+	}
+
+	// Janela noturna: começa em um dia listado e termina no dia seguinte
+	yesterday := (today + 6) % 7
+	return (w.Days[today] && clock >= w.Start) || (w.Days[yesterday] && clock < w.End)
+}
+
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	if spec == "daily" || spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(item, "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return days, fmt.Errorf("invalid day %q", to)
+			}
+		}
+
+		// Intervalos podem dar a volta na semana (ex: fri-mon)
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * time.Hour, nil
+		}
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseTTL interpreta a validade de um mapeamento: durações do Go (90m, 4h) e dias (2d)
+func ParseTTL(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q (examples: 30m, 4h, 2d)", s)
+	}
+	return d, nil
+}
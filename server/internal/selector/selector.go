@@ -0,0 +1,95 @@
+// Package selector escolhe clientes pelas tags e pelos campos id, name, group
+// e status, no formato "<termo>,<termo>" (todos precisam valer), ex:
+// "env=staging,site=lis*". Termos:
+//
+//	chave=valor   valor igual (aceita curingas * ? [..], como em path.Match)
+//	chave!=valor  valor diferente, ou chave ausente
+//	chave         chave presente (com qualquer valor)
+//	!chave        chave ausente
+package selector
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type op int
+
+const (
+	opEqual op = iota
+	opNotEqual
+	opExists
+	opAbsent
+)
+
+type term struct {
+	key, value string
+	op         op
+}
+
+// Selector é um conjunto de termos; o seletor vazio escolhe todos os clientes
+type Selector []term
+
+// Parse interpreta o seletor, ex: "env=prod,!canary"
+func Parse(spec string) (Selector, error) {
+	var s Selector
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var t term
+		switch {
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			t = term{strings.TrimSpace(key), strings.TrimSpace(value), opNotEqual}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			t = term{strings.TrimSpace(key), strings.TrimSpace(value), opEqual}
+		case strings.HasPrefix(part, "!"):
+			t = term{key: strings.TrimSpace(part[1:]), op: opAbsent}
+		default:
+			t = term{key: part, op: opExists}
+		}
+
+		if t.key == "" || strings.ContainsAny(t.key, "!= ") {
+			return nil, fmt.Errorf("invalid selector term %q (use key=value, key!=value, key or !key)", part)
+		}
+		if _, err := path.Match(t.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in selector", t.value)
+		}
+		s = append(s, t)
+	}
+	return s, nil
+}
+
+// Match informa se os rótulos do cliente (tags, id, name, group e status)
+// atendem a todos os termos
+func (s Selector) Match(labels map[string]string) bool {
+	for _, t := range s {
+		value, ok := labels[t.key]
+		var match bool
+		switch t.op {
+		case opEqual:
+			match = ok && glob(t.value, value)
+		case opNotEqual:
+			match = !ok || !glob(t.value, value)
+		case opExists:
+			match = ok
+		case opAbsent:
+			match = !ok
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// glob compara o valor com o padrão (padrões inválidos são recusados em Parse)
+func glob(pattern, value string) bool {
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
@@ -0,0 +1,51 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+)
+
+// Access abre um stream do operador até o destino no cliente. Destinos de um
+// mapeamento do cliente ativo agora seguem como fixos; os demais (inclusive de
+// mapeamentos desativados, vencidos ou fora da janela) como dinâmicos, sujeitos
+// ao ALLOWED_TARGETS do cliente (lista vazia recusa).
+func (m *Manager) Access(operatorID, clientID, target string) (net.Conn, error) {
+	if err := checkTarget(target); err != nil {
+		return nil, err
+	}
+
+	cs := m.lookup(clientID)
+	if cs == nil {
+		return nil, fmt.Errorf("client %s is offline", clientID)
+	}
+
+	ports, err := m.repo.GetClientPorts(clientID)
+	if err != nil {
+		return nil, err
+	}
+	var stream net.Conn
+	if fixedTarget(ports, target, time.Now()) {
+		stream, err = cs.OpenStream(target)
+	} else {
+		stream, err = cs.openDynamic(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cs.TrackStream(stream, ConnAccess, operatorID, target), nil
+}
+
+// fixedTarget indica se target é o destino de um mapeamento forward que deve
+// estar aberto no instante informado
+func fixedTarget(ports []database.PortMapping, target string, now time.Time) bool {
+	for _, p := range ports {
+		if p.Mode == database.ModeForward && p.Enabled && p.InactiveReason(now) == "" && p.Target() == target {
+			return true
+		}
+	}
+	return false
+}
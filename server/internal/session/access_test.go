@@ -0,0 +1,61 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+)
+
+func TestFixedTarget(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	forward := func(host string, port int) database.PortMapping {
+		return database.PortMapping{TargetHost: host, TargetPort: port, Mode: database.ModeForward, Enabled: true}
+	}
+	disabled := forward("10.0.0.2", 22)
+	disabled.Enabled = false
+	expired := forward("10.0.0.3", 22)
+	expired.ExpiresAt = now.Add(-time.Minute).Format(database.TimeLayout)
+	valid := forward("10.0.0.4", 22)
+	valid.ExpiresAt = now.Add(time.Hour).Format(database.TimeLayout)
+	outside := forward("10.0.0.5", 22)
+	outside.Schedule = "never"
+	socks := database.PortMapping{Mode: database.ModeSocks5, Enabled: true}
+
+	ports := []database.PortMapping{
+		forward("127.0.0.1", 22),
+		forward("unix:///var/run/docker.sock", 0),
+		disabled, expired, valid, outside, socks,
+	}
+	tests := []struct {
+		target string
+		fixed  bool
+	}{
+		{"127.0.0.1:22", true},
+		{"unix:///var/run/docker.sock", true},
+		{"10.0.0.4:22", true},
+		{"127.0.0.1:23", false},
+		{"10.0.0.2:22", false}, // desativado
+		{"10.0.0.3:22", false}, // vencido
+		{"10.0.0.5:22", false}, // janela inválida nunca abre
+		{"socks5", false},
+	}
+	for _, tt := range tests {
+		if got := fixedTarget(ports, tt.target, now); got != tt.fixed {
+			t.Errorf("fixedTarget(%q) = %v, want %v", tt.target, got, tt.fixed)
+		}
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	for _, target := range []string{"127.0.0.1:22", "db.internal:5432", "unix:///run/app.sock"} {
+		if err := checkTarget(target); err != nil {
+			t.Errorf("checkTarget(%q): %v", target, err)
+		}
+	}
+	for _, target := range []string{"", "host:22 src=1.2.3.4", "host:22\nX", "host\x00:22", "host :22"} {
+		if err := checkTarget(target); err == nil {
+			t.Errorf("checkTarget(%q) accepted", target)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/voidprobe/server/internal/database"
+)
+
+// Cluster: vários servidores (nós) compartilham o banco. Cada nó registra os
+// clientes conectados a ele em client_nodes e abre também as portas dos
+// clientes conectados aos outros nós; conexões nessas portas seguem pelo
+// relay até o nó que tem a sessão do cliente.
+const (
+	// relayTimeout limita a conexão e o handshake com o outro nó
+	relayTimeout = 10 * time.Second
+	// relayGreeting abre o handshake do relay, seguido do nonce
+	relayGreeting = "voidprobe-relay"
+)
+
+// ConnRelay: conexão recebida de outro nó do cluster
+const ConnRelay = "relay"
+
+// errRelayed: o cliente passou a ser atendido por outro nó
+var errRelayed = errors.New("client attached to another node")
+
+// Cluster identifica este servidor entre os nós que compartilham o banco
+type Cluster struct {
+	NodeID  string
+	Address string // endereço do relay anunciado aos outros nós (host:porta)
+	Token   string // segredo compartilhado do link entre nós
+}
+
+// relayNode é o nó que atende o cliente de uma sessão de relay
+type relayNode struct {
+	id, address string
+}
+
+// StartCluster registra o nó, abre o listener do relay em address e passa a
+// acompanhar em quais nós os clientes estão conectados
+func (m *Manager) StartCluster(cluster Cluster, address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	m.cluster = &cluster
+	m.leave = make(chan struct{})
+
+	log.Printf("Cluster node %s, relay listening on %s (advertised as %s)", cluster.NodeID, address, cluster.Address)
+
+	go m.serveRelay(listener)
+	go m.runCluster()
+	return listener, nil
+}
+
+// runCluster mantém o heartbeat do nó e as sessões de relay em dia
+func (m *Manager) runCluster() {
+	ticker := time.NewTicker(database.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		// Sem heartbeat o registro do nó pode estar vencido: tenta de novo no
+		// próximo tick sem mexer nas sessões de relay
+		if err := m.repo.NodeHeartbeat(m.cluster.NodeID, m.cluster.Address); err != nil {
+			log.Printf("Cluster: heartbeat failed: %v", err)
+		} else {
+			m.syncRelays()
+		}
+
+		select {
+		case <-m.leave:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LeaveCluster encerra o heartbeat e remove o nó do banco: os outros nós param
+// de encaminhar conexões para cá sem aguardar o NodeTimeout
+func (m *Manager) LeaveCluster() {
+	if m.cluster == nil {
+		return
+	}
+	// Envio sem buffer: retorna quando runCluster não está no meio de um heartbeat
+	m.leave <- struct{}{}
+	if err := m.repo.RemoveNode(m.cluster.NodeID); err != nil {
+		log.Printf("Cluster: failed to leave: %v", err)
+	}
+}
+
+// syncRelays abre sessões de relay para clientes conectados a outros nós,
+// fecha as que perderam o nó e converte sessões locais de clientes que
+// reconectaram em outro nó
+func (m *Manager) syncRelays() {
+	// Consulta com m.mu travado: um RegisterSession concorrente não pode ser
+	// confundido com a sessão antiga de um cliente que mudou de nó
+	m.mu.Lock()
+	attached, err := m.repo.ListClientNodes()
+	if err != nil {
+		m.mu.Unlock()
+		log.Printf("Cluster: %v", err)
+		return
+	}
+
+	owners := make(map[string]relayNode)
+	for _, cn := range attached {
+		if cn.Node.NodeID != m.cluster.NodeID && cn.Node.Alive() {
+			owners[cn.ClientID] = relayNode{cn.Node.NodeID, cn.Node.Address}
+		}
+	}
+
+	var opened []*ClientSession
+	for clientID, cs := range m.sessions {
+		node, remote := owners[clientID]
+		delete(owners, clientID)
+		switch {
+		case !remote:
+			if cs.relayed() {
+				log.Printf("Client %s no longer attached to a live node, closing relay", clientID)
+				m.remove(cs)
+			}
+		case cs.current() != nil:
+			// A última conexão do cliente foi em outro nó: esta é antiga
+			log.Printf("Client %s reconnected on node %s, closing stale session", clientID, node.id)
+			cs.current().Close()
+		case cs.relayTo(node):
+			log.Printf("Client %s attached to node %s, relaying via %s", clientID, node.id, node.address)
+			m.publish(EventConnected, clientID, "attached to node %s, relaying", node.id)
+		}
+	}
+	for clientID, node := range owners {
+		cs := m.newSession(clientID)
+		cs.relayTo(node)
+		m.sessions[clientID] = cs
+		opened = append(opened, cs)
+		log.Printf("Client %s attached to node %s, relaying via %s", clientID, node.id, node.address)
+		m.publish(EventConnected, clientID, "attached to node %s, relaying", node.id)
+	}
+	m.mu.Unlock()
+
+	for _, cs := range opened {
+		if err := cs.Reload(); err != nil && !isBindErrors(err) {
+			log.Printf("Client %s: relay port sync failed: %v", cs.ClientID, err)
+		}
+	}
+}
+
+// attachNode registra no banco que o cliente está conectado a este nó (m.mu travado)
+func (m *Manager) attachNode(clientID string) {
+	if m.cluster == nil {
+		return
+	}
+	if err := m.repo.AttachClient(clientID, m.cluster.NodeID); err != nil {
+		log.Printf("Client %s: %v", clientID, err)
+	}
+}
+
+// detachNode apaga o registro do cliente neste nó; false se ele já está em outro nó
+func (m *Manager) detachNode(clientID string) bool {
+	if m.cluster == nil {
+		return true
+	}
+	moved, err := m.repo.DetachClient(clientID, m.cluster.NodeID)
+	if err != nil {
+		log.Printf("Client %s: %v", clientID, err)
+	}
+	return !moved
+}
+
+// relayed informa se a sessão só encaminha conexões a outro nó
+func (cs *ClientSession) relayed() bool {
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+	return cs.relay != nil
+}
+
+// relayNode retorna o nó que atende o cliente (nil se a sessão é local)
+func (cs *ClientSession) relayNode() *relayNode {
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+	return cs.relay
+}
+
+// relayTo passa a encaminhar as conexões ao nó; conexões retidas aguardando a
+// reconexão seguem pelo relay. Retorna false se a sessão já apontava para ele.
+func (cs *ClientSession) relayTo(node relayNode) bool {
+	// Estados gravados por este nó deixam de valer: o outro nó grava os dele
+	cs.mu.Lock()
+	cs.states = make(map[int]portState)
+	cs.mu.Unlock()
+
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+
+	if cs.relay != nil && *cs.relay == node {
+		return false
+	}
+	if cs.graceTimer != nil {
+		cs.graceTimer.Stop()
+		cs.graceTimer = nil
+	}
+	cs.relay = &node
+	cs.since = time.Now()
+	if cs.attached != nil {
+		close(cs.attached)
+		cs.attached = nil
+	}
+	return true
+}
+
+// relayMAC autentica o pedido de relay com o segredo do cluster e o nonce do handshake
+func (m *Manager) relayMAC(nonce, request string) string {
+	mac := hmac.New(sha256.New, []byte(m.cluster.Token))
+	mac.Write([]byte(nonce + " " + request))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// dialRelay abre uma conexão até o cliente pelo nó que tem a sessão dele
+func (m *Manager) dialRelay(node *relayNode, clientID, header string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", node.address, relayTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", node.id, err)
+	}
+	conn.SetDeadline(time.Now().Add(relayTimeout))
+
+	greeting, err := readHeader(conn)
+	nonce, ok := strings.CutPrefix(greeting, relayGreeting+" ")
+	if err != nil || !ok {
+		conn.Close()
+		return nil, fmt.Errorf("node %s: invalid relay handshake", node.id)
+	}
+
+	request := clientID + " " + header
+	if _, err := fmt.Fprintf(conn, "%s %s\n", m.relayMAC(nonce, request), request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("node %s: %w", node.id, err)
+	}
+
+	// O outro nó responde depois de abrir o stream, o que pode aguardar a
+	// reconexão do cliente durante a carência
+	conn.SetDeadline(time.Time{})
+	reply, err := readHeader(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("node %s: %w", node.id, err)
+	}
+	if reply != AckOK {
+		conn.Close()
+		return nil, fmt.Errorf("node %s: %s", node.id, strings.TrimPrefix(reply, "ERR "))
+	}
+	return conn, nil
+}
+
+// serveRelay aceita conexões de outros nós
+func (m *Manager) serveRelay(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go m.handleRelay(conn)
+	}
+}
+
+// handleRelay autentica o pedido de outro nó e o encaminha ao cliente conectado
+// aqui; recusa clientes que este nó também só alcança por relay
+func (m *Manager) handleRelay(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(relayTimeout))
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return
+	}
+	nonceHex := hex.EncodeToString(nonce)
+	if _, err := fmt.Fprintf(conn, "%s %s\n", relayGreeting, nonceHex); err != nil {
+		conn.Close()
+		return
+	}
+
+	line, err := readHeader(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	mac, request, _ := strings.Cut(line, " ")
+	if !hmac.Equal([]byte(mac), []byte(m.relayMAC(nonceHex, request))) {
+		log.Printf("Relay: rejected unauthenticated request from %s", conn.RemoteAddr())
+		fmt.Fprintf(conn, "ERR unauthorized\n")
+		conn.Close()
+		return
+	}
+
+	fields := strings.Fields(request)
+	if len(fields) < 2 {
+		fmt.Fprintf(conn, "ERR invalid request\n")
+		conn.Close()
+		return
+	}
+	clientID, target, options := fields[0], fields[1], fields[2:]
+
+	cs := m.lookup(clientID)
+	if cs == nil || cs.relayed() {
+		fmt.Fprintf(conn, "ERR client %s is not attached to node %s\n", clientID, m.cluster.NodeID)
+		conn.Close()
+		return
+	}
+
+	// Sem prazo enquanto aguarda a reconexão do cliente (carência)
+	conn.SetDeadline(time.Time{})
+	stream, err := cs.OpenStream(target, options...)
+	if err != nil {
+		log.Printf("Relay from %s: client %s: %v", conn.RemoteAddr(), clientID, err)
+		fmt.Fprintf(conn, "ERR %v\n", err)
+		conn.Close()
+		return
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", AckOK); err != nil {
+		stream.Close()
+		conn.Close()
+		return
+	}
+
+	ProxyConnection(cs.Track(conn, ConnRelay, 0, conn.RemoteAddr().String(), target), stream)
+}
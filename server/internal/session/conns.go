@@ -0,0 +1,154 @@
+package session
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Origens de uma conexão rastreada
+const (
+	ConnPort   = "port"   // listener de client_ports
+	ConnHTTP   = "http"   // rota HTTP por hostname (conexão do pool do roteador)
+	ConnTLS    = "tls"    // rota TLS por SNI
+	ConnAccess = "access" // voidprobe-cli connect de um operador
+)
+
+// connSeq numera as conexões rastreadas
+var connSeq atomic.Uint64
+
+// ConnInfo descreve uma conexão em andamento e os bytes trafegados: BytesIn
+// segue para o cliente, BytesOut volta dele
+type ConnInfo struct {
+	ID       uint64
+	ClientID string
+	Kind     string
+	Port     int // porta exposta (só ConnPort)
+	Source   string
+	Target   string
+	Since    time.Time
+	BytesIn  int64
+	BytesOut int64
+}
+
+// trackedConn conta os bytes de uma conexão e sai da lista ao ser fechada
+type trackedConn struct {
+	net.Conn
+	cs      *ClientSession
+	info    ConnInfo
+	in, out atomic.Int64
+	stream  bool // lado do túnel: escrever é enviar ao cliente
+	once    sync.Once
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.stream {
+		c.out.Add(int64(n))
+	} else {
+		c.in.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if c.stream {
+		c.in.Add(int64(n))
+	} else {
+		c.out.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.cs.connMu.Lock()
+		delete(c.cs.conns, c.info.ID)
+		c.cs.connMu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// snapshot retorna a descrição com os contadores atuais
+func (c *trackedConn) snapshot() ConnInfo {
+	info := c.info
+	info.BytesIn = c.in.Load()
+	info.BytesOut = c.out.Load()
+	return info
+}
+
+// Track registra a conexão do visitante até ela ser fechada
+func (cs *ClientSession) Track(conn net.Conn, kind string, port int, source, target string) net.Conn {
+	return cs.track(conn, false, kind, port, source, target)
+}
+
+// TrackStream registra um stream do túnel (lado do cliente) até ele ser fechado
+func (cs *ClientSession) TrackStream(stream net.Conn, kind, source, target string) net.Conn {
+	return cs.track(stream, true, kind, 0, source, target)
+}
+
+func (cs *ClientSession) track(conn net.Conn, stream bool, kind string, port int, source, target string) net.Conn {
+	tc := &trackedConn{
+		Conn:   conn,
+		cs:     cs,
+		stream: stream,
+		info: ConnInfo{
+			ID:       connSeq.Add(1),
+			ClientID: cs.ClientID,
+			Kind:     kind,
+			Port:     port,
+			Source:   source,
+			Target:   target,
+			Since:    time.Now(),
+		},
+	}
+
+	cs.connMu.Lock()
+	cs.conns[tc.info.ID] = tc
+	cs.connMu.Unlock()
+	return tc
+}
+
+// closePortConns encerra as conexões em andamento recebidas pela porta exposta
+func (cs *ClientSession) closePortConns(port int) int {
+	var conns []*trackedConn
+	cs.connMu.Lock()
+	for _, tc := range cs.conns {
+		if tc.info.Kind == ConnPort && tc.info.Port == port {
+			conns = append(conns, tc)
+		}
+	}
+	cs.connMu.Unlock()
+
+	for _, tc := range conns {
+		tc.Close()
+	}
+	return len(conns)
+}
+
+// Connections lista as conexões em andamento (clientID vazio = todos), das mais antigas às mais novas
+func (m *Manager) Connections(clientID string) []ConnInfo {
+	m.mu.RLock()
+	sessions := make([]*ClientSession, 0, len(m.sessions))
+	for id, cs := range m.sessions {
+		if clientID == "" || id == clientID {
+			sessions = append(sessions, cs)
+		}
+	}
+	m.mu.RUnlock()
+
+	var infos []ConnInfo
+	for _, cs := range sessions {
+		cs.connMu.Lock()
+		for _, tc := range cs.conns {
+			infos = append(infos, tc.snapshot())
+		}
+		cs.connMu.Unlock()
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tipos de evento publicados pelo Manager (stream WatchEvents da API)
+const (
+	EventConnected    = "client_connected"
+	EventDisconnected = "client_disconnected"
+	EventPortState    = "port_state"
+	EventPortHealth   = "port_health"
+	EventConfig       = "config_changed"
+)
+
+// eventBuffer é a fila de cada assinante; quem não consome a tempo perde eventos
+const eventBuffer = 256
+
+// Event descreve uma mudança em sessões, portas ou configuração
+type Event struct {
+	Time       time.Time
+	Type       string
+	ClientID   string
+	Detail     string
+	OperatorID string // autor de mudanças feitas pela API
+}
+
+// Subscribe registra um assinante de eventos; cancel encerra a assinatura
+func (m *Manager) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, eventBuffer)
+
+	m.subMu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.subMu.Unlock()
+
+	return ch, func() {
+		m.subMu.Lock()
+		delete(m.subscribers, ch)
+		m.subMu.Unlock()
+	}
+}
+
+// Publish entrega o evento a todos os assinantes sem bloquear
+func (m *Manager) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publish cria e publica um evento do próprio servidor
+func (m *Manager) publish(eventType, clientID, format string, args ...interface{}) {
+	m.Publish(Event{Type: eventType, ClientID: clientID, Detail: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,144 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/voidprobe/server/internal/database"
+)
+
+// forwardDialTimeout limita a conexão do servidor ao destino de um local-forward
+const forwardDialTimeout = 10 * time.Second
+
+// AcceptStreams aceita streams abertos pelo cliente até a sessão encerrar
+func (cs *ClientSession) AcceptStreams(session *yamux.Session) {
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		go cs.handleClientStream(stream)
+	}
+}
+
+// handleClientStream despacha um stream aberto pelo cliente conforme o header
+func (cs *ClientSession) handleClientStream(stream net.Conn) {
+	header, err := readHeader(stream)
+	if err != nil {
+		log.Printf("Client %s: failed to read stream header: %v", cs.ClientID, err)
+		stream.Close()
+		return
+	}
+
+	cmd, arg, _ := strings.Cut(header, " ")
+	switch cmd {
+	case HeaderForward:
+		cs.handleForward(stream, arg)
+	case HeaderHealth:
+		cs.handleHealth(stream)
+	case HeaderServices:
+		cs.handleServices(stream)
+	default:
+		log.Printf("Client %s: unknown stream header %q", cs.ClientID, header)
+		stream.Close()
+	}
+}
+
+// handleForward conecta um local-forward do cliente ao destino configurado
+func (cs *ClientSession) handleForward(stream net.Conn, arg string) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		log.Printf("Client %s: invalid forward id %q", cs.ClientID, arg)
+		stream.Close()
+		return
+	}
+
+	forward, err := cs.repo.GetForward(cs.ClientID, id)
+	if err != nil || forward == nil {
+		log.Printf("Client %s: forward %d not found or disabled", cs.ClientID, id)
+		stream.Close()
+		return
+	}
+
+	if forward.TargetClient != "" {
+		cs.handleLink(stream, forward)
+		return
+	}
+
+	target := forward.Target()
+	local, err := net.DialTimeout("tcp", target, forwardDialTimeout)
+	if err != nil {
+		log.Printf("Forward %d (%s): failed to connect to %s: %v", id, cs.ClientID, target, err)
+		stream.Close()
+		return
+	}
+
+	log.Printf("Forward %d (%s): client:%s -> %s", id, cs.ClientID, forward.ListenAddr(), target)
+	ProxyConnection(local, stream)
+}
+
+// handleLink repassa a conexão do local-forward à sessão do cliente de destino;
+// o tráfego fica entre os dois túneis, sem listener TCP no servidor
+func (cs *ClientSession) handleLink(stream net.Conn, forward *database.LocalForward) {
+	peerID, target := forward.TargetClient, forward.Target()
+
+	allowed, err := cs.repo.LinkAllowed(cs.ClientID, peerID)
+	if err != nil || !allowed {
+		log.Printf("Forward %d (%s): link to %s not allowed", forward.ID, cs.ClientID, peerID)
+		stream.Close()
+		return
+	}
+
+	peer := cs.manager.lookup(peerID)
+	if peer == nil {
+		log.Printf("Forward %d (%s): client %s is offline", forward.ID, cs.ClientID, peerID)
+		stream.Close()
+		return
+	}
+
+	remote, err := peer.OpenStream(target)
+	if err != nil {
+		log.Printf("Forward %d (%s): failed to open stream to %s: %v", forward.ID, cs.ClientID, peerID, err)
+		stream.Close()
+		return
+	}
+
+	log.Printf("Forward %d (%s): client:%s -> %s:%s", forward.ID, cs.ClientID, forward.ListenAddr(), peerID, target)
+	ProxyConnection(stream, remote)
+}
+
+// pushForwards envia ao cliente a lista atual de local-forwards
+func (cs *ClientSession) pushForwards() error {
+	forwards, err := cs.repo.GetClientForwards(cs.ClientID)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(HeaderForwards + "\n")
+	for _, f := range forwards {
+		fmt.Fprintf(&b, "%d %s\n", f.ID, f.ListenAddr())
+	}
+
+	session := cs.current()
+	if session == nil {
+		return fmt.Errorf("client not connected")
+	}
+	stream, err := session.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open forwards stream: %w", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Write([]byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send forwards: %w", err)
+	}
+
+	log.Printf("Client %s: %d local-forward(s) pushed", cs.ClientID, len(forwards))
+	return nil
+}
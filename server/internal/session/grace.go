@@ -0,0 +1,93 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+var (
+	// errQueueFull: fila de conexões retidas durante a carência está cheia
+	errQueueFull = errors.New("client reconnecting and hold queue is full")
+	// errClientGone: o cliente não voltou dentro do período de carência
+	errClientGone = errors.New("client did not reconnect within grace period")
+)
+
+// current retorna a sessão yamux ativa (nil enquanto o cliente reconecta)
+func (cs *ClientSession) current() *yamux.Session {
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+	return cs.session
+}
+
+// attach associa a nova sessão yamux, libera conexões retidas e fecha uma
+// sessão anterior ainda aberta (conexão duplicada do mesmo client_id)
+func (cs *ClientSession) attach(session *yamux.Session) {
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+
+	if cs.graceTimer != nil {
+		cs.graceTimer.Stop()
+		cs.graceTimer = nil
+	}
+	if cs.session != nil && cs.session != session {
+		cs.session.Close()
+	}
+	cs.session = session
+	cs.relay = nil
+	cs.since = time.Now()
+	if cs.attached != nil {
+		close(cs.attached)
+		cs.attached = nil
+	}
+}
+
+// detach desassocia a sessão se ainda for a atual; novas conexões passam a
+// aguardar a reconexão
+func (cs *ClientSession) detach(session *yamux.Session) bool {
+	cs.sessMu.Lock()
+	defer cs.sessMu.Unlock()
+
+	if cs.session != session {
+		return false
+	}
+	cs.session = nil
+	cs.attached = make(chan struct{})
+	return true
+}
+
+// waitSession retorna a sessão ativa ou, durante a carência, ocupa uma vaga da
+// fila e aguarda o cliente voltar (ou a carência expirar); errRelayed se o
+// cliente está conectado a outro nó do cluster
+func (cs *ClientSession) waitSession() (*yamux.Session, error) {
+	for {
+		cs.sessMu.Lock()
+		session, attached, relay := cs.session, cs.attached, cs.relay
+		cs.sessMu.Unlock()
+
+		if session != nil {
+			return session, nil
+		}
+		if relay != nil {
+			return nil, errRelayed
+		}
+		if attached == nil {
+			return nil, errClientGone
+		}
+
+		select {
+		case cs.held <- struct{}{}:
+		default:
+			return nil, errQueueFull
+		}
+
+		select {
+		case <-attached:
+			<-cs.held
+		case <-cs.gone:
+			<-cs.held
+			return nil, errClientGone
+		}
+	}
+}
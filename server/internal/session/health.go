@@ -0,0 +1,115 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/voidprobe/server/internal/database"
+)
+
+// pushChecks envia ao cliente os destinos que ele deve sondar
+func (cs *ClientSession) pushChecks() error {
+	ports, err := cs.repo.GetClientPorts(cs.ClientID)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(HeaderChecks + "\n")
+	checked := make(map[int]bool)
+	for _, p := range ports {
+		if !p.Checked() {
+			continue
+		}
+		fmt.Fprintf(&b, "%d %s %s\n", p.ID, p.HealthCheck, p.Target())
+		checked[p.ID] = true
+	}
+
+	// Descarta estados de portas que deixaram de ser sondadas
+	cs.healthMu.Lock()
+	for id := range cs.health {
+		if !checked[id] {
+			delete(cs.health, id)
+		}
+	}
+	cs.healthMu.Unlock()
+
+	session := cs.current()
+	if session == nil {
+		return fmt.Errorf("client not connected")
+	}
+	stream, err := session.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open checks stream: %w", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Write([]byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send checks: %w", err)
+	}
+
+	log.Printf("Client %s: %d health check(s) pushed", cs.ClientID, len(checked))
+	return nil
+}
+
+// handleHealth lê os estados reportados pelo cliente até o stream fechar
+func (cs *ClientSession) handleHealth(stream net.Conn) {
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		portID, err := strconv.Atoi(fields[0])
+		if err != nil {
+			log.Printf("Client %s: invalid health report %q", cs.ClientID, scanner.Text())
+			continue
+		}
+		status := fields[1]
+		if status != database.HealthUp && status != database.HealthDown {
+			log.Printf("Client %s: invalid health status %q", cs.ClientID, status)
+			continue
+		}
+		var detail string
+		if len(fields) > 2 {
+			detail = fields[2]
+		}
+
+		cs.healthMu.Lock()
+		previous, known := cs.health[portID]
+		cs.health[portID] = database.PortHealth{Status: status, Detail: detail}
+		cs.healthMu.Unlock()
+
+		if !known || previous.Status != status {
+			if status == database.HealthDown {
+				log.Printf("Client %s: port %d target down: %s", cs.ClientID, portID, detail)
+				cs.manager.publish(EventPortHealth, cs.ClientID, "port id %d down: %s", portID, detail)
+			} else {
+				log.Printf("Client %s: port %d target up", cs.ClientID, portID)
+				cs.manager.publish(EventPortHealth, cs.ClientID, "port id %d up", portID)
+			}
+		}
+
+		if err := cs.repo.SetPortHealth(cs.ClientID, portID, status, detail); err != nil {
+			log.Printf("Client %s: %v", cs.ClientID, err)
+		}
+	}
+}
+
+// Health retorna o último estado reportado para o mapeamento
+func (cs *ClientSession) Health(portID int) database.PortHealth {
+	cs.healthMu.RLock()
+	defer cs.healthMu.RUnlock()
+
+	h, ok := cs.health[portID]
+	if !ok {
+		return database.PortHealth{Status: database.HealthUnknown}
+	}
+	return h
+}
@@ -1,129 +1,478 @@
 package session
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/armon/go-socks5"
 	"github.com/hashicorp/yamux"
+	"github.com/pires/go-proxyproto"
 	"github.com/voidprobe/server/internal/database"
 )
 
+// proxyHeaderTimeout limita a espera pelo header PROXY do balanceador
+const proxyHeaderTimeout = 10 * time.Second
+
+// scheduleInterval é a frequência com que validade e janelas de horário são reavaliadas
+const scheduleInterval = 30 * time.Second
+
 // PortListener representa um listener ativo
 type PortListener struct {
 	Port     int
 	Target   string
+	Mapping  database.PortMapping
 	Listener net.Listener
+	Socks    *socks5.Server // definido para mapeamentos no modo socks5
 	Cancel   chan struct{}
 }
 
-// ClientSession gerencia a sessão de um cliente e seus listeners
+// ClientSession gerencia a sessão de um cliente e seus listeners. Sobrevive a
+// reconexões dentro do período de carência: listeners continuam abertos e a
+// sessão yamux é trocada quando o mesmo client_id volta.
 type ClientSession struct {
 	ClientID  string
-	Session   *yamux.Session
 	Listeners map[int]*PortListener
 	mu        sync.RWMutex
-	repo      *database.Repository
+	repo      database.Store
+	manager   *Manager
+	closed    bool // sessão encerrada: o agendador não deve reabrir listeners
+
+	session    *yamux.Session // nil enquanto o cliente reconecta
+	relay      *relayNode     // cliente conectado a outro nó do cluster: conexões seguem pelo relay
+	attached   chan struct{}  // fechado quando o cliente volta
+	gone       chan struct{}  // fechado quando a carência expira
+	held       chan struct{}  // vagas da fila de conexões aguardando o cliente
+	graceTimer *time.Timer
+	since      time.Time // início da sessão yamux atual
+	sessMu     sync.Mutex
+
+	health   map[int]database.PortHealth // port_id -> último estado reportado pelo cliente
+	healthMu sync.RWMutex
+
+	states     map[int]portState // port_id -> último estado gravado (protegido por mu)
+	configSeen string            // configuração vista pelo auto-reload (protegido por mu)
+
+	conns  map[uint64]*trackedConn // conexões em andamento com contadores de bytes
+	connMu sync.Mutex
+}
+
+// portState é o estado de execução de um mapeamento e seu detalhe
+type portState struct {
+	state, detail string
+}
+
+// BindErrors lista os mapeamentos cujo listener não pôde ser aberto
+type BindErrors []string
+
+func (e BindErrors) Error() string {
+	return fmt.Sprintf("%d mapping(s) failed", len(e))
 }
 
 // Manager gerencia todas as sessões de clientes
 type Manager struct {
-	sessions map[string]*ClientSession
-	mu       sync.RWMutex
-	repo     *database.Repository
+	sessions  map[string]*ClientSession
+	mu        sync.RWMutex
+	repo      database.Store
+	grace     time.Duration // tempo que listeners ficam abertos após a queda do cliente
+	queueSize int           // conexões retidas por cliente durante a carência
+	cluster   *Cluster      // nil: servidor único, sem relay entre nós
+	leave     chan struct{} // LeaveCluster encerra o heartbeat
+
+	subscribers map[chan Event]struct{} // assinantes de eventos (WatchEvents)
+	subMu       sync.Mutex
 }
 
-// NewManager cria um novo gerenciador de sessões
-func NewManager(repo *database.Repository) *Manager {
+// NewManager cria um novo gerenciador de sessões; grace 0 fecha os listeners na desconexão
+func NewManager(repo database.Store, grace time.Duration, queueSize int) *Manager {
 	return &Manager{
-		sessions: make(map[string]*ClientSession),
-		repo:     repo,
+		sessions:    make(map[string]*ClientSession),
+		repo:        repo,
+		grace:       grace,
+		queueSize:   queueSize,
+		subscribers: make(map[chan Event]struct{}),
 	}
 }
 
-// RegisterSession registra uma nova sessão de cliente
+// RegisterSession registra a sessão do cliente, reaproveitando listeners de uma
+// sessão anterior ainda retida (ou substituindo uma conexão duplicada)
 func (m *Manager) RegisterSession(clientID string, session *yamux.Session) *ClientSession {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	cs := &ClientSession{
+	m.attachNode(clientID)
+
+	if cs, exists := m.sessions[clientID]; exists {
+		cs.attach(session)
+		log.Printf("Client %s reattached, %d listener(s) kept", clientID, len(cs.Listeners))
+		m.publish(EventConnected, clientID, "reconnected, %d listener(s) kept", len(cs.Listeners))
+		return cs
+	}
+
+	cs := m.newSession(clientID)
+	cs.attach(session)
+	m.sessions[clientID] = cs
+	m.publish(EventConnected, clientID, "connected")
+	return cs
+}
+
+// newSession cria a sessão de um cliente, ainda sem sessão yamux nem relay
+func (m *Manager) newSession(clientID string) *ClientSession {
+	return &ClientSession{
 		ClientID:  clientID,
-		Session:   session,
 		Listeners: make(map[int]*PortListener),
 		repo:      m.repo,
+		manager:   m,
+		gone:      make(chan struct{}),
+		held:      make(chan struct{}, m.queueSize),
+		health:    make(map[int]database.PortHealth),
+		states:    make(map[int]portState),
+		conns:     make(map[uint64]*trackedConn),
 	}
-	m.sessions[clientID] = cs
-	return cs
 }
 
-// UnregisterSession remove uma sessão de cliente
-func (m *Manager) UnregisterSession(clientID string) {
+// UnregisterSession trata a queda da sessão: fecha tudo ou, com carência,
+// mantém os listeners até o cliente voltar ou o prazo expirar
+func (m *Manager) UnregisterSession(clientID string, session *yamux.Session) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if cs, exists := m.sessions[clientID]; exists {
-		cs.CloseAll()
-		delete(m.sessions, clientID)
+	cs, exists := m.sessions[clientID]
+	// Sessão já substituída por uma reconexão: nada a fazer
+	if !exists || !cs.detach(session) {
+		return
 	}
+
+	if m.grace <= 0 {
+		m.remove(cs)
+		return
+	}
+
+	log.Printf("Client %s disconnected, holding listeners for %v", clientID, m.grace)
+	m.publish(EventDisconnected, clientID, "reconnecting, listeners held for %v", m.grace)
+	cs.sessMu.Lock()
+	cs.graceTimer = time.AfterFunc(m.grace, func() { m.expire(cs) })
+	cs.sessMu.Unlock()
 }
 
-// GetSession retorna a sessão de um cliente
-func (m *Manager) GetSession(clientID string) *ClientSession {
+// expire encerra a sessão retida se o cliente não voltou dentro da carência
+func (m *Manager) expire(cs *ClientSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[cs.ClientID] != cs || cs.current() != nil {
+		return
+	}
+	log.Printf("Client %s did not reconnect within %v, closing listeners", cs.ClientID, m.grace)
+	m.remove(cs)
+}
+
+// remove fecha listeners, libera conexões retidas e esquece a sessão (m.mu travado)
+func (m *Manager) remove(cs *ClientSession) {
+	cs.CloseAll()
+	close(cs.gone)
+	delete(m.sessions, cs.ClientID)
+
+	// Estado e saúde das portas pertencem ao nó que atende o cliente
+	if cs.relayed() {
+		m.publish(EventDisconnected, cs.ClientID, "relay closed, listeners closed")
+		return
+	}
+	m.publish(EventDisconnected, cs.ClientID, "offline, listeners closed")
+	if !m.detachNode(cs.ClientID) {
+		return
+	}
+	if err := m.repo.ResetClientHealth(cs.ClientID); err != nil {
+		log.Printf("Client %s: failed to reset health: %v", cs.ClientID, err)
+	}
+	if err := m.repo.SetClientOffline(cs.ClientID); err != nil {
+		log.Printf("Client %s: failed to update port states: %v", cs.ClientID, err)
+	}
+}
+
+// lookup retorna a sessão do cliente, inclusive durante a carência de reconexão
+func (m *Manager) lookup(clientID string) *ClientSession {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.sessions[clientID]
 }
 
+// Reachable retorna a sessão de um cliente conectado a este nó ou, no cluster,
+// a outro nó (conexões seguem pelo relay); nil se offline ou reconectando
+func (m *Manager) Reachable(clientID string) *ClientSession {
+	cs := m.lookup(clientID)
+	if cs == nil || (cs.current() == nil && !cs.relayed()) {
+		return nil
+	}
+	return cs
+}
+
+// GetSession retorna a sessão de um cliente conectado (nil se offline ou reconectando)
+func (m *Manager) GetSession(clientID string) *ClientSession {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cs := m.sessions[clientID]
+	if cs == nil || cs.current() == nil {
+		return nil
+	}
+	return cs
+}
+
+// Kick derruba a conexão do cliente; com carência os listeners ficam retidos
+func (m *Manager) Kick(clientID string) error {
+	cs := m.GetSession(clientID)
+	if cs == nil {
+		return m.notConnected(clientID)
+	}
+	cs.current().Close()
+	return nil
+}
+
+// notConnected explica por que o cliente não tem sessão neste nó
+func (m *Manager) notConnected(clientID string) error {
+	if cs := m.lookup(clientID); cs != nil {
+		if node := cs.relayNode(); node != nil {
+			return fmt.Errorf("client %s is connected to node %s", clientID, node.id)
+		}
+	}
+	return fmt.Errorf("client %s not connected", clientID)
+}
+
+// ListenerInfo descreve um listener aberto e a saúde do destino
+type ListenerInfo struct {
+	PortID  int
+	Port    int
+	Target  string
+	Checked bool // o cliente sonda o destino
+	Health  database.PortHealth
+}
+
+// SessionInfo resume a sessão de um cliente (conectado, reconectando ou em outro nó)
+type SessionInfo struct {
+	ClientID  string
+	Connected bool   // false: cliente reconectando, listeners retidos
+	Node      string // cliente conectado a outro nó do cluster (sessão de relay)
+	Address   string // endereço do relay do Node
+	Since     time.Time
+	Listeners []ListenerInfo
+}
+
+// Sessions lista as sessões em memória, ordenadas por client_id
+func (m *Manager) Sessions() []SessionInfo {
+	m.mu.RLock()
+	sessions := make([]*ClientSession, 0, len(m.sessions))
+	for _, cs := range m.sessions {
+		sessions = append(sessions, cs)
+	}
+	m.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, cs := range sessions {
+		cs.sessMu.Lock()
+		info := SessionInfo{ClientID: cs.ClientID, Connected: cs.session != nil, Since: cs.since}
+		if cs.relay != nil {
+			info.Node, info.Address = cs.relay.id, cs.relay.address
+		}
+		cs.sessMu.Unlock()
+
+		cs.mu.RLock()
+		for _, pl := range cs.Listeners {
+			info.Listeners = append(info.Listeners, ListenerInfo{
+				PortID:  pl.Mapping.ID,
+				Port:    pl.Port,
+				Target:  pl.Target,
+				Checked: pl.Mapping.Checked(),
+				Health:  cs.Health(pl.Mapping.ID),
+			})
+		}
+		cs.mu.RUnlock()
+
+		sort.Slice(info.Listeners, func(i, j int) bool { return info.Listeners[i].Port < info.Listeners[j].Port })
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ClientID < infos[j].ClientID })
+	return infos
+}
+
 // ReloadPorts recarrega as portas de um cliente
 func (m *Manager) ReloadPorts(clientID string) error {
 	cs := m.GetSession(clientID)
 	if cs == nil {
-		log.Printf("Client %s not connected", clientID)
-		return nil
+		err := m.notConnected(clientID)
+		log.Printf("Reload: %v", err)
+		return err
 	}
 	return cs.Reload()
 }
 
-// Reload recarrega as portas do banco e sincroniza listeners
+// Reload recarrega portas e local-forwards do banco e sincroniza listeners;
+// falhas de bind voltam como BindErrors depois de enviar forwards e checks
 func (cs *ClientSession) Reload() error {
+	// Configuração aplicada agora, para o auto-reload não repetir
+	if fingerprint, active, err := cs.fingerprint(); err == nil && active {
+		cs.mu.Lock()
+		cs.configSeen = fingerprint
+		cs.mu.Unlock()
+	}
+
+	err := cs.syncPorts()
+	if err != nil && !isBindErrors(err) {
+		return err
+	}
+
+	// Forwards e checks vão só pelo nó que tem a sessão do cliente
+	if cs.relayed() {
+		return err
+	}
+
+	// Envia local-forwards ao cliente (listeners abertos na rede dele)
+	if err := cs.pushForwards(); err != nil {
+		log.Printf("Client %s: failed to push forwards: %v", cs.ClientID, err)
+	}
+
+	// Envia os destinos a sondar (health checks)
+	if err := cs.pushChecks(); err != nil {
+		log.Printf("Client %s: failed to push health checks: %v", cs.ClientID, err)
+	}
+
+	return err
+}
+
+// syncPorts abre e fecha listeners conforme o banco, a validade e as janelas de
+// horário, gravando o estado de cada mapeamento
+func (cs *ClientSession) syncPorts() error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
+	if cs.closed {
+		return nil
+	}
+
 	// Busca portas do banco
 	ports, err := cs.repo.GetClientPorts(cs.ClientID)
 	if err != nil {
 		return err
 	}
 
-	// Cria mapa de portas do banco
+	// Cria mapa de portas do banco que devem estar abertas agora
+	now := time.Now()
 	wantedPorts := make(map[int]database.PortMapping)
+	inactive := make(map[int]string)
 	for _, p := range ports {
+		if reason := p.InactiveReason(now); reason != "" {
+			inactive[p.ExposedPort] = reason
+			cs.setState(p.ID, database.PortDisabled, reason)
+			continue
+		}
 		wantedPorts[p.ExposedPort] = p
 	}
 
-	// Remove listeners que não estão no banco
+	// Remove listeners que não estão no banco, foram alterados ou saíram da janela
 	for port, pl := range cs.Listeners {
-		if _, exists := wantedPorts[port]; !exists {
-			log.Printf("Closing port %d (removed)", port)
+		mapping, exists := wantedPorts[port]
+		if !exists || mapping != pl.Mapping {
+			if reason, ok := inactive[port]; ok {
+				log.Printf("Closing port %d (%s)", port, reason)
+			} else if exists {
+				log.Printf("Closing port %d (changed)", port)
+			} else {
+				// Desabilitado (ou removido: sem linha para gravar)
+				log.Printf("Closing port %d (removed)", port)
+				cs.setState(pl.Mapping.ID, database.PortDisabled, "")
+			}
 			close(pl.Cancel)
 			pl.Listener.Close()
 			delete(cs.Listeners, port)
+
+			// Validade vencida ou fora da janela: o acesso acaba também para
+			// quem já estava conectado
+			if _, ok := inactive[port]; ok {
+				if n := cs.closePortConns(port); n > 0 {
+					log.Printf("Closed %d connection(s) on port %d", n, port)
+				}
+			}
 		}
 	}
 
 	// Adiciona listeners novos
+	var failed BindErrors
 	for port, mapping := range wantedPorts {
 		if _, exists := cs.Listeners[port]; !exists {
 			err := cs.addListener(mapping)
 			if err != nil {
 				log.Printf("Failed to add port %d: %v", port, err)
+				cs.setState(mapping.ID, database.PortBindError, err.Error())
+				failed = append(failed, fmt.Sprintf("port %d (id %d): %v", port, mapping.ID, err))
+				continue
 			}
 		}
+		cs.setState(mapping.ID, database.PortListening, "")
 	}
 
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return failed
+	}
 	return nil
 }
 
+// setState grava o estado do mapeamento quando muda (cs.mu travado); sessões
+// de relay não gravam: o estado é o do nó que atende o cliente
+func (cs *ClientSession) setState(portID int, state, detail string) {
+	if cs.relayed() {
+		return
+	}
+	next := portState{state, detail}
+	if cs.states[portID] == next {
+		return
+	}
+	if err := cs.repo.SetPortState(portID, state, detail); err != nil {
+		log.Printf("Client %s: %v", cs.ClientID, err)
+		return
+	}
+	cs.states[portID] = next
+	if detail != "" {
+		state += ": " + detail
+	}
+	cs.manager.publish(EventPortState, cs.ClientID, "port id %d %s", portID, state)
+}
+
+// RunScheduler reavalia periodicamente as portas dos clientes conectados,
+// abrindo e fechando listeners com validade (expires_at) ou janela de horário
+func (m *Manager) RunScheduler() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.RLock()
+		sessions := make([]*ClientSession, 0, len(m.sessions))
+		for _, cs := range m.sessions {
+			sessions = append(sessions, cs)
+		}
+		m.mu.RUnlock()
+
+		for _, cs := range sessions {
+			// Falhas de bind já foram registradas por porta
+			if err := cs.syncPorts(); err != nil && !isBindErrors(err) {
+				log.Printf("Client %s: scheduled port sync failed: %v", cs.ClientID, err)
+			}
+		}
+	}
+}
+
+// isBindErrors informa se o erro de syncPorts é só de bind
+func isBindErrors(err error) bool {
+	_, ok := err.(BindErrors)
+	return ok
+}
+
 // addListener adiciona um novo listener para uma porta
 func (cs *ClientSession) addListener(port database.PortMapping) error {
 	addr := "0.0.0.0:" + itoa(port.ExposedPort)
@@ -132,15 +481,35 @@ func (cs *ClientSession) addListener(port database.PortMapping) error {
 		return err
 	}
 
-	target := port.TargetHost + ":" + itoa(port.TargetPort)
+	// Servidor atrás de balanceador: endereço real do admin vem no header PROXY
+	if port.AcceptProxy {
+		listener = &proxyproto.Listener{
+			Listener: listener,
+			Policy: func(net.Addr) (proxyproto.Policy, error) {
+				return proxyproto.REQUIRE, nil
+			},
+			ReadHeaderTimeout: proxyHeaderTimeout,
+		}
+	}
+
+	target := port.Target()
 	cancel := make(chan struct{})
 
 	pl := &PortListener{
 		Port:     port.ExposedPort,
 		Target:   target,
+		Mapping:  port,
 		Listener: listener,
 		Cancel:   cancel,
 	}
+	if port.Mode == database.ModeSocks5 {
+		socks, err := cs.newSocksServer(port)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		pl.Socks = socks
+	}
 	cs.Listeners[port.ExposedPort] = pl
 
 	log.Printf("Listening on port %d -> %s", port.ExposedPort, target)
@@ -169,21 +538,93 @@ func (cs *ClientSession) acceptConnections(pl *PortListener) {
 			}
 		}
 
-		log.Printf("Connection on port %d", pl.Port)
+		go cs.handleConnection(pl, conn)
+	}
+}
 
-		remoteConn, err := cs.Session.Open()
-		if err != nil {
-			log.Printf("Failed to open stream: %v", err)
+// handleConnection encaminha uma conexão aceita para o cliente
+func (cs *ClientSession) handleConnection(pl *PortListener, conn net.Conn) {
+	// Com accept_proxy, RemoteAddr lê o header PROXY (ou falha se ausente)
+	remoteAddr := conn.RemoteAddr()
+	if pc, ok := conn.(*proxyproto.Conn); ok && pc.ProxyHeader() == nil {
+		log.Printf("Port %d: rejected connection without PROXY header from %s", pl.Port, pc.Raw().RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	log.Printf("Connection on port %d from %s", pl.Port, remoteAddr)
+
+	// SOCKS5: o destino vem de cada CONNECT
+	if pl.Socks != nil {
+		pl.Socks.ServeConn(cs.Track(conn, ConnPort, pl.Port, remoteAddr.String(), "socks5"))
+		return
+	}
+
+	// Destino reportado como down: recusa com o motivo em vez de um túnel mudo
+	if pl.Mapping.RefuseDown {
+		if h := cs.Health(pl.Mapping.ID); h.Status == database.HealthDown {
+			log.Printf("Port %d: refused connection from %s, target %s unhealthy: %s", pl.Port, remoteAddr, pl.Target, h.Detail)
+			fmt.Fprintf(conn, "voidprobe: target %s is unhealthy: %s\r\n", pl.Target, h.Detail)
 			conn.Close()
-			continue
+			return
 		}
+	}
 
-		// Envia header com destino
-		header := pl.Target + "\n"
-		remoteConn.Write([]byte(header))
+	var options []string
+	if pl.Mapping.ProxyProto != "" {
+		options = append(options,
+			OptionProxy+pl.Mapping.ProxyProto,
+			OptionSource+remoteAddr.String(),
+			OptionDest+conn.LocalAddr().String())
+	}
+
+	remoteConn, err := cs.OpenStream(pl.Target, options...)
+	if err != nil {
+		log.Printf("Port %d: failed to open stream for %s: %v", pl.Port, remoteAddr, err)
+		// Conexão retida durante a carência: fecha com o motivo
+		if errors.Is(err, errClientGone) || errors.Is(err, errQueueFull) {
+			fmt.Fprintf(conn, "voidprobe: %s: %v\r\n", cs.ClientID, err)
+		}
+		conn.Close()
+		return
+	}
+
+	ProxyConnection(cs.Track(conn, ConnPort, pl.Port, remoteAddr.String(), pl.Target), remoteConn)
+}
+
+// OpenStream abre um stream para o cliente com o destino (e opções) no header;
+// durante a carência aguarda a reconexão do cliente, e no cluster segue pelo
+// relay quando o cliente está conectado a outro nó
+func (cs *ClientSession) OpenStream(target string, options ...string) (net.Conn, error) {
+	if err := checkTarget(target); err != nil {
+		return nil, err
+	}
+	header := strings.Join(append([]string{target}, options...), " ")
 
-		go proxyConnection(conn, remoteConn)
+	session, err := cs.waitSession()
+	for errors.Is(err, errRelayed) {
+		if node := cs.relayNode(); node != nil {
+			return cs.manager.dialRelay(node, cs.ClientID, header)
+		}
+		// O cliente acabou de voltar a este nó
+		session, err = cs.waitSession()
+	}
+	if err != nil {
+		return nil, err
 	}
+
+	stream, err := session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	// Envia header com destino
+	if _, err := stream.Write([]byte(header + "\n")); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return stream, nil
 }
 
 // CloseAll fecha todos os listeners
@@ -197,6 +638,7 @@ func (cs *ClientSession) CloseAll() {
 		pl.Listener.Close()
 	}
 	cs.Listeners = make(map[int]*PortListener)
+	cs.closed = true
 }
 
 // itoa converte int para string
@@ -212,8 +654,8 @@ func itoa(n int) string {
 	return s
 }
 
-// proxyConnection faz proxy bidirecional entre duas conexões
-func proxyConnection(local, remote net.Conn) {
+// ProxyConnection faz proxy bidirecional entre duas conexões
+func ProxyConnection(local, remote net.Conn) {
 	defer local.Close()
 	defer remote.Close()
 
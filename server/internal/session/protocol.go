@@ -0,0 +1,68 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+)
+
+// Headers de controle trocados pelo túnel. Streams de dados usam o destino
+// (host:porta ou unix:///caminho) como header; os de controle começam com "@".
+const (
+	// HeaderForwards: servidor -> cliente, seguido de linhas "<id> <host:porta>"
+	HeaderForwards = "@forwards"
+	// HeaderForward: cliente -> servidor, "@forward <id>" abre conexão de um local-forward
+	HeaderForward = "@forward"
+	// HeaderChecks: servidor -> cliente, seguido de linhas "<port_id> <check> <destino>"
+	HeaderChecks = "@checks"
+	// HeaderHealth: cliente -> servidor, stream contínuo de linhas "<port_id> <up|down> [detalhe]"
+	HeaderHealth = "@health"
+	// HeaderServices: cliente -> servidor ao conectar, seguido de linhas "<nome> <destino>"
+	HeaderServices = "@services"
+)
+
+// Opções após o destino no header de um stream de dados ("<destino> <opção>...")
+const (
+	// OptionDynamic marca destinos escolhidos pelo admin (SOCKS5); o cliente
+	// aplica ALLOWED_TARGETS e responde com AckOK ou "ERR <motivo>" antes dos dados
+	OptionDynamic = "dynamic"
+	// OptionProxy ("proxy=v1" ou "proxy=v2") pede ao cliente que envie um header
+	// PROXY protocol ao destino com os endereços de OptionSource e OptionDest
+	OptionProxy = "proxy="
+	// OptionSource: endereço original do admin ("src=ip:porta")
+	OptionSource = "src="
+	// OptionDest: endereço do listener exposto no servidor ("dst=ip:porta")
+	OptionDest = "dst="
+)
+
+// AckOK confirma que o cliente conectou ao destino de um stream dinâmico
+const AckOK = "OK"
+
+// maxHeaderSize limita o tamanho de uma linha de header
+const maxHeaderSize = 512
+
+// checkTarget recusa destinos com espaço ou caractere de controle, que
+// injetariam opções ou linhas no header (ex: FQDN de SOCKS5 "host src=...")
+func checkTarget(target string) error {
+	if target == "" || strings.IndexFunc(target, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("invalid target %q", target)
+	}
+	return nil
+}
+
+// readHeader lê a linha de header byte a byte, sem consumir dados do stream
+func readHeader(conn net.Conn) (string, error) {
+	header := make([]byte, 0, 64)
+	b := make([]byte, 1)
+	for len(header) < maxHeaderSize {
+		if _, err := conn.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(header), nil
+		}
+		header = append(header, b[0])
+	}
+	return "", fmt.Errorf("header exceeds %d bytes", maxHeaderSize)
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/voidprobe/server/internal/database"
+)
+
+// serviceName limita os nomes declarados (usados como argumento no voidprobe-cli)
+var serviceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// handleServices recebe a lista de serviços oferecidos pelo cliente e a grava
+// como pendente; serviços retirados do SERVICES perdem o mapeamento aprovado
+func (cs *ClientSession) handleServices(stream net.Conn) {
+	defer stream.Close()
+
+	var services []database.Service
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		service, err := parseService(line)
+		if err != nil {
+			log.Printf("Client %s: ignoring service %q: %v", cs.ClientID, line, err)
+			continue
+		}
+		services = append(services, service)
+	}
+
+	changed, err := cs.repo.SyncServices(cs.ClientID, services)
+	if err != nil {
+		log.Printf("Client %s: %v", cs.ClientID, err)
+		return
+	}
+	log.Printf("Client %s: %d service(s) offered", cs.ClientID, len(services))
+
+	if changed {
+		if err := cs.Reload(); err != nil {
+			log.Printf("Client %s: reload after service change: %v", cs.ClientID, err)
+		}
+	}
+}
+
+// parseService lê "<nome> <host:porta|unix:///caminho>"
+func parseService(line string) (database.Service, error) {
+	name, target, ok := strings.Cut(line, " ")
+	if !ok || !serviceName.MatchString(name) {
+		return database.Service{}, fmt.Errorf("invalid name")
+	}
+
+	if strings.HasPrefix(target, database.UnixPrefix) {
+		if !strings.HasPrefix(strings.TrimPrefix(target, database.UnixPrefix), "/") {
+			return database.Service{}, fmt.Errorf("unix target must be an absolute path")
+		}
+		return database.Service{Name: name, TargetHost: target}, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return database.Service{}, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 || host == "" {
+		return database.Service{}, fmt.Errorf("invalid target")
+	}
+	return database.Service{Name: name, TargetHost: host, TargetPort: port}, nil
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/armon/go-socks5"
+	"github.com/voidprobe/server/internal/database"
+)
+
+// socksCredentials valida usuário/senha do mapeamento SOCKS5
+type socksCredentials struct {
+	user string
+	hash string
+}
+
+// Valid compara usuário e hash da senha em tempo constante
+func (c socksCredentials) Valid(user, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(c.user)) == 1
+	hashOK := subtle.ConstantTimeCompare([]byte(database.HashKey(password)), []byte(c.hash)) == 1
+	return userOK && hashOK
+}
+
+// clientResolver mantém o FQDN para que o nome seja resolvido na rede do cliente
+type clientResolver struct{}
+
+func (clientResolver) Resolve(ctx context.Context, name string) (context.Context, net.IP, error) {
+	return ctx, nil, nil
+}
+
+// newSocksServer cria o servidor SOCKS5 de um mapeamento; cada CONNECT vira um stream yamux
+func (cs *ClientSession) newSocksServer(port database.PortMapping) (*socks5.Server, error) {
+	return socks5.New(&socks5.Config{
+		Credentials: socksCredentials{user: port.AuthUser, hash: port.AuthHash},
+		Resolver:    clientResolver{},
+		Rules:       &socks5.PermitCommand{EnableConnect: true},
+		Logger:      log.Default(),
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return cs.dialDynamic(port.ExposedPort, addr)
+		},
+	})
+}
+
+// dialDynamic abre um stream para o cliente com destino dinâmico e aguarda a confirmação
+func (cs *ClientSession) dialDynamic(port int, addr string) (net.Conn, error) {
+	stream, err := cs.openDynamic(addr)
+	var rejected rejectedError
+	if errors.As(err, &rejected) {
+		log.Printf("SOCKS5 on port %d: %s rejected by client: %s", port, addr, rejected)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("SOCKS5 on port %d -> %s", port, addr)
+	return socksConn{stream}, nil
+}
+
+// rejectedError traz o motivo de "ERR <motivo>"; go-socks5 traduz "refused" em
+// connection refused e demais erros em host unreachable
+type rejectedError string
+
+func (e rejectedError) Error() string {
+	return string(e)
+}
+
+// openDynamic abre um stream com destino dinâmico e aguarda o AckOK do cliente
+func (cs *ClientSession) openDynamic(addr string) (net.Conn, error) {
+	stream, err := cs.OpenStream(addr, OptionDynamic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+
+	ack, err := readHeader(stream)
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("no answer from client: %w", err)
+	}
+	if ack != AckOK {
+		stream.Close()
+		return nil, rejectedError(strings.TrimPrefix(ack, "ERR "))
+	}
+	return stream, nil
+}
+
+// socksConn expõe endereço TCP local, exigido pela resposta do go-socks5
+type socksConn struct {
+	net.Conn
+}
+
+func (socksConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4zero, Port: 0}
+}
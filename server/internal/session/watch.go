@@ -0,0 +1,124 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// RunWatcher verifica a versão de dados do banco a cada interval e, quando
+// outro processo (voidprobe-cli ou outra instância) grava no banco, reconcilia
+// as sessões cujo cliente, portas ou local-forwards mudaram. Clientes
+// bloqueados ou removidos são desconectados.
+func (m *Manager) RunWatcher(interval time.Duration) {
+	version, err := m.repo.DataVersion()
+	if err != nil {
+		log.Printf("Auto-reload disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		current, err := m.repo.DataVersion()
+		if err != nil {
+			log.Printf("Auto-reload: %v", err)
+			continue
+		}
+		if current == version {
+			continue
+		}
+		version = current
+
+		m.mu.RLock()
+		sessions := make([]*ClientSession, 0, len(m.sessions))
+		for _, cs := range m.sessions {
+			sessions = append(sessions, cs)
+		}
+		m.mu.RUnlock()
+
+		for _, cs := range sessions {
+			m.reconcile(cs)
+		}
+	}
+}
+
+// Refresh reconcilia a sessão do cliente após uma mudança feita pela API: no
+// SQLite as gravações da própria conexão do servidor não alteram o data_version
+func (m *Manager) Refresh(clientID string) {
+	if cs := m.lookup(clientID); cs != nil {
+		m.reconcile(cs)
+	}
+}
+
+// reconcile aplica à sessão as mudanças do banco desde a última verificação
+func (m *Manager) reconcile(cs *ClientSession) {
+	fingerprint, active, err := cs.fingerprint()
+	if err != nil {
+		log.Printf("Auto-reload: client %s: %v", cs.ClientID, err)
+		return
+	}
+
+	if !active {
+		log.Printf("Client %s blocked or removed, disconnecting", cs.ClientID)
+		m.drop(cs)
+		return
+	}
+
+	cs.mu.RLock()
+	changed := fingerprint != cs.configSeen
+	cs.mu.RUnlock()
+
+	// Reconectando: o Reload da reconexão aplica as mudanças
+	if !changed || (cs.current() == nil && !cs.relayed()) {
+		return
+	}
+
+	log.Printf("Client %s: configuration changed, reloading", cs.ClientID)
+	if err := cs.Reload(); err != nil {
+		log.Printf("Client %s: auto-reload: %v", cs.ClientID, err)
+	}
+}
+
+// fingerprint resume status, portas e local-forwards do cliente no banco;
+// active é false se o cliente foi bloqueado ou removido
+func (cs *ClientSession) fingerprint() (fingerprint string, active bool, err error) {
+	client, err := cs.repo.GetClient(cs.ClientID)
+	if err != nil {
+		return "", false, err
+	}
+	if client == nil || client.Status != "active" {
+		return "", false, nil
+	}
+
+	ports, err := cs.repo.GetClientPorts(cs.ClientID)
+	if err != nil {
+		return "", false, err
+	}
+	forwards, err := cs.repo.GetClientForwards(cs.ClientID)
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprint(ports, forwards), true, nil
+}
+
+// drop encerra a sessão na hora, sem período de carência
+func (m *Manager) drop(cs *ClientSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[cs.ClientID] != cs {
+		return
+	}
+	if session := cs.current(); session != nil {
+		session.Close()
+	}
+	cs.sessMu.Lock()
+	if cs.graceTimer != nil {
+		cs.graceTimer.Stop()
+	}
+	cs.sessMu.Unlock()
+	m.remove(cs)
+}
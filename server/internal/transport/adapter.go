@@ -23,6 +23,16 @@ type Adapter struct {
 	writeMu  sync.Mutex // Mutex separado para escrita
 	closed   bool
 	closedMu sync.RWMutex
+
+	recvOnce sync.Once
+	recvCh   chan recvResult // mensagens lidas do stream em background
+	done     chan struct{}   // fechado por Close, desbloqueia Read
+}
+
+// recvResult é o resultado de uma chamada a Recv.
+type recvResult struct {
+	msg *pb.Chunk
+	err error
 }
 
 // NewAdapter cria um novo adaptador.
@@ -30,6 +40,24 @@ func NewAdapter(stream GrpcStream) *Adapter {
 	return &Adapter{
 		Stream: stream,
 		buffer: make([]byte, 0),
+		recvCh: make(chan recvResult),
+		done:   make(chan struct{}),
+	}
+}
+
+// recvLoop lê o stream em background; Recv não pode ser interrompido e o
+// yamux espera o loop de leitura terminar ao fechar a sessão.
+func (a *Adapter) recvLoop() {
+	for {
+		msg, err := a.Stream.Recv()
+		select {
+		case a.recvCh <- recvResult{msg, err}:
+		case <-a.done:
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -64,10 +92,17 @@ func (a *Adapter) Read(p []byte) (int, error) {
 	}
 
 	// Recebe novos dados do stream (NÃO bloqueia escrita)
-	msg, err := a.Stream.Recv()
-	if err != nil {
-		a.setClosed()
-		return 0, err
+	a.recvOnce.Do(func() { go a.recvLoop() })
+	var msg *pb.Chunk
+	select {
+	case r := <-a.recvCh:
+		if r.err != nil {
+			a.setClosed()
+			return 0, r.err
+		}
+		msg = r.msg
+	case <-a.done:
+		return 0, io.EOF
 	}
 
 	// Copia dados para o buffer de leitura
@@ -105,13 +140,13 @@ func (a *Adapter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-// Close implementa io.Closer.
+// Close implementa io.Closer e desbloqueia um Read em andamento.
 func (a *Adapter) Close() error {
-	a.setClosed()
-
-	a.readMu.Lock()
-	a.buffer = nil
-	a.readMu.Unlock()
-
+	a.closedMu.Lock()
+	defer a.closedMu.Unlock()
+	if !a.closed {
+		close(a.done)
+	}
+	a.closed = true
 	return nil
 }